@@ -1,6 +1,12 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/opslevel/opslevel-go/v2022"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
@@ -14,22 +20,37 @@ var accountCmd = &cobra.Command{
 var lifecycleCmd = &cobra.Command{
 	Use:   "lifecycles",
 	Short: "Lists the valid alias for lifecycles in your account",
-	Long:  `Lists the valid alias for lifecycles in your account`,
-	Run:   movedToCLI,
+	Long:  `Lists the valid alias for lifecycles in your account. Use '--output json|yaml' to include the IDs for scripting.`,
+	Run:   runLifecycles,
 }
 
 var tierCmd = &cobra.Command{
 	Use:   "tiers",
 	Short: "Lists the valid alias for tiers in your account",
-	Long:  `Lists the valid alias for tiers in your account`,
-	Run:   movedToCLI,
+	Long:  `Lists the valid alias for tiers in your account. Use '--output json|yaml' to include the IDs for scripting.`,
+	Run:   runTiers,
 }
 
 var teamCmd = &cobra.Command{
 	Use:   "teams",
 	Short: "Lists the valid alias for teams in your account",
-	Long:  `Lists the valid alias for teams in your account`,
-	Run:   movedToCLI,
+	Long:  `Lists the valid alias for teams in your account. Use '--output json|yaml' to include the IDs for scripting.`,
+	Run:   runTeams,
+}
+
+var rubricCmd = &cobra.Command{
+	Use:   "rubric",
+	Short: "Lists the levels, categories and checks of the rubric in your account",
+	Long: `Lists the levels, categories and checks of the rubric in your account with their IDs.
+Custom event checks include the integration their payloads are sent to. Use '--output json|yaml' for scripting.`,
+	Run: runRubric,
+}
+
+var levelsCmd = &cobra.Command{
+	Use:   "levels",
+	Short: "Lists the valid alias for levels in your account",
+	Long:  `Lists the valid alias for levels in your account. Use '--output json|yaml' to include the IDs for scripting.`,
+	Run:   runLevels,
 }
 
 var toolsCmd = &cobra.Command{
@@ -39,6 +60,32 @@ var toolsCmd = &cobra.Command{
 	Run:   movedToCLI,
 }
 
+// accountEntry is the machine readable form of the account resources
+type accountEntry struct {
+	Id      string   `json:"id"`
+	Alias   string   `json:"alias,omitempty"`
+	Name    string   `json:"name"`
+	Index   *int     `json:"index,omitempty"`
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+type checkEntry struct {
+	Id            string `json:"id"`
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	Category      string `json:"category"`
+	Level         string `json:"level"`
+	Enabled       bool   `json:"enabled"`
+	Integration   string `json:"integration,omitempty"` // The name of the integration a custom event check receives payloads from
+	IntegrationId string `json:"integrationId,omitempty"`
+}
+
+type rubricEntries struct {
+	Levels     []accountEntry `json:"levels"`
+	Categories []accountEntry `json:"categories"`
+	Checks     []checkEntry   `json:"checks"`
+}
+
 func movedToCLI(cmd *cobra.Command, args []string) {
 	log.Error().Msg("This command has been moved to our CLI. https://www.opslevel.com/docs/api/cli/\nIt will be removed at a future date!")
 }
@@ -47,6 +94,132 @@ func init() {
 	accountCmd.AddCommand(lifecycleCmd)
 	accountCmd.AddCommand(tierCmd)
 	accountCmd.AddCommand(teamCmd)
+	accountCmd.AddCommand(rubricCmd)
+	accountCmd.AddCommand(levelsCmd)
 	accountCmd.AddCommand(toolsCmd)
 	rootCmd.AddCommand(accountCmd)
 }
+
+func runLifecycles(cmd *cobra.Command, args []string) {
+	list, err := createOpslevelClient().ListLifecycles()
+	cobra.CheckErr(err)
+	entries := []accountEntry{}
+	for _, item := range list {
+		index := item.Index
+		entries = append(entries, accountEntry{Id: fmt.Sprint(item.Id), Alias: item.Alias, Name: item.Name, Index: &index})
+	}
+	cobra.CheckErr(printAccountEntries(entries))
+}
+
+func runTiers(cmd *cobra.Command, args []string) {
+	list, err := createOpslevelClient().ListTiers()
+	cobra.CheckErr(err)
+	entries := []accountEntry{}
+	for _, item := range list {
+		index := item.Index
+		entries = append(entries, accountEntry{Id: fmt.Sprint(item.Id), Alias: item.Alias, Name: item.Name, Index: &index})
+	}
+	cobra.CheckErr(printAccountEntries(entries))
+}
+
+func runTeams(cmd *cobra.Command, args []string) {
+	list, err := createOpslevelClient().ListTeams()
+	cobra.CheckErr(err)
+	entries := []accountEntry{}
+	for _, item := range list {
+		entries = append(entries, accountEntry{Id: fmt.Sprint(item.Id), Alias: item.Alias, Name: item.Name, Aliases: item.Aliases})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Alias < entries[j].Alias })
+	cobra.CheckErr(printAccountEntries(entries))
+}
+
+func runRubric(cmd *cobra.Command, args []string) {
+	client := createOpslevelClient()
+	levels, err := client.ListLevels()
+	cobra.CheckErr(err)
+	categories, err := client.ListCategories()
+	cobra.CheckErr(err)
+	checks, err := client.ListChecks()
+	cobra.CheckErr(err)
+	output := rubricEntries{Levels: levelEntries(levels), Categories: []accountEntry{}, Checks: checkEntries(checks)}
+	for _, item := range categories {
+		output.Categories = append(output.Categories, accountEntry{Id: fmt.Sprint(item.Id), Name: item.Name})
+	}
+	if IsTextOutput() || outputFormat == "table" {
+		fmt.Println("LEVELS")
+		cobra.CheckErr(printAccountEntriesTable(output.Levels))
+		fmt.Println("\nCATEGORIES")
+		cobra.CheckErr(printAccountEntriesTable(output.Categories))
+		fmt.Println("\nCHECKS")
+		cobra.CheckErr(printCheckEntriesTable(output.Checks))
+		return
+	}
+	cobra.CheckErr(printStructured(output))
+}
+
+func runLevels(cmd *cobra.Command, args []string) {
+	levels, err := createOpslevelClient().ListLevels()
+	cobra.CheckErr(err)
+	cobra.CheckErr(printAccountEntries(levelEntries(levels)))
+}
+
+func checkEntries(checks []opslevel.Check) []checkEntry {
+	entries := []checkEntry{}
+	for _, item := range checks {
+		entry := checkEntry{
+			Id:       fmt.Sprint(item.Id),
+			Name:     item.Name,
+			Type:     string(item.Type),
+			Category: item.Category.Name,
+			Level:    item.Level.Alias,
+			Enabled:  item.Enabled,
+		}
+		if item.Type == opslevel.CheckTypeGeneric && item.Integration.Id != nil {
+			entry.Integration = item.Integration.Name
+			entry.IntegrationId = fmt.Sprint(item.Integration.Id)
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Category != entries[j].Category {
+			return entries[i].Category < entries[j].Category
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+func printCheckEntriesTable(entries []checkEntry) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tCATEGORY\tLEVEL\tINTEGRATION\tID")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.Name, entry.Type, orDash(entry.Category), orDash(entry.Level), orDash(entry.Integration), entry.Id)
+	}
+	return w.Flush()
+}
+
+func levelEntries(levels []opslevel.Level) []accountEntry {
+	entries := []accountEntry{}
+	for _, item := range levels {
+		index := item.Index
+		entries = append(entries, accountEntry{Id: fmt.Sprint(item.Id), Alias: item.Alias, Name: item.Name, Index: &index})
+	}
+	sort.Slice(entries, func(i, j int) bool { return *entries[i].Index < *entries[j].Index })
+	return entries
+}
+
+func printAccountEntries(entries []accountEntry) error {
+	if IsTextOutput() || outputFormat == "table" {
+		return printAccountEntriesTable(entries)
+	}
+	return printStructured(entries)
+}
+
+func printAccountEntriesTable(entries []accountEntry) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "ALIAS\tNAME\tID")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", orDash(entry.Alias), entry.Name, entry.Id)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/rocktavious/autopilot"
+)
+
+func Test_LevelEntries_AreSortedByIndex(t *testing.T) {
+	// Arrange
+	levels := []opslevel.Level{
+		{Id: "3", Alias: "gold", Name: "Gold", Index: 3},
+		{Id: "1", Alias: "bronze", Name: "Bronze", Index: 1},
+		{Id: "2", Alias: "silver", Name: "Silver", Index: 2},
+	}
+	// Act
+	result := levelEntries(levels)
+	// Assert
+	autopilot.Equals(t, 3, len(result))
+	autopilot.Equals(t, "bronze", result[0].Alias)
+	autopilot.Equals(t, "silver", result[1].Alias)
+	autopilot.Equals(t, "gold", result[2].Alias)
+	autopilot.Equals(t, 1, *result[0].Index)
+	autopilot.Equals(t, "1", result[0].Id)
+}
+
+func Test_CheckEntries_AreSortedByCategoryAndName(t *testing.T) {
+	// Arrange
+	checks := []opslevel.Check{
+		{Id: "1", Name: "Has Owner", Type: opslevel.CheckTypeHasOwner, Category: opslevel.Category{Name: "Ownership"}, Level: opslevel.Level{Alias: "bronze"}, Enabled: true},
+		{Id: "2", Name: "Deployed Recently", Type: opslevel.CheckTypeGeneric, Category: opslevel.Category{Name: "Reliability"}, Level: opslevel.Level{Alias: "silver"}},
+		{Id: "3", Name: "Has Docs", Type: opslevel.CheckTypeHasDocumentation, Category: opslevel.Category{Name: "Ownership"}, Level: opslevel.Level{Alias: "bronze"}},
+	}
+	checks[1].Integration = opslevel.Integration{Id: "9", Name: "Deploys"}
+	checks[2].Integration = opslevel.Integration{Id: "8", Name: "Ignored"}
+	// Act
+	result := checkEntries(checks)
+	// Assert
+	autopilot.Equals(t, 3, len(result))
+	autopilot.Equals(t, "Has Docs", result[0].Name)
+	autopilot.Equals(t, "Has Owner", result[1].Name)
+	autopilot.Equals(t, "Deployed Recently", result[2].Name)
+	autopilot.Equals(t, "", result[0].Integration)
+	autopilot.Equals(t, "Deploys", result[2].Integration)
+	autopilot.Equals(t, "9", result[2].IntegrationId)
+	autopilot.Equals(t, "silver", result[2].Level)
+}
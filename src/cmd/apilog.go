@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// logAPI traces every GraphQL request and response sent to OpsLevel
+var logAPI bool
+
+// apiLog logs at trace level regardless of the level of the other logs
+func apiLog() *zerolog.Event {
+	logger := log.Logger.Level(zerolog.TraceLevel)
+	return logger.Trace()
+}
+
+const apiLogMaxResponseLength = 1024
+
+var (
+	graphqlOperationRegex = regexp.MustCompile(`^\s*(query|mutation)?[^{]*{\s*([A-Za-z0-9_]+)`)
+	apiLogSecretKeyRegex  = regexp.MustCompile(`(?i)token|secret|password|authorization`)
+)
+
+type graphqlRequestBody struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+// newAPILogTransport logs the operation, variables, duration and truncated response of each GraphQL call
+func newAPILogTransport(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		var request graphqlRequestBody
+		if req.Body != nil {
+			body, err := io.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			_ = json.Unmarshal(body, &request)
+		}
+		operation := graphqlOperationName(request.Query)
+		if requestId := req.Header.Get(requestIdHeader); requestId != "" {
+			operation = fmt.Sprintf("%s (request id '%s')", operation, requestId)
+		}
+		variables, _ := json.Marshal(redactVariables(request.Variables))
+		apiLog().Msgf("[API] %s request variables: %s", operation, redactToken(string(variables)))
+
+		start := time.Now()
+		resp, err := next.RoundTrip(req)
+		duration := time.Since(start).Round(time.Millisecond)
+		if err != nil {
+			apiLog().Msgf("[API] %s failed after %s\n\tREASON: %v", operation, duration, err)
+			return resp, err
+		}
+		body, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		if readErr != nil {
+			apiLog().Msgf("[API] %s responded %s after %s but the body could not be read\n\tREASON: %v", operation, resp.Status, duration, readErr)
+			return resp, nil
+		}
+		apiLog().Msgf("[API] %s responded %s after %s: %s", operation, resp.Status, duration, truncate(redactToken(strings.TrimSpace(string(body))), apiLogMaxResponseLength))
+		return resp, nil
+	})
+}
+
+// graphqlOperationName returns '<query|mutation> <first field>' IE: 'mutation serviceCreate'
+func graphqlOperationName(query string) string {
+	matches := graphqlOperationRegex.FindStringSubmatch(query)
+	if matches == nil {
+		return "unknown"
+	}
+	kind := matches[1]
+	if kind == "" {
+		kind = "query"
+	}
+	return kind + " " + matches[2]
+}
+
+// redactToken removes the API token should it ever be echoed back in a logged payload
+func redactToken(value string) string {
+	if token := viper.GetString("api-token"); token != "" {
+		return strings.ReplaceAll(value, token, redacted)
+	}
+	return value
+}
+
+func redactVariables(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		output := map[string]interface{}{}
+		for key, item := range typed {
+			if apiLogSecretKeyRegex.MatchString(key) {
+				output[key] = redacted
+			} else {
+				output[key] = redactVariables(item)
+			}
+		}
+		return output
+	case []interface{}:
+		output := make([]interface{}, len(typed))
+		for i, item := range typed {
+			output[i] = redactVariables(item)
+		}
+		return output
+	default:
+		return value
+	}
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rocktavious/autopilot"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func Test_APILogTransport_LogsRegardlessOfTheLogLevel(t *testing.T) {
+	// Arrange
+	var output bytes.Buffer
+	logger, globalLevel := log.Logger, zerolog.GlobalLevel()
+	defer func() { log.Logger = logger; zerolog.SetGlobalLevel(globalLevel) }()
+	log.Logger = zerolog.New(&output).Level(zerolog.InfoLevel)
+	zerolog.SetGlobalLevel(zerolog.TraceLevel)
+	transport := newAPILogTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Header: http.Header{}, Body: io.NopCloser(strings.NewReader(`{"data": {}}`))}, nil
+	}))
+	req, _ := http.NewRequest(http.MethodPost, "https://app.opslevel.com/graphql", strings.NewReader(`{"query": "mutation { serviceCreate { service { id } } }"}`))
+	// Act
+	_, err := transport.RoundTrip(req)
+	log.Debug().Msg("hidden debug log")
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Assert(t, strings.Contains(output.String(), "[API] mutation serviceCreate responded 200 OK"), "expected the API call to be logged but got %s", output.String())
+	autopilot.Assert(t, !strings.Contains(output.String(), "hidden debug log"), "expected the other logs to keep the info level but got %s", output.String())
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/opslevel/kubectl-opslevel/common"
+	"github.com/opslevel/kubectl-opslevel/config"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Commands for managing the persisted account cache",
+	Long: `The tiers, lifecycles and teams of every account are persisted to disk and reused by later runs
+until they are older than '--cache-ttl' so a session of commands does not refetch them every time. They are
+refetched as soon as a looked up alias is missing from the cached ones.`,
+}
+
+var cacheRefreshCmd = &cobra.Command{
+	Use:   "refresh",
+	Short: "Fetch the tiers, lifecycles and teams of every configured account and persist them",
+	Long:  `Fetch the tiers, lifecycles and teams of every configured account and persist them`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if common.CacheTTL <= 0 {
+			checkErr(fmt.Errorf("the account cache is disabled - set '--cache-ttl' to a positive duration"), ExitCodeConfig)
+		}
+		c, err := config.New()
+		checkErr(err, ExitCodeConfig)
+		for account, client := range createOpslevelClients(c) {
+			checkErr(common.RefreshAccount(account, client), ExitCodeConfig)
+			if account == "" {
+				account = "default"
+			}
+			log.Info().Msgf("Refreshed the cache of account '%s'", account)
+		}
+	},
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove every persisted account cache so the next run fetches the account data again",
+	Long:  `Remove every persisted account cache so the next run fetches the account data again`,
+	Run: func(cmd *cobra.Command, args []string) {
+		removed, err := common.ClearAccountCaches()
+		checkErr(err, ExitCodeConfig)
+		log.Info().Msgf("Removed %d cached accounts from '%s'", removed, common.CacheDirectory)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheRefreshCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/opslevel/kubectl-opslevel/common"
+)
+
+// importCheckpoint persists the keys of the service registrations that were reconciled so an
+// interrupted 'service import' can be resumed without re-issuing the API calls for them
+type importCheckpoint struct {
+	mutex     sync.Mutex
+	path      string
+	file      *os.File
+	completed map[string]bool
+}
+
+// openCheckpoint starts a new checkpoint file or, when resume is set, continues the existing one
+func openCheckpoint(path string, resume bool) (*importCheckpoint, error) {
+	checkpoint := &importCheckpoint{path: path, completed: map[string]bool{}}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		if err := checkpoint.load(); err != nil {
+			return nil, err
+		}
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open checkpoint '%s': %v", path, err)
+	}
+	checkpoint.file = file
+	return checkpoint, nil
+}
+
+func (c *importCheckpoint) load() error {
+	file, err := os.Open(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read checkpoint '%s': %v", c.path, err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if key := strings.TrimSpace(scanner.Text()); key != "" {
+			c.completed[key] = true
+		}
+	}
+	return scanner.Err()
+}
+
+// Remaining returns the service registrations that are not yet recorded in the checkpoint
+func (c *importCheckpoint) Remaining(services []common.ServiceRegistration) []common.ServiceRegistration {
+	var output []common.ServiceRegistration
+	for _, service := range services {
+		if !c.completed[service.Key()] {
+			output = append(output, service)
+		}
+	}
+	return output
+}
+
+// Complete records the service registration as reconciled
+func (c *importCheckpoint) Complete(service common.ServiceRegistration) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	key := service.Key()
+	c.completed[key] = true
+	_, err := fmt.Fprintln(c.file, key)
+	return err
+}
+
+// Close keeps the checkpoint file for a later '--resume' or removes it once the import finished cleanly
+func (c *importCheckpoint) Close(finished bool) error {
+	if err := c.file.Close(); err != nil {
+		return err
+	}
+	if finished {
+		return os.Remove(c.path)
+	}
+	return nil
+}
@@ -38,7 +38,7 @@ func init() {
 
 func runCollect(cmd *cobra.Command, args []string) {
 	config, configErr := config.New()
-	cobra.CheckErr(configErr)
+	checkErr(configErr, ExitCodeConfig)
 
 	jq.ValidateInstalled()
 
@@ -47,7 +47,9 @@ func runCollect(cmd *cobra.Command, args []string) {
 		cobra.CheckErr(fmt.Errorf("please specify --integration-url"))
 	}
 
-	k8sClient := k8sutils.CreateKubernetesClient()
+	k8sClient, k8sClientErr := k8sutils.NewKubernetesClient()
+	checkErr(k8sClientErr, ExitCodeKubernetes)
+	checkErr(common.ApplyGlobals(config, k8sClient), ExitCodeConfig)
 
 	resync := time.Hour * time.Duration(reconcileResyncInterval)
 	collectQueue := make(chan string, 1)
@@ -64,7 +66,7 @@ func runCollect(cmd *cobra.Command, args []string) {
 			continue
 		}
 		callback := createCollectHandler(fmt.Sprintf("service.import[%d]", i), importConfig, collectQueue)
-		controller := k8sutils.NewController(*gvr, resync, reconcileBatchSize)
+		controller := k8sutils.NewController(*gvr, selector.GetListOptions(), resync, reconcileBatchSize)
 		controller.OnAdd = callback
 		controller.OnUpdate = callback
 		go controller.Start(1)
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/opslevel/kubectl-opslevel/common"
+	"github.com/opslevel/kubectl-opslevel/k8sutils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Dynamic shell completion for flags whose values live in the cluster or in OpsLevel.
+// Errors are swallowed because there is nowhere to surface them while the shell is completing.
+
+func completeNamespaces(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	client, err := k8sutils.NewKubernetesClient()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	namespaces, err := client.GetAllNamespaces()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return filterCompletions(namespaces, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+func completeKinds(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	client, err := k8sutils.NewKubernetesClient()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	kinds, err := client.GetKinds()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return filterCompletions(kinds, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+func completeServiceAliases(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	client, err := buildOpslevelClient(viper.GetString("api-token"), viper.GetString("api-url"))
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	services, err := common.ListServices(client, nil)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	var aliases []string
+	for _, service := range services {
+		aliases = append(aliases, service.Aliases...)
+	}
+	sort.Strings(aliases)
+	return filterCompletions(aliases, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// filterCompletions returns the values with the given prefix - the part before the last comma is kept so slice flags complete each item
+func filterCompletions(values []string, toComplete string) []string {
+	prefix := ""
+	if index := strings.LastIndex(toComplete, ","); index >= 0 {
+		prefix = toComplete[:index+1]
+		toComplete = toComplete[index+1:]
+	}
+	var output []string
+	for _, value := range values {
+		if strings.HasPrefix(value, toComplete) {
+			output = append(output, prefix+value)
+		}
+	}
+	return output
+}
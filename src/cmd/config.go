@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net/url"
 
 	yaml "gopkg.in/yaml.v3"
 
@@ -25,6 +26,8 @@ service:
           - .metadata.namespace == "kube-system"
           - .metadata.annotations."opslevel.com/ignore"
       opslevel: # This is how you map your kubernetes data to opslevel service
+        # an empty name, system, framework or tags.assign defaults to the app.kubernetes.io/name, part-of, managed-by, version and component labels
+        # disableRecommendedLabels: true
         name: .metadata.name
         owner: .metadata.namespace
         aliases: # This are how we identify the services again during reconciliation - please make sure they are very unique
@@ -51,28 +54,59 @@ service:
     - selector: # This limits what data we look at in Kubernetes
         apiVersion: apps/v1 # only supports resources found in 'kubectl api-resources --verbs="get,list"'
         kind: Deployment
+        # labelSelector: app.kubernetes.io/managed-by=helm # filters resources server side before they are downloaded
+        # discover: true # instead of apiVersion and kind walk every listable kind and keep the resources with an 'opslevel.com/' annotation
+        # discoverGroups: [apps, argoproj.io] # the API groups discover walks - defaults to the workload kinds and every custom resource group
+        # fieldSelector: metadata.namespace!=kube-system # filters resources on their fields server side - only '=', '==' and '!=' are supported
         excludes: # filters out resources if any expression returns truthy
           - .metadata.namespace == "kube-system"
           - .metadata.annotations."opslevel.com/ignore"
       opslevel: # This is how you map your kubernetes data to opslevel service
         name: .metadata.name
         description: .metadata.annotations."opslevel.com/description"
-        owner: .metadata.annotations."opslevel.com/owner"
+        owner: .metadata.annotations."opslevel.com/owner" # the alias or the OpsLevel ID of the owning team
         lifecycle: .metadata.annotations."opslevel.com/lifecycle"
         tier: .metadata.annotations."opslevel.com/tier"
+        # the full object including '.status' is passed so custom resources can use the operator reported state
+        # 'phase', 'ready' and 'condition("<type>")' read '.status' IE: for an Argo Rollout or a Knative Service
+        # tier: 'if ready then .metadata.annotations."opslevel.com/tier" elif phase == "Degraded" then "tier_4" else empty end'
         product: .metadata.annotations."opslevel.com/product"
         language: .metadata.annotations."opslevel.com/language"
         framework: .metadata.annotations."opslevel.com/framework"
+        system: .metadata.annotations."opslevel.com/system" # the alias of the system the service belongs to - see 'systems' below
+        domain: .metadata.annotations."opslevel.com/domain" # the alias of the domain the system belongs to - see 'domains' below
+        deployVersion: .spec.template.spec.containers[0].image | split(":")[-1] # 'service reconcile --deploy-integration-url' sends a deploy event when this changes
+        type: 'if .kind == "CronJob" or .kind == "Job" then "worker" else .metadata.annotations."opslevel.com/type" end' # the alias of the component type IE: backend, frontend, worker or library
+        note: .metadata.annotations."opslevel.com/note" # Markdown runbook snippets - or 'configmap:<namespace>/<name>/<key>' to read it from a ConfigMap
         aliases: # This are how we identify the services again during reconciliation - please make sure they are very unique
           - '"k8s:\(.metadata.name)-\(.metadata.namespace)"'
+        # aliasNormalization: # applied to every alias - helps match the naming conventions of existing OpsLevel aliases
+        #   lowercase: true
+        #   stripPrefixes: ["k8s:"]
+        #   replace:
+        #     - pattern: '[_.]'
+        #       with: "-"
         tags:
           assign: # tag with the same key name but with a different value will be updated on the service
             - '{"imported": "kubectl-opslevel"}'
+            # $cluster is the cluster name detected from your kubeconfig context (override with --cluster-name)
+            - '{"cluster": $cluster}'
             # find annoations with format: opslevel.com/tags.<key name>: <value>
             - '.metadata.annotations | to_entries |  map(select(.key | startswith("opslevel.com/tags"))) | map({(.key | split(".")[2]): .value})'
             - .metadata.labels
           create: # tag with the same key name but with a different value with be added to the service
             - '{"environment": .spec.template.metadata.labels.environment}'
+          # transforms: # applied in order to every tag - use 'keys' to limit a transform to specific tag keys
+          #   - target: both # one of value|key|both
+          #     stripPrefixes: ["app.kubernetes.io/"]
+          #     lowercase: true
+          #     replace:
+          #       - pattern: '[^a-z0-9_./:-]'
+          #         with: "_"
+          #     maxLength: 255
+          # keys: # per tag key semantics regardless of whether 'assign' or 'create' parsed the tag - matched case-insensitively
+          #   environment: single # assign - the service keeps one value which is replaced
+          #   team-alias: multi # create - every value is added to the service
         tools:
           - '{"category": "other", "environment": "production", "displayName": "my-cool-tool", "url": .metadata.annotations."example.com/my-cool-tool"} | if .url then . else empty end'
           # find annotations with format: opslevel.com/tools.<category>.<displayname>: <url> 
@@ -84,7 +118,24 @@ service:
           # if just the alias is returned as a single string we'll build the name for you and set the directory to "/"
           - .metadata.annotations.repo
           # find annotations with format: opslevel.com/repo.<displayname>.<repo.subpath.dots.turned.to.forwardslash>: <opslevel repo alias> 
-          - '.metadata.annotations | to_entries |  map(select(.key | startswith("opslevel.com/repos"))) | map({"name": .key | split(".")[2], "directory": .key | split(".")[3:] | join("/"), "repo": .value})'
+          - '.metadata.annotations | to_entries |  map(select(.key | startswith("opslevel.com/repos."))) | map({"name": .key | split(".")[2], "directory": .key | split(".")[3:] | join("/"), "repo": .value})'
+          # monorepos - attach several paths of one repo with format: opslevel.com/repos: "<alias>:<directory>[=<displayname>], ..."
+          - .metadata.annotations."opslevel.com/repos"
+        docs: # urls or repository relative paths - yaml/json API specs become the service's API document and other urls are attached as 'wiki' tools
+          - .metadata.annotations."opslevel.com/docs" | split(",")?
+        properties: # custom property definition alias -> JQ expression - the json result (string, number, object, ...) is assigned as the value - the aliases are matched case-insensitively
+          # tier_sla: .metadata.annotations."opslevel.com/sla" | tonumber?
+          # runtime: '{"image": .spec.template.spec.containers[0].image, "replicas": .spec.replicas}'
+        # checkFacts: true # add has_resource_limits, runs_as_non_root, has_liveness_probe, has_readiness_probe and has_pod_disruption_budget to the check payload
+        # pagerDuty: # attach the PagerDuty services referenced in the annotations as 'incidents' tools
+        #   enabled: true
+        #   subdomain: acme # links annotations like 'pagerduty.com/service-id: PABC123' to https://acme.pagerduty.com
+        checkPayload: # JQ expressions that return a map merged into the custom event check payload posted to 'checks.url'
+          - '{"replicas": .spec.replicas}'
+        dependencies: # aliases of the services this service depends on - edges created by this tool that are no longer declared are removed
+          - '.metadata.annotations."opslevel.com/dependencies" // "" | split(",") | map(select(. != ""))'
+        dependents: # aliases of the services that depend on this service
+          - '.metadata.annotations."opslevel.com/dependents" // "" | split(",") | map(select(. != ""))'
   collect:
     - selector: # This limits what data we look at in Kubernetes
         apiVersion: apps/v1 # only supports resources found in 'kubectl api-resources --verbs="get,list"'
@@ -92,6 +143,100 @@ service:
         excludes: # filters out resources if any expression returns truthy
           - .metadata.namespace == "kube-system"
           - .metadata.annotations."opslevel.com/ignore"
+#systems:
+#  autoCreate: true # create the systems referenced by 'system' that do not exist yet
+#  namespaces: true # create a system per namespace tagged with its workload count, requested cpu and memory and quota usage
+#  definitions: # the name, description and owning team used when creating a system - defaults to the alias as name
+#    - alias: checkout
+#      name: Checkout
+#      description: Everything needed to take payments
+#      owner: payments-team
+#  import: # create or update a system per namespace - the services of the namespace without a system are placed in it
+#    - selector:
+#        apiVersion: v1
+#        kind: Namespace # the only supported kind
+#        labelSelector: opslevel.com/system=true
+#      opslevel: # JQ expressions - the alias defaults to '<cluster>-<namespace>' like 'namespaces' above
+#        name: .metadata.name
+#        description: .metadata.annotations."opslevel.com/description"
+#        owner: .metadata.annotations."opslevel.com/owner"
+#domains:
+#  autoCreate: true # create the domains referenced by 'domain' that do not exist yet
+#  definitions:
+#    - alias: commerce
+#      name: Commerce
+#teams:
+#  autoCreate: true # create the owner teams that do not exist yet instead of leaving the services ownerless
+#  annotations: # the namespace annotations a created team's details are read from - these are the defaults
+#    alias: opslevel.com/owner
+#    name: opslevel.com/team-name
+#    contact: opslevel.com/team-contact # an email, '#slack-channel' or url
+#    manager: opslevel.com/team-manager
+#  members: # used by 'kubectl opslevel team sync-members' to add the users bound in owned namespaces to the team
+#    roles: [admin, edit] # only bindings to these roles - empty uses every binding
+#    remove: false # also remove members that are no longer bound
+#docs:
+#  url: https://upload.opslevel.com/integrations/document/XXXXXXXX # the API document integration that API specs referenced by url are pushed to
+#checks:
+#  url: https://upload.opslevel.com/integrations/custom_event/XXXXXXXX # the custom event check integration - payloads look like {"service": <alias>, "cluster": <cluster>, "facts": {...}}
+#infra: # map non-service resources to OpsLevel infrastructure resources with 'kubectl opslevel infra import'
+#  cluster: # register the cluster (kubernetes version, provider, region, node count) related to the services imported from it
+#    enabled: true
+#    owner: platform-team
+#  import:
+#    - selector:
+#        apiVersion: postgresql.cnpg.io/v1
+#        kind: Cluster
+#      opslevel:
+#        name: .metadata.name
+#        schema: '"Database"'
+#        owner: .metadata.annotations."opslevel.com/owner"
+#        aliases:
+#          - '"k8s:\(.metadata.name)-\(.metadata.namespace)"'
+#        provider:
+#          account: $cluster
+#          name: '"CloudNativePG"'
+#          type: .kind
+#        data:
+#          - '{"engine": "postgres", "version": .spec.imageName, "instances": .spec.instances}'
+#        services: # the aliases of the services that use the resource
+#          - .metadata.annotations."opslevel.com/used-by" | split(",")?
+#tagPrefix: k8s. # prepended to the key of every tag this tool assigns or creates so they are told apart from the manually curated ones
+#pruneTags: true # remove the tags carrying the 'tagPrefix' which are no longer parsed for a service - the removals are confirmed before they are applied
+#disableManagedBy: true # stop stamping the managed-by, managed-by-cluster, managed-by-namespace, managed-by-version and last-synced-at tags on the synced services
+#tagRemovals: # tags deleted from every reconciled service - 'key' removes every value, 'key=value' only that one
+#  - team-legacy
+#  - environment=prd
+#ignoreResources: # regular expressions matched against '<namespace>/<name>' of every resource - matches are skipped
+#  - '.*/.*-canary$'
+#costs: # assign the range of the monthly cost from OpenCost and the actual cpu and memory usage as tags IE: 'cpu-usage:200m-500m' - falls back to metrics-server
+#  enabled: true
+#  openCost: opencost/opencost:9003 # the OpenCost service called through the API server proxy
+#gitOps: # attach the repository and path Argo CD or Flux deploy every resource from
+#  enabled: true
+#imageRepositories: # infer the repositories of the services without any from their container images
+#  - image: '^ghcr\.io/acme/(.+)$' # matched against the image without its tag
+#    repository: github.com:acme/$1
+#  - image: '^[0-9]+\.dkr\.ecr\.[a-z0-9-]+\.amazonaws\.com/(.+)$'
+#    repository: github.com:acme/$1
+#idle: # flag the services a Service selects that had no ready endpoints for days in the run report
+#  enabled: true
+#  days: 14
+#  lifecycle: end-of-life # also move idle services to this lifecycle
+#namespaces: # restrict the scanned namespaces to roll the import out team by team
+#  include: ["team-*"] # globs of the namespaces to scan - empty scans every namespace
+#  exclude: ["kube-*"] # globs of the namespaces never scanned
+#  optIn: opslevel.com/import=true # only scan the namespaces carrying this label
+#api-url: https://opslevel.example.com/ # for self-hosted or regional OpsLevel instances
+#accounts: # route selectors to different OpsLevel accounts by adding 'account: <name>' next to 'selector'
+#  - name: payments
+#    apiTokenPath: /var/run/secrets/opslevel/payments-token
+#profiles: # select one with --profile <name> - any key set in a profile overrides the top level value
+#  production:
+#    clusterName: prod-us1
+#    api-url: https://api.opslevel.com/
+#  staging:
+#    clusterName: staging-us1
 `)
 
 var configCmd = &cobra.Command{
@@ -115,14 +260,68 @@ var configSchemaCmd = &cobra.Command{
 var configViewCmd = &cobra.Command{
 	Use:   "view",
 	Short: "Print the final configuration result",
-	Long:  "Print the final configuration after loading all the overrides and defaults",
-	Run: func(cmd *cobra.Command, args []string) {
-		conf, err := config.New()
-		cobra.CheckErr(err)
-		output, err2 := yaml.Marshal(conf)
-		cobra.CheckErr(err2)
-		fmt.Println(string(output))
-	},
+	Long: `Print the final configuration after loading all the overrides and defaults
+
+This includes the effective settings from flags, environment variables and the selected profile
+merged with the config file. API tokens are redacted. Use '--output json' for json.`,
+	Run: runConfigView,
+}
+
+const redacted = "<redacted>"
+
+// effectiveConfig is everything the tool will execute with after flags, environment variables, profiles and defaults are merged
+type effectiveConfig struct {
+	Settings map[string]interface{} `json:"settings"`
+	Config   *config.Config         `json:"config"`
+}
+
+func runConfigView(cmd *cobra.Command, args []string) {
+	conf, err := config.New()
+	checkErr(err, ExitCodeConfig)
+	for i := range conf.Accounts {
+		conf.Accounts[i].APIToken = redact(conf.Accounts[i].APIToken)
+	}
+	view := effectiveConfig{
+		Settings: map[string]interface{}{
+			"profile":                 viper.GetString("profile"),
+			"api-url":                 viper.GetString("api-url"),
+			"api-token":               redact(viper.GetString("api-token")),
+			"api-token-path":          apiTokenFile,
+			"api-timeout":             apiTimeout,
+			"request-timeout":         viper.GetDuration("request-timeout").String(),
+			"timeout":                 viper.GetDuration("timeout").String(),
+			"workers":                 concurrency,
+			"log-format":              viper.GetString("log-format"),
+			"log-level":               viper.GetString("log-level"),
+			"k8s-page-size":           viper.GetInt64("k8s-page-size"),
+			"k8s-qps":                 viper.GetFloat64("k8s-qps"),
+			"k8s-burst":               viper.GetInt("k8s-burst"),
+			"k8s-protobuf":            viper.GetBool("k8s-protobuf"),
+			"k8s-consistent-snapshot": viper.GetBool("k8s-consistent-snapshot"),
+			"k8s-proxy-url":           redactURL(viper.GetString("k8s-proxy-url")),
+			"k8s-exec-timeout":        viper.GetDuration("k8s-exec-timeout").String(),
+			"clusterName":             viper.GetString("clusterName"),
+		},
+		Config: conf,
+	}
+	output, err := marshalStructured(view, outputFormat != "json")
+	cobra.CheckErr(err)
+	fmt.Print(string(output))
+}
+
+// redactURL hides the password of a url IE: of a proxy with basic auth
+func redactURL(value string) string {
+	if parsed, err := url.Parse(value); err == nil {
+		return parsed.Redacted()
+	}
+	return value
+}
+
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redacted
 }
 
 var configSampleCmd = &cobra.Command{
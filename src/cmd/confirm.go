@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/opslevel/kubectl-opslevel/common"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// assumeYes skips the confirmation prompt of destructive commands
+var assumeYes bool
+
+func addConfirmationFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Do not prompt for confirmation before removing data from OpsLevel")
+	cmd.Flags().BoolVar(&assumeYes, "force", false, "Alias of '--yes'")
+}
+
+// confirmDestructive prints the summary of what will be removed and asks the user to confirm it.
+// Without a terminal on stdin the command fails unless '--yes' was given so automation never hangs.
+func confirmDestructive(summary []string, question string) (bool, error) {
+	if assumeYes {
+		return true, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, fmt.Errorf("refusing to continue without confirmation - rerun with '--yes' to run non-interactively")
+	}
+	for _, line := range summary {
+		fmt.Fprintf(os.Stderr, "  - %s\n", line)
+	}
+	fmt.Fprintf(os.Stderr, "%s (y/N): ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// deferRemovals makes the run plan its tag, dependency and team member removals so they are confirmed once with
+// confirmRemovals - with '--yes' they are sent as the services are reconciled
+func deferRemovals() {
+	common.DeferRemovals = !assumeYes
+}
+
+// confirmRemovals lists the removals the run planned and applies them once confirmed - it returns how many failed
+func confirmRemovals() int {
+	removals := common.PendingRemovals()
+	if len(removals) == 0 {
+		return 0
+	}
+	var summary []string
+	for _, removal := range removals {
+		summary = append(summary, removal.String())
+	}
+	confirmed, err := confirmDestructive(summary, fmt.Sprintf("Apply these %d removals in OpsLevel?", len(removals)))
+	if err != nil || !confirmed {
+		reason := "not confirmed"
+		if err != nil {
+			reason = err.Error()
+		}
+		log.Warn().Msgf("Skipped %d planned removals\n\tREASON: %s", len(removals), reason)
+		return 0
+	}
+	failed := 0
+	for _, removal := range removals {
+		if err := removal.Apply(); err != nil {
+			log.Error().Msgf("[%s] Failed removing %s\n\tREASON: %v", removal.Service, removal.Description, err)
+			failed++
+		} else {
+			log.Info().Msgf("[%s] Removed %s", removal.Service, removal.Description)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/opslevel/kubectl-opslevel/common"
+	"github.com/opslevel/opslevel-go/v2022"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	deleteAliases    []string
+	deleteAllManaged bool
+	deleteManagedTag string
+)
+
+var deleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Delete services from OpsLevel",
+	Long: `This command will delete the services matching the given aliases or, with '--all-managed',
+every service carrying the tag that marks it as created by this tool
+
+The services to delete are listed and you are asked to confirm before anything is removed.
+Use '--yes' to skip the prompt in automation.`,
+	Example: `  kubectl opslevel service delete --alias my-service
+  kubectl opslevel service delete --all-managed --dry-run
+  kubectl opslevel service delete --all-managed --yes`,
+	Run: runDelete,
+}
+
+func init() {
+	serviceCmd.AddCommand(deleteCmd)
+
+	deleteCmd.Flags().StringSliceVar(&deleteAliases, "alias", nil, "Comma separated list of aliases of the services to delete")
+	deleteCmd.RegisterFlagCompletionFunc("alias", completeServiceAliases)
+	deleteCmd.Flags().BoolVar(&deleteAllManaged, "all-managed", false, "Delete every service tagged with the value of 'managed-tag'")
+	deleteCmd.Flags().StringVar(&deleteManagedTag, "managed-tag", common.ManagedByTag, "The '<key>:<value>' tag used to find the services created by this tool - the config's 'tagPrefix' is prepended to the default")
+	deleteCmd.Flags().BoolVar(&common.DryRun, "dry-run", false, "Only log the services that would be deleted")
+	addConfirmationFlags(deleteCmd)
+}
+
+func runDelete(cmd *cobra.Command, args []string) {
+	if len(deleteAliases) == 0 && !deleteAllManaged {
+		cobra.CheckErr(fmt.Errorf("one of '--alias' or '--all-managed' is required"))
+	}
+
+	client := createOpslevelClient()
+	var services []opslevel.Service
+	for _, alias := range deleteAliases {
+		service, err := client.GetServiceWithAlias(alias)
+		if err != nil {
+			log.Error().Msgf("[%s] Failed to lookup service\n\tREASON: %v", alias, err)
+			continue
+		}
+		if service.Id == nil {
+			log.Warn().Msgf("[%s] No service found with this alias", alias)
+			continue
+		}
+		services = append(services, *service)
+	}
+	if deleteAllManaged {
+		if !cmd.Flags().Changed("managed-tag") {
+			deleteManagedTag = prefixedTag(viper.GetString("tagPrefix"), deleteManagedTag)
+		}
+		tag := opslevel.NewTagArgs(deleteManagedTag)
+		managed, err := common.ListServices(client, &tag)
+		cobra.CheckErr(err)
+		log.Info().Msgf("Found %d services tagged with '%s'", len(managed), deleteManagedTag)
+		services = append(services, managed...)
+	}
+
+	services = uniqueServices(services)
+	if len(services) == 0 {
+		fmt.Println("No services to delete")
+		return
+	}
+	if !common.DryRun {
+		var summary []string
+		for _, service := range services {
+			summary = append(summary, fmt.Sprintf("%s (%s)", service.Name, strings.Join(service.Aliases, ", ")))
+		}
+		confirmed, err := confirmDestructive(summary, fmt.Sprintf("Delete these %d services from OpsLevel?", len(services)))
+		cobra.CheckErr(err)
+		if !confirmed {
+			fmt.Println("Aborted - no services were deleted")
+			return
+		}
+	}
+
+	deleted := map[string]bool{}
+	failed := 0
+	for i := range services {
+		service := &services[i]
+		id := fmt.Sprint(service.Id)
+		if err := common.DeleteService(client, service); err != nil {
+			log.Error().Msgf("[%s] Failed to delete service\n\tREASON: %v", service.Name, err)
+			failed++
+			continue
+		}
+		deleted[id] = true
+	}
+	if common.DryRun {
+		fmt.Printf("Dry run complete - %d services would be deleted\n", len(deleted))
+	} else {
+		fmt.Printf("%d services deleted, %d failed\n", len(deleted), failed)
+	}
+}
+
+// prefixedTag prepends the config's 'tagPrefix' to the key of a '<key>:<value>' tag unless it already carries it
+func prefixedTag(prefix string, tag string) string {
+	if prefix == "" || strings.HasPrefix(tag, prefix) {
+		return tag
+	}
+	return prefix + tag
+}
+
+func uniqueServices(services []opslevel.Service) []opslevel.Service {
+	seen := map[string]bool{}
+	var output []opslevel.Service
+	for _, service := range services {
+		id := fmt.Sprint(service.Id)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		output = append(output, service)
+	}
+	return output
+}
@@ -0,0 +1,19 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/opslevel/kubectl-opslevel/common"
+	"github.com/rocktavious/autopilot"
+)
+
+func Test_PrefixedTag_FindsTheManagedByTagOfThePrefix(t *testing.T) {
+	// Act
+	plain := prefixedTag("", common.ManagedByTag)
+	prefixed := prefixedTag("k8s-", common.ManagedByTag)
+	already := prefixedTag("k8s-", "k8s-managed-by:kubectl-opslevel")
+	// Assert
+	autopilot.Equals(t, "managed-by:kubectl-opslevel", plain)
+	autopilot.Equals(t, "k8s-managed-by:kubectl-opslevel", prefixed)
+	autopilot.Equals(t, "k8s-managed-by:kubectl-opslevel", already)
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/opslevel/kubectl-opslevel/common"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	deployService       string
+	deployVersion       string
+	deployEnvironment   string
+	deployDescription   string
+	deployDeployerEmail string
+	deployDeployerName  string
+	deployUrl           string
+	deployNumber        string
+	deployDedupId       string
+)
+
+var deployCmd = &cobra.Command{
+	Use:   "deploy",
+	Short: "Commands for sending deploy events to OpsLevel",
+	Long:  `Commands for sending deploy events to OpsLevel`,
+}
+
+var deploySendCmd = &cobra.Command{
+	Use:   "send",
+	Short: "Send a deploy event to an OpsLevel deploy integration",
+	Long: `This command will send a single deploy event for the service to the url of an OpsLevel deploy integration
+so teams without a CI integration still get their deploy history populated.
+
+'service reconcile --deploy-integration-url' sends these events automatically whenever the 'deployVersion'
+of a watched service changes.`,
+	Example: `  kubectl opslevel deploy send --service k8s:checkout-prod --version 4f2a9c1 --integration-url https://upload.opslevel.com/integrations/deploy/XXXXXXXX`,
+	Run:     runDeploySend,
+}
+
+func init() {
+	rootCmd.AddCommand(deployCmd)
+	deployCmd.AddCommand(deploySendCmd)
+
+	deploySendCmd.Flags().String("integration-url", "", "The url of the OpsLevel deploy integration. Overrides environment variable 'OPSLEVEL_DEPLOY_INTEGRATION_URL'")
+	deploySendCmd.Flags().StringVar(&deployService, "service", "", "The alias of the deployed service")
+	deploySendCmd.Flags().StringVar(&deployVersion, "version", "", "The deployed version - IE: the commit sha")
+	deploySendCmd.Flags().StringVar(&deployEnvironment, "environment", "", "The environment deployed to - defaults to the cluster name")
+	deploySendCmd.Flags().StringVar(&deployDescription, "description", "", "A description of the deploy")
+	deploySendCmd.Flags().StringVar(&deployDeployerEmail, "deployer-email", "", "The email of who made the deploy")
+	deploySendCmd.Flags().StringVar(&deployDeployerName, "deployer-name", "kubectl-opslevel", "The name of who made the deploy")
+	deploySendCmd.Flags().StringVar(&deployUrl, "deploy-url", "", "A link to the deploy")
+	deploySendCmd.Flags().StringVar(&deployNumber, "deploy-number", "", "The number of the deploy")
+	deploySendCmd.Flags().StringVar(&deployDedupId, "dedup-id", "", "The id used by OpsLevel to dedup deploy events - defaults to '<service>-<version>'")
+	deploySendCmd.Flags().BoolVar(&common.DryRun, "dry-run", false, "Only log the deploy event that would be sent")
+	deploySendCmd.MarkFlagRequired("service")
+	deploySendCmd.MarkFlagRequired("version")
+	deploySendCmd.RegisterFlagCompletionFunc("service", completeServiceAliases)
+
+	viper.BindPFlag("deploy-integration-url", deploySendCmd.Flags().Lookup("integration-url"))
+	viper.BindEnv("deploy-integration-url", "OPSLEVEL_DEPLOY_INTEGRATION_URL")
+}
+
+func runDeploySend(cmd *cobra.Command, args []string) {
+	url := viper.GetString("deploy-integration-url")
+	if url == "" {
+		checkErr(fmt.Errorf("please specify --integration-url"), ExitCodeConfig)
+	}
+	event := common.DeployEvent{
+		Service:      deployService,
+		Deployer:     common.DeployDeployer{Email: deployDeployerEmail, Name: deployDeployerName},
+		DeployedAt:   time.Now().UTC(),
+		Description:  deployDescription,
+		Environment:  deployEnvironment,
+		DeployUrl:    deployUrl,
+		DeployNumber: deployNumber,
+		Commit:       common.DeployCommit{Sha: deployVersion},
+		DedupId:      deployDedupId,
+	}
+	if event.Environment == "" {
+		event.Environment = viper.GetString("clusterName")
+	}
+	cobra.CheckErr(common.SendDeployEvent(createRestClient(), url, event))
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/opslevel/kubectl-opslevel/common"
+	"github.com/opslevel/kubectl-opslevel/jq"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show what an import would change in OpsLevel",
+	Long: `This command will take the data found in your Kubernetes cluster and compare it field by field
+with the matching services in OpsLevel without making any changes`,
+	Run: runDiff,
+}
+
+func init() {
+	serviceCmd.AddCommand(diffCmd)
+	addResourceSourceFlags(diffCmd)
+}
+
+func runDiff(cmd *cobra.Command, args []string) {
+	config, configErr := newServiceConfig()
+	checkErr(configErr, ExitCodeConfig)
+
+	jq.ValidateInstalled()
+
+	services, servicesErr := common.GetAllServices(config)
+	checkErrOr(servicesErr, ExitCodeConfig)
+
+	clients := createOpslevelClients(config)
+	for account, olClient := range clients {
+		common.CacheAccount(account, olClient)
+	}
+	common.PrefetchServiceAliases(clients, services)
+
+	counts := map[common.ServiceDiffResult]int{}
+	for _, service := range services {
+		result, diff, err := common.DiffService(clients[service.Account], service)
+		counts[result]++
+		switch result {
+		case common.ServiceDiffResult_Create:
+			fmt.Printf("[%s] Would create new service:\n%s\n", service.Name, diff)
+		case common.ServiceDiffResult_Update:
+			fmt.Printf("[%s] Would update service:\n%s\n", service.Name, diff)
+		case common.ServiceDiffResult_NoChanges:
+			log.Info().Msgf("[%s] No changes detected", service.Name)
+		case common.ServiceDiffResult_Skipped:
+			log.Warn().Msgf("[%s] Skipping diff\n\tREASON: %v", service.Name, err)
+		}
+	}
+	fmt.Printf("%d to create, %d to update, %d unchanged, %d skipped\n",
+		counts[common.ServiceDiffResult_Create],
+		counts[common.ServiceDiffResult_Update],
+		counts[common.ServiceDiffResult_NoChanges],
+		counts[common.ServiceDiffResult_Skipped],
+	)
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/opslevel/kubectl-opslevel/common"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// Exit codes so automation can branch on what went wrong without parsing the logs
+const (
+	ExitCodeOK             = 0
+	ExitCodeError          = 1 // Unclassified error - the same code cobra.CheckErr uses
+	ExitCodeConfig         = 2 // Invalid flags, config file, selectors or jq expressions
+	ExitCodeAuth           = 3 // The OpsLevel API rejected the token or could not be reached
+	ExitCodeKubernetes     = 4 // The kubeconfig could not be loaded or the Kubernetes API failed
+	ExitCodePartialFailure = 5 // Some services failed to reconcile
+	ExitCodeTotalFailure   = 6 // Every service failed to reconcile
+	ExitCodeTimeout        = 7 // The run exceeded --timeout
+)
+
+const exitCodesHelp = `Exit Codes:
+  0  Success
+  1  Unclassified error
+  2  Configuration error (flags, config file, selectors or jq expressions)
+  3  OpsLevel authentication or API connectivity failure
+  4  Kubernetes access failure
+  5  Partial reconcile failure - some services failed
+  6  Total reconcile failure - every service failed
+  7  The run exceeded --timeout`
+
+// checkErr prints the error like cobra.CheckErr but exits with the given code
+func checkErr(err error, code int) {
+	if err == nil {
+		return
+	}
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	exit(code)
+}
+
+// exit exits with the given code or ExitCodeTimeout when the run was aborted because it exceeded --timeout
+func exit(code int) {
+	if errors.Is(rootContext.Err(), context.DeadlineExceeded) {
+		log.Error().Msgf("Aborted because the run exceeded the timeout of %s", viper.GetDuration("timeout"))
+		code = ExitCodeTimeout
+	}
+	closeAuditLog()
+	os.Exit(code)
+}
+
+// aborted reports whether the run was aborted so the commands stop queueing work
+func aborted() bool {
+	return rootContext.Err() != nil
+}
+
+// checkErrOr exits with ExitCodeKubernetes when the error was caused by the Kubernetes API otherwise with the given code
+func checkErrOr(err error, code int) {
+	if errors.Is(err, common.ErrKubernetesAccess) {
+		checkErr(err, ExitCodeKubernetes)
+	}
+	checkErr(err, code)
+}
+
+// resultsExitCode maps the outcome of a reconcile run to its exit code
+func resultsExitCode(summary common.ServiceResultsSummary) int {
+	failed := summary.Failed + summary.Errored
+	switch {
+	case failed == 0:
+		return ExitCodeOK
+	case summary.Failed == summary.Total:
+		return ExitCodeTotalFailure
+	default:
+		return ExitCodePartialFailure
+	}
+}
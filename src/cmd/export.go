@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/opslevel/kubectl-opslevel/common"
+	"github.com/opslevel/kubectl-opslevel/jq"
+	yaml "gopkg.in/yaml.v3"
+
+	"github.com/spf13/cobra"
+)
+
+var exportFormat string
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the data found in your Kubernetes cluster to another catalog format",
+	Long: `This command will convert the services found in your Kubernetes cluster into another catalog's format
+and print them to stdout.
+
+Use '--format backstage' to generate Backstage Component entities for a catalog-info.yaml file.`,
+	Example: `  kubectl opslevel service export --format backstage > catalog-info.yaml`,
+	Run:     runExport,
+}
+
+func init() {
+	serviceCmd.AddCommand(exportCmd)
+	addResourceSourceFlags(exportCmd)
+
+	exportCmd.Flags().StringVar(&exportFormat, "format", "backstage", "The catalog format to export to. One of: backstage")
+}
+
+func runExport(cmd *cobra.Command, args []string) {
+	if exportFormat != "backstage" {
+		checkErr(fmt.Errorf("unsupported export format '%s' - must be one of [backstage]", exportFormat), ExitCodeConfig)
+	}
+
+	config, err := newServiceConfig()
+	checkErr(err, ExitCodeConfig)
+
+	jq.ValidateInstalled()
+
+	services, err := common.GetAllServices(config)
+	checkErrOr(err, ExitCodeConfig)
+
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	for _, service := range common.SortServices(services) {
+		cobra.CheckErr(encoder.Encode(service.ToBackstageEntity()))
+	}
+	cobra.CheckErr(encoder.Close())
+}
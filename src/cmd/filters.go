@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/opslevel/kubectl-opslevel/common"
+	"github.com/opslevel/kubectl-opslevel/jq"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var filtersCreate bool
+
+var filtersCmd = &cobra.Command{
+	Use:   "filters",
+	Short: "Commands for managing OpsLevel filters scoped to your Kubernetes cluster",
+	Long:  `Commands for managing OpsLevel filters scoped to your Kubernetes cluster`,
+}
+
+var filtersGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Print or create OpsLevel filters selecting the services synced from the cluster and each of its namespaces",
+	Long: `This command will build one OpsLevel filter selecting every service synced from the cluster and one per namespace
+the services were found in, keyed on the 'managed-by-cluster' and 'managed-by-namespace' tags stamped on every synced service.
+
+The filter definitions are printed as yaml (or json with '--output json'). Use '--create' to create the missing filters
+in OpsLevel and update the ones whose predicates changed - they are matched by name.`,
+	Example: `  kubectl opslevel filters generate
+  kubectl opslevel filters generate --create --dry-run`,
+	Run: runFiltersGenerate,
+}
+
+func init() {
+	rootCmd.AddCommand(filtersCmd)
+	filtersCmd.AddCommand(filtersGenerateCmd)
+
+	filtersGenerateCmd.Flags().BoolVar(&filtersCreate, "create", false, "Create or update the filters in OpsLevel instead of printing them")
+	filtersGenerateCmd.Flags().BoolVar(&common.DryRun, "dry-run", false, "Only log the filters that would be created or updated")
+	filtersGenerateCmd.Flags().StringSliceVarP(&common.InputFiles, "filename", "f", nil, "Read the kubernetes resources from 'kubectl get -o json|yaml' output in these files instead of the live cluster - '-' reads stdin")
+}
+
+func runFiltersGenerate(cmd *cobra.Command, args []string) {
+	config, err := newServiceConfig()
+	checkErr(err, ExitCodeConfig)
+
+	jq.ValidateInstalled()
+
+	services, err := common.GetAllServices(config)
+	checkErrOr(err, ExitCodeConfig)
+	cluster := jq.GetArg("cluster")
+	if cluster == "" {
+		checkErr(fmt.Errorf("unable to detect the cluster name - set it with '--cluster-name'"), ExitCodeConfig)
+	}
+	var namespaces []string
+	for _, service := range services {
+		namespaces = append(namespaces, service.Namespace)
+	}
+	filters := common.ScopeFilters(cluster, namespaces)
+
+	if !filtersCreate {
+		if outputFormat != "json" {
+			outputFormat = "yaml"
+		}
+		cobra.CheckErr(printStructured(filters))
+		return
+	}
+	if config.DisableManagedBy {
+		log.Warn().Msg("The filters select nothing while 'disableManagedBy' is set because the services are not tagged")
+	}
+	results, err := common.EnsureScopeFilters(createOpslevelClient(), filters)
+	checkErr(err, ExitCodeAuth)
+	summary := common.SummarizeResults(results)
+	log.Info().Msgf("Filters - %d created, %d updated, %d unchanged, %d failed", summary.Created, summary.Updated, summary.Unchanged, summary.Failed)
+	exit(resultsExitCode(summary))
+}
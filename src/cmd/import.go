@@ -1,65 +1,340 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/opslevel/kubectl-opslevel/common"
 	"github.com/opslevel/kubectl-opslevel/config"
 	"github.com/opslevel/kubectl-opslevel/jq"
+	"github.com/opslevel/kubectl-opslevel/k8sutils"
 	"github.com/opslevel/opslevel-go/v2022"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
 
+var (
+	importBackstageCatalog string
+	importTUI              bool
+	importServices         []string
+	importCheckpointFile   string
+	importResume           bool
+	serviceFilter          string
+	importContexts         []string
+	importAllContexts      bool
+)
+
 var importCmd = &cobra.Command{
 	Use:   "import",
 	Short: "Create or Update service entries in OpsLevel",
-	Long:  `This command will take the data found in your Kubernetes cluster and begin to reconcile it with OpsLevel`,
-	Run:   runImport,
+	Long: `This command will take the data found in your Kubernetes cluster and begin to reconcile it with OpsLevel
+
+Use '--output json|yaml' to print a result document with the action, diff and errors of every service to stdout.
+The logs are always written to stderr.
+
+Use '--backstage' to instead reconcile the Component entities from a Backstage catalog-info.yaml file or URL
+
+With '--checkpoint' the aliases of every reconciled service are written to a checkpoint file while the import
+runs. If the import is interrupted rerun it with '--resume' to skip the services that were already reconciled.
+The checkpoint file is removed once an import finishes without errors.
+
+Use '--contexts prod-eu1,prod-us1' or '--all-contexts' to gather the services of several kubeconfig contexts one
+after another and reconcile them in a single run. The context name is exposed to JQ expressions as $context.
+
+The tags, dependencies and team members the import would remove are listed once every service was reconciled and
+only removed after you confirm - use '--yes' to remove them as the services are reconciled in automation.`,
+	Run: runImport,
 }
 
 func init() {
 	serviceCmd.AddCommand(importCmd)
+	addResourceSourceFlags(importCmd)
+
+	importCmd.Flags().BoolVar(&common.DryRun, "dry-run", false, "Perform all lookups but only log the mutations that would be sent to OpsLevel")
+	addConfirmationFlags(importCmd)
+	importCmd.Flags().StringSliceVar(&importServices, "services", nil, "Comma separated list of aliases - only the registrations with one of these aliases are reconciled (IE: 'checkout,payments-api')")
+	importCmd.RegisterFlagCompletionFunc("services", completeServiceAliases)
+	importCmd.Flags().BoolVar(&importTUI, "tui", false, "Show a live dashboard of each service's status with a scrollable error pane instead of the log output (requires a terminal)")
+	importCmd.Flags().StringVar(&importCheckpointFile, "checkpoint", ".opslevel-import.checkpoint", "Record the reconciled services in this file so an interrupted import can be resumed - only written when this flag or '--resume' is given")
+	importCmd.Flags().BoolVar(&importResume, "resume", false, "Skip the services already reconciled according to the checkpoint file of a previous interrupted import")
+	importCmd.Flags().StringVar(&serviceFilter, "filter", "", "The id, name or alias of an OpsLevel filter (IE: on tag, tier or owner) - only the found services it selects are reconciled")
+	importCmd.Flags().StringSliceVar(&importContexts, "contexts", nil, "Comma separated list of kubeconfig contexts to gather services from one after another (IE: 'prod-eu1,prod-us1')")
+	importCmd.Flags().BoolVar(&importAllContexts, "all-contexts", false, "Gather services from every context in the kubeconfig")
+	importCmd.Flags().StringVar(&importBackstageCatalog, "backstage", "", "A path or http(s) URL to a Backstage catalog-info.yaml whose Component entities are imported instead of the Kubernetes data")
 }
 
-func runImport(cmd *cobra.Command, args []string) {
-	config, configErr := config.New()
-	cobra.CheckErr(configErr)
+// getAllServicesForContexts gathers the services of every context given by '--contexts' or '--all-contexts' one
+// after another since the kubernetes client, the detected cluster name and the JQ variables are shared by the whole run
+func getAllServicesForContexts(config *config.Config) ([]common.ServiceRegistration, error) {
+	contexts := importContexts
+	if importAllContexts {
+		var err error
+		if contexts, err = k8sutils.ListKubeContexts(); err != nil {
+			return nil, fmt.Errorf("%w: %v", common.ErrKubernetesAccess, err)
+		}
+	}
+	if len(contexts) == 0 {
+		return common.GetAllServices(config)
+	}
+	defer k8sutils.UseKubeContext(k8sutils.CurrentKubeContext())
+	var output []common.ServiceRegistration
+	for _, context := range contexts {
+		k8sutils.UseKubeContext(context)
+		log.Info().Msgf("Gathering services from kubeconfig context '%s'", context)
+		services, err := common.GetAllServices(config)
+		if err != nil {
+			return nil, fmt.Errorf("context '%s': %w", context, err)
+		}
+		output = append(output, services...)
+	}
+	return common.MergeServices(output)
+}
 
-	jq.ValidateInstalled()
+func runImport(cmd *cobra.Command, args []string) {
+	config, configErr := newServiceConfig()
+	checkErr(configErr, ExitCodeConfig)
 
-	services, servicesErr := common.GetAllServices(config)
-	cobra.CheckErr(servicesErr)
+	var services []common.ServiceRegistration
+	var servicesErr error
+	if importBackstageCatalog != "" {
+		services, servicesErr = readBackstageCatalog(importBackstageCatalog)
+	} else {
+		jq.ValidateInstalled()
+		common.PersistIdleState = !common.DryRun
+		services, servicesErr = getAllServicesForContexts(config)
+	}
+	checkErrOr(servicesErr, ExitCodeConfig)
+	common.DeclareDependencies(services)
+	if len(importServices) > 0 {
+		services = filterServicesByAlias(services, importServices...)
+		for _, alias := range importServices {
+			if len(filterServicesByAlias(services, alias)) == 0 {
+				log.Warn().Msgf("[%s] No service registration found with this alias", alias)
+			}
+		}
+		log.Info().Msgf("Reconciling %d service registrations matching the aliases %v", len(services), importServices)
+	}
 
-	olClient := createOpslevelClient()
+	results := &importResults{}
+	if !common.DryRun && (importResume || cmd.Flags().Changed("checkpoint")) {
+		checkpoint, err := openCheckpoint(importCheckpointFile, importResume)
+		if err != nil && !importResume {
+			// a read-only working directory IE: a CronJob must not stop the import itself
+			log.Warn().Msgf("Continuing without a checkpoint\n\tREASON: %v", err)
+		} else {
+			checkErr(err, ExitCodeConfig)
+			if importResume {
+				remaining := checkpoint.Remaining(services)
+				log.Info().Msgf("Resuming from checkpoint '%s' - skipping %d already reconciled services", importCheckpointFile, len(services)-len(remaining))
+				services = remaining
+			}
+			results.checkpoint = checkpoint
+		}
+	}
 
-	opslevel.Cache.CacheTiers(olClient)
-	opslevel.Cache.CacheLifecycles(olClient)
-	opslevel.Cache.CacheTeams(olClient)
+	setReconcileConfig(config)
+	clients := createOpslevelClients(config)
+	for account, olClient := range clients {
+		common.CacheAccount(account, olClient)
+	}
+	if filters := loadServiceFilters(clients); filters != nil {
+		var filtered []common.ServiceRegistration
+		for _, service := range services {
+			if matchesServiceFilters(filters, service) {
+				filtered = append(filtered, service)
+			}
+		}
+		log.Info().Msgf("Reconciling %d of %d service registrations selected by the filter '%s'", len(filtered), len(services), serviceFilter)
+		services = filtered
+	}
+	if len(config.Systems.Import) > 0 {
+		common.SyncImportedSystems(clients, services)
+	}
+	if config.Systems.Namespaces {
+		common.SyncNamespaceSystems(clients, services)
+	}
+	common.PrefetchServiceAliases(clients, services)
 
 	log.Info().Msgf("Worker Concurrency == %v", concurrency)
+	if importTUI && !isTerminal() {
+		log.Warn().Msg("Ignoring '--tui' because the output is not a terminal")
+		importTUI = false
+	}
+	stopDisplay := func() {}
+	if importTUI {
+		dashboard := newTUIDashboard("Import", services)
+		dashboard.Start()
+		stopDisplay = dashboard.Stop
+	} else if !quiet {
+		bar := newProgress("Import", len(services))
+		common.OnServiceStatus = func(key string, name string, status common.ServiceStatus) {
+			if status == common.ServiceStatus_Done || status == common.ServiceStatus_Failed {
+				bar.Increment()
+			}
+		}
+		stopDisplay = func() { common.OnServiceStatus = nil }
+	}
 	done := make(chan bool)
 	queue := make(chan common.ServiceRegistration, concurrency)
-	go createWorkerPool(concurrency, queue, done)
+	deferRemovals()
+	go createWorkerPool(concurrency, config, queue, results, done)
 	go enqueue(services, queue)
 	<-done
-	log.Info().Msg("Import Complete")
+	stopDisplay()
+	if config.Infra.Cluster.Enabled {
+		for _, registration := range common.ClusterInfra(config.Infra.Cluster, services) {
+			result := common.ReconcileInfra(clients[registration.Account], registration)
+			if result.HasErrors() {
+				log.Error().Msgf("[%s] Failed registering the cluster as an infrastructure resource\n\tREASON: %v", registration.Name, result.Errors)
+			} else {
+				log.Info().Msgf("[%s] Registered the cluster as an infrastructure resource related to %d services", registration.Name, len(registration.Services))
+			}
+		}
+	}
+
+	removalsFailed := confirmRemovals()
+
+	document := results.document()
+	if results.checkpoint != nil {
+		if err := results.checkpoint.Close(document.Summary.Failed+document.Summary.Errored == 0); err != nil {
+			log.Warn().Msgf("Unable to clean up checkpoint '%s'\n\tREASON: %v", importCheckpointFile, err)
+		}
+	}
+	if outputFormat == "json" || outputFormat == "yaml" {
+		cobra.CheckErr(printStructured(document))
+	}
+	if len(document.UnpinnedKinds) > 0 {
+		log.Warn().Msgf("Listed %s at their latest state instead of resourceVersion %s", strings.Join(document.UnpinnedKinds, ", "), document.ResourceVersion)
+	}
+	summary := fmt.Sprintf("%d created, %d updated, %d unchanged, %d skipped, %d failed", document.Summary.Created, document.Summary.Updated, document.Summary.Unchanged, document.Summary.Skipped, document.Summary.Failed+document.Summary.Errored)
+	if common.DryRun {
+		summary = fmt.Sprintf("Import Dry Run Complete - no changes were made - %s", summary)
+	} else {
+		summary = fmt.Sprintf("Import Complete - %s", summary)
+	}
+	if quiet {
+		fmt.Fprintln(os.Stderr, summary)
+	} else {
+		log.Info().Msg(summary)
+	}
+	if code := resultsExitCode(document.Summary); code != ExitCodeOK {
+		log.Error().Msgf("%d of %d services failed to reconcile", document.Summary.Failed+document.Summary.Errored, document.Summary.Total)
+		exit(code)
+	}
+	if removalsFailed > 0 {
+		log.Error().Msgf("%d of the confirmed removals failed", removalsFailed)
+		exit(ExitCodePartialFailure)
+	}
+	if aborted() {
+		exit(ExitCodeTimeout)
+	}
 }
 
 // TODO: Helpers probably shouldn't be exported
 // Helpers
 
-func createWorkerPool(count int, queue chan common.ServiceRegistration, done chan<- bool) {
+// importResults collects the outcome of every service from the concurrent workers
+type importResults struct {
+	mutex      sync.Mutex
+	results    []common.ServiceResult
+	checkpoint *importCheckpoint
+}
+
+type importResultsDocument struct {
+	DryRun          bool                         `json:"dryRun"`
+	ResourceVersion string                       `json:"resourceVersion,omitempty"` // The resourceVersion the Kubernetes resources were listed at
+	UnpinnedKinds   []string                     `json:"unpinnedKinds,omitempty"`   // The kinds listed at their latest state instead of the resourceVersion
+	Summary         common.ServiceResultsSummary `json:"summary"`
+	Services        []common.ServiceResult       `json:"services"`
+}
+
+func (r *importResults) add(registration common.ServiceRegistration, result common.ServiceResult) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.results = append(r.results, result)
+	if r.checkpoint != nil && !result.HasErrors() {
+		if err := r.checkpoint.Complete(registration); err != nil {
+			log.Warn().Msgf("[%s] Unable to record checkpoint\n\tREASON: %v", result.Name, err)
+		}
+	}
+}
+
+func (r *importResults) document() importResultsDocument {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	services := append([]common.ServiceResult{}, r.results...)
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	return importResultsDocument{
+		DryRun:          common.DryRun,
+		ResourceVersion: k8sutils.SnapshotResourceVersion(),
+		UnpinnedKinds:   k8sutils.UnpinnedKinds(),
+		Summary:         common.SummarizeResults(services),
+		Services:        services,
+	}
+}
+
+// loadServiceFilters looks up '--filter' in every account - the result is nil when no filter is given
+func loadServiceFilters(clients map[string]*opslevel.Client) map[string]*common.ServiceFilter {
+	if serviceFilter == "" {
+		return nil
+	}
+	filters := map[string]*common.ServiceFilter{}
+	for account, client := range clients {
+		filter, err := common.GetServiceFilter(client, serviceFilter)
+		checkErr(err, ExitCodeConfig)
+		log.Info().Msgf("Filter '%s' selects %d services", filter.Name, filter.Size())
+		filters[account] = filter
+	}
+	return filters
+}
+
+func matchesServiceFilters(filters map[string]*common.ServiceFilter, service common.ServiceRegistration) bool {
+	if filters == nil {
+		return true
+	}
+	filter, ok := filters[service.Account]
+	return ok && filter.Matches(service)
+}
+
+func readBackstageCatalog(location string) ([]common.ServiceRegistration, error) {
+	var data []byte
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		resp, err := common.NewHTTPClient().R().Get(location)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download backstage catalog %s: %v", location, err)
+		}
+		if resp.IsError() {
+			return nil, fmt.Errorf("failed to download backstage catalog %s: %s", location, resp.Status())
+		}
+		data = resp.Body()
+	} else {
+		var err error
+		if data, err = os.ReadFile(location); err != nil {
+			return nil, fmt.Errorf("failed to read backstage catalog %s: %v", location, err)
+		}
+	}
+	services, err := common.ParseBackstageCatalog(data)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Msgf("Found %d components in backstage catalog %s", len(services), location)
+	return services, nil
+}
+
+func createWorkerPool(count int, config *config.Config, queue chan common.ServiceRegistration, results *importResults, done chan<- bool) {
 	var waitGroup sync.WaitGroup
 	waitGroup.Add(count)
 	for i := 0; i < count; i++ {
-		go func(c *opslevel.Client, q chan common.ServiceRegistration, wg *sync.WaitGroup) {
+		go func(c map[string]*opslevel.Client, q chan common.ServiceRegistration, wg *sync.WaitGroup) {
 			for data := range q {
-				common.ReconcileService(c, data)
+				results.add(data, common.ReconcileService(c[data.Account], data))
 			}
 			wg.Done()
-		}(createOpslevelClient(), queue, &waitGroup)
+		}(createOpslevelClients(config), queue, &waitGroup)
 	}
 	waitGroup.Wait()
 	done <- true
@@ -67,6 +342,9 @@ func createWorkerPool(count int, queue chan common.ServiceRegistration, done cha
 
 func enqueue(services []common.ServiceRegistration, queue chan common.ServiceRegistration) {
 	for _, service := range services {
+		if aborted() {
+			break
+		}
 		queue <- service
 	}
 	close(queue)
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/opslevel/kubectl-opslevel/common"
+	"github.com/opslevel/kubectl-opslevel/config"
+	"github.com/opslevel/kubectl-opslevel/jq"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var infraCmd = &cobra.Command{
+	Use:   "infra",
+	Short: "Commands for interacting with the infrastructure resource API",
+	Long: `Commands for mapping non-service kubernetes resources - databases managed by operator CRDs, caches, queues
+and PVC-backed storage - to OpsLevel infrastructure resources using the 'infra.import' section of the config file`,
+}
+
+var infraPreviewCmd = &cobra.Command{
+	Use:   "preview",
+	Short: "Preview the infrastructure resources found in your Kubernetes cluster",
+	Long:  `This command will print out every infrastructure resource it can find in your Kubernetes cluster based on the 'infra.import' settings in the configuration file.`,
+	Run:   runInfraPreview,
+}
+
+var infraImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Create or Update infrastructure resources in OpsLevel",
+	Long: `This command will create or update an OpsLevel infrastructure resource for every resource found by the 'infra.import'
+selectors, assign its owner and aliases and relate it to the services that use it.`,
+	Run: runInfraImport,
+}
+
+func init() {
+	rootCmd.AddCommand(infraCmd)
+	infraCmd.AddCommand(infraPreviewCmd, infraImportCmd)
+
+	infraCmd.PersistentFlags().StringSliceVarP(&common.InputFiles, "filename", "f", nil, "Read the kubernetes resources from 'kubectl get -o json|yaml' output in these files instead of the live cluster - '-' reads stdin")
+	infraImportCmd.Flags().BoolVar(&common.DryRun, "dry-run", false, "Perform all lookups but only log the mutations that would be sent to OpsLevel")
+}
+
+func getAllInfra() (*config.Config, []common.InfraRegistration) {
+	c, err := config.New()
+	checkErr(err, ExitCodeConfig)
+	if len(c.Infra.Import) == 0 && !c.Infra.Cluster.Enabled {
+		checkErr(fmt.Errorf("the config file has no 'infra.import' selectors and 'infra.cluster' is not enabled"), ExitCodeConfig)
+	}
+	jq.ValidateInstalled()
+	resources, err := common.GetAllInfra(c)
+	checkErrOr(err, ExitCodeConfig)
+	return c, resources
+}
+
+func runInfraPreview(cmd *cobra.Command, args []string) {
+	_, resources := getAllInfra()
+	if IsTextOutput() {
+		prettyJSON, err := marshalStructured(resources, false)
+		cobra.CheckErr(err)
+		fmt.Println(string(prettyJSON))
+		fmt.Printf("\nFound %d infrastructure resources\n", len(resources))
+		return
+	}
+	cobra.CheckErr(printStructured(resources))
+}
+
+func runInfraImport(cmd *cobra.Command, args []string) {
+	c, resources := getAllInfra()
+	clients := createOpslevelClients(c)
+	for account, client := range clients {
+		common.CacheAccount(account, client)
+	}
+	var results []common.ServiceResult
+	for _, resource := range resources {
+		results = append(results, common.ReconcileInfra(clients[resource.Account], resource))
+	}
+	summary := common.SummarizeResults(results)
+	log.Info().Msgf("Reconciled %d infrastructure resources - %d created, %d updated, %d skipped, %d failed", summary.Total, summary.Created, summary.Updated, summary.Skipped, summary.Failed)
+	exit(resultsExitCode(summary))
+}
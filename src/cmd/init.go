@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/opslevel/kubectl-opslevel/config"
+	"github.com/opslevel/kubectl-opslevel/k8sutils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v3"
+)
+
+var initOutputFile string
+
+// initKindAPIVersions are the workload kinds offered by the wizard
+var initKindAPIVersions = map[string]string{
+	"Deployment":  "apps/v1",
+	"StatefulSet": "apps/v1",
+	"DaemonSet":   "apps/v1",
+	"CronJob":     "batch/v1",
+	"Job":         "batch/v1",
+	"Service":     "v1",
+}
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Interactively create a config file",
+	Long: `This command will walk you through choosing the kinds and namespaces to import, mapping your labels
+to OpsLevel service fields, testing your API token and then writes a working config file.`,
+	Run: runInit,
+}
+
+func init() {
+	rootCmd.AddCommand(initCmd)
+
+	initCmd.Flags().StringVarP(&initOutputFile, "file", "f", "./opslevel-k8s.yaml", "The path of the config file to write")
+}
+
+type initWizard struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (w *initWizard) ask(question string, fallback string) string {
+	if fallback != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", question, fallback)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", question)
+	}
+	answer, _ := w.in.ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return fallback
+	}
+	return answer
+}
+
+func (w *initWizard) askList(question string, fallback string) []string {
+	var output []string
+	for _, item := range strings.Split(w.ask(question, fallback), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			output = append(output, item)
+		}
+	}
+	return output
+}
+
+func (w *initWizard) confirm(question string) bool {
+	answer := strings.ToLower(w.ask(question+" (y/n)", "y"))
+	return answer == "y" || answer == "yes"
+}
+
+func runInit(cmd *cobra.Command, args []string) {
+	w := &initWizard{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+	fmt.Fprintln(w.out, "This wizard writes a kubectl-opslevel config file. Press enter to accept the [default].")
+
+	// Kubernetes
+	var namespaces []string
+	if client, err := k8sutils.NewKubernetesClient(); err != nil {
+		fmt.Fprintf(w.out, "\nUnable to connect to Kubernetes (%v) - continuing without cluster lookups\n", err)
+	} else if found, err := client.GetAllNamespaces(); err == nil {
+		namespaces = found
+		fmt.Fprintf(w.out, "\nFound namespaces: %s\n", strings.Join(found, ", "))
+	}
+	selectedNamespaces := w.askList("\nNamespaces to import, comma separated - empty imports every namespace", "")
+	for _, namespace := range selectedNamespaces {
+		if len(namespaces) > 0 && !contains(namespaces, namespace) {
+			fmt.Fprintf(w.out, "Warning: namespace '%s' was not found in the cluster\n", namespace)
+		}
+	}
+	fmt.Fprintf(w.out, "Supported kinds: %s\n", strings.Join(sortedKeys(initKindAPIVersions), ", "))
+	kinds := w.askList("Kinds to import, comma separated", "Deployment")
+
+	// Field mapping
+	fmt.Fprintln(w.out, "\nMap your labels to OpsLevel service fields - leave empty to skip a field")
+	fields := map[string]string{
+		"name": ".metadata.name",
+	}
+	for _, field := range []struct{ name, question, fallback string }{
+		{"owner", "Label holding the owning team alias", "app.kubernetes.io/part-of"},
+		{"lifecycle", "Label holding the lifecycle", ""},
+		{"tier", "Label holding the tier", ""},
+		{"product", "Label holding the product", ""},
+		{"language", "Label holding the language", ""},
+	} {
+		if label := w.ask(field.question, field.fallback); label != "" {
+			fields[field.name] = fmt.Sprintf(".metadata.labels.\"%s\"", label)
+		}
+	}
+
+	// OpsLevel
+	if token := viper.GetString("api-token"); token == "" {
+		fmt.Fprintln(w.out, "\nNo API token found - set OPSLEVEL_API_TOKEN or pass --api-token before running 'service import'")
+	} else if _, err := buildOpslevelClient(token, viper.GetString("api-url")); err != nil {
+		fmt.Fprintf(w.out, "\nThe API token could not be validated: %v\n", err)
+	} else {
+		fmt.Fprintln(w.out, "\nThe API token is valid")
+	}
+
+	// Write
+	var data bytes.Buffer
+	encoder := yaml.NewEncoder(&data)
+	encoder.SetIndent(2)
+	cobra.CheckErr(encoder.Encode(buildInitConfig(kinds, selectedNamespaces, fields)))
+	path := w.ask("\nWrite config file to", initOutputFile)
+	if _, err := os.Stat(path); err == nil && !w.confirm(fmt.Sprintf("'%s' already exists - overwrite?", path)) {
+		fmt.Fprintln(w.out, "Aborted - nothing was written")
+		return
+	}
+	cobra.CheckErr(os.WriteFile(path, data.Bytes(), 0o644))
+	fmt.Fprintf(w.out, "Wrote %s - try it with:\n\n  kubectl opslevel service preview -c %s\n", path, path)
+}
+
+func buildInitConfig(kinds []string, namespaces []string, fields map[string]string) map[string]interface{} {
+	var imports []interface{}
+	var collects []interface{}
+	for _, kind := range kinds {
+		apiVersion, ok := initKindAPIVersions[kind]
+		if !ok {
+			apiVersion = "apps/v1"
+		}
+		selector := map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       kind,
+			"excludes":   []string{`.metadata.namespace == "kube-system"`, `.metadata.annotations."opslevel.com/ignore"`},
+		}
+		if len(namespaces) > 0 {
+			selector["namespaces"] = namespaces
+		}
+		opslevel := map[string]interface{}{
+			"aliases": []string{`"k8s:\(.metadata.name)-\(.metadata.namespace)"`},
+			"tags": map[string]interface{}{
+				"assign": []string{`{"imported": "kubectl-opslevel"}`, `{"cluster": $cluster}`},
+			},
+		}
+		for field, expression := range fields {
+			opslevel[field] = expression
+		}
+		imports = append(imports, map[string]interface{}{"selector": selector, "opslevel": opslevel})
+		collects = append(collects, map[string]interface{}{"selector": selector})
+	}
+	return map[string]interface{}{
+		"version": config.ConfigCurrentVersion,
+		"service": map[string]interface{}{
+			"import":  imports,
+			"collect": collects,
+		},
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(data map[string]string) []string {
+	var output []string
+	for key := range data {
+		output = append(output, key)
+	}
+	sort.Strings(output)
+	return output
+}
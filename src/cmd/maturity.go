@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/opslevel/kubectl-opslevel/common"
+	"github.com/opslevel/kubectl-opslevel/jq"
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/rs/zerolog/log"
+	"github.com/shurcooL/graphql"
+	"github.com/spf13/cobra"
+)
+
+var maturityCmd = &cobra.Command{
+	Use:   "maturity",
+	Short: "Print a per team maturity scorecard of the services found in your Kubernetes cluster",
+	Long: `This command will look up the maturity level of every service found in your Kubernetes cluster based on the
+settings in the configuration file and print how many services of each team reached each rubric level.
+
+Services that are not in OpsLevel yet are counted as 'MISSING'.
+Use '--output json|yaml' to also get the level of every category per service.`,
+	Run: runMaturity,
+}
+
+func init() {
+	serviceCmd.AddCommand(maturityCmd)
+	addResourceSourceFlags(maturityCmd)
+}
+
+type maturityService struct {
+	Name       string            `json:"name"`
+	Alias      string            `json:"alias"`
+	Team       string            `json:"team,omitempty"`
+	Level      string            `json:"level,omitempty"`
+	Missing    bool              `json:"missing,omitempty"`
+	Categories map[string]string `json:"categories,omitempty"`
+}
+
+type maturityTeam struct {
+	Team     string         `json:"team"`
+	Services int            `json:"services"`
+	Missing  int            `json:"missing"`
+	Levels   map[string]int `json:"levels"`
+}
+
+type maturityReportDocument struct {
+	Levels   []string          `json:"levels"`
+	Teams    []maturityTeam    `json:"teams"`
+	Services []maturityService `json:"services"`
+}
+
+type serviceMaturityWithOwner struct {
+	Id    graphql.ID
+	Name  string
+	Owner struct {
+		Alias string
+	}
+	MaturityReport opslevel.MaturityReport
+}
+
+func getServiceMaturity(client *opslevel.Client, alias string) (*serviceMaturityWithOwner, error) {
+	var q struct {
+		Account struct {
+			Service serviceMaturityWithOwner `graphql:"service(alias: $service)"`
+		}
+	}
+	v := opslevel.PayloadVariables{
+		"service": graphql.String(alias),
+	}
+	if err := client.Query(&q, v); err != nil {
+		return nil, err
+	}
+	return &q.Account.Service, nil
+}
+
+func runMaturity(cmd *cobra.Command, args []string) {
+	config, err := newServiceConfig()
+	checkErr(err, ExitCodeConfig)
+
+	jq.ValidateInstalled()
+
+	services, err := common.GetAllServices(config)
+	checkErrOr(err, ExitCodeConfig)
+	clients := createOpslevelClients(config)
+
+	levels, err := createOpslevelClient().ListLevels()
+	cobra.CheckErr(err)
+	sort.Slice(levels, func(i, j int) bool { return levels[i].Index < levels[j].Index })
+
+	var bar *progress
+	if !quiet {
+		bar = newProgress("Maturity", len(services))
+	}
+	var mutex sync.Mutex
+	var waitGroup sync.WaitGroup
+	queue := make(chan common.ServiceRegistration)
+	report := maturityReportDocument{Levels: []string{}, Services: []maturityService{}}
+	for i := 0; i < concurrency; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for registration := range queue {
+				entry := lookupMaturity(clients[registration.Account], registration)
+				mutex.Lock()
+				report.Services = append(report.Services, entry)
+				if bar != nil {
+					bar.Increment()
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	for _, registration := range services {
+		if aborted() {
+			break
+		}
+		if len(registration.Aliases) > 0 {
+			queue <- registration
+		} else if bar != nil {
+			bar.Increment()
+		}
+	}
+	close(queue)
+	waitGroup.Wait()
+
+	for _, level := range levels {
+		report.Levels = append(report.Levels, level.Name)
+	}
+	sort.Slice(report.Services, func(i, j int) bool { return report.Services[i].Alias < report.Services[j].Alias })
+	report.Teams = summarizeMaturity(report.Services)
+
+	if IsTextOutput() || outputFormat == "table" {
+		cobra.CheckErr(printMaturityTable(report))
+		return
+	}
+	cobra.CheckErr(printStructured(report))
+}
+
+func lookupMaturity(client *opslevel.Client, registration common.ServiceRegistration) maturityService {
+	entry := maturityService{Name: registration.Name, Alias: registration.Key(), Team: registration.Owner}
+	for _, alias := range registration.Aliases {
+		service, err := getServiceMaturity(client, alias)
+		if err != nil {
+			log.Warn().Msgf("[%s] Failed looking up maturity\n\tREASON: %v", registration.Name, err)
+			continue
+		}
+		if service.Id == nil {
+			continue
+		}
+		entry.Name = service.Name
+		if service.Owner.Alias != "" {
+			entry.Team = service.Owner.Alias
+		}
+		entry.Level = service.MaturityReport.OverallLevel.Name
+		entry.Categories = map[string]string{}
+		for _, breakdown := range service.MaturityReport.CategoryBreakdown {
+			entry.Categories[breakdown.Category.Name] = breakdown.Level.Name
+		}
+		return entry
+	}
+	entry.Missing = true
+	return entry
+}
+
+func summarizeMaturity(services []maturityService) []maturityTeam {
+	teams := map[string]*maturityTeam{}
+	for _, service := range services {
+		name := orDash(service.Team)
+		team, ok := teams[name]
+		if !ok {
+			team = &maturityTeam{Team: name, Levels: map[string]int{}}
+			teams[name] = team
+		}
+		team.Services++
+		if service.Missing {
+			team.Missing++
+		} else {
+			team.Levels[service.Level]++
+		}
+	}
+	output := []maturityTeam{}
+	for _, team := range teams {
+		output = append(output, *team)
+	}
+	sort.Slice(output, func(i, j int) bool { return output[i].Team < output[j].Team })
+	return output
+}
+
+func printMaturityTable(report maturityReportDocument) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	header := append([]string{"TEAM", "SERVICES"}, report.Levels...)
+	fmt.Fprintln(w, strings.ToUpper(strings.Join(append(header, "MISSING"), "\t")))
+	for _, team := range report.Teams {
+		row := []string{team.Team, fmt.Sprint(team.Services)}
+		for _, level := range report.Levels {
+			row = append(row, fmt.Sprint(team.Levels[level]))
+		}
+		fmt.Fprintln(w, strings.Join(append(row, fmt.Sprint(team.Missing)), "\t"))
+	}
+	return w.Flush()
+}
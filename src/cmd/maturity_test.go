@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/rocktavious/autopilot"
+)
+
+func Test_SummarizeMaturity_CountsTheLevelsPerTeam(t *testing.T) {
+	// Arrange
+	services := []maturityService{
+		{Name: "web", Alias: "web", Team: "platform", Level: "Gold"},
+		{Name: "api", Alias: "api", Team: "platform", Level: "Bronze"},
+		{Name: "worker", Alias: "worker", Team: "platform", Missing: true},
+		{Name: "db", Alias: "db", Team: "data", Level: "Gold"},
+		{Name: "cron", Alias: "cron", Level: "Bronze"},
+	}
+	// Act
+	result := summarizeMaturity(services)
+	// Assert
+	autopilot.Equals(t, []maturityTeam{
+		{Team: "-", Services: 1, Levels: map[string]int{"Bronze": 1}},
+		{Team: "data", Services: 1, Levels: map[string]int{"Gold": 1}},
+		{Team: "platform", Services: 3, Missing: 1, Levels: map[string]int{"Gold": 1, "Bronze": 1}},
+	}, result)
+}
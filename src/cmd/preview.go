@@ -1,27 +1,44 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
 	"math/rand"
+	"os"
 	"sort"
 	"strconv"
+	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/opslevel/kubectl-opslevel/common"
-	"github.com/opslevel/kubectl-opslevel/config"
 	"github.com/opslevel/kubectl-opslevel/jq"
 
-	_ "github.com/rs/zerolog/log"
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
 
+var (
+	previewServiceAlias  string
+	previewSamples       int
+	previewAll           bool
+	previewSeed          int64
+	previewWriteSnapshot string
+	previewDiffSnapshot  string
+)
+
 // previewCmd represents the preview command
 var previewCmd = &cobra.Command{
 	Use:   "preview [SAMPLES_COUNT]",
 	Short: "Preview the data found in your Kubernetes cluster returning SAMPLES_COUNT",
 	Long: `This command will print out all the data it can find in your Kubernetes cluster based on the settings in the configuration file.
-If SAMPLES_COUNT=0 this will print out everything.`,
+If SAMPLES_COUNT=0 or '--all' is given this will print out everything.
+Use '--seed' to get the same sample on every run.
+The service registrations and their aliases, tags, tools and repositories are sorted so consecutive runs are diffable.
+
+Use '--output table' for a compact summary per service or '--output json|yaml' for just the data.
+
+Use '--write-snapshot' to save every service registration to a file and '--diff-snapshot' on a later run to
+see how a config change alters the emitted registrations before it affects OpsLevel.`,
 	Run:        runPreview,
 	Args:       cobra.MaximumNArgs(1),
 	ArgAliases: []string{"samples"},
@@ -29,52 +46,179 @@ If SAMPLES_COUNT=0 this will print out everything.`,
 
 func init() {
 	serviceCmd.AddCommand(previewCmd)
+	addResourceSourceFlags(previewCmd)
+
+	previewCmd.Flags().StringVar(&previewServiceAlias, "service", "", "Only render the service registration with this alias")
+	previewCmd.RegisterFlagCompletionFunc("service", completeServiceAliases)
+	previewCmd.Flags().IntVar(&previewSamples, "samples", 5, "The number of random service registrations to print - 0 prints everything")
+	previewCmd.Flags().BoolVar(&previewAll, "all", false, "Print every service registration instead of a sample")
+	previewCmd.Flags().Int64Var(&previewSeed, "seed", 0, "The seed for choosing the sample so runs are reproducible - 0 uses a random seed")
+	previewCmd.Flags().StringVar(&previewWriteSnapshot, "write-snapshot", "", "Write every service registration to this json file")
+	previewCmd.Flags().StringVar(&previewDiffSnapshot, "diff-snapshot", "", "Print the differences between the service registrations and this json snapshot file instead of a sample")
 }
 
 func runPreview(cmd *cobra.Command, args []string) {
-	var samples = 5
+	var samples = previewSamples
 	if len(args) > 0 {
 		if parsedSamples, err := strconv.Atoi(args[0]); err == nil {
 			samples = parsedSamples
 		}
 	}
+	if samples < 0 {
+		checkErr(fmt.Errorf("the number of samples must not be negative but got %d", samples), ExitCodeConfig)
+	}
+	if previewAll {
+		samples = 0
+	}
 
-	config, err := config.New()
-	cobra.CheckErr(err)
+	config, err := newServiceConfig()
+	checkErr(err, ExitCodeConfig)
 
 	jq.ValidateInstalled()
 
+	if !quiet {
+		var bar *progress
+		common.OnResourcesParsed = func(done int, total int) {
+			if bar == nil {
+				bar = newProgress("Preview", total)
+			}
+			bar.Set(done)
+		}
+	}
 	services, err2 := common.GetAllServices(config)
-	cobra.CheckErr(err2)
+	common.OnResourcesParsed = nil
+	checkErrOr(err2, ExitCodeConfig)
+	// Sorted so consecutive runs are diffable regardless of the order the cluster returned the resources in
+	services = common.SortServices(services)
+	if previewServiceAlias != "" {
+		services = filterServicesByAlias(services, previewServiceAlias)
+		if len(services) == 0 {
+			cobra.CheckErr(fmt.Errorf("no service registration found with alias '%s'", previewServiceAlias))
+		}
+	}
+	if previewWriteSnapshot != "" {
+		cobra.CheckErr(common.WriteSnapshot(previewWriteSnapshot, services))
+		log.Info().Msgf("Wrote %d service registrations to snapshot '%s'", len(services), previewWriteSnapshot)
+	}
+	if previewDiffSnapshot != "" {
+		previous, err := common.ReadSnapshot(previewDiffSnapshot)
+		checkErr(err, ExitCodeConfig)
+		cobra.CheckErr(printSnapshotDiff(common.DiffSnapshots(previous, services)))
+		return
+	}
 	servicesCount := len(services)
 	if samples < 1 {
 		samples = servicesCount
 	}
 
-	if IsTextOutput() { fmt.Print("The following data was found in your Kubernetes cluster ...\n\n") }
-	if len(services) == 0 {
-		fmt.Printf("[]\n")
-	} else {
-		prettyJSON, err := json.MarshalIndent(sample(services, samples), "", "    ")
-		if err != nil {
-			cobra.CheckErr(err)
+	if IsTextOutput() {
+		fmt.Print("The following data was found in your Kubernetes cluster ...\n\n")
+	}
+	cobra.CheckErr(printServices(sample(services, samples, previewSeed)))
+	if samples < servicesCount {
+		if IsTextOutput() || outputFormat == "table" {
+			fmt.Printf("\nShowing %v / %v resources\n", samples, servicesCount)
 		}
-		fmt.Printf("%s\n", string(prettyJSON))
-		if samples < servicesCount {
-			if IsTextOutput() { fmt.Printf("\nShowing %v / %v resources\n", samples, servicesCount) }
+	}
+
+	if IsTextOutput() {
+		fmt.Println("\nIf you're happy with the above data you can reconcile it with OpsLevel by running:\n\n OPSLEVEL_API_TOKEN=XXX kubectl opslevel service import\n\nOtherwise, please adjust the config file and rerun this command")
+	}
+}
+
+// filterServicesByAlias returns the registrations with at least one of the aliases
+func filterServicesByAlias(services []common.ServiceRegistration, aliases ...string) []common.ServiceRegistration {
+	wanted := map[string]bool{}
+	for _, alias := range aliases {
+		wanted[alias] = true
+	}
+	var output []common.ServiceRegistration
+	for _, service := range services {
+		for _, item := range service.Aliases {
+			if wanted[item] {
+				output = append(output, service)
+				break
+			}
+		}
+	}
+	return output
+}
+
+func printSnapshotDiff(diff common.SnapshotDiff) error {
+	if !IsTextOutput() {
+		return printStructured(diff)
+	}
+	if diff.IsEmpty() {
+		fmt.Println("No differences found compared to the snapshot")
+		return nil
+	}
+	for _, service := range diff.Added {
+		fmt.Printf("+ %s\n", orDash(service.Name))
+	}
+	for _, service := range diff.Removed {
+		fmt.Printf("- %s\n", orDash(service.Name))
+	}
+	for _, change := range diff.Changed {
+		fmt.Printf("~ %s\n", change.Key)
+		for _, field := range change.Fields {
+			fmt.Printf("    %s: %s -> %s\n", field.Field, orDash(field.Before), orDash(field.After))
 		}
 	}
+	fmt.Printf("\n%d added, %d removed, %d changed\n", len(diff.Added), len(diff.Removed), len(diff.Changed))
+	return nil
+}
+
+func printServices(services []common.ServiceRegistration) error {
+	if services == nil {
+		services = []common.ServiceRegistration{}
+	}
+	switch outputFormat {
+	case "table":
+		return printServicesTable(services)
+	default:
+		return printStructured(services)
+	}
+}
 
-	if IsTextOutput() { fmt.Println("\nIf you're happy with the above data you can reconcile it with OpsLevel by running:\n\n OPSLEVEL_API_TOKEN=XXX kubectl opslevel service import\n\nOtherwise, please adjust the config file and rerun this command") }
+func printServicesTable(services []common.ServiceRegistration) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tOWNER\tTIER\tLIFECYCLE\tALIASES\tTAGS\tTOOLS\tREPOS")
+	for _, service := range services {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\n",
+			orDash(service.Name),
+			orDash(service.Owner),
+			orDash(service.Tier),
+			orDash(service.Lifecycle),
+			len(service.Aliases),
+			len(service.TagAssigns)+len(service.TagCreates),
+			len(service.Tools),
+			len(service.Repositories),
+		)
+	}
+	return w.Flush()
 }
 
-func sample(data []common.ServiceRegistration, samples int) []common.ServiceRegistration {
+func orDash(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return "-"
+	}
+	return value
+}
+
+func sample(data []common.ServiceRegistration, samples int, seed int64) []common.ServiceRegistration {
 	max := len(data)
 	if samples >= max {
 		return data
 	}
 	output := make([]common.ServiceRegistration, samples)
-	rand.Seed(time.Now().UTC().UnixNano())
+	if seed == 0 {
+		seed = time.Now().UTC().UnixNano()
+	} else {
+		// Sort a copy so the same seed picks the same services regardless of the order the cluster returned them
+		data = append([]common.ServiceRegistration(nil), data...)
+		sort.SliceStable(data, func(i, j int) bool { return data[i].Name < data[j].Name })
+	}
+	rand.Seed(seed)
 	for i, index := range getSamples(0, max, samples) {
 		output[i] = data[index]
 	}
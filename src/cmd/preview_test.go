@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/opslevel/kubectl-opslevel/common"
+	"github.com/rocktavious/autopilot"
+)
+
+func Test_Sample_KeepsTheOrderOfTheCallersServices(t *testing.T) {
+	// Arrange
+	services := []common.ServiceRegistration{{Name: "web"}, {Name: "api"}, {Name: "db"}}
+	// Act
+	output := sample(services, 2, 42)
+	// Assert
+	autopilot.Equals(t, 2, len(output))
+	autopilot.Equals(t, "web", services[0].Name)
+	autopilot.Equals(t, "api", services[1].Name)
+	autopilot.Equals(t, "db", services[2].Name)
+}
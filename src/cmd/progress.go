@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/term"
+)
+
+const progressBarWidth = 30
+
+// progress renders a progress bar with an ETA on stderr when it is a terminal and only warnings and errors are logged
+// so the bar is not interleaved with the log lines - otherwise it logs a line every 10 percent so CI logs stay readable
+type progress struct {
+	mutex       sync.Mutex
+	label       string
+	total       int
+	done        int
+	started     time.Time
+	tty         bool
+	lastRender  time.Time
+	lastPercent int
+}
+
+func newProgress(label string, total int) *progress {
+	return &progress{
+		label:   label,
+		total:   total,
+		started: time.Now(),
+		tty:     term.IsTerminal(int(os.Stderr.Fd())) && log.Logger.GetLevel() >= zerolog.WarnLevel,
+	}
+}
+
+func (p *progress) Increment() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.set(p.done + 1)
+}
+
+func (p *progress) Set(done int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.set(done)
+}
+
+func (p *progress) set(done int) {
+	p.done = done
+	if p.total < 1 {
+		return
+	}
+	percent := p.done * 100 / p.total
+	if p.tty {
+		if p.done < p.total && time.Since(p.lastRender) < 100*time.Millisecond {
+			return
+		}
+		p.lastRender = time.Now()
+		filled := progressBarWidth * p.done / p.total
+		bar := strings.Repeat("#", filled) + strings.Repeat("-", progressBarWidth-filled)
+		fmt.Fprintf(os.Stderr, "\r\033[2K%s [%s] %d/%d %3d%% ETA %s", p.label, bar, p.done, p.total, percent, p.eta())
+		if p.done >= p.total {
+			fmt.Fprintln(os.Stderr)
+		}
+		return
+	}
+	if percent/10 > p.lastPercent/10 || p.done == p.total {
+		p.lastPercent = percent
+		log.Info().Msgf("[%s] %d%% (%d/%d) ETA %s", p.label, percent, p.done, p.total, p.eta())
+	}
+}
+
+func (p *progress) eta() time.Duration {
+	if p.done < 1 || p.done >= p.total {
+		return 0
+	}
+	elapsed := time.Since(p.started)
+	return (elapsed / time.Duration(p.done) * time.Duration(p.total-p.done)).Round(time.Second)
+}
@@ -5,25 +5,52 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/go-resty/resty/v2"
 	"github.com/opslevel/kubectl-opslevel/common"
 	"github.com/opslevel/kubectl-opslevel/config"
 	"github.com/opslevel/kubectl-opslevel/jq"
 	"github.com/opslevel/kubectl-opslevel/k8sutils"
-	"github.com/opslevel/opslevel-go/v2022"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 var (
-	reconcileResyncInterval int
-	reconcileBatchSize      int
+	reconcileResyncInterval       int
+	reconcileBatchSize            int
+	reconcileDeployURL            string
+	reconcileHealthInterval       time.Duration
+	reconcileTokenRefreshInterval time.Duration
 )
 
 var reconcileCmd = &cobra.Command{
 	Use:   "reconcile",
 	Short: "Run in the foreground as a kubernetes controller to reconcile data with service entries in OpsLevel",
-	Long:  `Run in the foreground as a kubernetes controller to reconcile data with service entries in OpsLevel`,
-	Run:   runReconcile,
+	Long: `Run in the foreground as a kubernetes controller to reconcile data with service entries in OpsLevel
+
+Services whose registration did not change since they were last reconciled (IE: on status updates or rollout
+churn) are skipped until the next '--resync'.
+
+Namespaces are watched as well so the services of a namespace that is created or gets the 'namespaces.optIn'
+label are reconciled right away instead of at the next '--resync'.
+
+Dependencies are created as their services are reconciled. The managed dependencies no service declares any more
+are only removed after the first '--resync' since every service has been seen by then.
+
+The controller cannot ask for confirmation so the tags and dependencies it would remove are logged at every
+'--resync' and skipped unless '--yes' is given.
+
+The namespace teams, costs, GitOps sources, idle endpoints and namespace systems enabled in the config are
+listed once at startup like 'service import' does.
+
+With '--deploy-integration-url' a deploy event is sent whenever the 'deployVersion' of a service changes.
+
+With '--health-interval' the replica readiness, container restart count and rollout status of every service
+backed by a Deployment, StatefulSet or DaemonSet are posted to 'checks.url' as the facts 'desired_replicas',
+'ready_replicas', 'all_replicas_ready', 'restart_count' and 'rollout_status' (complete, progressing or failed).`,
+	Run: runReconcile,
 }
 
 func init() {
@@ -31,23 +58,34 @@ func init() {
 
 	reconcileCmd.Flags().IntVar(&reconcileResyncInterval, "resync", 24, "The amount (in hours) before a full resync of the kubernetes cluster happens with OpsLevel. [default: 24]")
 	reconcileCmd.Flags().IntVar(&reconcileBatchSize, "batch", 500, "The max amount of k8s resources to batch process with jq. Helps to speedup initial startup. [default: 500]")
+	reconcileCmd.Flags().StringVar(&serviceFilter, "filter", "", "The id, name or alias of an OpsLevel filter (IE: on tag, tier or owner) - only the found services it selects are reconciled")
+	reconcileCmd.Flags().DurationVar(&reconcileHealthInterval, "health-interval", 0, "How often the replica readiness, restart counts and rollout status of every service are posted to 'checks.url' IE: '5m' - 0 disables")
+	reconcileCmd.Flags().DurationVar(&reconcileTokenRefreshInterval, "token-refresh", time.Minute, "How often the api token files and secrets of the default and config 'accounts' are re-read to pick up rotated tokens - 0 disables")
+	reconcileCmd.Flags().StringVar(&reconcileDeployURL, "deploy-integration-url", "", "The url of an OpsLevel deploy integration to send a deploy event to whenever the 'deployVersion' of a service changes")
+	addConfirmationFlags(reconcileCmd)
 }
 
 func runReconcile(cmd *cobra.Command, args []string) {
-	config, configErr := config.New()
-	cobra.CheckErr(configErr)
+	config, configErr := newServiceConfig()
+	checkErr(configErr, ExitCodeConfig)
 
 	jq.ValidateInstalled()
 
-	k8sClient := k8sutils.CreateKubernetesClient()
-	olClient := createOpslevelClient()
-
-	opslevel.Cache.CacheTiers(olClient)
-	opslevel.Cache.CacheLifecycles(olClient)
-	opslevel.Cache.CacheTeams(olClient)
+	k8sClient, k8sClientErr := k8sutils.NewKubernetesClient()
+	checkErr(k8sClientErr, ExitCodeKubernetes)
+	checkErr(common.ApplyGlobals(config, k8sClient), ExitCodeConfig)
+	common.SetDependencyPruning(false)
+	setReconcileConfig(config)
+	deferRemovals()
+	clients := createOpslevelClients(config)
+	for account, olClient := range clients {
+		common.CacheAccount(account, olClient)
+	}
+	filters := loadServiceFilters(clients)
 
 	resync := time.Hour * time.Duration(reconcileResyncInterval)
 	reconcileQueue := make(chan common.ServiceRegistration, 1)
+	var controllers []*k8sutils.KubernetesController
 
 	for i, importConfig := range config.Service.Import {
 		selector := importConfig.SelectorConfig
@@ -55,37 +93,98 @@ func runReconcile(cmd *cobra.Command, args []string) {
 			log.Fatal().Err(selectorErr)
 			return
 		}
-		gvr, err := k8sClient.GetGVR(selector)
-		if err != nil {
-			log.Error().Err(err)
-			continue
+		selectors := []k8sutils.KubernetesSelector{selector}
+		if selector.Discover {
+			discovered, err := k8sClient.DiscoverAnnotatedSelectors(selector)
+			if err != nil {
+				log.Error().Err(err)
+				continue
+			}
+			log.Info().Msgf("[service.import[%d]] Watching the %d discovered kinds with annotated resources - restart to pick up newly annotated kinds", i, len(discovered))
+			selectors = discovered
+		}
+		for _, selector := range selectors {
+			gvr, err := k8sClient.GetGVR(selector)
+			if err != nil {
+				log.Error().Err(err)
+				continue
+			}
+			selectorConfig := importConfig
+			selectorConfig.SelectorConfig = selector
+			callback := createHandler(fmt.Sprintf("service.import[%d]", i), selectorConfig, reconcileQueue)
+			controller := k8sutils.NewController(*gvr, selector.GetListOptions(), resync, reconcileBatchSize)
+			controller.OnAdd = callback
+			controller.OnUpdate = callback
+			go controller.Start(1)
+			controllers = append(controllers, controller)
 		}
-		callback := createHandler(fmt.Sprintf("service.import[%d]", i), importConfig, reconcileQueue)
-		controller := k8sutils.NewController(*gvr, resync, reconcileBatchSize)
-		controller.OnAdd = callback
-		controller.OnUpdate = callback
-		go controller.Start(1)
 	}
+	watchNamespaces(k8sClient, resync, controllers)
 
 	// Loop forever resyncing teams at resync interval
 	ticker := time.NewTicker(resync)
 	go func() {
 		for {
 			<-ticker.C
-			olClient := createOpslevelClient()
+			common.SetDependencyPruning(true)
+			confirmRemovals()
+			common.ResetRepositoryLookups()
+			common.ResetConfigMaps()
+			if err := k8sClient.RefreshNamespaces(); err != nil {
+				log.Warn().Msgf("Unable to refresh the namespaces to scan: %v", err)
+			}
 			// has a mutex lock that will block TryGet in ReconcileService goroutine
-			opslevel.Cache.CacheTiers(olClient)
-			opslevel.Cache.CacheLifecycles(olClient)
-			opslevel.Cache.CacheTeams(olClient)
+			for account, olClient := range createOpslevelClients(config) {
+				if err := common.RefreshAccount(account, olClient); err != nil {
+					log.Warn().Msgf("Unable to persist the account cache: %v", err)
+				}
+			}
 		}
 	}()
 
+	health := common.NewHealthReporter()
+	if reconcileHealthInterval > 0 {
+		go func() {
+			for range time.Tick(reconcileHealthInterval) {
+				if err := health.Report(k8sClient); err != nil {
+					log.Warn().Msgf("Unable to report the runtime health of the services: %v", err)
+				}
+			}
+		}()
+	}
+
 	// Loop forever waiting to reconcile 1 service at a time
 	go func() {
-		client := createOpslevelClient()
+		clients := createOpslevelClients(config)
+		deploys := common.NewDeployTracker()
+		// hashes expire well before the next informer resync so its events always reconcile the drift made in OpsLevel
+		registrations := common.NewRegistrationTracker(resync / 2)
+		restClient := createRestClient()
+		// the namespace systems are synced once per account before the first of their services is reconciled
+		syncedSystems := map[string]bool{}
 		for {
 			for service := range reconcileQueue {
-				common.ReconcileService(client, service)
+				if refreshAPIToken(reconcileTokenRefreshInterval, config) {
+					clients = createOpslevelClients(config)
+				}
+				if !matchesServiceFilters(filters, service) {
+					log.Debug().Msgf("[%s] Skipped because the filter '%s' does not select it", service.Name, serviceFilter)
+					continue
+				}
+				if registrations.Unchanged(service, time.Now()) {
+					log.Debug().Msgf("[%s] Skipped because its registration did not change since it was last reconciled", service.Name)
+					continue
+				}
+				if config.Systems.Namespaces && service.System != "" && !syncedSystems[service.Account+"/"+service.System] {
+					common.SyncNamespaceSystems(clients, []common.ServiceRegistration{service})
+					syncedSystems[service.Account+"/"+service.System] = true
+				}
+				health.Remember(service)
+				result := common.ReconcileService(clients[service.Account], service)
+				registrations.Remember(service, result, time.Now())
+				if reconcileDeployURL != "" && deploys.Changed(service) {
+					sendWatchedDeploy(restClient, service)
+				}
 			}
 		}
 	}()
@@ -93,6 +192,39 @@ func runReconcile(cmd *cobra.Command, args []string) {
 	k8sutils.Start()
 }
 
+// watchNamespaces requeues the cached resources of a namespace once it is created or opts in so its services are
+// reconciled within the next event cycle instead of at the next resync
+func watchNamespaces(k8sClient *k8sutils.ClientWrapper, resync time.Duration, controllers []*k8sutils.KubernetesController) {
+	allowed := map[string]bool{}
+	if namespaces, err := k8sClient.GetNamespaces(k8sutils.KubernetesSelector{}); err == nil {
+		for _, namespace := range namespaces {
+			allowed[namespace] = true
+		}
+	}
+	handler := func(items []interface{}) {
+		for _, item := range items {
+			namespace, ok := item.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			name := namespace.GetName()
+			isAllowed := k8sutils.ObserveNamespace(name, namespace.GetLabels())
+			if isAllowed && !allowed[name] {
+				requeued := 0
+				for _, controller := range controllers {
+					requeued += controller.Requeue(name)
+				}
+				log.Info().Msgf("[%s] Namespace is now imported - requeued %d resource(s)", name, requeued)
+			}
+			allowed[name] = isAllowed
+		}
+	}
+	controller := k8sutils.NewController(schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}, metav1.ListOptions{}, resync, reconcileBatchSize)
+	controller.OnAdd = handler
+	controller.OnUpdate = handler
+	go controller.Start(1)
+}
+
 func createHandler(field string, config config.Import, queue chan common.ServiceRegistration) k8sutils.KubernetesControllerHandler {
 	id := fmt.Sprintf("%s/%s", config.SelectorConfig.ApiVersion, config.SelectorConfig.Kind)
 	return func(items []interface{}) {
@@ -107,8 +239,24 @@ func createHandler(field string, config config.Import, queue chan common.Service
 			return
 		}
 		log.Info().Msgf("[%s] Processing '%d' service(s)", id, len(services))
+		common.PlaceInNamespaceSystems(services)
+		common.DeclareDependencies(services)
 		for _, service := range services {
 			queue <- service
 		}
 	}
 }
+
+func sendWatchedDeploy(restClient *resty.Client, service common.ServiceRegistration) {
+	event := common.DeployEvent{
+		Service:     service.Aliases[0],
+		Deployer:    common.DeployDeployer{Name: "kubectl-opslevel"},
+		DeployedAt:  time.Now().UTC(),
+		Description: fmt.Sprintf("Detected version '%s' in the cluster", service.DeployVersion),
+		Environment: jq.GetArg("cluster"),
+		Commit:      common.DeployCommit{Sha: service.DeployVersion},
+	}
+	if err := common.SendDeployEvent(restClient, reconcileDeployURL, event); err != nil {
+		log.Error().Msgf("[%s] Failed sending deploy event\n\tREASON: %v", service.Name, err)
+	}
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/opslevel/kubectl-opslevel/common"
+	"github.com/opslevel/kubectl-opslevel/jq"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var renderDirectory string
+
+var renderFileNameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+var renderCmd = &cobra.Command{
+	Use:   "render",
+	Short: "Render the service registrations found in your Kubernetes cluster to disk",
+	Long: `This command will parse the data found in your Kubernetes cluster and write one file per service registration
+to the output directory without ever contacting the OpsLevel API, for air-gapped review or feeding into other tooling.
+
+Files are written as yaml unless '--output json' is given.`,
+	Example: `  kubectl opslevel service render --dir ./rendered
+  kubectl opslevel service render --dir ./rendered -o json`,
+	Run: runRender,
+}
+
+func init() {
+	serviceCmd.AddCommand(renderCmd)
+	addResourceSourceFlags(renderCmd)
+
+	renderCmd.Flags().StringVar(&renderDirectory, "dir", "./rendered", "The directory to write the service registration files to - it is created if missing")
+}
+
+func runRender(cmd *cobra.Command, args []string) {
+	config, err := newServiceConfig()
+	checkErr(err, ExitCodeConfig)
+
+	jq.ValidateInstalled()
+
+	services, err := common.GetAllServices(config)
+	checkErrOr(err, ExitCodeConfig)
+
+	asYAML := outputFormat != "json"
+	extension := ".yaml"
+	if !asYAML {
+		extension = ".json"
+	}
+	cobra.CheckErr(os.MkdirAll(renderDirectory, 0o755))
+	written := map[string]int{}
+	for _, service := range services {
+		name := renderFileName(service)
+		written[name]++
+		if written[name] > 1 {
+			name = fmt.Sprintf("%s-%d", name, written[name])
+		}
+		data, err := marshalStructured(service, asYAML)
+		cobra.CheckErr(err)
+		path := filepath.Join(renderDirectory, name+extension)
+		cobra.CheckErr(os.WriteFile(path, data, 0o644))
+		log.Debug().Msgf("[%s] Rendered to %s", service.Name, path)
+	}
+	log.Info().Msgf("Rendered %d service registrations to %s", len(services), renderDirectory)
+}
+
+// renderFileName uses the first alias since it is unique per registration where names might not be
+func renderFileName(service common.ServiceRegistration) string {
+	name := service.Name
+	if len(service.Aliases) > 0 {
+		name = service.Aliases[0]
+	}
+	name = strings.Trim(renderFileNameInvalidChars.ReplaceAllString(name, "_"), "._")
+	if name == "" {
+		return "service"
+	}
+	return name
+}
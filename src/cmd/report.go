@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/opslevel/kubectl-opslevel/common"
+	"github.com/opslevel/kubectl-opslevel/jq"
+	"github.com/spf13/cobra"
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Commands for reporting on the OpsLevel catalog of your Kubernetes cluster",
+	Long:  `Commands for reporting on the OpsLevel catalog of your Kubernetes cluster`,
+}
+
+var reportCoverageCmd = &cobra.Command{
+	Use:   "coverage",
+	Short: "Show how many workloads per namespace and per team are cataloged in OpsLevel",
+	Long: `This command will look up the service of every workload found in your Kubernetes cluster without changing anything
+and count per namespace and per team how many are matched to an existing OpsLevel service, how many an import would
+create as a new service and how many fail to resolve their service, owner, tier or lifecycle.
+
+Use '--output json|yaml' for a machine readable report that also lists the failures.`,
+	Run: runReportCoverage,
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+	reportCmd.AddCommand(reportCoverageCmd)
+}
+
+type coverageCounts struct {
+	Name      string `json:"name"`
+	Workloads int    `json:"workloads"`
+	Matched   int    `json:"matched"`
+	New       int    `json:"new"`
+	Failed    int    `json:"failed"`
+}
+
+func (c *coverageCounts) add(coverage common.ServiceCoverage) {
+	c.Workloads++
+	switch coverage.Status {
+	case common.CoverageStatus_Matched:
+		c.Matched++
+	case common.CoverageStatus_New:
+		c.New++
+	case common.CoverageStatus_Failed:
+		c.Failed++
+	}
+}
+
+type coverageDocument struct {
+	Total      coverageCounts           `json:"total"`
+	Namespaces []coverageCounts         `json:"namespaces"`
+	Teams      []coverageCounts         `json:"teams"`
+	Failures   []common.ServiceCoverage `json:"failures"`
+}
+
+func groupCoverage(coverages []common.ServiceCoverage, key func(common.ServiceCoverage) string) []coverageCounts {
+	groups := map[string]*coverageCounts{}
+	for _, coverage := range coverages {
+		name := key(coverage)
+		if groups[name] == nil {
+			groups[name] = &coverageCounts{Name: name}
+		}
+		groups[name].add(coverage)
+	}
+	output := []coverageCounts{}
+	for _, group := range groups {
+		output = append(output, *group)
+	}
+	sort.Slice(output, func(i, j int) bool { return output[i].Name < output[j].Name })
+	return output
+}
+
+func newCoverageDocument(coverages []common.ServiceCoverage) coverageDocument {
+	document := coverageDocument{
+		Total:      coverageCounts{Name: "total"},
+		Namespaces: groupCoverage(coverages, func(c common.ServiceCoverage) string { return orDash(c.Namespace) }),
+		Teams:      groupCoverage(coverages, func(c common.ServiceCoverage) string { return orDash(c.Team) }),
+		Failures:   []common.ServiceCoverage{},
+	}
+	for _, coverage := range coverages {
+		document.Total.add(coverage)
+		if coverage.Status == common.CoverageStatus_Failed {
+			document.Failures = append(document.Failures, coverage)
+		}
+	}
+	sort.Slice(document.Failures, func(i, j int) bool { return document.Failures[i].Name < document.Failures[j].Name })
+	return document
+}
+
+func runReportCoverage(cmd *cobra.Command, args []string) {
+	config, err := newServiceConfig()
+	checkErr(err, ExitCodeConfig)
+
+	jq.ValidateInstalled()
+
+	services, err := common.GetAllServices(config)
+	checkErrOr(err, ExitCodeConfig)
+	common.SetTeams(config.Teams)
+	clients := createOpslevelClients(config)
+	for account, client := range clients {
+		common.CacheAccount(account, client)
+	}
+	common.PrefetchServiceAliases(clients, services)
+
+	var mutex sync.Mutex
+	var waitGroup sync.WaitGroup
+	queue := make(chan common.ServiceRegistration)
+	var coverages []common.ServiceCoverage
+	for i := 0; i < concurrency; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for service := range queue {
+				coverage := common.CheckCoverage(clients[service.Account], service)
+				mutex.Lock()
+				coverages = append(coverages, coverage)
+				mutex.Unlock()
+			}
+		}()
+	}
+	for _, service := range services {
+		if aborted() {
+			break
+		}
+		queue <- service
+	}
+	close(queue)
+	waitGroup.Wait()
+
+	document := newCoverageDocument(coverages)
+	if !IsTextOutput() {
+		cobra.CheckErr(printStructured(document))
+		return
+	}
+	cobra.CheckErr(printCoverageTable("NAMESPACE", document.Namespaces))
+	fmt.Println()
+	cobra.CheckErr(printCoverageTable("TEAM", document.Teams))
+	for _, failure := range document.Failures {
+		fmt.Printf("\n[%s] %s", failure.Name, strings.Join(failure.Problems, "; "))
+	}
+	if len(document.Failures) > 0 {
+		fmt.Println()
+	}
+	total := document.Total
+	fmt.Printf("\n%d workloads - %d matched, %d new, %d failed\n", total.Workloads, total.Matched, total.New, total.Failed)
+}
+
+func printCoverageTable(header string, rows []coverageCounts) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(w, "%s\tWORKLOADS\tMATCHED\tNEW\tFAILED\n", header)
+	for _, row := range rows {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", row.Name, row.Workloads, row.Matched, row.New, row.Failed)
+	}
+	return w.Flush()
+}
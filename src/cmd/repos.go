@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/opslevel/kubectl-opslevel/common"
+	"github.com/opslevel/kubectl-opslevel/jq"
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/spf13/cobra"
+)
+
+var reposCmd = &cobra.Command{
+	Use:   "repos",
+	Short: "Commands for inspecting the repositories referenced by the services",
+	Long:  `Commands for inspecting the repositories referenced by the services`,
+}
+
+var reposMissingCmd = &cobra.Command{
+	Use:   "missing",
+	Short: "List the repository aliases referenced in your Kubernetes cluster that OpsLevel cannot find",
+	Long: `This command will look up every repository alias referenced by the services found in your Kubernetes cluster
+and list the ones OpsLevel does not know grouped by VCS host, so the git integrations can be fixed in one pass.
+
+Use '--output json|yaml' for a machine readable report.`,
+	Run: runReposMissing,
+}
+
+func init() {
+	serviceCmd.AddCommand(reposCmd)
+	reposCmd.AddCommand(reposMissingCmd)
+	addResourceSourceFlags(reposMissingCmd)
+}
+
+type missingRepository struct {
+	Alias    string   `json:"alias"`
+	Services []string `json:"services"`
+	Error    string   `json:"error,omitempty"`
+}
+
+type missingRepositoriesHost struct {
+	Host         string              `json:"host"`
+	Repositories []missingRepository `json:"repositories"`
+}
+
+type missingRepositoriesDocument struct {
+	Checked int                       `json:"checked"`
+	Missing int                       `json:"missing"`
+	Hosts   []missingRepositoriesHost `json:"hosts"`
+}
+
+// repositoryHost is the VCS host of an OpsLevel repository alias - IE: 'github.com:org/repo' => 'github.com'
+func repositoryHost(alias string) string {
+	if index := strings.Index(alias, ":"); index > 0 {
+		return alias[:index]
+	}
+	return "unknown"
+}
+
+type repositoryReference struct {
+	account  string
+	alias    string
+	services []string
+}
+
+// collectRepositoryReferences returns the referenced repository aliases per account with the services referencing them
+func collectRepositoryReferences(services []common.ServiceRegistration) []*repositoryReference {
+	references := map[string]*repositoryReference{}
+	for _, service := range services {
+		for _, repository := range service.Repositories {
+			alias := string(repository.Repository.Alias)
+			if alias == "" {
+				continue
+			}
+			key := service.Account + "/" + alias
+			if references[key] == nil {
+				references[key] = &repositoryReference{account: service.Account, alias: alias}
+			}
+			references[key].services = append(references[key].services, service.Name)
+		}
+	}
+	var output []*repositoryReference
+	for _, reference := range references {
+		output = append(output, reference)
+	}
+	sort.Slice(output, func(i, j int) bool { return output[i].alias < output[j].alias })
+	return output
+}
+
+func lookupMissingRepository(client *opslevel.Client, reference *repositoryReference) *missingRepository {
+	repository, err := client.GetRepositoryWithAlias(reference.alias)
+	if err == nil && repository != nil && repository.Id != nil {
+		return nil
+	}
+	services := append([]string{}, reference.services...)
+	sort.Strings(services)
+	missing := &missingRepository{Alias: reference.alias, Services: services}
+	if err != nil {
+		missing.Error = err.Error()
+	}
+	return missing
+}
+
+func runReposMissing(cmd *cobra.Command, args []string) {
+	config, err := newServiceConfig()
+	checkErr(err, ExitCodeConfig)
+
+	jq.ValidateInstalled()
+
+	services, err := common.GetAllServices(config)
+	checkErrOr(err, ExitCodeConfig)
+	clients := createOpslevelClients(config)
+	references := collectRepositoryReferences(services)
+
+	var mutex sync.Mutex
+	var waitGroup sync.WaitGroup
+	queue := make(chan *repositoryReference)
+	hosts := map[string][]missingRepository{}
+	for i := 0; i < concurrency; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for reference := range queue {
+				if missing := lookupMissingRepository(clients[reference.account], reference); missing != nil {
+					mutex.Lock()
+					host := repositoryHost(missing.Alias)
+					hosts[host] = append(hosts[host], *missing)
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+	for _, reference := range references {
+		if aborted() {
+			break
+		}
+		queue <- reference
+	}
+	close(queue)
+	waitGroup.Wait()
+
+	report := missingRepositoriesDocument{Checked: len(references), Hosts: []missingRepositoriesHost{}}
+	for host, repositories := range hosts {
+		sort.Slice(repositories, func(i, j int) bool { return repositories[i].Alias < repositories[j].Alias })
+		report.Hosts = append(report.Hosts, missingRepositoriesHost{Host: host, Repositories: repositories})
+		report.Missing += len(repositories)
+	}
+	sort.Slice(report.Hosts, func(i, j int) bool { return report.Hosts[i].Host < report.Hosts[j].Host })
+
+	if !IsTextOutput() {
+		cobra.CheckErr(printStructured(report))
+		return
+	}
+	if report.Missing == 0 {
+		fmt.Printf("All %d referenced repositories were found in OpsLevel\n", report.Checked)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "HOST\tREPOSITORY\tSERVICES")
+	for _, host := range report.Hosts {
+		for _, repository := range host.Repositories {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", host.Host, repository.Alias, strings.Join(repository.Services, ","))
+		}
+	}
+	cobra.CheckErr(w.Flush())
+	fmt.Printf("\n%d of %d referenced repositories were not found in OpsLevel\n", report.Missing, report.Checked)
+}
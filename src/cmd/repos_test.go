@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/opslevel/kubectl-opslevel/common"
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/rocktavious/autopilot"
+	"github.com/shurcooL/graphql"
+)
+
+func Test_RepositoryHost(t *testing.T) {
+	// Arrange
+	// Act
+	result1 := repositoryHost("github.com:opslevel/kubectl-opslevel")
+	result2 := repositoryHost("kubectl-opslevel")
+	// Assert
+	autopilot.Equals(t, "github.com", result1)
+	autopilot.Equals(t, "unknown", result2)
+}
+
+func Test_CollectRepositoryReferences_GroupsTheServicesByAccountAndAlias(t *testing.T) {
+	// Arrange
+	repository := func(alias string) opslevel.ServiceRepositoryCreateInput {
+		return opslevel.ServiceRepositoryCreateInput{Repository: opslevel.IdentifierInput{Alias: graphql.String(alias)}}
+	}
+	services := []common.ServiceRegistration{
+		{Name: "web", Repositories: []opslevel.ServiceRepositoryCreateInput{repository("github.com:org/web"), repository("")}},
+		{Name: "worker", Repositories: []opslevel.ServiceRepositoryCreateInput{repository("github.com:org/web")}},
+		{Name: "api", Account: "staging", Repositories: []opslevel.ServiceRepositoryCreateInput{repository("github.com:org/api"), repository("github.com:org/web")}},
+	}
+	// Act
+	result := collectRepositoryReferences(services)
+	// Assert
+	autopilot.Equals(t, 3, len(result))
+	autopilot.Equals(t, "github.com:org/api", result[0].alias)
+	autopilot.Equals(t, []string{"api"}, result[0].services)
+	byAccount := map[string][]string{}
+	for _, reference := range result[1:] {
+		autopilot.Equals(t, "github.com:org/web", reference.alias)
+		byAccount[reference.account] = reference.services
+	}
+	autopilot.Equals(t, map[string][]string{"": {"web", "worker"}, "staging": {"api"}}, byAccount)
+}
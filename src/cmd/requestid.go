@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/opslevel/kubectl-opslevel/k8sutils"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+const (
+	runIdHeader     = "X-OpsLevel-Run-Id"
+	requestIdHeader = "X-Request-Id"
+)
+
+// runId is sent with every OpsLevel API call of this invocation so support can find all of them in the OpsLevel logs
+var runId = newCorrelationId()
+
+func newCorrelationId() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// userAgentExtra reports the plugin version and the cluster - IE: 'kubectl-v2022.10.1 cluster/prod-us1'
+func userAgentExtra() string {
+	extra := fmt.Sprintf("kubectl-%s", version)
+	cluster := viper.GetString("clusterName")
+	if cluster == "" {
+		cluster = k8sutils.KubeconfigClusterName()
+	}
+	if cluster = strings.Join(strings.Fields(cluster), "-"); cluster != "" {
+		extra = fmt.Sprintf("%s cluster/%s", extra, cluster)
+	}
+	return extra
+}
+
+// newRequestIdTransport tags each GraphQL call with the run id and its own request id and logs both when the call fails
+func newRequestIdTransport(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		requestId := newCorrelationId()
+		req.Header.Set(runIdHeader, runId)
+		req.Header.Set(requestIdHeader, requestId)
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			log.Warn().Msgf("OpsLevel API call failed (run id '%s', request id '%s')\n\tREASON: %v", runId, requestId, err)
+		} else if resp.StatusCode >= http.StatusBadRequest {
+			log.Warn().Msgf("OpsLevel API call responded %s (run id '%s', request id '%s')", resp.Status, runId, requestId)
+		}
+		return resp, err
+	})
+}
+
+// tagRestRequests is the equivalent of newRequestIdTransport for the REST client
+func tagRestRequests(client *resty.Client) {
+	client.SetHeader(runIdHeader, runId)
+	client.OnBeforeRequest(func(c *resty.Client, req *resty.Request) error {
+		req.SetHeader(requestIdHeader, newCorrelationId())
+		return nil
+	})
+	client.OnAfterResponse(func(c *resty.Client, resp *resty.Response) error {
+		if resp.IsError() {
+			log.Warn().Msgf("OpsLevel API call responded %s (run id '%s', request id '%s')", resp.Status(), runId, resp.Request.Header.Get(requestIdHeader))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/rocktavious/autopilot"
+	"github.com/spf13/viper"
+)
+
+func Test_RequestIdTransport_TagsEveryCallWithItsOwnRequestId(t *testing.T) {
+	// Arrange
+	var runIds, requestIds []string
+	transport := newRequestIdTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		runIds = append(runIds, req.Header.Get(runIdHeader))
+		requestIds = append(requestIds, req.Header.Get(requestIdHeader))
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}, nil
+	}))
+	req, _ := http.NewRequest(http.MethodPost, "https://app.opslevel.com/graphql", nil)
+	// Act
+	_, err1 := transport.RoundTrip(req)
+	_, err2 := transport.RoundTrip(req)
+	// Assert
+	autopilot.Ok(t, err1)
+	autopilot.Ok(t, err2)
+	autopilot.Equals(t, []string{runId, runId}, runIds)
+	autopilot.Equals(t, 16, len(requestIds[0]))
+	autopilot.Assert(t, requestIds[0] != requestIds[1], "expected a request id per call but got %v", requestIds)
+	autopilot.Equals(t, "", req.Header.Get(requestIdHeader))
+}
+
+func Test_TagRestRequests_SendsTheRunAndRequestIds(t *testing.T) {
+	// Arrange
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+	}))
+	defer server.Close()
+	client := resty.New()
+	tagRestRequests(client)
+	// Act
+	_, err := client.R().Get(server.URL)
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Equals(t, runId, header.Get(runIdHeader))
+	autopilot.Equals(t, 16, len(header.Get(requestIdHeader)))
+}
+
+func Test_UserAgentExtra_ReportsTheVersionAndCluster(t *testing.T) {
+	// Arrange
+	previous := version
+	version = "v2022.10.1"
+	viper.Set("clusterName", "prod us1")
+	defer func() {
+		version = previous
+		viper.Set("clusterName", "")
+	}()
+	// Act
+	extra := userAgentExtra()
+	// Assert
+	autopilot.Equals(t, "kubectl-v2022.10.1 cluster/prod-us1", extra)
+}
@@ -1,72 +1,169 @@
 package cmd
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-resty/resty/v2"
+	"net/url"
 	"os"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/opslevel/kubectl-opslevel/common"
+	"github.com/opslevel/kubectl-opslevel/config"
+	"github.com/opslevel/kubectl-opslevel/k8sutils"
 	"github.com/opslevel/opslevel-go/v2022"
 	"github.com/spf13/cobra"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"golang.org/x/term"
+	yaml "gopkg.in/yaml.v3"
 
 	// https://github.com/golang/go/issues/33803
 	"go.uber.org/automaxprocs/maxprocs"
 )
 
 var (
-	apiToken     string
-	apiTokenFile string
-	apiTimeout   int
-	cfgFile      string
-	concurrency  int
-	outputFormat string
+	apiToken          string
+	apiTokenFile      string
+	apiTokenSecret    string
+	apiTokenSecretKey string
+	apiTimeout        int
+	apiTLSConfig      *tls.Config
+	cfgFile           string
+	profile           string
+	concurrency       int
+	outputFormat      string
+	quiet             bool
+	// rootContext is cancelled once the run exceeds --timeout so the commands stop starting new work and unwind
+	rootContext       = context.Background()
+	cancelRootContext = func() {}
 )
 
 var rootCmd = &cobra.Command{
 	Use:     "kubectl-opslevel",
 	Aliases: []string{"kubectl opslevel"},
 	Short:   "Opslevel Commandline Tools",
-	Long:    `Opslevel Commandline Tools`,
+	Long: `Opslevel Commandline Tools
+
+The standard kubectl connection flags such as '--kubeconfig', '--context', '--server', '--token' and '--as' are
+supported with two deviations: '--namespace' is a flag of the 'service' commands which restricts every import
+selector to the given namespaces and '--request-timeout' takes a duration which also bounds the OpsLevel API calls.
+
+` + exitCodesHelp,
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		closeAuditLog()
+	},
 }
 
 func Execute(v string) {
 	version = v
-	cobra.CheckErr(rootCmd.Execute())
+	// the wrapped exec credential plugin must neither load the config nor write anything but the credential to stdout
+	if len(os.Args) > 1 && os.Args[1] == k8sutils.ExecCredentialCommand {
+		os.Exit(k8sutils.RunExecCredential(os.Args[2:]))
+	}
+	err := rootCmd.Execute()
+	cancelRootContext()
+	if errors.Is(rootContext.Err(), context.DeadlineExceeded) {
+		exit(ExitCodeTimeout)
+	}
+	cobra.CheckErr(err)
 }
 
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "./opslevel-k8s.yaml", "")
-	rootCmd.PersistentFlags().String("log-format", "TEXT", "overrides environment variable 'OPSLEVEL_LOG_FORMAT' (options [\"JSON\", \"TEXT\"])")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "The named profile from the config file's 'profiles' section to overlay on top of the base config. Overrides environment variable 'OPSLEVEL_PROFILE'")
+	rootCmd.PersistentFlags().String("log-format", "auto", "overrides environment variable 'OPSLEVEL_LOG_FORMAT' (options [\"auto\", \"console\", \"json\"]) - auto uses console on a terminal and json otherwise")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Only log warnings and errors and print the final summary - the per-service info logs and progress are suppressed. Overrides environment variable 'OPSLEVEL_QUIET'")
+	rootCmd.PersistentFlags().Bool("no-color", false, "Disable colors in the console log output. Overrides environment variable 'NO_COLOR'")
+	rootCmd.PersistentFlags().BoolVar(&logAPI, "log-api", false, "Log the operation, variables, duration and truncated response of every OpsLevel API call regardless of the log level. Overrides environment variable 'OPSLEVEL_LOG_API'")
 	rootCmd.PersistentFlags().String("log-level", "INFO", "overrides environment variable 'OPSLEVEL_LOG_LEVEL' (options [\"ERROR\", \"WARN\", \"INFO\", \"DEBUG\"])")
 	rootCmd.PersistentFlags().StringVar(&apiToken, "api-token", "", "The OpsLevel API Token. Overrides environment variable 'OPSLEVEL_API_TOKEN' and the argument 'api-token-path'")
 	rootCmd.PersistentFlags().StringVar(&apiTokenFile, "api-token-path", "", "Absolute path to a file containing the OpsLevel API Token. Overrides environment variable 'OPSLEVEL_API_TOKEN'")
-	rootCmd.PersistentFlags().String("api-url", "https://api.opslevel.com/", "The OpsLevel API Url. Overrides environment variable 'OPSLEVEL_API_URL'")
+	rootCmd.PersistentFlags().StringVar(&apiTokenSecret, "api-token-secret", "", "A Kubernetes Secret in the format '<namespace>/<name>' containing the OpsLevel API Token. Overrides environment variable 'OPSLEVEL_API_TOKEN'")
+	rootCmd.PersistentFlags().StringVar(&apiTokenSecretKey, "api-token-secret-key", "OPSLEVEL_API_TOKEN", "The key in the Kubernetes Secret given by 'api-token-secret' which holds the OpsLevel API Token")
+	rootCmd.PersistentFlags().String("api-url", "https://api.opslevel.com/", "The OpsLevel API Url for self-hosted or regional instances, with or without the '/graphql' suffix. Overrides environment variable 'OPSLEVEL_API_URL'")
 	rootCmd.PersistentFlags().IntVar(&apiTimeout, "api-timeout", 40, "The OpsLevel API timeout in seconds. Overrides environment variable 'OPSLEVEL_API_TIMEOUT'")
+	rootCmd.PersistentFlags().String("api-ca-file", "", "A PEM bundle of CA certificates trusted for the OpsLevel API on top of the system roots - IE: for a TLS-inspecting proxy. HTTPS_PROXY and NO_PROXY are honored. Overrides environment variable 'OPSLEVEL_API_CA_FILE'")
+	rootCmd.PersistentFlags().String("api-client-cert", "", "A PEM client certificate presented to the OpsLevel API or proxy for mutual TLS. Requires 'api-client-key'. Overrides environment variable 'OPSLEVEL_API_CLIENT_CERT'")
+	rootCmd.PersistentFlags().String("api-client-key", "", "The PEM private key of 'api-client-cert'. Overrides environment variable 'OPSLEVEL_API_CLIENT_KEY'")
+	rootCmd.PersistentFlags().Bool("adaptive-throttle", true, "Space out the OpsLevel API calls of all workers from the rate limit headers and 429 responses of the API. Overrides environment variable 'OPSLEVEL_ADAPTIVE_THROTTLE'")
+	rootCmd.PersistentFlags().Duration("timeout", 0, "The max duration of the whole run (IE: '30m') after which the API calls in flight are cancelled and no new work is started - 0 means no limit. Overrides environment variable 'OPSLEVEL_TIMEOUT'")
+	rootCmd.PersistentFlags().Duration("request-timeout", 0, "The deadline for each Kubernetes and OpsLevel API call (IE: '30s') - 0 means no deadline for Kubernetes and 'api-timeout' for OpsLevel. Overrides environment variable 'OPSLEVEL_REQUEST_TIMEOUT'")
+	rootCmd.PersistentFlags().String("audit-log", "", "Append one json line per OpsLevel mutation (timestamp, service alias, operation, input, outcome) to this file. Overrides environment variable 'OPSLEVEL_AUDIT_LOG'")
 	rootCmd.PersistentFlags().IntP("workers", "w", -1, "Sets the number of workers for API call processing. -1 == # CPU cores (cgroup aware). Overrides environment variable 'OPSLEVEL_WORKERS'")
-	rootCmd.PersistentFlags().StringP("output", "o", "text", "Output format.  One of: json|text")
+	rootCmd.PersistentFlags().StringP("output", "o", "text", "Output format.  One of: json|text|yaml|table")
+	rootCmd.PersistentFlags().Int64("k8s-page-size", 500, "The max amount of resources requested per Kubernetes list call. 0 disables paging. Overrides environment variable 'OPSLEVEL_K8S_PAGE_SIZE'")
+	rootCmd.PersistentFlags().Float32("k8s-qps", 0, "The sustained Kubernetes API calls per second allowed by the client. 0 uses the client-go default of 5 and a negative value disables client side throttling. Overrides environment variable 'OPSLEVEL_K8S_QPS'")
+	rootCmd.PersistentFlags().Int("k8s-burst", 0, "The Kubernetes API calls allowed in a burst above 'k8s-qps'. 0 uses the client-go default of 10. Overrides environment variable 'OPSLEVEL_K8S_BURST'")
+	rootCmd.PersistentFlags().Bool("k8s-protobuf", true, "Request the built-in Kubernetes types as protobuf instead of json to speed up listing large clusters - set it to false to keep the fields unknown to the bundled client-go. Overrides environment variable 'OPSLEVEL_K8S_PROTOBUF'")
+	rootCmd.PersistentFlags().Bool("k8s-consistent-snapshot", true, "List every kind at the resourceVersion of the first list so resources are joined as seen at one point in time - set it to false to have the lists served from the watch cache of the API server. Overrides environment variable 'OPSLEVEL_K8S_CONSISTENT_SNAPSHOT'")
+	rootCmd.PersistentFlags().Duration("k8s-exec-timeout", 30*time.Second, "How long the exec credential plugin of the kubeconfig (IE: 'aws eks get-token' or 'gke-gcloud-auth-plugin') may take to return a token - 0 never times out. Overrides environment variable 'OPSLEVEL_K8S_EXEC_TIMEOUT'")
+	rootCmd.PersistentFlags().Duration("cache-ttl", 15*time.Minute, "How long the tiers, lifecycles and teams fetched from each account are reused by later runs - 0 disables the cache. Overrides environment variable 'OPSLEVEL_CACHE_TTL'")
+	rootCmd.PersistentFlags().String("cache-dir", "", "The directory the account cache is persisted in - defaults to the user cache directory. Overrides environment variable 'OPSLEVEL_CACHE_DIR'")
+	rootCmd.PersistentFlags().String("cluster-name", "", "The cluster name exposed to JQ expressions as $cluster. Detected from the kubeconfig context when not set. Overrides environment variable 'OPSLEVEL_CLUSTER_NAME'")
 
 	viper.BindPFlags(rootCmd.PersistentFlags())
+	// the kubectl flags are read by client-go directly and kept out of viper so they never shadow config keys
+	kubectlFlags := pflag.NewFlagSet("kubectl", pflag.ExitOnError)
+	k8sutils.BindKubectlFlags(kubectlFlags)
+	rootCmd.PersistentFlags().AddFlagSet(kubectlFlags)
+	viper.BindPFlag("clusterName", rootCmd.PersistentFlags().Lookup("cluster-name"))
 	viper.BindEnv("log-format", "OPSLEVEL_LOG_FORMAT", "OL_LOG_FORMAT", "OL_LOGFORMAT")
 	viper.BindEnv("log-level", "OPSLEVEL_LOG_LEVEL", "OL_LOG_LEVEL", "OL_LOGLEVEL")
+	viper.BindEnv("no-color", "NO_COLOR", "OPSLEVEL_NO_COLOR")
+	viper.BindEnv("quiet", "OPSLEVEL_QUIET")
+	viper.BindEnv("log-api", "OPSLEVEL_LOG_API")
 	viper.BindEnv("api-url", "OPSLEVEL_API_URL", "OL_API_URL", "OL_APIURL", "OPSLEVEL_APP_URL", "OL_APP_URL")
 	viper.BindEnv("api-token", "OPSLEVEL_API_TOKEN", "OL_API_TOKEN", "OL_APITOKEN")
 	viper.BindEnv("api-timeout", "OPSLEVEL_API_TIMEOUT")
+	viper.BindEnv("api-ca-file", "OPSLEVEL_API_CA_FILE")
+	viper.BindEnv("api-client-cert", "OPSLEVEL_API_CLIENT_CERT")
+	viper.BindEnv("api-client-key", "OPSLEVEL_API_CLIENT_KEY")
+	viper.BindEnv("adaptive-throttle", "OPSLEVEL_ADAPTIVE_THROTTLE")
+	viper.BindEnv("timeout", "OPSLEVEL_TIMEOUT")
+	viper.BindEnv("request-timeout", "OPSLEVEL_REQUEST_TIMEOUT")
+	viper.BindEnv("audit-log", "OPSLEVEL_AUDIT_LOG")
 	viper.BindEnv("workers", "OPSLEVEL_WORKERS", "OL_WORKERS")
+	viper.BindEnv("profile", "OPSLEVEL_PROFILE", "OL_PROFILE")
+	viper.BindEnv("k8s-page-size", "OPSLEVEL_K8S_PAGE_SIZE")
+	viper.BindEnv("k8s-qps", "OPSLEVEL_K8S_QPS")
+	viper.BindEnv("k8s-burst", "OPSLEVEL_K8S_BURST")
+	viper.BindEnv("k8s-protobuf", "OPSLEVEL_K8S_PROTOBUF")
+	viper.BindEnv("k8s-consistent-snapshot", "OPSLEVEL_K8S_CONSISTENT_SNAPSHOT")
+	viper.BindEnv("k8s-exec-timeout", "OPSLEVEL_K8S_EXEC_TIMEOUT")
+	viper.BindEnv("k8s-proxy-url", "OPSLEVEL_K8S_PROXY_URL")
+	viper.BindEnv("cache-ttl", "OPSLEVEL_CACHE_TTL")
+	viper.BindEnv("cache-dir", "OPSLEVEL_CACHE_DIR")
+	viper.BindEnv("clusterName", "OPSLEVEL_CLUSTER_NAME", "OL_CLUSTER_NAME")
 	cobra.OnInitialize(initConfig)
 }
 
 func initConfig() {
 	readConfig()
+	setupProfile()
 	setupLogging()
+	setupAPIURL()
+	setupAPITLS()
 	setupOutput()
 	setupConcurrency()
+	setupKubernetes()
+	setupTimeouts()
+	setupAuditLog()
 	setupAPIToken()
+	setupCache()
 }
 
 func readConfig() {
@@ -92,34 +189,115 @@ func readConfig() {
 	viper.ReadInConfig()
 }
 
+// setupProfile overlays the selected named profile on top of the base config so
+// that any key set in the profile (selectors, clusterName, api-url, etc.) wins
+func setupProfile() {
+	name := viper.GetString("profile")
+	if name == "" {
+		return
+	}
+	key := fmt.Sprintf("profiles.%s", name)
+	if !viper.IsSet(key) {
+		checkErr(fmt.Errorf("profile '%s' not found in config file - available profiles: [%s]", name, strings.Join(listProfiles(), ", ")), ExitCodeConfig)
+	}
+	checkErr(viper.MergeConfigMap(viper.GetStringMap(key)), ExitCodeConfig)
+}
+
+func listProfiles() []string {
+	var output []string
+	for name := range viper.GetStringMap("profiles") {
+		output = append(output, name)
+	}
+	sort.Strings(output)
+	return output
+}
+
 func setupLogging() {
 	logFormat := strings.ToLower(viper.GetString("log-format"))
 	logLevel := strings.ToLower(viper.GetString("log-level"))
 
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 
-	if logFormat == "text" {
-		output := zerolog.ConsoleWriter{Out: os.Stderr}
-		log.Logger = log.Output(output)
+	isTTY := term.IsTerminal(int(os.Stderr.Fd()))
+	if logFormat == "auto" || logFormat == "" {
+		logFormat = "json"
+		if isTTY {
+			logFormat = "console"
+		}
+	}
+	switch logFormat {
+	case "console", "text":
+		log.Logger = log.Output(zerolog.ConsoleWriter{
+			Out:        os.Stderr,
+			NoColor:    !isTTY || noColor(),
+			TimeFormat: time.Kitchen,
+		})
+	case "json":
+		log.Logger = zerolog.New(os.Stderr).With().Timestamp().Logger()
+	default:
+		checkErr(fmt.Errorf("invalid log format '%s' - must be one of [auto, console, json]", logFormat), ExitCodeConfig)
 	}
 
-	switch {
-	case logLevel == "error":
-		zerolog.SetGlobalLevel(zerolog.ErrorLevel)
-	case logLevel == "warn":
-		zerolog.SetGlobalLevel(zerolog.WarnLevel)
-	case logLevel == "debug":
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
-	case logLevel == "trace":
+	level := zerolog.InfoLevel
+	switch logLevel {
+	case "error":
+		level = zerolog.ErrorLevel
+	case "warn":
+		level = zerolog.WarnLevel
+	case "debug":
+		level = zerolog.DebugLevel
+	case "trace":
+		level = zerolog.TraceLevel
+	}
+	quiet = viper.GetBool("quiet")
+	if quiet && level < zerolog.WarnLevel {
+		level = zerolog.WarnLevel
+	}
+	// the logger keeps the chosen level while '--log-api' lets its own trace logs through the global level
+	log.Logger = log.Logger.Level(level)
+	zerolog.SetGlobalLevel(level)
+	logAPI = viper.GetBool("log-api")
+	if logAPI {
 		zerolog.SetGlobalLevel(zerolog.TraceLevel)
-	default:
-		zerolog.SetGlobalLevel(zerolog.InfoLevel)
 	}
 }
 
+// noColor follows https://no-color.org where any non empty NO_COLOR value disables colors
+func noColor() bool {
+	value := viper.GetString("no-color")
+	return value != "" && value != "false"
+}
+
+func setupAPIURL() {
+	const key = "api-url"
+
+	url, err := normalizeAPIURL(viper.GetString(key))
+	checkErr(err, ExitCodeConfig)
+	viper.Set(key, url)
+}
+
+func setupAPITLS() {
+	var err error
+	apiTLSConfig, err = loadAPITLSConfig(viper.GetString("api-ca-file"), viper.GetString("api-client-cert"), viper.GetString("api-client-key"))
+	checkErr(err, ExitCodeConfig)
+	common.SetHTTPTLSConfig(apiTLSConfig)
+}
+
+// normalizeAPIURL validates the API url and strips the '/graphql' suffix which the OpsLevel client appends itself
+func normalizeAPIURL(value string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(value))
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return "", fmt.Errorf("invalid api url '%s' - expected format 'https://<host>[/<path>]'", value)
+	}
+	parsed.Path = strings.TrimSuffix(strings.TrimRight(parsed.Path, "/"), "/graphql")
+	return parsed.String(), nil
+}
+
 func setupOutput() {
-	outputFormat := strings.ToLower(viper.GetString("output"))
-	if outputFormat != "json" {
+	outputFormat = strings.ToLower(viper.GetString("output"))
+	switch outputFormat {
+	case "json", "yaml", "table":
+	default:
 		outputFormat = "text"
 	}
 }
@@ -128,6 +306,73 @@ func IsTextOutput() bool {
 	return outputFormat == "text"
 }
 
+// printStructured prints the data as yaml when requested by '--output' otherwise as indented json
+func printStructured(data interface{}) error {
+	output, err := marshalStructured(data, outputFormat == "yaml")
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(output))
+	return nil
+}
+
+func marshalStructured(data interface{}, asYAML bool) ([]byte, error) {
+	prettyJSON, err := json.MarshalIndent(data, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	if !asYAML {
+		return append(prettyJSON, '\n'), nil
+	}
+	// Round trip through json so the yaml keys match the json output
+	var generic interface{}
+	if err := json.Unmarshal(prettyJSON, &generic); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(generic)
+}
+
+func setupKubernetes() {
+	k8sutils.ListPageSize = viper.GetInt64("k8s-page-size")
+	k8sutils.ClientQPS = float32(viper.GetFloat64("k8s-qps"))
+	k8sutils.ClientBurst = viper.GetInt("k8s-burst")
+	k8sutils.UseProtobuf = viper.GetBool("k8s-protobuf")
+	k8sutils.ConsistentSnapshot = viper.GetBool("k8s-consistent-snapshot")
+	k8sutils.ProxyURL = viper.GetString("k8s-proxy-url")
+	k8sutils.ExecTimeout = viper.GetDuration("k8s-exec-timeout")
+}
+
+// setupTimeouts applies the per call deadline to both API clients and cancels the root context once the run exceeds
+// --timeout which aborts the API calls in flight
+func setupTimeouts() {
+	if requestTimeout := viper.GetDuration("request-timeout"); requestTimeout > 0 {
+		k8sutils.RequestTimeout = requestTimeout
+		apiTimeout = int(requestTimeout.Round(time.Second).Seconds())
+		if apiTimeout < 1 {
+			apiTimeout = 1
+		}
+	}
+	if timeout := viper.GetDuration("timeout"); timeout > 0 {
+		rootContext, cancelRootContext = context.WithTimeout(context.Background(), timeout)
+		k8sutils.Context = rootContext
+	}
+}
+
+func setupAuditLog() {
+	common.RunId = runId
+	log.Debug().Msgf("OpsLevel API calls are tagged with run id '%s'", runId)
+	if path := viper.GetString("audit-log"); path != "" {
+		checkErr(common.OpenAuditLog(path), ExitCodeConfig)
+	}
+}
+
+// closeAuditLog runs after every command and before every early exit so the audit log is not left open
+func closeAuditLog() {
+	if err := common.CloseAuditLog(); err != nil {
+		log.Warn().Msgf("Unable to close the audit log\n\tREASON: %v", err)
+	}
+}
+
 func setupConcurrency() {
 	maxprocs.Set(maxprocs.Logger(log.Debug().Msgf))
 
@@ -137,12 +382,15 @@ func setupConcurrency() {
 	}
 }
 
+var apiTokenLastRefresh time.Time
+
 // setupAPIToken evaluates several API token sources and sets the preferred token based on precedence.
 //
 // Precedence:
 //   1. --api-token
 //   2. --api-token-path
-//   3. OL_APITOKEN
+//   3. --api-token-secret
+//   4. OL_APITOKEN
 //
 func setupAPIToken() {
 	const key = "api-token"
@@ -152,30 +400,230 @@ func setupAPIToken() {
 		return
 	}
 
-	if apiTokenFile == "" {
-		return
+	token, err := readAPIToken()
+	checkErrOr(err, ExitCodeConfig)
+	apiTokenLastRefresh = time.Now()
+	if token == "" {
+		// pinned since opslevel-go hands the token to its clients through the same environment variable
+		token = viper.GetString(key)
 	}
+	viper.Set(key, token)
+}
 
-	b, err := os.ReadFile(apiTokenFile)
-	if err != nil {
-		cobra.CheckErr(fmt.Errorf("failed to read provided api token file %s: %v", apiTokenFile, err))
+// setupCache persists the account lookup tables per OpsLevel instance and token so runs against
+// different instances never share them
+func setupCache() {
+	common.CacheTTL = viper.GetDuration("cache-ttl")
+	common.CacheDirectory = viper.GetString("cache-dir")
+	if common.CacheDirectory == "" {
+		if dir, err := os.UserCacheDir(); err == nil {
+			common.CacheDirectory = filepath.Join(dir, "kubectl-opslevel")
+		}
 	}
+	sum := sha256.Sum256([]byte(viper.GetString("api-url") + "\n" + viper.GetString("api-token")))
+	common.CacheNamespace = hex.EncodeToString(sum[:])
+}
 
-	token := strings.TrimSpace(string(b))
-	viper.Set(key, token)
+// readAPIToken returns the token found in --api-token-path or --api-token-secret or an empty string if neither is set
+func readAPIToken() (string, error) {
+	if apiTokenFile != "" {
+		b, err := os.ReadFile(apiTokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read provided api token file %s: %v", apiTokenFile, err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+
+	if apiTokenSecret != "" {
+		parts := strings.SplitN(apiTokenSecret, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return "", fmt.Errorf("invalid api token secret '%s' - expected format '<namespace>/<name>'", apiTokenSecret)
+		}
+		k8sClient, err := k8sutils.NewKubernetesClient()
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", common.ErrKubernetesAccess, err)
+		}
+		value, err := k8sClient.GetSecretValue(parts[0], parts[1], apiTokenSecretKey)
+		if err != nil {
+			return "", fmt.Errorf("%w: failed to read provided api token secret %s: %v", common.ErrKubernetesAccess, apiTokenSecret, err)
+		}
+		return strings.TrimSpace(value), nil
+	}
+
+	return "", nil
+}
+
+// refreshAPIToken re-reads the api tokens from their files or secret at most once per interval
+// and returns true when a token was rotated so long running commands can recreate their clients
+func refreshAPIToken(interval time.Duration, c *config.Config) bool {
+	const key = "api-token"
+
+	if interval <= 0 || time.Since(apiTokenLastRefresh) < interval {
+		return false
+	}
+	apiTokenLastRefresh = time.Now()
+	rotated := false
+	if apiToken == "" {
+		token, err := readAPIToken()
+		if err != nil {
+			log.Warn().Msgf("Unable to refresh api token: %v", err)
+		} else if token != "" && token != viper.GetString(key) {
+			viper.Set(key, token)
+			rotated = true
+		}
+	}
+	for _, account := range c.Accounts {
+		if account.APIToken != "" || account.APITokenPath == "" {
+			continue
+		}
+		token, err := readAccountAPIToken(account)
+		if err != nil {
+			log.Warn().Msgf("Unable to refresh api token: %v", err)
+			continue
+		}
+		accountTokensMutex.Lock()
+		if token != "" && token != accountTokens[account.Name] {
+			rotated = true
+		}
+		accountTokensMutex.Unlock()
+	}
+	if rotated {
+		log.Info().Msg("Detected a rotated api token ... recreating OpsLevel clients")
+	}
+	return rotated
+}
+
+var (
+	accountTokensMutex sync.Mutex
+	// accountTokens are the tokens read from the 'apiTokenPath' of the accounts keyed by account name
+	accountTokens = map[string]string{}
+)
+
+// readAccountAPIToken returns the token of the account from its 'apiTokenPath' or an empty string if it is not set
+func readAccountAPIToken(account config.Account) (string, error) {
+	if account.APITokenPath == "" {
+		return "", nil
+	}
+	b, err := os.ReadFile(account.APITokenPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read api token file %s for account '%s': %v", account.APITokenPath, account.Name, err)
+	}
+	return strings.TrimSpace(string(b)), nil
 }
 
 func createOpslevelClient() *opslevel.Client {
-	client := opslevel.NewGQLClient(
-		opslevel.SetAPIToken(viper.GetString("api-token")),
-		opslevel.SetURL(viper.GetString("api-url")),
-		opslevel.SetUserAgentExtra(fmt.Sprintf("kubectl-%s", version)),
+	return newOpslevelClient(viper.GetString("api-token"), viper.GetString("api-url"))
+}
+
+func createOpslevelClientForAccount(account config.Account) *opslevel.Client {
+	token := account.APIToken
+	if token == "" {
+		var err error
+		token, err = readAccountAPIToken(account)
+		checkErr(err, ExitCodeConfig)
+		accountTokensMutex.Lock()
+		accountTokens[account.Name] = token
+		accountTokensMutex.Unlock()
+	}
+	apiURL := viper.GetString("api-url")
+	if account.APIURL != "" {
+		var err error
+		apiURL, err = normalizeAPIURL(account.APIURL)
+		checkErr(err, ExitCodeConfig)
+	}
+	return newOpslevelClient(token, apiURL)
+}
+
+// createOpslevelClients returns a client for every account referenced by the import config keyed by account name
+// the default account (configured via --api-token) uses the empty string as its key
+func createOpslevelClients(c *config.Config) map[string]*opslevel.Client {
+	clients := map[string]*opslevel.Client{}
+	var names []string
+	for _, importConfig := range c.Service.Import {
+		names = append(names, importConfig.Account)
+	}
+	for _, importConfig := range c.Infra.Import {
+		names = append(names, importConfig.Account)
+	}
+	if c.Infra.Cluster.Enabled {
+		names = append(names, c.Infra.Cluster.Account)
+	}
+	for _, name := range names {
+		if _, ok := clients[name]; ok {
+			continue
+		}
+		if name == "" {
+			clients[name] = createOpslevelClient()
+			continue
+		}
+		account, err := c.GetAccount(name)
+		checkErr(err, ExitCodeConfig)
+		clients[name] = createOpslevelClientForAccount(*account)
+	}
+	return clients
+}
+
+func newOpslevelClient(token string, apiURL string) *opslevel.Client {
+	client, err := buildOpslevelClient(token, apiURL)
+	checkErr(err, ExitCodeAuth)
+	return client
+}
+
+func buildOpslevelClient(token string, apiURL string) (*opslevel.Client, error) {
+	client := newGQLClient(token,
+		opslevel.SetURL(apiURL),
+		opslevel.SetUserAgentExtra(userAgentExtra()),
 		opslevel.SetTimeout(time.Second*time.Duration(apiTimeout)),
 	)
-	cobra.CheckErr(client.Validate())
-	return client
+	if apiTLSConfig != nil {
+		if err := configureOpslevelTLS(client, apiTLSConfig); err != nil {
+			return nil, err
+		}
+	}
+	if viper.GetBool("adaptive-throttle") {
+		if err := wrapOpslevelTransport(client, newThrottleTransport); err != nil {
+			log.Warn().Msgf("Unable to enable adaptive throttling\n\tREASON: %v", err)
+		}
+	}
+	if logAPI {
+		if err := wrapOpslevelTransport(client, newAPILogTransport); err != nil {
+			log.Warn().Msgf("Unable to enable API logging\n\tREASON: %v", err)
+		}
+	}
+	if err := wrapOpslevelTransport(client, newRequestIdTransport); err != nil {
+		log.Warn().Msgf("Unable to tag API calls with request ids\n\tREASON: %v", err)
+	}
+	if err := wrapOpslevelTransport(client, newAbortTransport); err != nil {
+		log.Warn().Msgf("Unable to abort the API calls on --timeout\n\tREASON: %v", err)
+	}
+	return client, client.Validate()
+}
+
+var gqlClientMutex sync.Mutex
+
+// newGQLClient builds a client with the token without leaking it to the clients built later - opslevel-go reads the
+// token from the environment variable 'OPSLEVEL_API_TOKEN' which also resolves the default account's token
+func newGQLClient(token string, options ...opslevel.Option) *opslevel.Client {
+	const env = "OPSLEVEL_API_TOKEN"
+	gqlClientMutex.Lock()
+	defer gqlClientMutex.Unlock()
+	previous, wasSet := os.LookupEnv(env)
+	os.Setenv(env, token)
+	defer func() {
+		if wasSet {
+			os.Setenv(env, previous)
+		} else {
+			os.Unsetenv(env)
+		}
+	}()
+	return opslevel.NewGQLClient(options...)
 }
 
 func createRestClient() *resty.Client {
-	return opslevel.NewRestClient(opslevel.SetURL(viper.GetString("api-url")))
+	client := opslevel.NewRestClient(opslevel.SetURL(viper.GetString("api-url")), opslevel.SetUserAgentExtra(userAgentExtra()))
+	tagRestRequests(client)
+	if apiTLSConfig != nil {
+		client.SetTLSClientConfig(apiTLSConfig)
+	}
+	return client
 }
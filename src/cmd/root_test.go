@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opslevel/kubectl-opslevel/config"
+	"github.com/rocktavious/autopilot"
+	"github.com/spf13/viper"
+)
+
+func Test_CreateOpslevelClient_KeepsTheDefaultTokenAfterAnAccountClient(t *testing.T) {
+	// Arrange
+	var mutex sync.Mutex
+	var tokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		tokens = append(tokens, r.Header.Get("Authorization"))
+		mutex.Unlock()
+		w.Write([]byte(`{"data": {"account": {"id": "1"}}}`))
+	}))
+	defer server.Close()
+	t.Setenv("OPSLEVEL_API_TOKEN", "default-token")
+	viper.Set("api-url", server.URL)
+	defer viper.Set("api-url", "")
+	setupAPIToken()
+	defer viper.Set("api-token", "")
+	// Act
+	createOpslevelClientForAccount(config.Account{Name: "payments", APIToken: "payments-token"})
+	createOpslevelClient()
+	// Assert
+	autopilot.Equals(t, []string{"Bearer payments-token", "Bearer default-token"}, tokens)
+	autopilot.Equals(t, "default-token", viper.GetString("api-token"))
+}
+
+func Test_RefreshAPIToken_DetectsRotatedAccountTokens(t *testing.T) {
+	// Arrange
+	path := t.TempDir() + "/payments-token"
+	autopilot.Ok(t, os.WriteFile(path, []byte("rotated-token\n"), 0o600))
+	c := &config.Config{Accounts: []config.Account{{Name: "payments", APITokenPath: path}}}
+	apiToken = "default-token"
+	apiTokenLastRefresh = time.Time{}
+	accountTokens["payments"] = "payments-token"
+	defer func() {
+		apiToken = ""
+		apiTokenLastRefresh = time.Time{}
+		delete(accountTokens, "payments")
+	}()
+	// Act
+	disabled := refreshAPIToken(0, c)
+	rotated := refreshAPIToken(time.Minute, c)
+	throttled := refreshAPIToken(time.Minute, c)
+	// Assert
+	autopilot.Equals(t, false, disabled)
+	autopilot.Equals(t, true, rotated)
+	autopilot.Equals(t, false, throttled)
+}
+
+func Test_RootFlags_KeepTheKubectlFlagsOutOfViper(t *testing.T) {
+	// Arrange
+	keys := map[string]bool{}
+	// Act
+	for _, key := range viper.AllKeys() {
+		keys[key] = true
+	}
+	// Assert
+	autopilot.Assert(t, rootCmd.PersistentFlags().Lookup("server") != nil, "expected the kubectl '--server' flag")
+	autopilot.Assert(t, rootCmd.PersistentFlags().Lookup("kubeconfig") != nil, "expected the kubectl '--kubeconfig' flag")
+	autopilot.Equals(t, false, keys["server"])
+	autopilot.Equals(t, false, keys["token"])
+	autopilot.Equals(t, false, keys["kubeconfig"])
+	autopilot.Equals(t, true, keys["api-token"])
+}
@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"github.com/opslevel/opslevel-go/v2022"
+)
+
+// getSchemaMutations introspects the mutations the OpsLevel API schema exposes
+func getSchemaMutations(client *opslevel.Client) (map[string]bool, error) {
+	var q struct {
+		Schema struct {
+			MutationType *struct {
+				Fields []struct {
+					Name string
+				}
+			}
+		} `graphql:"__schema"`
+	}
+	if err := client.Query(&q, nil); err != nil {
+		return nil, err
+	}
+	output := map[string]bool{}
+	if q.Schema.MutationType != nil {
+		for _, field := range q.Schema.MutationType.Fields {
+			output[field.Name] = true
+		}
+	}
+	return output, nil
+}
@@ -1,9 +1,20 @@
 package cmd
 
 import (
+	"strings"
+
+	"github.com/opslevel/kubectl-opslevel/common"
+	"github.com/opslevel/kubectl-opslevel/config"
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
 
+var (
+	serviceLabelSelector string
+	serviceNamespaces    []string
+	serviceKinds         []string
+)
+
 var serviceCmd = &cobra.Command{
 	Use:   "service",
 	Short: "Commands for interacting with the service API",
@@ -12,4 +23,64 @@ var serviceCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(serviceCmd)
+
+	serviceCmd.PersistentFlags().StringSliceVarP(&serviceNamespaces, "namespace", "n", nil, "Comma separated list of namespaces to restrict every import selector to (IE: 'payments,checkout')")
+	serviceCmd.PersistentFlags().StringVarP(&serviceLabelSelector, "selector", "l", "", "Kubernetes label selector (IE: 'team=payments,tier!=cache') sent to the API server and AND'ed with each import selector's 'labelSelector'")
+	serviceCmd.PersistentFlags().StringSliceVar(&serviceKinds, "kind", nil, "Comma separated list of kinds to restrict the import selectors to (IE: 'Deployment,StatefulSet')")
+
+	serviceCmd.RegisterFlagCompletionFunc("namespace", completeNamespaces)
+	serviceCmd.RegisterFlagCompletionFunc("kind", completeKinds)
+}
+
+// addResourceSourceFlags registers '--record', '--from-recording' and '-f' on the commands that list the kubernetes
+// resources once - 'reconcile' watches the live cluster and has none of them
+func addResourceSourceFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&common.RecordDirectory, "record", "", "Dump the raw kubernetes resources listed by every selector into this directory for later use with '--from-recording'")
+	cmd.Flags().StringVar(&common.ReplayDirectory, "from-recording", "", "Read the kubernetes resources from a directory made with '--record' instead of the live cluster - the namespace and label filters are not re-applied")
+	cmd.Flags().StringSliceVarP(&common.InputFiles, "filename", "f", nil, "Read the kubernetes resources from 'kubectl get -o json|yaml' output in these files instead of the live cluster - '-' reads stdin")
+}
+
+// newServiceConfig loads the config and narrows every import selector with the runtime filters given on the commandline
+func newServiceConfig() (*config.Config, error) {
+	c, err := config.New()
+	if err != nil {
+		return c, err
+	}
+	var imports []config.Import
+	for _, importConfig := range c.Service.Import {
+		if !containsKind(serviceKinds, importConfig.SelectorConfig.Kind) {
+			log.Debug().Msgf("Skipping selector '%s/%s' because it is not one of the kinds %v", importConfig.SelectorConfig.ApiVersion, importConfig.SelectorConfig.Kind, serviceKinds)
+			continue
+		}
+		if !importConfig.SelectorConfig.RestrictNamespaces(serviceNamespaces) {
+			log.Debug().Msgf("Skipping selector '%s/%s' because it does not include any of the namespaces %v", importConfig.SelectorConfig.ApiVersion, importConfig.SelectorConfig.Kind, serviceNamespaces)
+			continue
+		}
+		importConfig.SelectorConfig.AddLabelSelector(serviceLabelSelector)
+		imports = append(imports, importConfig)
+	}
+	c.Service.Import = imports
+	return c, nil
+}
+
+func containsKind(kinds []string, kind string) bool {
+	if len(kinds) == 0 {
+		return true
+	}
+	for _, item := range kinds {
+		if strings.EqualFold(item, kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// setReconcileConfig applies the config sections ReconcileService reads so 'service import' and 'service reconcile'
+// reconcile the same features
+func setReconcileConfig(c *config.Config) {
+	common.SetSystems(c.Systems)
+	common.SetDomains(c.Domains)
+	common.SetChecks(c.Checks)
+	common.SetTeams(c.Teams)
+	common.SetDocs(c.Docs)
 }
@@ -0,0 +1,18 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/rocktavious/autopilot"
+)
+
+func Test_ResourceSourceFlags_AreOnlyOnTheCommandsHonouringThem(t *testing.T) {
+	// Act
+	importFlag := importCmd.Flags().Lookup("from-recording")
+	reconcileFlag := reconcileCmd.InheritedFlags().Lookup("from-recording")
+	reconcileShorthand := reconcileCmd.InheritedFlags().ShorthandLookup("f")
+	// Assert
+	autopilot.Assert(t, importFlag != nil, "expected 'service import' to have '--from-recording'")
+	autopilot.Assert(t, reconcileFlag == nil, "expected 'service reconcile' to not have '--from-recording'")
+	autopilot.Assert(t, reconcileShorthand == nil, "expected 'service reconcile' to not have '-f'")
+}
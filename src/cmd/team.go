@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"github.com/opslevel/kubectl-opslevel/common"
+	"github.com/opslevel/kubectl-opslevel/config"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var teamRootCmd = &cobra.Command{
+	Use:   "team",
+	Short: "Commands for interacting with the team API",
+	Long:  `Commands for interacting with the team API`,
+}
+
+var teamSyncMembersCmd = &cobra.Command{
+	Use:   "sync-members",
+	Short: "Reconcile team membership in OpsLevel with the RBAC RoleBindings",
+	Long: `This command will read the RoleBindings in every namespace annotated with an owning team (see 'teams.annotations.alias')
+and the ClusterRoleBindings annotated with an owning team, then add the bound users to the team in OpsLevel by email.
+
+Only User subjects whose name is an email address are synced. Use 'teams.members.roles' to only consider bindings
+to some roles and 'teams.members.remove' to also remove the members that are no longer bound. The members to remove
+are listed and only removed after you confirm - use '--yes' to skip the prompt in automation.`,
+	Run: runTeamSyncMembers,
+}
+
+func init() {
+	rootCmd.AddCommand(teamRootCmd)
+	teamRootCmd.AddCommand(teamSyncMembersCmd)
+
+	teamSyncMembersCmd.Flags().BoolVar(&common.DryRun, "dry-run", false, "Perform all lookups but only log the membership changes that would be sent to OpsLevel")
+	addConfirmationFlags(teamSyncMembersCmd)
+	teamSyncMembersCmd.Flags().StringSliceVarP(&common.InputFiles, "filename", "f", nil, "Read the kubernetes resources from 'kubectl get -o json|yaml' output in these files instead of the live cluster - '-' reads stdin")
+}
+
+func runTeamSyncMembers(cmd *cobra.Command, args []string) {
+	c, err := config.New()
+	checkErr(err, ExitCodeConfig)
+	memberships, err := common.GetTeamMemberships(c)
+	checkErrOr(err, ExitCodeConfig)
+	if len(memberships) == 0 {
+		log.Info().Msg("No namespaces or ClusterRoleBindings annotated with an owning team - there are no members to sync")
+		return
+	}
+	client := createOpslevelClient()
+	deferRemovals()
+	var results []common.ServiceResult
+	for _, membership := range memberships {
+		results = append(results, common.ReconcileTeamMembers(client, membership, c.Teams.Members.Remove))
+	}
+	removalsFailed := confirmRemovals()
+	summary := common.SummarizeResults(results)
+	log.Info().Msgf("Synced the members of %d teams - %d updated, %d unchanged, %d failed", summary.Total, summary.Updated, summary.Unchanged, summary.Failed)
+	if code := resultsExitCode(summary); code != ExitCodeOK || removalsFailed == 0 {
+		exit(code)
+	}
+	exit(ExitCodePartialFailure)
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// throttleRemainingRatio is the share of the rate limit window left below which calls are spaced out
+	throttleRemainingRatio = 0.2
+	throttleMinPause       = time.Second
+	throttleMaxPause       = time.Minute
+)
+
+var (
+	rateLimitRemainingHeaders = []string{"RateLimit-Remaining", "X-RateLimit-Remaining"}
+	rateLimitLimitHeaders     = []string{"RateLimit-Limit", "X-RateLimit-Limit"}
+	rateLimitResetHeaders     = []string{"RateLimit-Reset", "X-RateLimit-Reset"}
+)
+
+// apiThrottle is shared by the clients of every account since they count against the same limit when the token is shared
+type apiThrottle struct {
+	mutex    sync.Mutex
+	next     time.Time
+	interval time.Duration
+	pause    time.Duration
+}
+
+var sharedThrottle = &apiThrottle{}
+
+// reserve returns when the next call may be sent and books the slot after it
+func (t *apiThrottle) reserve(now time.Time) time.Time {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	start := now
+	if t.next.After(start) {
+		start = t.next
+	}
+	t.next = start.Add(t.interval)
+	return start
+}
+
+// observe adjusts the spacing between calls from the rate limit headers of the response
+func (t *apiThrottle) observe(resp *http.Response, now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		pause, ok := retryAfter(resp.Header.Get("Retry-After"), now)
+		if !ok {
+			// without a hint back off exponentially until a call succeeds
+			pause = t.pause * 2
+			if pause < throttleMinPause {
+				pause = throttleMinPause
+			}
+		}
+		if pause > throttleMaxPause {
+			pause = throttleMaxPause
+		}
+		t.pause = pause
+		if until := now.Add(pause); until.After(t.next) {
+			t.next = until
+		}
+		log.Warn().Msgf("OpsLevel API rate limit reached ... pausing API calls for %s", pause)
+		return
+	}
+	t.pause = 0
+	remaining, hasRemaining := headerInt(resp.Header, rateLimitRemainingHeaders)
+	reset, hasReset := headerInt(resp.Header, rateLimitResetHeaders)
+	if !hasRemaining || !hasReset {
+		return
+	}
+	window := resetDuration(reset, now)
+	interval := time.Duration(0)
+	if remaining <= 0 {
+		if until := now.Add(window); until.After(t.next) {
+			t.next = until
+		}
+	} else if limit, ok := headerInt(resp.Header, rateLimitLimitHeaders); !ok || float64(remaining) < float64(limit)*throttleRemainingRatio {
+		interval = window / time.Duration(remaining)
+	}
+	if interval != t.interval {
+		log.Debug().Msgf("OpsLevel API has %d calls left for %s ... spacing API calls %s apart", remaining, window, interval)
+		t.interval = interval
+	}
+}
+
+func headerInt(header http.Header, names []string) (int64, bool) {
+	for _, name := range names {
+		if value := header.Get(name); value != "" {
+			if parsed, err := strconv.ParseInt(value, 10, 64); err == nil {
+				return parsed, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// resetDuration reads a reset header given in seconds until the window resets or as a unix timestamp
+func resetDuration(reset int64, now time.Time) time.Duration {
+	if reset > now.Unix()/2 {
+		return time.Unix(reset, 0).Sub(now)
+	}
+	return time.Duration(reset) * time.Second
+}
+
+// retryAfter reads the Retry-After header given in seconds or as an http date
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if at.Before(now) {
+			return 0, true
+		}
+		return at.Sub(now), true
+	}
+	return 0, false
+}
+
+// newThrottleTransport delays each OpsLevel API call so the workers stay just under the API rate limit
+func newThrottleTransport(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if wait := time.Until(sharedThrottle.reserve(time.Now())); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-req.Context().Done():
+				timer.Stop()
+				return nil, req.Context().Err()
+			case <-timer.C:
+			}
+		}
+		resp, err := next.RoundTrip(req)
+		if err == nil {
+			sharedThrottle.observe(resp, time.Now())
+		}
+		return resp, err
+	})
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rocktavious/autopilot"
+)
+
+func throttleResponse(status int, headers map[string]string) *http.Response {
+	resp := &http.Response{StatusCode: status, Header: http.Header{}}
+	for key, value := range headers {
+		resp.Header.Set(key, value)
+	}
+	return resp
+}
+
+func Test_RetryAfter(t *testing.T) {
+	// Arrange
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	// Act
+	seconds, secondsOk := retryAfter("30", now)
+	date, dateOk := retryAfter(now.Add(time.Minute).Format(http.TimeFormat), now)
+	past, pastOk := retryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now)
+	_, emptyOk := retryAfter("", now)
+	_, invalidOk := retryAfter("soon", now)
+	// Assert
+	autopilot.Equals(t, true, secondsOk)
+	autopilot.Equals(t, 30*time.Second, seconds)
+	autopilot.Equals(t, true, dateOk)
+	autopilot.Equals(t, time.Minute, date)
+	autopilot.Equals(t, true, pastOk)
+	autopilot.Equals(t, time.Duration(0), past)
+	autopilot.Equals(t, false, emptyOk)
+	autopilot.Equals(t, false, invalidOk)
+}
+
+func Test_ResetDuration(t *testing.T) {
+	// Arrange
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	// Act
+	relative := resetDuration(60, now)
+	absolute := resetDuration(now.Add(90*time.Second).Unix(), now)
+	// Assert
+	autopilot.Equals(t, time.Minute, relative)
+	autopilot.Equals(t, 90*time.Second, absolute)
+}
+
+func Test_ApiThrottle_SpacesCallsBelowTheRemainingRatio(t *testing.T) {
+	// Arrange
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	throttle := &apiThrottle{}
+	// Act
+	throttle.observe(throttleResponse(http.StatusOK, map[string]string{"X-RateLimit-Limit": "100", "X-RateLimit-Remaining": "50", "X-RateLimit-Reset": "60"}), now)
+	plenty := throttle.interval
+	throttle.observe(throttleResponse(http.StatusOK, map[string]string{"RateLimit-Limit": "100", "RateLimit-Remaining": "10", "RateLimit-Reset": "60"}), now)
+	first := throttle.reserve(now)
+	second := throttle.reserve(now)
+	// Assert
+	autopilot.Equals(t, time.Duration(0), plenty)
+	autopilot.Equals(t, 6*time.Second, throttle.interval)
+	autopilot.Equals(t, now, first)
+	autopilot.Equals(t, now.Add(6*time.Second), second)
+}
+
+func Test_ApiThrottle_PausesUntilTheWindowResets(t *testing.T) {
+	// Arrange
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	throttle := &apiThrottle{}
+	// Act
+	throttle.observe(throttleResponse(http.StatusOK, map[string]string{"RateLimit-Limit": "100", "RateLimit-Remaining": "0", "RateLimit-Reset": "20"}), now)
+	// Assert
+	autopilot.Equals(t, now.Add(20*time.Second), throttle.reserve(now))
+}
+
+func Test_ApiThrottle_BacksOffOnTooManyRequests(t *testing.T) {
+	// Arrange
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	throttle := &apiThrottle{}
+	var pauses []time.Duration
+	// Act
+	for i := 0; i < 8; i++ {
+		throttle.observe(throttleResponse(http.StatusTooManyRequests, nil), now)
+		pauses = append(pauses, throttle.pause)
+	}
+	throttle.observe(throttleResponse(http.StatusTooManyRequests, map[string]string{"Retry-After": "5"}), now)
+	hinted := throttle.pause
+	throttle.observe(throttleResponse(http.StatusOK, nil), now)
+	// Assert
+	autopilot.Equals(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second, time.Minute, time.Minute}, pauses)
+	autopilot.Equals(t, 5*time.Second, hinted)
+	autopilot.Equals(t, time.Duration(0), throttle.pause)
+	autopilot.Equals(t, now.Add(time.Minute), throttle.reserve(now))
+}
+
+func Test_ThrottleTransport_StopsWaitingWhenTheRequestIsCancelled(t *testing.T) {
+	// Arrange
+	previous := sharedThrottle
+	sharedThrottle = &apiThrottle{next: time.Now().Add(time.Hour)}
+	defer func() { sharedThrottle = previous }()
+	sent := false
+	transport := newThrottleTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		sent = true
+		return throttleResponse(http.StatusOK, nil), nil
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "https://app.opslevel.com/graphql", nil)
+	// Act
+	_, err := transport.RoundTrip(req)
+	// Assert
+	autopilot.Assert(t, errors.Is(err, context.Canceled), "expected the cancelled request to stop waiting but got %v", err)
+	autopilot.Equals(t, false, sent)
+}
+
+func Test_ThrottleTransport_ObservesTheResponse(t *testing.T) {
+	// Arrange
+	previous := sharedThrottle
+	sharedThrottle = &apiThrottle{}
+	defer func() { sharedThrottle = previous }()
+	transport := newThrottleTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return throttleResponse(http.StatusOK, map[string]string{"RateLimit-Limit": "100", "RateLimit-Remaining": "5", "RateLimit-Reset": "60"}), nil
+	}))
+	req, _ := http.NewRequest(http.MethodPost, "https://app.opslevel.com/graphql", nil)
+	// Act
+	_, err := transport.RoundTrip(req)
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Equals(t, 12*time.Second, sharedThrottle.interval)
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"unsafe"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/shurcooL/graphql"
+	"golang.org/x/oauth2"
+)
+
+// opslevelLayoutVersion is the opslevel-go release whose unexported client layout the transport hooks below rely on
+const opslevelLayoutVersion = "v2022.10.22"
+
+// wrapOpslevelTransport installs a middleware in front of the http transport of the opslevel client.
+// opslevel-go does not expose its http.Client so it is reached through reflection.
+func wrapOpslevelTransport(client *opslevel.Client, wrap func(http.RoundTripper) http.RoundTripper) error {
+	httpClient, err := opslevelHTTPClient(client)
+	if err != nil {
+		return err
+	}
+	transport := httpClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	httpClient.Transport = wrap(transport)
+	return nil
+}
+
+// opslevelHTTPClient reaches the http.Client of the opslevel client through the unexported graphql client
+func opslevelHTTPClient(client *opslevel.Client) (*http.Client, error) {
+	graphqlClient, err := unexportedField(reflect.ValueOf(client).Elem(), "client", reflect.TypeOf(&graphql.Client{}))
+	if err != nil {
+		return nil, err
+	}
+	if graphqlClient.IsNil() {
+		return nil, fmt.Errorf("unable to find the graphql client of the opslevel client")
+	}
+	httpClient, err := unexportedField(graphqlClient.Elem(), "httpClient", reflect.TypeOf(&http.Client{}))
+	if err != nil {
+		return nil, err
+	}
+	if httpClient.IsNil() {
+		return nil, fmt.Errorf("unable to find the http client of the opslevel client")
+	}
+	return httpClient.Interface().(*http.Client), nil
+}
+
+// configureOpslevelTLS swaps the *http.Transport at the bottom of the opslevel client's transport chain
+// (oauth2 -> user agent -> retries -> http) for a clone using the tls config which honors HTTPS_PROXY and NO_PROXY.
+// Every hop is checked so a library upgrade changing the chain fails the configuration instead of skipping the CA.
+func configureOpslevelTLS(client *opslevel.Client, tlsConfig *tls.Config) error {
+	httpClient, err := opslevelHTTPClient(client)
+	if err != nil {
+		return err
+	}
+	auth, ok := httpClient.Transport.(*oauth2.Transport)
+	if !ok {
+		return fmt.Errorf("unexpected transport %T of the opslevel client", httpClient.Transport)
+	}
+	userAgent := reflect.ValueOf(auth.Base)
+	if userAgent.Kind() != reflect.Ptr || userAgent.IsNil() {
+		return fmt.Errorf("unexpected transport %T below the oauth2 transport of the opslevel client", auth.Base)
+	}
+	underlying, err := unexportedField(userAgent.Elem(), "underlyingTransport", reflect.TypeOf((*http.RoundTripper)(nil)).Elem())
+	if err != nil {
+		return err
+	}
+	retries, ok := underlying.Interface().(*retryablehttp.RoundTripper)
+	if !ok || retries.Client == nil || retries.Client.HTTPClient == nil {
+		return fmt.Errorf("unexpected transport %T below the user agent transport of the opslevel client", underlying.Interface())
+	}
+	transport, ok := retries.Client.HTTPClient.Transport.(*http.Transport)
+	if !ok {
+		return fmt.Errorf("unexpected transport %T below the retry transport of the opslevel client", retries.Client.HTTPClient.Transport)
+	}
+	clone := transport.Clone()
+	clone.TLSClientConfig = tlsConfig
+	clone.Proxy = http.ProxyFromEnvironment
+	retries.Client.HTTPClient.Transport = clone
+	return nil
+}
+
+// unexportedField makes the unexported field of an addressable struct of opslevel-go accessible - it fails when a
+// library upgrade renamed the field or changed its type instead of silently leaving the client unconfigured
+func unexportedField(v reflect.Value, name string, fieldType reflect.Type) (reflect.Value, error) {
+	if v.Kind() != reflect.Struct || !v.CanAddr() {
+		return reflect.Value{}, fmt.Errorf("unable to read the field '%s' of %s", name, v.Type())
+	}
+	field := v.FieldByName(name)
+	if !field.IsValid() || field.Type() != fieldType {
+		return reflect.Value{}, fmt.Errorf("unable to find the field '%s %s' of %s - the layout of opslevel-go changed since %s", name, fieldType, v.Type(), opslevelLayoutVersion)
+	}
+	return reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem(), nil
+}
+
+// loadAPITLSConfig builds the tls config for the OpsLevel API from a PEM CA bundle which is trusted on top of the
+// system roots and a client certificate for mutual TLS - nil when none of them are set
+func loadAPITLSConfig(caFile string, certFile string, keyFile string) (*tls.Config, error) {
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the api ca bundle '%s': %v", caFile, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in the api ca bundle '%s'", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("both 'api-client-cert' and 'api-client-key' are required for mutual TLS")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the api client certificate '%s': %v", certFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// newAbortTransport runs the OpsLevel API calls (and their retries) under the root context so they are cancelled once
+// the run exceeds --timeout - opslevel-go sends every call without a context
+func newAbortTransport(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Context().Done() == nil {
+			req = req.WithContext(rootContext)
+		}
+		return next.RoundTrip(req)
+	})
+}
+
+// roundTripperFunc adapts a function to the http.RoundTripper interface
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/rocktavious/autopilot"
+)
+
+func writePEM(t *testing.T, name string, blockType string, data []byte) string {
+	file := filepath.Join(t.TempDir(), name)
+	autopilot.Ok(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: data}), 0o600))
+	return file
+}
+
+func writeClientCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	autopilot.Ok(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "kubectl-opslevel"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	autopilot.Ok(t, err)
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	autopilot.Ok(t, err)
+	return writePEM(t, "client.crt", "CERTIFICATE", cert), writePEM(t, "client.key", "EC PRIVATE KEY", keyBytes)
+}
+
+func Test_LoadAPITLSConfig_IsNilWithoutFiles(t *testing.T) {
+	// Act
+	tlsConfig, err := loadAPITLSConfig("", "", "")
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Assert(t, tlsConfig == nil, "expected no tls config but got %v", tlsConfig)
+}
+
+func Test_LoadAPITLSConfig_LoadsTheCABundleAndClientCertificate(t *testing.T) {
+	// Arrange
+	certFile, keyFile := writeClientCertificate(t)
+	// Act
+	tlsConfig, err := loadAPITLSConfig(certFile, certFile, keyFile)
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Assert(t, tlsConfig.RootCAs != nil, "expected the ca bundle to be trusted")
+	autopilot.Equals(t, 1, len(tlsConfig.Certificates))
+}
+
+func Test_LoadAPITLSConfig_FailsOnInvalidFiles(t *testing.T) {
+	// Arrange
+	certFile, keyFile := writeClientCertificate(t)
+	notPEM := filepath.Join(t.TempDir(), "ca.txt")
+	autopilot.Ok(t, os.WriteFile(notPEM, []byte("not a certificate"), 0o600))
+	// Act
+	_, missingErr := loadAPITLSConfig(filepath.Join(t.TempDir(), "missing.pem"), "", "")
+	_, notPEMErr := loadAPITLSConfig(notPEM, "", "")
+	_, withoutKeyErr := loadAPITLSConfig("", certFile, "")
+	_, swappedErr := loadAPITLSConfig("", keyFile, certFile)
+	// Assert
+	autopilot.Assert(t, missingErr != nil, "expected a missing ca bundle to fail")
+	autopilot.Assert(t, notPEMErr != nil, "expected a ca bundle without certificates to fail")
+	autopilot.Assert(t, withoutKeyErr != nil, "expected a client certificate without a key to fail")
+	autopilot.Assert(t, swappedErr != nil, "expected a swapped certificate and key to fail")
+}
+
+func Test_ConfigureOpslevelTLS_TrustsTheCABundle(t *testing.T) {
+	// Arrange
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": {"__schema": {"mutationType": {"fields": [{"name": "serviceCreate"}]}}}}`))
+	}))
+	defer server.Close()
+	tlsConfig, err := loadAPITLSConfig(writePEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw), "", "")
+	autopilot.Ok(t, err)
+	untrusted := newGQLClient("token", opslevel.SetURL(server.URL), opslevel.SetMaxRetries(0))
+	client := newGQLClient("token", opslevel.SetURL(server.URL), opslevel.SetMaxRetries(0))
+	// Act
+	configErr := configureOpslevelTLS(client, tlsConfig)
+	_, untrustedErr := getSchemaMutations(untrusted)
+	mutations, trustedErr := getSchemaMutations(client)
+	// Assert
+	autopilot.Ok(t, configErr)
+	autopilot.Assert(t, untrustedErr != nil, "expected the self signed certificate to be rejected without the ca bundle")
+	autopilot.Ok(t, trustedErr)
+	autopilot.Equals(t, true, mutations["serviceCreate"])
+}
+
+func Test_OpslevelLayoutVersion_MatchesTheDependency(t *testing.T) {
+	// Arrange
+	info, ok := debug.ReadBuildInfo()
+	autopilot.Assert(t, ok, "expected the build info of the test binary")
+	version := ""
+	for _, dep := range info.Deps {
+		if dep.Path == "github.com/opslevel/opslevel-go/v2022" {
+			version = dep.Version
+		}
+	}
+	// Assert
+	autopilot.Assert(t, version == opslevelLayoutVersion, "opslevel-go was upgraded to %s - verify the transport hooks in transport.go against its client layout and bump opslevelLayoutVersion", version)
+}
+
+func Test_OpslevelHTTPClient_ReachesTheTransportChain(t *testing.T) {
+	// Arrange
+	client := newGQLClient("token", opslevel.SetURL("https://app.opslevel.com"))
+	// Act
+	httpClient, err := opslevelHTTPClient(client)
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Assert(t, httpClient.Transport != nil, "expected the transport chain of the opslevel client")
+	autopilot.Ok(t, configureOpslevelTLS(client, nil))
+}
+
+func Test_UnexportedField_FailsWhenTheLayoutChanged(t *testing.T) {
+	// Arrange
+	value := reflect.ValueOf(&struct{ client *http.Client }{}).Elem()
+	// Act
+	_, renamedErr := unexportedField(value, "httpClient", reflect.TypeOf(&http.Client{}))
+	_, retypedErr := unexportedField(value, "client", reflect.TypeOf(&http.Transport{}))
+	field, err := unexportedField(value, "client", reflect.TypeOf(&http.Client{}))
+	// Assert
+	autopilot.Assert(t, renamedErr != nil, "expected a renamed field to fail")
+	autopilot.Assert(t, retypedErr != nil, "expected a field of another type to fail")
+	autopilot.Ok(t, err)
+	field.Set(reflect.ValueOf(&http.Client{}))
+	autopilot.Assert(t, value.Field(0).Pointer() != 0, "expected the unexported field to be settable")
+}
+
+func Test_AbortTransport_CancelsTheCallsOnceTheRunIsAborted(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	rootContext = ctx
+	defer func() { rootContext = context.Background() }()
+	transport := newAbortTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, req.Context().Err()
+	}))
+	request := httptest.NewRequest(http.MethodPost, "https://app.opslevel.com/graphql", nil)
+	// Act
+	_, before := transport.RoundTrip(request)
+	cancel()
+	_, after := transport.RoundTrip(request)
+	// Assert
+	autopilot.Ok(t, before)
+	autopilot.Equals(t, context.Canceled, after)
+}
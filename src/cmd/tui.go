@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opslevel/kubectl-opslevel/common"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/term"
+)
+
+const tuiErrorPaneHeight = 8
+
+type tuiRow struct {
+	name    string
+	status  common.ServiceStatus
+	updated time.Time
+}
+
+// tuiDashboard renders a live table of the services being reconciled with a scrollable pane of warnings and errors.
+// It takes over the terminal so the zerolog output is captured into the pane instead of being printed.
+type tuiDashboard struct {
+	mutex        sync.Mutex
+	title        string
+	rows         map[string]*tuiRow // Keyed by the Key of the registration since names are not unique across namespaces
+	errors       []string
+	errorsScroll int
+	stop         chan bool
+	stopped      sync.WaitGroup
+	restore      func()
+	logger       zerolog.Logger
+}
+
+func isTerminal() bool {
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+func newTUIDashboard(title string, services []common.ServiceRegistration) *tuiDashboard {
+	dashboard := &tuiDashboard{
+		title: title,
+		rows:  map[string]*tuiRow{},
+		stop:  make(chan bool),
+	}
+	now := time.Now()
+	for _, service := range services {
+		dashboard.rows[service.Key()] = &tuiRow{name: service.Name, status: common.ServiceStatus_Queued, updated: now}
+	}
+	return dashboard
+}
+
+// Start captures the logs and status updates and renders until Stop is called
+func (d *tuiDashboard) Start() {
+	d.logger = log.Logger
+	log.Logger = zerolog.New(d).Level(d.logger.GetLevel()).With().Timestamp().Logger()
+	common.OnServiceStatus = d.setStatus
+
+	d.restore = func() {}
+	if state, err := term.MakeRaw(int(os.Stdin.Fd())); err == nil {
+		d.restore = func() { term.Restore(int(os.Stdin.Fd()), state) }
+		go d.readKeys()
+	}
+	fmt.Print("\033[?1049h\033[?25l") // alternate screen, hide cursor
+
+	d.stopped.Add(1)
+	go func() {
+		defer d.stopped.Done()
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			d.render()
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop restores the terminal and logger then prints a summary and every captured error
+func (d *tuiDashboard) Stop() {
+	close(d.stop)
+	d.stopped.Wait()
+	d.restoreTerminal()
+	common.OnServiceStatus = nil
+	log.Logger = d.logger
+
+	counts := d.counts()
+	fmt.Printf("%s: %d done, %d failed of %d services\n", d.title, counts[common.ServiceStatus_Done], counts[common.ServiceStatus_Failed], len(d.rows))
+	for _, line := range d.errors {
+		fmt.Println(line)
+	}
+}
+
+func (d *tuiDashboard) restoreTerminal() {
+	fmt.Print("\033[?25h\033[?1049l") // show cursor, main screen
+	d.restore()
+}
+
+// WriteLevel implements zerolog.LevelWriter - only warnings and errors are kept for the error pane
+func (d *tuiDashboard) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if level < zerolog.WarnLevel {
+		return len(p), nil
+	}
+	var event struct {
+		Level   string `json:"level"`
+		Message string `json:"message"`
+	}
+	line := strings.TrimSpace(string(p))
+	if err := json.Unmarshal(p, &event); err == nil {
+		line = fmt.Sprintf("%s %s", strings.ToUpper(event.Level), event.Message)
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, item := range strings.Split(line, "\n") {
+		d.errors = append(d.errors, strings.ReplaceAll(item, "\t", "    "))
+	}
+	return len(p), nil
+}
+
+func (d *tuiDashboard) Write(p []byte) (int, error) {
+	return d.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (d *tuiDashboard) setStatus(key string, name string, status common.ServiceStatus) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	row, ok := d.rows[key]
+	if !ok {
+		row = &tuiRow{name: name}
+		d.rows[key] = row
+	}
+	row.status = status
+	row.updated = time.Now()
+}
+
+func (d *tuiDashboard) counts() map[common.ServiceStatus]int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	output := map[common.ServiceStatus]int{}
+	for _, row := range d.rows {
+		output[row.status]++
+	}
+	return output
+}
+
+func (d *tuiDashboard) scroll(delta int) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.errorsScroll += delta
+	if max := len(d.errors) - tuiErrorPaneHeight; d.errorsScroll > max {
+		d.errorsScroll = max
+	}
+	if d.errorsScroll < 0 {
+		d.errorsScroll = 0
+	}
+}
+
+// readKeys handles the arrow keys (or j/k) for scrolling the error pane and ctrl+c since the terminal is in raw mode
+func (d *tuiDashboard) readKeys() {
+	buffer := make([]byte, 3)
+	for {
+		n, err := os.Stdin.Read(buffer)
+		if err != nil {
+			return
+		}
+		switch key := string(buffer[:n]); key {
+		case "\033[A", "k":
+			d.scroll(1)
+		case "\033[B", "j":
+			d.scroll(-1)
+		case "\x03":
+			d.restoreTerminal()
+			os.Exit(130)
+		}
+	}
+}
+
+func (d *tuiDashboard) render() {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = 120, 40
+	}
+	counts := d.counts()
+
+	d.mutex.Lock()
+	rows := make([]*tuiRow, 0, len(d.rows))
+	for _, row := range d.rows {
+		rows = append(rows, row)
+	}
+	// In progress and failed services first, then the most recently updated
+	sort.Slice(rows, func(i, j int) bool {
+		pi, pj := tuiStatusPriority(rows[i].status), tuiStatusPriority(rows[j].status)
+		if pi != pj {
+			return pi < pj
+		}
+		if !rows[i].updated.Equal(rows[j].updated) {
+			return rows[i].updated.After(rows[j].updated)
+		}
+		return rows[i].name < rows[j].name
+	})
+	end := len(d.errors) - d.errorsScroll
+	start := end - tuiErrorPaneHeight
+	if start < 0 {
+		start = 0
+	}
+	errors := append([]string{}, d.errors[start:end]...)
+	errorsCount := len(d.errors)
+	d.mutex.Unlock()
+
+	var b strings.Builder
+	b.WriteString("\033[H\033[2J")
+	processed := counts[common.ServiceStatus_Done] + counts[common.ServiceStatus_Failed]
+	fmt.Fprintf(&b, "%s - %d/%d processed, %d failed\r\n\r\n", d.title, processed, len(rows), counts[common.ServiceStatus_Failed])
+	fmt.Fprintf(&b, "%-16s %s\r\n", "STATUS", "SERVICE")
+	tableHeight := height - tuiErrorPaneHeight - 6
+	for i, row := range rows {
+		if i >= tableHeight {
+			fmt.Fprintf(&b, "... %d more\r\n", len(rows)-i)
+			break
+		}
+		fmt.Fprintf(&b, "%-16s %s\r\n", row.status, truncate(row.name, width-17))
+	}
+	fmt.Fprintf(&b, "\r\nWARNINGS & ERRORS (%d) - scroll with up/down\r\n", errorsCount)
+	for _, line := range errors {
+		fmt.Fprintf(&b, "%s\r\n", truncate(line, width))
+	}
+	fmt.Print(b.String())
+}
+
+func tuiStatusPriority(status common.ServiceStatus) int {
+	switch status {
+	case common.ServiceStatus_Queued:
+		return 2
+	case common.ServiceStatus_Done:
+		return 3
+	case common.ServiceStatus_Failed:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func truncate(value string, length int) string {
+	if length > 3 && len(value) > length {
+		return value[:length-3] + "..."
+	}
+	return value
+}
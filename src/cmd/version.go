@@ -2,23 +2,157 @@ package cmd
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/go-resty/resty/v2"
+	"github.com/opslevel/kubectl-opslevel/common"
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 var version = "development"
 
+var versionCheck bool
+
+const latestReleaseURL = "https://api.github.com/repos/OpsLevel/kubectl-opslevel/releases/latest"
+
+// requiredMutations are the OpsLevel API mutations this binary calls across its commands
+var requiredMutations = []string{
+	"aliasCreate",
+	"domainCreate",
+	"filterCreate",
+	"filterUpdate",
+	"infrastructureResourceCreate",
+	"infrastructureResourceUpdate",
+	"propertyAssign",
+	"relationshipCreate",
+	"serviceCreate",
+	"serviceDelete",
+	"serviceDependencyCreate",
+	"serviceDependencyDelete",
+	"serviceNoteUpdate",
+	"serviceRepositoryCreate",
+	"serviceRepositoryUpdate",
+	"serviceUpdate",
+	"systemCreate",
+	"systemUpdate",
+	"tagAssign",
+	"tagCreate",
+	"tagDelete",
+	"teamCreate",
+	"teamMembershipCreate",
+	"teamMembershipDelete",
+	"toolCreate",
+	"toolUpdate",
+}
+
 var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Print version information",
-	Long:  `Print version information`,
-	Run:   runVersion,
+	Long: `Print version information
+
+Use '--check' to compare against the latest GitHub release and verify the OpsLevel API
+supports every mutation this version depends on.`,
+	Run: runVersion,
 }
 
 func init() {
 	rootCmd.AddCommand(versionCmd)
+	common.ToolVersion = version
+
+	versionCmd.Flags().BoolVar(&versionCheck, "check", false, "Check for a newer release and verify the OpsLevel API is compatible")
 }
 
 func runVersion(cmd *cobra.Command, args []string) {
 	fmt.Println(version)
+	if !versionCheck {
+		return
+	}
+
+	latest, err := getLatestRelease()
+	if err != nil {
+		log.Warn().Msgf("Unable to check for the latest release\n\tREASON: %v", err)
+	} else if version == "development" {
+		fmt.Printf("Latest release is %s (this is a development build)\n", latest)
+	} else if compareVersions(version, latest) < 0 {
+		fmt.Printf("A newer version is available: %s - see https://github.com/OpsLevel/kubectl-opslevel/releases\n", latest)
+	} else {
+		fmt.Println("You are running the latest version")
+	}
+
+	if viper.GetString("api-token") == "" {
+		log.Warn().Msg("Skipping the OpsLevel API compatibility check because no api token is set")
+		return
+	}
+	missing, err := getMissingMutations()
+	checkErr(err, ExitCodeAuth)
+	if len(missing) > 0 {
+		fmt.Printf("The OpsLevel API at %s is missing mutations this version depends on: [%s] - an upgrade of kubectl-opslevel or the self-hosted instance is needed\n", viper.GetString("api-url"), strings.Join(missing, ", "))
+		return
+	}
+	fmt.Println("The OpsLevel API supports every feature this version depends on")
+}
+
+func getLatestRelease() (string, error) {
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	resp, err := resty.New().R().SetResult(&release).Get(latestReleaseURL)
+	if err != nil {
+		return "", err
+	}
+	if resp.IsError() {
+		return "", fmt.Errorf("github returned %s", resp.Status())
+	}
+	return release.TagName, nil
+}
+
+func getMissingMutations() ([]string, error) {
+	client, err := buildOpslevelClient(viper.GetString("api-token"), viper.GetString("api-url"))
+	if err != nil {
+		return nil, err
+	}
+	available, err := getSchemaMutations(client)
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, name := range requiredMutations {
+		if !available[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing, nil
+}
+
+// compareVersions compares dotted versions with an optional 'v' prefix returning -1, 0 or 1 - pre-release suffixes are ignored
+func compareVersions(a string, b string) int {
+	aParts := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bParts := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		aValue, bValue := versionPart(aParts, i), versionPart(bParts, i)
+		if aValue != bValue {
+			if aValue < bValue {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionPart(parts []string, index int) int {
+	if index >= len(parts) {
+		return 0
+	}
+	value := parts[index]
+	if cut := strings.IndexAny(value, "-+"); cut >= 0 {
+		value = value[:cut]
+	}
+	number, _ := strconv.Atoi(value)
+	return number
 }
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/rocktavious/autopilot"
+)
+
+func Test_RequiredMutations_CoverTheMutationsOfTheSources(t *testing.T) {
+	// Arrange
+	mutation := regexp.MustCompile(`graphql:"([a-z][A-Za-z]*(Create|Update|Delete|Assign))\(`)
+	required := map[string]bool{}
+	for _, name := range requiredMutations {
+		required[name] = true
+	}
+	files, err := filepath.Glob("../common/*.go")
+	autopilot.Ok(t, err)
+	cmdFiles, err := filepath.Glob("*.go")
+	autopilot.Ok(t, err)
+	// Act
+	var missing []string
+	for _, file := range append(files, cmdFiles...) {
+		data, readErr := os.ReadFile(file)
+		autopilot.Ok(t, readErr)
+		for _, match := range mutation.FindAllStringSubmatch(string(data), -1) {
+			if !required[match[1]] {
+				missing = append(missing, match[1])
+			}
+		}
+	}
+	// Assert
+	autopilot.Equals(t, []string(nil), missing)
+}
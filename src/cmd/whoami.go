@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var whoamiCmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Validate the API token and print the account it belongs to",
+	Long: `This command will validate the OpsLevel API token and print the account it belongs to and which of the
+resources used by an import the token can read.
+
+The OpsLevel API does not expose whether a token may write so only the read access is reported.`,
+	Run: runWhoami,
+}
+
+type whoamiScope struct {
+	Resource string `json:"resource"`
+	Read     bool   `json:"read"`
+	Error    string `json:"error,omitempty"`
+}
+
+type whoamiResult struct {
+	AccountId   string        `json:"accountId"`
+	AccountName string        `json:"accountName"`
+	APIURL      string        `json:"apiUrl"`
+	TokenSource string        `json:"tokenSource"`
+	Scopes      []whoamiScope `json:"scopes"`
+}
+
+func init() {
+	rootCmd.AddCommand(whoamiCmd)
+}
+
+func runWhoami(cmd *cobra.Command, args []string) {
+	token := viper.GetString("api-token")
+	if token == "" {
+		checkErr(fmt.Errorf("no api token set - use --api-token, --api-token-path, --api-token-secret or OPSLEVEL_API_TOKEN"), ExitCodeConfig)
+	}
+	client, err := buildOpslevelClient(token, viper.GetString("api-url"))
+	checkErr(err, ExitCodeAuth)
+
+	var q struct {
+		Account struct {
+			Id   string
+			Name string
+		}
+	}
+	checkErr(client.Query(&q, nil), ExitCodeAuth)
+
+	result := whoamiResult{
+		AccountId:   q.Account.Id,
+		AccountName: q.Account.Name,
+		APIURL:      viper.GetString("api-url"),
+		TokenSource: getAPITokenSource(),
+		Scopes:      getReadScopes(client),
+	}
+	if !IsTextOutput() {
+		cobra.CheckErr(printStructured(result))
+		return
+	}
+	fmt.Printf("Account:      %s (%s)\n", result.AccountName, result.AccountId)
+	fmt.Printf("API URL:      %s\n", result.APIURL)
+	fmt.Printf("Token Source: %s\n", result.TokenSource)
+	fmt.Println("Scopes:")
+	for _, scope := range result.Scopes {
+		if scope.Read {
+			fmt.Printf("  %-14s read\n", scope.Resource)
+		} else {
+			fmt.Printf("  %-14s denied (%s)\n", scope.Resource, scope.Error)
+		}
+	}
+}
+
+func getAPITokenSource() string {
+	switch {
+	case apiToken != "":
+		return "--api-token"
+	case apiTokenFile != "":
+		return fmt.Sprintf("--api-token-path %s", apiTokenFile)
+	case apiTokenSecret != "":
+		return fmt.Sprintf("--api-token-secret %s (key %s)", apiTokenSecret, apiTokenSecretKey)
+	default:
+		return "environment"
+	}
+}
+
+func getReadScopes(client *opslevel.Client) []whoamiScope {
+	probes := []struct {
+		resource string
+		query    interface{}
+	}{
+		{"services", &struct {
+			Account struct {
+				Services struct{ TotalCount int } `graphql:"services(first: 1)"`
+			}
+		}{}},
+		{"teams", &struct {
+			Account struct {
+				Teams struct{ TotalCount int } `graphql:"teams(first: 1)"`
+			}
+		}{}},
+		{"repositories", &struct {
+			Account struct {
+				Repositories struct{ TotalCount int } `graphql:"repositories(first: 1)"`
+			}
+		}{}},
+		{"tiers", &struct {
+			Account struct {
+				Tiers []struct{ Alias string }
+			}
+		}{}},
+		{"lifecycles", &struct {
+			Account struct {
+				Lifecycles []struct{ Alias string }
+			}
+		}{}},
+	}
+	var output []whoamiScope
+	for _, probe := range probes {
+		scope := whoamiScope{Resource: probe.resource, Read: true}
+		if err := client.Query(probe.query, nil); err != nil {
+			scope.Read = false
+			scope.Error = err.Error()
+		}
+		output = append(output, scope)
+	}
+	return output
+}
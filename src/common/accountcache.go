@@ -0,0 +1,168 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// CacheDirectory is where the tier, lifecycle and team lookup tables of every account are persisted
+	CacheDirectory string
+	// CacheTTL is how long a persisted lookup table is used before it is fetched again - 0 disables persisting
+	CacheTTL time.Duration
+	// CacheNamespace separates the persisted lookup tables of different OpsLevel instances and tokens
+	CacheNamespace string
+
+	diskCachedAccountsMutex sync.Mutex
+	diskCachedAccounts      = map[string]bool{}
+)
+
+type accountCacheFile struct {
+	FetchedAt  time.Time                     `json:"fetchedAt"`
+	Tiers      map[string]opslevel.Tier      `json:"tiers"`
+	Lifecycles map[string]opslevel.Lifecycle `json:"lifecycles"`
+	Teams      map[string]opslevel.Team      `json:"teams"`
+}
+
+func accountCachePath(account string) string {
+	sum := sha256.Sum256([]byte(CacheNamespace + "\n" + account))
+	return filepath.Join(CacheDirectory, "account-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// loadAccountCache fills the lookup tables from disk when they were persisted less than CacheTTL ago
+func loadAccountCache(account string, cache *opslevel.Cacher) bool {
+	if CacheTTL <= 0 || CacheDirectory == "" {
+		return false
+	}
+	data, err := os.ReadFile(accountCachePath(account))
+	if err != nil {
+		return false
+	}
+	var file accountCacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		log.Debug().Msgf("Ignoring unreadable account cache: %v", err)
+		return false
+	}
+	if time.Since(file.FetchedAt) > CacheTTL {
+		return false
+	}
+	cache.Tiers = file.Tiers
+	cache.Lifecycles = file.Lifecycles
+	cache.Teams = file.Teams
+	diskCachedAccountsMutex.Lock()
+	defer diskCachedAccountsMutex.Unlock()
+	diskCachedAccounts[account] = true
+	log.Debug().Msgf("Using the account lookup tables cached %s ago", time.Since(file.FetchedAt).Round(time.Second))
+	return true
+}
+
+func saveAccountCache(account string, cache *opslevel.Cacher) error {
+	if CacheTTL <= 0 || CacheDirectory == "" {
+		return nil
+	}
+	if err := os.MkdirAll(CacheDirectory, 0o700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(accountCacheFile{
+		FetchedAt:  time.Now(),
+		Tiers:      cache.Tiers,
+		Lifecycles: cache.Lifecycles,
+		Teams:      cache.Teams,
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(accountCachePath(account), data, 0o600)
+}
+
+// isDiskCached is true when the account's lookup tables came from disk so they may miss recently created teams
+func isDiskCached(account string) bool {
+	diskCachedAccountsMutex.Lock()
+	defer diskCachedAccountsMutex.Unlock()
+	return diskCachedAccounts[account]
+}
+
+// refreshDiskCachedAccount refetches the lookup tables of an account read from disk once an alias is missing from
+// them - it happens at most once per run since the refetched tables are no longer disk cached
+func refreshDiskCachedAccount(account string, client *opslevel.Client) bool {
+	if client == nil {
+		return false
+	}
+	diskCachedAccountsMutex.Lock()
+	stale := diskCachedAccounts[account]
+	delete(diskCachedAccounts, account)
+	diskCachedAccountsMutex.Unlock()
+	if !stale {
+		return false
+	}
+	log.Info().Msgf("Refetching the cached tiers, lifecycles and teams since an alias is missing from them")
+	if err := RefreshAccount(account, client); err != nil {
+		log.Warn().Msgf("Unable to persist the account cache: %v", err)
+	}
+	return true
+}
+
+// lookupTier finds the tier by alias and refetches the disk cached tiers when it is missing
+func lookupTier(client *opslevel.Client, account string, alias string) (*opslevel.Tier, bool) {
+	if v, ok := getCache(account).TryGetTier(alias); ok {
+		return v, true
+	}
+	if alias != "" && refreshDiskCachedAccount(account, client) {
+		return getCache(account).TryGetTier(alias)
+	}
+	return nil, false
+}
+
+// lookupLifecycle finds the lifecycle by alias and refetches the disk cached lifecycles when it is missing
+func lookupLifecycle(client *opslevel.Client, account string, alias string) (*opslevel.Lifecycle, bool) {
+	if v, ok := getCache(account).TryGetLifecycle(alias); ok {
+		return v, true
+	}
+	if alias != "" && refreshDiskCachedAccount(account, client) {
+		return getCache(account).TryGetLifecycle(alias)
+	}
+	return nil, false
+}
+
+// RefreshAccount fetches the tier, lifecycle and team lookup tables of the named account and persists them
+func RefreshAccount(account string, client *opslevel.Client) error {
+	cache := getCache(account)
+	cache.CacheTiers(client)
+	cache.CacheLifecycles(client)
+	cache.CacheTeams(client)
+	diskCachedAccountsMutex.Lock()
+	delete(diskCachedAccounts, account)
+	diskCachedAccountsMutex.Unlock()
+	return saveAccountCache(account, cache)
+}
+
+// ClearAccountCaches removes every persisted lookup table and returns how many were removed
+func ClearAccountCaches() (int, error) {
+	entries, err := os.ReadDir(CacheDirectory)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), "account-") || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		if err := os.Remove(filepath.Join(CacheDirectory, entry.Name())); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,50 @@
+package common
+
+import (
+	"sync"
+
+	"github.com/shurcooL/graphql"
+)
+
+// AliasCache remembers the ids of the systems, domains and other resources looked up (or created) by alias
+// during a run so concurrent workers neither repeat the lookup nor create the same resource twice
+type AliasCache struct {
+	mutex sync.Mutex
+	ids   map[string]graphql.ID
+}
+
+var (
+	aliasCachesMutex sync.Mutex
+	aliasCaches      = map[string]*AliasCache{}
+)
+
+// GetOrCreateAliasCache returns the alias cache of the named account - an empty name is the default account
+func GetOrCreateAliasCache(account string) *AliasCache {
+	aliasCachesMutex.Lock()
+	defer aliasCachesMutex.Unlock()
+	if cache, ok := aliasCaches[account]; ok {
+		return cache
+	}
+	cache := &AliasCache{ids: map[string]graphql.ID{}}
+	aliasCaches[account] = cache
+	return cache
+}
+
+// Resolve returns the cached id for the kind and alias or calls resolve to find or create it.
+// Calls are serialized so a resource missing in OpsLevel is only created once.
+func (c *AliasCache) Resolve(kind string, alias string, resolve func() (graphql.ID, error)) (graphql.ID, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	key := kind + "/" + alias
+	if id, ok := c.ids[key]; ok {
+		return id, nil
+	}
+	id, err := resolve()
+	if err != nil {
+		return nil, err
+	}
+	if id != nil {
+		c.ids[key] = id
+	}
+	return id, nil
+}
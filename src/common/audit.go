@@ -0,0 +1,86 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	AuditOutcome_Success = "success"
+	AuditOutcome_Failure = "failure"
+)
+
+// AuditEntry is one line of the audit log describing a single mutation sent to OpsLevel
+type AuditEntry struct {
+	Timestamp time.Time   `json:"timestamp"`
+	RunId     string      `json:"runId,omitempty"`
+	Service   string      `json:"service"`
+	Alias     string      `json:"alias,omitempty"`
+	Operation string      `json:"operation"`
+	Input     interface{} `json:"input"`
+	Outcome   string      `json:"outcome"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// RunId is the id sent with every OpsLevel API call of the run - it is recorded in the audit log for correlation
+var RunId string
+
+var (
+	auditLogMutex sync.Mutex
+	auditLogFile  *os.File
+)
+
+// OpenAuditLog appends one json line per mutation to the file at path until CloseAuditLog is called
+func OpenAuditLog(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("unable to open audit log '%s': %v", path, err)
+	}
+	auditLogMutex.Lock()
+	defer auditLogMutex.Unlock()
+	auditLogFile = file
+	return nil
+}
+
+// CloseAuditLog stops writing the audit log
+func CloseAuditLog() error {
+	auditLogMutex.Lock()
+	defer auditLogMutex.Unlock()
+	if auditLogFile == nil {
+		return nil
+	}
+	err := auditLogFile.Close()
+	auditLogFile = nil
+	return err
+}
+
+func audit(service string, aliases []string, operation string, input interface{}, err error) {
+	auditLogMutex.Lock()
+	defer auditLogMutex.Unlock()
+	if auditLogFile == nil {
+		return
+	}
+	entry := AuditEntry{
+		Timestamp: time.Now().UTC(),
+		RunId:     RunId,
+		Service:   service,
+		Operation: operation,
+		Input:     input,
+		Outcome:   AuditOutcome_Success,
+	}
+	if len(aliases) > 0 {
+		entry.Alias = aliases[0]
+	}
+	if err != nil {
+		entry.Outcome = AuditOutcome_Failure
+		entry.Error = err.Error()
+	}
+	line, marshalErr := json.Marshal(entry)
+	if marshalErr != nil {
+		line, _ = json.Marshal(AuditEntry{Timestamp: entry.Timestamp, RunId: RunId, Service: service, Alias: entry.Alias, Operation: operation, Outcome: entry.Outcome, Error: entry.Error})
+	}
+	auditLogFile.Write(append(line, '\n'))
+}
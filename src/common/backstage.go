@@ -0,0 +1,229 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/rs/zerolog/log"
+	yaml "gopkg.in/yaml.v3"
+)
+
+const (
+	BackstageApiVersion = "backstage.io/v1alpha1"
+	BackstageKind       = "Component"
+)
+
+var (
+	backstageNameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9\-_.]+`)
+	backstageTagInvalidChars  = regexp.MustCompile(`[^a-z0-9+#\-]+`)
+)
+
+type BackstageLink struct {
+	Url   string `yaml:"url"`
+	Title string `yaml:"title,omitempty"`
+	Type  string `yaml:"type,omitempty"`
+}
+
+type BackstageMetadata struct {
+	Name        string            `yaml:"name"`
+	Title       string            `yaml:"title,omitempty"`
+	Description string            `yaml:"description,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+	Tags        []string          `yaml:"tags,omitempty"`
+	Links       []BackstageLink   `yaml:"links,omitempty"`
+}
+
+type BackstageComponentSpec struct {
+	Type      string `yaml:"type"`
+	Lifecycle string `yaml:"lifecycle"`
+	Owner     string `yaml:"owner"`
+	System    string `yaml:"system,omitempty"`
+}
+
+// BackstageEntity is a Backstage catalog-info.yaml Component entity
+type BackstageEntity struct {
+	ApiVersion string                 `yaml:"apiVersion"`
+	Kind       string                 `yaml:"kind"`
+	Metadata   BackstageMetadata      `yaml:"metadata"`
+	Spec       BackstageComponentSpec `yaml:"spec"`
+}
+
+// ToBackstageEntity converts the service registration into a Backstage Component entity.
+// Fields Backstage has no equivalent for are kept as 'opslevel.com/*' annotations.
+func (s *ServiceRegistration) ToBackstageEntity() BackstageEntity {
+	name := s.Name
+	if len(s.Aliases) > 0 {
+		name = s.Aliases[0]
+	}
+	annotations := map[string]string{}
+	if len(s.Aliases) > 0 {
+		annotations["opslevel.com/aliases"] = strings.Join(s.Aliases, ",")
+	}
+	for key, value := range map[string]string{
+		"opslevel.com/tier":      s.Tier,
+		"opslevel.com/language":  s.Language,
+		"opslevel.com/framework": s.Framework,
+	} {
+		if value != "" {
+			annotations[key] = value
+		}
+	}
+	var repositories []string
+	for _, repository := range s.Repositories {
+		if repository.Repository.Alias != "" {
+			repositories = append(repositories, string(repository.Repository.Alias))
+		} else if repository.Repository.Id != nil {
+			repositories = append(repositories, fmt.Sprint(repository.Repository.Id))
+		}
+	}
+	if len(repositories) > 0 {
+		annotations["opslevel.com/repositories"] = strings.Join(repositories, ",")
+	}
+
+	var tags []string
+	for _, tag := range append(s.TagAssigns, s.TagCreates...) {
+		if converted := toBackstageTag(tag.Key + "-" + tag.Value); converted != "" {
+			tags = append(tags, converted)
+		}
+	}
+	var links []BackstageLink
+	for _, tool := range s.Tools {
+		links = append(links, BackstageLink{Url: tool.Url, Title: tool.DisplayName, Type: string(tool.Category)})
+	}
+
+	return BackstageEntity{
+		ApiVersion: BackstageApiVersion,
+		Kind:       BackstageKind,
+		Metadata: BackstageMetadata{
+			Name:        toBackstageName(name),
+			Title:       s.Name,
+			Description: s.Description,
+			Annotations: annotations,
+			Tags:        removeDuplicates(tags),
+			Links:       links,
+		},
+		Spec: BackstageComponentSpec{
+			Type:      "service",
+			Lifecycle: orDefault(strings.ToLower(s.Lifecycle), "unknown"),
+			Owner:     orDefault(s.Owner, "unknown"),
+			System:    s.Product,
+		},
+	}
+}
+
+// ParseBackstageCatalog decodes a (multi document) Backstage catalog-info.yaml and converts every
+// Component entity into a service registration - other entity kinds are skipped
+func ParseBackstageCatalog(data []byte) ([]ServiceRegistration, error) {
+	var output []ServiceRegistration
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var entity BackstageEntity
+		err := decoder.Decode(&entity)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse backstage catalog: %v", err)
+		}
+		if entity.Kind != BackstageKind {
+			if entity.Kind != "" {
+				log.Debug().Msgf("[%s] Skipping backstage entity of kind '%s'", entity.Metadata.Name, entity.Kind)
+			}
+			continue
+		}
+		output = append(output, entity.ToServiceRegistration())
+	}
+	return dedupServices(output)
+}
+
+// ToServiceRegistration converts the Backstage Component entity into a service registration.
+// The 'opslevel.com/*' annotations written by ToBackstageEntity are honored so exports round trip.
+func (e *BackstageEntity) ToServiceRegistration() ServiceRegistration {
+	annotations := e.Metadata.Annotations
+	aliases := []string{e.Metadata.Name}
+	if value := annotations["opslevel.com/aliases"]; value != "" {
+		aliases = append(strings.Split(value, ","), aliases...)
+	}
+	// every tag shares the 'backstage' key so they are created - an assign would keep only one of them
+	var tags []opslevel.TagInput
+	for _, tag := range e.Metadata.Tags {
+		tags = append(tags, opslevel.TagInput{Key: "backstage", Value: tag})
+	}
+	var tools []opslevel.ToolCreateInput
+	for _, link := range e.Metadata.Links {
+		if link.Url == "" {
+			continue
+		}
+		tools = append(tools, opslevel.ToolCreateInput{
+			Category:    opslevel.ToolCategoryOther,
+			DisplayName: orDefault(link.Title, link.Url),
+			Url:         link.Url,
+		})
+	}
+	var repositories []opslevel.ServiceRepositoryCreateInput
+	var repositoryAliases []string
+	if value := annotations["opslevel.com/repositories"]; value != "" {
+		repositoryAliases = strings.Split(value, ",")
+	}
+	if slug := annotations["github.com/project-slug"]; slug != "" {
+		repositoryAliases = append(repositoryAliases, "github.com:"+slug)
+	}
+	for _, alias := range removeDuplicates(repositoryAliases) {
+		repositories = append(repositories, *convertToServiceRepositoryCreateInput(map[string]string{"repo": alias}))
+	}
+	return ServiceRegistration{
+		Name:         orDefault(e.Metadata.Title, e.Metadata.Name),
+		Description:  e.Metadata.Description,
+		Owner:        fromBackstageEntityRef(e.Spec.Owner),
+		Lifecycle:    e.Spec.Lifecycle,
+		Tier:         annotations["opslevel.com/tier"],
+		Product:      fromBackstageEntityRef(e.Spec.System),
+		Language:     annotations["opslevel.com/language"],
+		Framework:    annotations["opslevel.com/framework"],
+		Aliases:      removeDuplicates(aliases),
+		TagCreates:   tags,
+		Tools:        tools,
+		Repositories: repositories,
+	}
+}
+
+// fromBackstageEntityRef strips the kind and namespace from a Backstage entity reference (IE: 'group:default/platform' => 'platform')
+func fromBackstageEntityRef(ref string) string {
+	if index := strings.Index(ref, ":"); index >= 0 {
+		ref = ref[index+1:]
+	}
+	if index := strings.LastIndex(ref, "/"); index >= 0 {
+		ref = ref[index+1:]
+	}
+	return ref
+}
+
+// toBackstageName sanitizes the value to match the Backstage entity name format (max 63 chars of [a-zA-Z0-9-_.])
+func toBackstageName(value string) string {
+	name := strings.Trim(backstageNameInvalidChars.ReplaceAllString(value, "-"), "-_.")
+	if len(name) > 63 {
+		name = strings.Trim(name[:63], "-_.")
+	}
+	return name
+}
+
+// toBackstageTag sanitizes the value to match the Backstage tag format (max 63 chars of [a-z0-9+#-])
+func toBackstageTag(value string) string {
+	tag := strings.Trim(backstageTagInvalidChars.ReplaceAllString(strings.ToLower(value), "-"), "-")
+	if len(tag) > 63 {
+		tag = strings.Trim(tag[:63], "-")
+	}
+	return tag
+}
+
+func orDefault(value string, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,208 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/opslevel/kubectl-opslevel/config"
+	"github.com/opslevel/kubectl-opslevel/jq"
+	"github.com/opslevel/kubectl-opslevel/k8sutils"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	checksConfigMutex sync.Mutex
+	checksConfig      config.ChecksConfig
+
+	// podDisruptionBudgets are the selectors of the PodDisruptionBudgets per namespace used for the 'has_pod_disruption_budget' fact
+	podDisruptionBudgets map[string][]labels.Selector
+)
+
+var podDisruptionBudgetSelector = k8sutils.KubernetesSelector{ApiVersion: "policy/v1", Kind: "PodDisruptionBudget"}
+
+// SetChecks configures where the custom event check payloads of the registrations are sent
+func SetChecks(checks config.ChecksConfig) {
+	checksConfigMutex.Lock()
+	defer checksConfigMutex.Unlock()
+	checksConfig = checks
+}
+
+func getChecksConfig() config.ChecksConfig {
+	checksConfigMutex.Lock()
+	defer checksConfigMutex.Unlock()
+	return checksConfig
+}
+
+// CheckPayload is the json body posted to the custom event check integration for a single service
+type CheckPayload struct {
+	Service string                 `json:"service"`
+	Cluster string                 `json:"cluster,omitempty"`
+	Facts   map[string]interface{} `json:"facts"`
+}
+
+// loadPodDisruptionBudgets lists the PodDisruptionBudgets once so every registration can check whether its pods are covered
+func loadPodDisruptionBudgets(source resourceSource) error {
+	podDisruptionBudgets = map[string][]labels.Selector{}
+	resources, err := source.Query(-1, podDisruptionBudgetSelector)
+	if err != nil {
+		return err
+	}
+	if RecordDirectory != "" {
+		if err := writeRecording(RecordDirectory, -1, podDisruptionBudgetSelector, resources); err != nil {
+			return err
+		}
+	}
+	for _, resource := range resources {
+		var pdb struct {
+			Metadata metav1.ObjectMeta `json:"metadata"`
+			Spec     struct {
+				Selector *metav1.LabelSelector `json:"selector"`
+			} `json:"spec"`
+		}
+		if err := json.Unmarshal(resource, &pdb); err != nil || pdb.Spec.Selector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil {
+			continue
+		}
+		podDisruptionBudgets[pdb.Metadata.Namespace] = append(podDisruptionBudgets[pdb.Metadata.Namespace], selector)
+	}
+	return nil
+}
+
+// podTemplate returns the pod spec and labels of workloads, cronjobs and pods
+func podTemplate(resource map[string]interface{}) (map[string]interface{}, map[string]string, bool) {
+	template, found, _ := unstructured.NestedMap(resource, "spec", "template")
+	if !found {
+		template, found, _ = unstructured.NestedMap(resource, "spec", "jobTemplate", "spec", "template")
+	}
+	if !found {
+		if kind, _, _ := unstructured.NestedString(resource, "kind"); kind == "Pod" {
+			template, found = resource, true
+		}
+	}
+	if !found {
+		return nil, nil, false
+	}
+	spec, _, _ := unstructured.NestedMap(template, "spec")
+	podLabels, _, _ := unstructured.NestedStringMap(template, "metadata", "labels")
+	return spec, podLabels, true
+}
+
+// builtinCheckFacts computes the facts about the pod template of a resource that rubric checks commonly look at
+func builtinCheckFacts(data []byte) map[string]interface{} {
+	facts := map[string]interface{}{}
+	var resource map[string]interface{}
+	if err := json.Unmarshal(data, &resource); err != nil {
+		return facts
+	}
+	spec, podLabels, ok := podTemplate(resource)
+	if !ok {
+		return facts
+	}
+	containers, _, _ := unstructured.NestedSlice(spec, "containers")
+	podNonRoot, _, _ := unstructured.NestedBool(spec, "securityContext", "runAsNonRoot")
+	hasLimits, nonRoot, liveness, readiness := len(containers) > 0, len(containers) > 0, len(containers) > 0, len(containers) > 0
+	for _, item := range containers {
+		container, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		_, hasCPU, _ := unstructured.NestedFieldNoCopy(container, "resources", "limits", "cpu")
+		_, hasMemory, _ := unstructured.NestedFieldNoCopy(container, "resources", "limits", "memory")
+		hasLimits = hasLimits && hasCPU && hasMemory
+		containerNonRoot, found, _ := unstructured.NestedBool(container, "securityContext", "runAsNonRoot")
+		nonRoot = nonRoot && ((found && containerNonRoot) || (!found && podNonRoot))
+		_, hasLiveness, _ := unstructured.NestedFieldNoCopy(container, "livenessProbe")
+		_, hasReadiness, _ := unstructured.NestedFieldNoCopy(container, "readinessProbe")
+		liveness = liveness && hasLiveness
+		readiness = readiness && hasReadiness
+	}
+	facts["has_resource_limits"] = hasLimits
+	facts["runs_as_non_root"] = nonRoot
+	facts["has_liveness_probe"] = liveness
+	facts["has_readiness_probe"] = readiness
+	if podDisruptionBudgets != nil {
+		namespace, _, _ := unstructured.NestedString(resource, "metadata", "namespace")
+		covered := false
+		for _, selector := range podDisruptionBudgets[namespace] {
+			if selector.Matches(labels.Set(podLabels)) {
+				covered = true
+				break
+			}
+		}
+		facts["has_pod_disruption_budget"] = covered
+	}
+	return facts
+}
+
+// parseCheckPayloads merges the maps returned by the JQ expressions with the built-in facts of every resource
+func parseCheckPayloads(field string, c config.ServiceRegistrationConfig, resources [][]byte, joined []byte) []map[string]interface{} {
+	output := make([]map[string]interface{}, len(resources))
+	if len(c.CheckPayload) == 0 && !c.CheckFacts {
+		return output
+	}
+	for i, resource := range resources {
+		output[i] = map[string]interface{}{}
+		if c.CheckFacts {
+			for key, value := range builtinCheckFacts(resource) {
+				output[i][key] = value
+			}
+		}
+	}
+	for index, filter := range c.CheckPayload {
+		parser := NewJQParserMulti(filter)
+		var values []json.RawMessage
+		if err := json.Unmarshal(parser.doParse(fmt.Sprintf("%s.checkPayload[%d]", field, index+1), joined), &values); err != nil {
+			continue
+		}
+		for i, value := range values {
+			var facts map[string]interface{}
+			if i >= len(output) || json.Unmarshal(value, &facts) != nil {
+				continue
+			}
+			for key, fact := range facts {
+				output[i][key] = fact
+			}
+		}
+	}
+	return output
+}
+
+func handleCheckPayload(registration ServiceRegistration, result *ServiceResult) {
+	url := getChecksConfig().URL
+	if url == "" || len(registration.CheckPayload) == 0 {
+		return
+	}
+	payload := CheckPayload{
+		Service: registration.Aliases[0],
+		Cluster: jq.GetArg("cluster"),
+		Facts:   registration.CheckPayload,
+	}
+	data, _ := json.Marshal(payload)
+	if result.dryRun("send check payload %s", string(data)) {
+		return
+	}
+	err := postCheckPayload(url, data)
+	audit(registration.Name, registration.Aliases, "checkPayload", payload, err)
+	if err != nil {
+		result.failed(err, "Failed sending check payload")
+	} else {
+		log.Debug().Msgf("[%s] Sent check payload %s", registration.Name, string(data))
+	}
+}
+
+// postCheckPayload posts a json encoded CheckPayload to the custom event check integration
+func postCheckPayload(url string, data []byte) error {
+	resp, err := NewHTTPClient().R().SetHeader("Content-Type", "application/json").SetBody(data).Post(url)
+	if err == nil && resp.IsError() {
+		err = fmt.Errorf("%s", resp.Status())
+	}
+	return err
+}
@@ -4,43 +4,135 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/opslevel/opslevel-go/v2022"
 	"github.com/rs/zerolog/log"
+	"github.com/shurcooL/graphql"
 )
 
-func ReconcileService(client *opslevel.Client, service ServiceRegistration) {
-	if len(service.Aliases) <= 0 {
-		log.Warn().Msgf("[%s] found 0 aliases from kubernetes data", service.Name)
+// DryRun makes ReconcileService perform all lookups but only log the mutations it would send to OpsLevel
+var DryRun bool
+
+func isDryRun(service string, format string, args ...interface{}) bool {
+	if DryRun {
+		log.Info().Msgf("[%s] DRY RUN - would %s", service, fmt.Sprintf(format, args...))
+	}
+	return DryRun
+}
+
+var (
+	accountCachesMutex sync.Mutex
+	accountCaches      = map[string]*opslevel.Cacher{}
+)
+
+// CacheAccount populates the tier, lifecycle and team lookup tables for the named account from disk when they
+// were persisted less than CacheTTL ago and from the API otherwise
+// an empty account name is the default account which uses opslevel.Cache
+func CacheAccount(account string, client *opslevel.Client) {
+	if loadAccountCache(account, getCache(account)) {
 		return
 	}
+	if err := RefreshAccount(account, client); err != nil {
+		log.Warn().Msgf("Unable to persist the account cache: %v", err)
+	}
+}
+
+func getCache(account string) *opslevel.Cacher {
+	if account == "" {
+		return opslevel.Cache
+	}
+	accountCachesMutex.Lock()
+	defer accountCachesMutex.Unlock()
+	if cache, ok := accountCaches[account]; ok {
+		return cache
+	}
+	cache := &opslevel.Cacher{
+		Tiers:        make(map[string]opslevel.Tier),
+		Lifecycles:   make(map[string]opslevel.Lifecycle),
+		Teams:        make(map[string]opslevel.Team),
+		Categories:   make(map[string]opslevel.Category),
+		Levels:       make(map[string]opslevel.Level),
+		Filters:      make(map[string]opslevel.Filter),
+		Integrations: make(map[string]opslevel.Integration),
+		Repositories: make(map[string]opslevel.Repository),
+	}
+	accountCaches[account] = cache
+	return cache
+}
+
+// ReconcileService creates or updates the service in OpsLevel and returns a summary of what was done
+func ReconcileService(client *opslevel.Client, service ServiceRegistration) ServiceResult {
+	result := newServiceResult(service)
+	if len(service.Aliases) <= 0 {
+		result.Action = ServiceAction_Skipped
+		result.warned("found 0 aliases from kubernetes data")
+		reportStatus(service, ServiceStatus_Failed)
+		return *result
+	}
 	log.Trace().Msgf("[%s] Parsed Data: \n%s", service.Name, service.toPrettyJson())
+	reportStatus(service, ServiceStatus_LookingUp)
 	foundService, foundServiceStatus := validateServiceAliases(client, service)
 	switch foundServiceStatus {
 	case serviceAliasesResult_NoAliasesMatched:
-		newService, newServiceErr := createService(client, service)
+		reportStatus(service, ServiceStatus_Creating)
+		desired := serviceState{}
+		desired.apply(service, true)
+		result.Diff = cmp.Diff(serviceState{}, desired)
+		newService, newServiceErr := createService(client, service, result)
 		if newServiceErr != nil {
 			log.Warn().Msgf("[%s] api error during service creation ... skipping reconciliation.\n\tREASON: %v", service.Name, newServiceErr)
-			return
+			result.Action = ServiceAction_Failed
+			reportStatus(service, ServiceStatus_Failed)
+			return *result
 		}
+		result.Action = ServiceAction_Created
 		foundService = newService
 	case serviceAliasesResult_AliasMatched:
-		updateService(client, service, foundService)
+		reportStatus(service, ServiceStatus_Updating)
+		current := newServiceState(foundService)
+		current.sort()
+		desired := newServiceState(foundService)
+		desired.apply(withDefaultRepositoryAliases(client, service), false)
+		result.Diff = cmp.Diff(current, desired)
+		result.Action = ServiceAction_Unchanged
+		if result.Diff != "" {
+			result.Action = ServiceAction_Updated
+		}
+		updateService(client, service, foundService, result)
 
 	case serviceAliasesResult_MultipleServicesFound:
-		log.Warn().Msgf("[%s] found multiple services with aliases = [\"%s\"].  cannot know which service to target for update ... skipping reconciliation", service.Name, strings.Join(service.Aliases, "\", \""))
-		return
+		result.Action = ServiceAction_Skipped
+		result.warned("found multiple services with aliases = [\"%s\"].  cannot know which service to target for update ... skipping reconciliation", strings.Join(service.Aliases, "\", \""))
+		reportStatus(service, ServiceStatus_Failed)
+		return *result
 	case serviceAliasesResult_APIErrorHappened:
-		log.Warn().Msgf("[%s] api error during service lookup by alias.  unable to guarentee service was found or not ... skipping reconciliation", service.Name)
-		return
+		result.Action = ServiceAction_Failed
+		result.failed(fmt.Errorf("api error during service lookup by alias"), "unable to guarentee service was found or not ... skipping reconciliation")
+		reportStatus(service, ServiceStatus_Failed)
+		return *result
 	}
 
-	handleAliases(client, service, foundService)
-	handleTags(client, service, foundService)
-	handleTools(client, service, foundService)
-	handleRepositories(client, service, foundService)
+	handleAliases(client, service, foundService, result)
+	reportStatus(service, ServiceStatus_UpdatingTags)
+	handleTags(client, service, foundService, result)
+	handleTools(client, service, foundService, result)
+	handleRepositories(client, service, foundService, result)
+	handleDocs(client, service, foundService, result)
+	handleNote(client, service, foundService, result)
+	handleProperties(client, service, foundService, result)
+	handleSystem(client, service, foundService, result)
+	handleType(client, service, foundService, result)
+	handleDependencies(client, service, foundService, result)
+	handleCheckPayload(service, result)
+	handleManagedBy(client, service, foundService, result)
+	if service.IdleSince != "" {
+		result.warned("no ready endpoints since %s - the service looks unused", service.IdleSince)
+	}
 	log.Info().Msgf("[%s] Finished processing data", foundService.Name)
+	reportStatus(service, ServiceStatus_Done)
+	return *result
 }
 
 type serviceAliasesResult string
@@ -58,33 +150,38 @@ const (
 // serviceAliasesResult_MultipleServicesFound - means that all API calls succeeded but multiple services were returning means the list of aliases does not definitively describe a single service and might be a configuration problem
 // serviceAliasesResult_APIErrorHappened - means that 1 of N aliases got an 4xx/5xx and thereforce we cannot say 100% that the services doesn't exist
 func validateServiceAliases(client *opslevel.Client, registration ServiceRegistration) (*opslevel.Service, serviceAliasesResult) {
-	var gotError error
-	foundServices := map[string]*opslevel.Service{}
-	for _, alias := range registration.Aliases {
-		foundService, err := client.GetServiceWithAlias(alias)
+	ids, missing := takePrefetchedAliases(registration.Account, registration.Aliases)
+	if len(missing) > 0 {
+		looked, err := lookupServiceIds(client, missing)
 		if err != nil {
-			gotError = err
-		} else {
-			if foundService.Id != nil {
-				foundServices[foundService.Id.(string)] = foundService
-			}
+			return nil, serviceAliasesResult_APIErrorHappened
+		}
+		for alias, id := range looked {
+			ids[alias] = id
 		}
 	}
-	if gotError != nil {
-		return nil, serviceAliasesResult_APIErrorHappened
+	foundIds := map[string]graphql.ID{}
+	for _, id := range ids {
+		if id != nil {
+			foundIds[fmt.Sprint(id)] = id
+		}
 	}
-	foundServicesCount := len(foundServices)
+	foundServicesCount := len(foundIds)
 	if foundServicesCount > 1 {
 		return nil, serviceAliasesResult_MultipleServicesFound
 	}
 	if foundServicesCount < 1 {
 		return nil, serviceAliasesResult_NoAliasesMatched
 	}
-	output := []*opslevel.Service{}
-	for _, value := range foundServices {
-		output = append(output, value)
+	var foundId graphql.ID
+	for _, id := range foundIds {
+		foundId = id
 	}
-	return output[0], serviceAliasesResult_AliasMatched
+	foundService, err := client.GetService(foundId)
+	if err != nil || foundService.Id == nil {
+		return nil, serviceAliasesResult_APIErrorHappened
+	}
+	return foundService, serviceAliasesResult_AliasMatched
 }
 
 func serviceNeedsUpdate(input opslevel.ServiceUpdateInput, service *opslevel.Service) bool {
@@ -115,7 +212,7 @@ func serviceNeedsUpdate(input opslevel.ServiceUpdateInput, service *opslevel.Ser
 	return false
 }
 
-func createService(client *opslevel.Client, registration ServiceRegistration) (*opslevel.Service, error) {
+func createService(client *opslevel.Client, registration ServiceRegistration, result *ServiceResult) (*opslevel.Service, error) {
 	serviceCreateInput := opslevel.ServiceCreateInput{
 		Name:        registration.Name,
 		Product:     registration.Product,
@@ -123,31 +220,33 @@ func createService(client *opslevel.Client, registration ServiceRegistration) (*
 		Language:    registration.Language,
 		Framework:   registration.Framework,
 	}
-	if v, ok := opslevel.Cache.TryGetTier(registration.Tier); ok {
+	if v, ok := lookupTier(client, registration.Account, registration.Tier); ok {
 		serviceCreateInput.Tier = string(v.Alias)
 	} else if registration.Tier != "" {
-		log.Warn().Msgf("[%s] Unable to find 'Tier' with alias '%s'", registration.Name, registration.Tier)
+		result.warned("Unable to find 'Tier' with alias '%s'", registration.Tier)
 	}
-	if v, ok := opslevel.Cache.TryGetLifecycle(registration.Lifecycle); ok {
+	if v, ok := lookupLifecycle(client, registration.Account, registration.Lifecycle); ok {
 		serviceCreateInput.Lifecycle = string(v.Alias)
 	} else if registration.Lifecycle != "" {
-		log.Warn().Msgf("[%s] Unable to find 'Lifecycle' with alias '%s'", registration.Name, registration.Lifecycle)
+		result.warned("Unable to find 'Lifecycle' with alias '%s'", registration.Lifecycle)
+	}
+	if owner := resolveOwner(client, registration, result); owner != "" {
+		serviceCreateInput.Owner = owner
 	}
-	if v, ok := opslevel.Cache.TryGetTeam(registration.Owner); ok {
-		serviceCreateInput.Owner = string(v.Alias)
-	} else if registration.Owner != "" {
-		log.Warn().Msgf("[%s] Unable to find 'Team' with alias '%s'", registration.Name, registration.Owner)
+	if result.dryRun("create service with input %+v", serviceCreateInput) {
+		return &opslevel.Service{Name: registration.Name}, nil
 	}
 	service, err := client.CreateService(serviceCreateInput)
+	audit(registration.Name, registration.Aliases, "serviceCreate", serviceCreateInput, err)
 	if err != nil {
-		log.Error().Msgf("[%s] Failed creating service\n\tREASON: %v", registration.Name, err.Error())
+		result.failed(err, "Failed creating service")
 	} else {
-		log.Info().Msgf("[%s] Created new service", service.Name)
+		result.changed("Created new service")
 	}
 	return service, err
 }
 
-func updateService(client *opslevel.Client, registration ServiceRegistration, service *opslevel.Service) {
+func updateService(client *opslevel.Client, registration ServiceRegistration, service *opslevel.Service, result *ServiceResult) {
 	updateServiceInput := opslevel.ServiceUpdateInput{
 		Id:          service.Id,
 		Product:     registration.Product,
@@ -155,28 +254,30 @@ func updateService(client *opslevel.Client, registration ServiceRegistration, se
 		Language:    registration.Language,
 		Framework:   registration.Framework,
 	}
-	if v, ok := opslevel.Cache.TryGetTier(registration.Tier); ok {
+	if v, ok := lookupTier(client, registration.Account, registration.Tier); ok {
 		updateServiceInput.Tier = string(v.Alias)
 	} else if registration.Tier != "" {
-		log.Warn().Msgf("[%s] Unable to find 'Tier' with alias '%s'", service.Name, registration.Tier)
+		result.warned("Unable to find 'Tier' with alias '%s'", registration.Tier)
 	}
-	if v, ok := opslevel.Cache.TryGetLifecycle(registration.Lifecycle); ok {
+	if v, ok := lookupLifecycle(client, registration.Account, registration.Lifecycle); ok {
 		updateServiceInput.Lifecycle = string(v.Alias)
 	} else if registration.Lifecycle != "" {
-		log.Warn().Msgf("[%s] Unable to find 'Lifecycle' with alias '%s'", service.Name, registration.Lifecycle)
+		result.warned("Unable to find 'Lifecycle' with alias '%s'", registration.Lifecycle)
 	}
-	if v, ok := opslevel.Cache.TryGetTeam(registration.Owner); ok {
-		updateServiceInput.Owner = string(v.Alias)
-	} else if registration.Owner != "" {
-		log.Warn().Msgf("[%s] Unable to find 'Team' with alias '%s'", service.Name, registration.Owner)
+	if owner := resolveOwner(client, registration, result); owner != "" {
+		updateServiceInput.Owner = owner
 	}
 	if serviceNeedsUpdate(updateServiceInput, service) {
+		if result.dryRun("update service with input %+v", updateServiceInput) {
+			return
+		}
 		updatedService, updateServiceErr := client.UpdateService(updateServiceInput)
+		audit(registration.Name, registration.Aliases, "serviceUpdate", updateServiceInput, updateServiceErr)
 		if updateServiceErr != nil {
-			log.Error().Msgf("[%s] Failed updating service\n\tREASON: %v", service.Name, updateServiceErr.Error())
+			result.failed(updateServiceErr, "Failed updating service")
 		} else {
 			if diff := cmp.Diff(service, updatedService); diff != "" {
-				log.Info().Msgf("[%s] Updated Service - Diff:\n%s", service.Name, diff)
+				result.changed("Updated Service - Diff:\n%s", diff)
 			}
 		}
 	} else {
@@ -184,26 +285,32 @@ func updateService(client *opslevel.Client, registration ServiceRegistration, se
 	}
 }
 
-func handleAliases(client *opslevel.Client, registration ServiceRegistration, service *opslevel.Service) {
+func handleAliases(client *opslevel.Client, registration ServiceRegistration, service *opslevel.Service, result *ServiceResult) {
 	for _, alias := range registration.Aliases {
 		if alias == "" || service.HasAlias(alias) {
 			continue
 		}
-		_, err := client.CreateAlias(opslevel.AliasCreateInput{
+		if result.dryRun("assign alias '%s'", alias) {
+			continue
+		}
+		input := opslevel.AliasCreateInput{
 			Alias:   alias,
 			OwnerId: service.Id,
-		})
+		}
+		_, err := client.CreateAlias(input)
+		audit(registration.Name, registration.Aliases, "aliasCreate", input, err)
 		if err != nil {
-			log.Error().Msgf("[%s] Failed assigning alias '%s'\n\tREASON: %v", service.Name, alias, err.Error())
+			result.failed(err, "Failed assigning alias '%s'", alias)
 		} else {
-			log.Info().Msgf("[%s] Assigned alias '%s'", service.Name, alias)
+			result.changed("Assigned alias '%s'", alias)
 		}
 	}
 }
 
-func handleTags(client *opslevel.Client, registration ServiceRegistration, service *opslevel.Service) {
-	assignTags(client, registration, service)
-	createTags(client, registration, service)
+func handleTags(client *opslevel.Client, registration ServiceRegistration, service *opslevel.Service, result *ServiceResult) {
+	assignTags(client, registration, service, result)
+	createTags(client, registration, service, result)
+	handleTagRemovals(client, registration, service, result)
 }
 
 func containsAllTags(tagAssigns []opslevel.TagInput, serviceTags []opslevel.Tag) bool {
@@ -225,7 +332,7 @@ func containsAllTags(tagAssigns []opslevel.TagInput, serviceTags []opslevel.Tag)
 	return true
 }
 
-func assignTags(client *opslevel.Client, registration ServiceRegistration, service *opslevel.Service) {
+func assignTags(client *opslevel.Client, registration ServiceRegistration, service *opslevel.Service, result *ServiceResult) {
 	if registration.TagAssigns == nil {
 		return
 	}
@@ -234,19 +341,23 @@ func assignTags(client *opslevel.Client, registration ServiceRegistration, servi
 			Id:   service.Id,
 			Tags: registration.TagAssigns,
 		}
-		_, err := client.AssignTags(input)
 		jsonBytes, _ := json.Marshal(registration.TagAssigns)
+		if result.dryRun("assign tags: %s", string(jsonBytes)) {
+			return
+		}
+		_, err := client.AssignTags(input)
+		audit(registration.Name, registration.Aliases, "tagAssign", input, err)
 		if err != nil {
-			log.Error().Msgf("[%s] Failed assigning tags: %s\n\tREASON: %v", service.Name, string(jsonBytes), err.Error())
+			result.failed(err, "Failed assigning tags: %s", string(jsonBytes))
 		} else {
-			log.Info().Msgf("[%s] Assigned tags: %s", service.Name, string(jsonBytes))
+			result.changed("Assigned tags: %s", string(jsonBytes))
 		}
 	} else {
 		log.Info().Msgf("[%s] All tags already assigned to service.", service.Name)
 	}
 }
 
-func createTags(client *opslevel.Client, registration ServiceRegistration, service *opslevel.Service) {
+func createTags(client *opslevel.Client, registration ServiceRegistration, service *opslevel.Service, result *ServiceResult) {
 	for _, tag := range registration.TagCreates {
 		if service.HasTag(tag.Key, tag.Value) {
 			continue
@@ -256,52 +367,90 @@ func createTags(client *opslevel.Client, registration ServiceRegistration, servi
 			Key:   tag.Key,
 			Value: tag.Value,
 		}
+		if result.dryRun("create tag '%s = %s'", tag.Key, tag.Value) {
+			continue
+		}
 		_, err := client.CreateTag(input)
+		audit(registration.Name, registration.Aliases, "tagCreate", input, err)
 		if err != nil {
-			log.Error().Msgf("[%s] Failed creating tag '%s = %s'\n\tREASON: %v", service.Name, tag.Key, tag.Value, err.Error())
+			result.failed(err, "Failed creating tag '%s = %s'", tag.Key, tag.Value)
 		} else {
-			log.Info().Msgf("[%s] Created tag '%s = %s'", service.Name, tag.Key, tag.Value)
+			result.changed("Created tag '%s = %s'", tag.Key, tag.Value)
+		}
+	}
+}
+
+// findTool returns the tool of the service with the category, name and environment - tools are tracked by these three
+// so a tool whose url changes is updated rather than created again
+func findTool(service *opslevel.Service, category opslevel.ToolCategory, name string, environment string) *opslevel.Tool {
+	for _, tool := range service.Tools.Nodes {
+		if tool.Category == category && tool.DisplayName == name && tool.Environment == environment {
+			return &tool
 		}
 	}
+	return nil
 }
 
-func handleTools(client *opslevel.Client, registration ServiceRegistration, service *opslevel.Service) {
+func handleTools(client *opslevel.Client, registration ServiceRegistration, service *opslevel.Service, result *ServiceResult) {
 	for _, tool := range registration.Tools {
-		if service.HasTool(tool.Category, tool.DisplayName, tool.Environment) {
-			log.Debug().Msgf("[%s] Tool '{Category: %s, Environment: %s, Name: %s}' already exists on service ... skipping", service.Name, tool.Category, tool.Environment, tool.DisplayName)
+		if existing := findTool(service, tool.Category, tool.DisplayName, tool.Environment); existing != nil {
+			if tool.Url == "" || existing.Url == tool.Url {
+				log.Debug().Msgf("[%s] Tool '{Category: %s, Environment: %s, Name: %s}' already exists on service ... skipping", service.Name, tool.Category, tool.Environment, tool.DisplayName)
+				continue
+			}
+			if result.dryRun("update tool '{Category: %s, Environment: %s, Name: %s}' url to '%s'", tool.Category, tool.Environment, tool.DisplayName, tool.Url) {
+				continue
+			}
+			toolUpdate := opslevel.ToolUpdateInput{Id: existing.Id, Url: tool.Url}
+			_, err := client.UpdateTool(toolUpdate)
+			audit(registration.Name, registration.Aliases, "toolUpdate", toolUpdate, err)
+			if err != nil {
+				result.failed(err, "Failed updating tool '{Category: %s, Environment: %s, Name: %s}'", tool.Category, tool.Environment, tool.DisplayName)
+			} else {
+				result.changed("Updated tool '{Category: %s, Environment: %s, Name: %s}' url to '%s'", tool.Category, tool.Environment, tool.DisplayName, tool.Url)
+			}
 			continue
 		}
 		tool.ServiceId = service.Id
+		if result.dryRun("create tool '{Category: %s, Environment: %s, Name: %s}'", tool.Category, tool.Environment, tool.DisplayName) {
+			continue
+		}
 		_, err := client.CreateTool(tool)
+		audit(registration.Name, registration.Aliases, "toolCreate", tool, err)
 		if err != nil {
-			log.Error().Msgf("[%s] Failed assigning tool '{Category: %s, Environment: %s, Name: %s}'\n\tREASON: %v", service.Name, tool.Category, tool.Environment, tool.DisplayName, err.Error())
+			result.failed(err, "Failed assigning tool '{Category: %s, Environment: %s, Name: %s}'", tool.Category, tool.Environment, tool.DisplayName)
 		} else {
-			log.Info().Msgf("[%s] Ensured tool '{Category: %s, Environment: %s, Name: %s}'", service.Name, tool.Category, tool.Environment, tool.DisplayName)
+			result.changed("Ensured tool '{Category: %s, Environment: %s, Name: %s}'", tool.Category, tool.Environment, tool.DisplayName)
 		}
 	}
 }
 
-func handleRepositories(client *opslevel.Client, registration ServiceRegistration, service *opslevel.Service) {
+func handleRepositories(client *opslevel.Client, registration ServiceRegistration, service *opslevel.Service, result *ServiceResult) {
 	for _, repositoryCreate := range registration.Repositories {
 		repositoryAsString := fmt.Sprintf("{Alias: %s, Directory: %s, Name: %s}", repositoryCreate.Repository.Alias, repositoryCreate.BaseDirectory, repositoryCreate.DisplayName)
-		foundRepository, foundRepositoryErr := client.GetRepositoryWithAlias(string(repositoryCreate.Repository.Alias))
+		foundRepository, foundRepositoryErr := getRepositoryWithAlias(client, registration.Account, string(repositoryCreate.Repository.Alias))
 		if foundRepositoryErr != nil {
-			log.Warn().Msgf("[%s] Repository with alias: '%s' not found so it cannot be attached to service ... skipping", service.Name, repositoryAsString)
+			result.warned("Repository with alias: '%s' not found so it cannot be attached to service ... skipping", repositoryAsString)
 			continue
 		}
-		serviceRepository := foundRepository.GetService(service.Id, repositoryCreate.BaseDirectory)
+		serviceRepository := foundRepository.serviceRepository(service.Id, repositoryCreate.BaseDirectory)
 		if serviceRepository != nil {
 			if repositoryCreate.DisplayName != "" && serviceRepository.DisplayName != repositoryCreate.DisplayName {
 				repositoryUpdate := opslevel.ServiceRepositoryUpdateInput{
 					Id:          serviceRepository.Id,
 					DisplayName: repositoryCreate.DisplayName,
 				}
-				_, err := client.UpdateServiceRepository(repositoryUpdate)
+				if result.dryRun("update repository '%s'", repositoryAsString) {
+					continue
+				}
+				updated, err := client.UpdateServiceRepository(repositoryUpdate)
+				audit(registration.Name, registration.Aliases, "serviceRepositoryUpdate", repositoryUpdate, err)
 				if err != nil {
-					log.Error().Msgf("[%s] Failed updating repository '%s'\n\tREASON: %v", service.Name, repositoryAsString, err.Error())
+					result.failed(err, "Failed updating repository '%s'", repositoryAsString)
 					continue
 				} else {
-					log.Info().Msgf("[%s] Updated repository '%s'", service.Name, repositoryAsString)
+					foundRepository.remember(updated)
+					result.changed("Updated repository '%s'", repositoryAsString)
 					continue
 				}
 			}
@@ -309,11 +458,31 @@ func handleRepositories(client *opslevel.Client, registration ServiceRegistratio
 			continue
 		}
 		repositoryCreate.Service = opslevel.IdentifierInput{Id: service.Id}
-		_, err := client.CreateServiceRepository(repositoryCreate)
+		if result.dryRun("attach repository '%s'", repositoryAsString) {
+			continue
+		}
+		created, err := client.CreateServiceRepository(repositoryCreate)
+		audit(registration.Name, registration.Aliases, "serviceRepositoryCreate", repositoryCreate, err)
 		if err != nil {
-			log.Error().Msgf("[%s] Failed assigning repository '%s'\n\tREASON: %v", service.Name, repositoryAsString, err.Error())
+			result.failed(err, "Failed assigning repository '%s'", repositoryAsString)
 		} else {
-			log.Info().Msgf("[%s] Attached repository '%s'", service.Name, repositoryAsString)
+			foundRepository.remember(created)
+			result.changed("Attached repository '%s'", repositoryAsString)
 		}
 	}
 }
+
+// DeleteService removes the service from OpsLevel honoring DryRun
+func DeleteService(client *opslevel.Client, service *opslevel.Service) error {
+	if isDryRun(service.Name, "delete service") {
+		return nil
+	}
+	input := opslevel.ServiceDeleteInput{Id: service.Id}
+	err := client.DeleteService(input)
+	audit(service.Name, service.Aliases, "serviceDelete", input, err)
+	if err != nil {
+		return err
+	}
+	log.Info().Msgf("[%s] Deleted service", service.Name)
+	return nil
+}
@@ -7,12 +7,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/opslevel/kubectl-opslevel/config"
 	"github.com/opslevel/opslevel-go/v2022"
 	"github.com/rocktavious/autopilot"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/shurcooL/graphql"
 )
 
 // Helper Functions
@@ -274,11 +277,15 @@ func Test_ValidateServiceAliases_WhenNoAliasesMatch(t *testing.T) {
 
 func Test_ValidateServiceAliases_WhenSuccessfulMatch(t *testing.T) {
 	// Arrange
+	lookupResponse := StringMockResponse{
+		Status: http.StatusOK,
+		Data:   `{"data": {"account": {"s0": {"id": "XXX"}, "s1": {"id": "XXX"}, "s2": null}}}`,
+	}
 	mockedResponse := FixtureMockResponse{
 		Status: http.StatusOK,
 		Path:   "service",
 	}
-	mockedClient, mockedServer := AMockedClient(mockedResponse, mockedResponse, mockedResponse)
+	mockedClient, mockedServer := AMockedClient(lookupResponse, mockedResponse)
 	defer mockedServer.Close()
 	registration := ServiceRegistration{
 		Name: "Test",
@@ -297,19 +304,11 @@ func Test_ValidateServiceAliases_WhenSuccessfulMatch(t *testing.T) {
 
 func Test_ValidateServiceAliases_WhenAliasesMatchMoreThenOneService(t *testing.T) {
 	// Arrange
-	mockedResponse1 := FixtureMockResponse{
-		Status: http.StatusOK,
-		Path:   "service",
-	}
-	mockedResponse2 := StringMockResponse{
-		Status: http.StatusOK,
-		Data:   "{}",
-	}
-	mockedResponse3 := FixtureMockResponse{
+	mockedResponse := StringMockResponse{
 		Status: http.StatusOK,
-		Path:   "service2",
+		Data:   `{"data": {"account": {"s0": {"id": "XXX"}, "s1": null, "s2": {"id": "YYY"}}}}`,
 	}
-	mockedClient, mockedServer := AMockedClient(mockedResponse1, mockedResponse2, mockedResponse3)
+	mockedClient, mockedServer := AMockedClient(mockedResponse)
 	defer mockedServer.Close()
 	registration := ServiceRegistration{
 		Name: "Test",
@@ -336,7 +335,7 @@ func Test_ValidateServiceAliases_WhenHasNon200(t *testing.T) {
 		Status: http.StatusRequestTimeout,
 		Data:   "{}",
 	}
-	mockedClient, mockedServer := AMockedClient(mockedResponse1, mockedResponse2, mockedResponse1)
+	mockedClient, mockedServer := AMockedClient(mockedResponse2, mockedResponse1, mockedResponse1)
 	defer mockedServer.Close()
 	registration := ServiceRegistration{
 		Name: "Test",
@@ -352,3 +351,588 @@ func Test_ValidateServiceAliases_WhenHasNon200(t *testing.T) {
 	autopilot.Equals(t, (*opslevel.Service)(nil), service)
 	autopilot.Equals(t, serviceAliasesResult_APIErrorHappened, status)
 }
+
+func Test_SummarizeResults_CountsActionsAndPartialErrors(t *testing.T) {
+	// Arrange
+	results := []ServiceResult{
+		{Name: "a", Action: ServiceAction_Created},
+		{Name: "b", Action: ServiceAction_Updated, Errors: []string{"Failed creating tag 'a = b': boom"}},
+		{Name: "c", Action: ServiceAction_Unchanged},
+		{Name: "d", Action: ServiceAction_Failed, Errors: []string{"boom"}},
+	}
+	// Act
+	summary := SummarizeResults(results)
+	// Assert
+	autopilot.Equals(t, ServiceResultsSummary{Total: 4, Created: 1, Updated: 1, Unchanged: 1, Failed: 1, Errored: 1}, summary)
+	autopilot.Equals(t, true, results[1].HasErrors())
+	autopilot.Equals(t, false, results[2].HasErrors())
+}
+
+func Test_Audit_WritesOneJSONLinePerMutation(t *testing.T) {
+	// Arrange
+	path := t.TempDir() + "/audit.jsonl"
+	autopilot.Ok(t, OpenAuditLog(path))
+	// Act
+	audit("Test", []string{"k8s:test"}, "tagCreate", opslevel.TagCreateInput{Key: "env", Value: "prod"}, nil)
+	audit("Test", []string{"k8s:test"}, "aliasCreate", opslevel.AliasCreateInput{Alias: "k8s:test"}, fmt.Errorf("boom"))
+	autopilot.Ok(t, CloseAuditLog())
+	// Assert
+	data, err := os.ReadFile(path)
+	autopilot.Ok(t, err)
+	var entries []AuditEntry
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry AuditEntry
+		autopilot.Ok(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	autopilot.Equals(t, 2, len(entries))
+	autopilot.Equals(t, "k8s:test", entries[0].Alias)
+	autopilot.Equals(t, AuditOutcome_Success, entries[0].Outcome)
+	autopilot.Equals(t, "aliasCreate", entries[1].Operation)
+	autopilot.Equals(t, AuditOutcome_Failure, entries[1].Outcome)
+	autopilot.Equals(t, "boom", entries[1].Error)
+}
+
+func Test_HandleDependencies_CreatesDeclaredAndPrunesManagedEdges(t *testing.T) {
+	// Arrange
+	declaredDependencies, declaredByService = map[string]int{}, map[string][]string{}
+	mockedClient, mockedServer := AMockedClient(
+		StringMockResponse{Status: 200, Data: `{"data": {"account": {"service": {
+			"dependencies": {"edges": [
+				{"id": "edge-db", "locked": false, "notes": "", "node": {"id": "db", "aliases": ["k8s:db"]}},
+				{"id": "edge-old", "locked": false, "notes": "Managed by kubectl-opslevel", "node": {"id": "old", "aliases": ["k8s:old"]}},
+				{"id": "edge-manual", "locked": false, "notes": "added by hand", "node": {"id": "manual", "aliases": ["k8s:manual"]}}
+			]},
+			"dependents": {"edges": []}
+		}}}}`},
+		StringMockResponse{Status: 200, Data: `{"data": {"serviceDependencyCreate": {"errors": []}}}`},
+		StringMockResponse{Status: 200, Data: `{"data": {"serviceDependencyDelete": {"errors": []}}}`},
+	)
+	defer mockedServer.Close()
+	registration := ServiceRegistration{
+		Name:         "Test",
+		Aliases:      []string{"k8s:test"},
+		Dependencies: []string{"k8s:db", "k8s:cache"},
+	}
+	result := newServiceResult(registration)
+	// Act
+	handleDependencies(mockedClient, registration, &opslevel.Service{ServiceId: opslevel.ServiceId{Id: "test"}}, result)
+	// Assert
+	autopilot.Equals(t, []string(nil), result.Errors)
+	autopilot.Equals(t, []string{"Created dependency on 'k8s:cache'", "Removed undeclared dependency on '[k8s:old]'"}, result.Changes)
+}
+
+func Test_HandleDependencies_PrunesTheManagedEdgesOnceNothingIsDeclared(t *testing.T) {
+	// Arrange
+	declaredDependencies, declaredByService = map[string]int{}, map[string][]string{}
+	mockedClient, mockedServer := AMockedClient(
+		StringMockResponse{Status: 200, Data: `{"data": {"account": {"service": {
+			"dependencies": {"edges": [
+				{"id": "edge-old", "locked": false, "notes": "Managed by kubectl-opslevel", "node": {"id": "old", "aliases": ["k8s:old"]}}
+			]},
+			"dependents": {"edges": []}
+		}}}}`},
+		StringMockResponse{Status: 200, Data: `{"data": {"serviceDependencyDelete": {"errors": []}}}`},
+	)
+	defer mockedServer.Close()
+	registration := ServiceRegistration{Name: "Test", Aliases: []string{"k8s:test"}}
+	DeclareDependencies([]ServiceRegistration{{Name: "Test", Aliases: []string{"k8s:test"}, Dependencies: []string{"k8s:old"}}})
+	DeclareDependencies([]ServiceRegistration{registration})
+	result := newServiceResult(registration)
+	// Act
+	handleDependencies(mockedClient, registration, &opslevel.Service{ServiceId: opslevel.ServiceId{Id: "test"}}, result)
+	// Assert
+	autopilot.Equals(t, []string(nil), result.Errors)
+	autopilot.Equals(t, []string{"Removed undeclared dependency on '[k8s:old]'"}, result.Changes)
+}
+
+func Test_HandleSystem_CreatesMissingSystemAndAssignsService(t *testing.T) {
+	// Arrange
+	SetSystems(config.SystemsConfig{AutoCreate: true, Definitions: []config.SystemConfig{{Alias: "checkout", Name: "Checkout"}}})
+	defer SetSystems(config.SystemsConfig{})
+	mockedClient, mockedServer := AMockedClient(
+		StringMockResponse{Status: 200, Data: `{"data": {"account": {"system": null}}}`},
+		StringMockResponse{Status: 200, Data: `{"data": {"systemCreate": {"system": {"id": "system-1", "name": "Checkout", "aliases": ["checkout"]}, "errors": []}}}`},
+		StringMockResponse{Status: 200, Data: `{"data": {"account": {"service": {"parent": null}}}}`},
+		StringMockResponse{Status: 200, Data: `{"data": {"serviceUpdate": {"errors": []}}}`},
+	)
+	defer mockedServer.Close()
+	registration := ServiceRegistration{
+		Name:    "Test",
+		Account: "systems-test",
+		Aliases: []string{"k8s:test"},
+		System:  "checkout",
+	}
+	result := newServiceResult(registration)
+	// Act
+	handleSystem(mockedClient, registration, &opslevel.Service{ServiceId: opslevel.ServiceId{Id: "test"}}, result)
+	// Assert
+	autopilot.Equals(t, []string(nil), result.Errors)
+	autopilot.Equals(t, []string{"Created system 'checkout'", "Assigned service to system 'checkout'"}, result.Changes)
+}
+
+func Test_HandleSystem_ReconcilesDomainSystemServiceChain(t *testing.T) {
+	// Arrange
+	SetSystems(config.SystemsConfig{AutoCreate: true})
+	SetDomains(config.DomainsConfig{AutoCreate: true})
+	defer SetSystems(config.SystemsConfig{})
+	defer SetDomains(config.DomainsConfig{})
+	mockedClient, mockedServer := AMockedClient(
+		StringMockResponse{Status: 200, Data: `{"data": {"account": {"domain": null}}}`},
+		StringMockResponse{Status: 200, Data: `{"data": {"domainCreate": {"domain": {"id": "domain-1", "name": "commerce", "aliases": ["commerce"]}, "errors": []}}}`},
+		StringMockResponse{Status: 200, Data: `{"data": {"account": {"system": {"id": "system-1", "name": "checkout", "aliases": ["checkout"]}}}}`},
+		StringMockResponse{Status: 200, Data: `{"data": {"account": {"system": {"parent": null}}}}`},
+		StringMockResponse{Status: 200, Data: `{"data": {"systemUpdate": {"errors": []}}}`},
+		StringMockResponse{Status: 200, Data: `{"data": {"account": {"service": {"parent": {"id": "system-1", "name": "checkout", "aliases": ["checkout"]}}}}}`},
+	)
+	defer mockedServer.Close()
+	registration := ServiceRegistration{
+		Name:    "Test",
+		Account: "domains-test",
+		Aliases: []string{"k8s:test"},
+		System:  "checkout",
+		Domain:  "commerce",
+	}
+	result := newServiceResult(registration)
+	// Act
+	handleSystem(mockedClient, registration, &opslevel.Service{ServiceId: opslevel.ServiceId{Id: "test"}}, result)
+	// Assert
+	autopilot.Equals(t, []string(nil), result.Errors)
+	autopilot.Equals(t, []string{"Created domain 'commerce'", "Assigned system 'checkout' to domain 'commerce'"}, result.Changes)
+}
+
+func Test_HandleProperties_AssignsOnlyChangedValues(t *testing.T) {
+	// Arrange
+	mockedClient, mockedServer := AMockedClient(
+		StringMockResponse{Status: 200, Data: `{"data": {"account": {"service": {"properties": {"nodes": [
+			{"definition": {"id": "def-1", "aliases": ["Replicas"]}, "value": "3"},
+			{"definition": {"id": "def-2", "aliases": ["runtime"]}, "value": "{\"image\": \"nginx:0\"}"}
+		]}}}}}`},
+		StringMockResponse{Status: 200, Data: `{"data": {"propertyAssign": {"errors": []}}}`},
+	)
+	defer mockedServer.Close()
+	registration := ServiceRegistration{
+		Name:       "Test",
+		Aliases:    []string{"k8s:test"},
+		Properties: map[string]string{"replicas": "3", "runtime": `{"image":"nginx:1"}`},
+	}
+	result := newServiceResult(registration)
+	// Act
+	handleProperties(mockedClient, registration, &opslevel.Service{ServiceId: opslevel.ServiceId{Id: "test"}}, result)
+	// Assert
+	autopilot.Equals(t, []string(nil), result.Errors)
+	autopilot.Equals(t, []string{`Assigned property 'runtime = {"image":"nginx:1"}'`}, result.Changes)
+}
+
+func Test_FindTeam_ResolvesAnIDOncePerRun(t *testing.T) {
+	// Arrange
+	id := "Z2lkOi8vb3BzbGV2ZWwvVGVhbS8xMjM"
+	teamResponse := StringMockResponse{
+		Status: http.StatusOK,
+		Data:   `{"data": {"account": {"team": {"id": "Z2lkOi8vb3BzbGV2ZWwvVGVhbS8xMjM", "alias": "payments"}}}}`,
+	}
+	client, server := AMockedClient(teamResponse, teamResponse)
+	defer server.Close()
+	// Act
+	team, err := findTeam(client, "", id)
+	cached, cachedErr := findTeam(nil, "", id)
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Ok(t, cachedErr)
+	autopilot.Equals(t, "payments", team.Alias)
+	autopilot.Equals(t, team, cached)
+}
+
+func Test_FindTeam_ResolvesAnIDOncePerAccount(t *testing.T) {
+	// Arrange
+	id := "Z2lkOi8vb3BzbGV2ZWwvVGVhbS80NTY"
+	teamResponse := StringMockResponse{
+		Status: http.StatusOK,
+		Data:   `{"data": {"account": {"team": {"id": "Z2lkOi8vb3BzbGV2ZWwvVGVhbS80NTY", "alias": "payments"}}}}`,
+	}
+	client, server := AMockedClient(teamResponse)
+	defer server.Close()
+	// Act
+	team, err := findTeam(client, "eu", id)
+	other, otherErr := findTeam(nil, "us", id)
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Ok(t, otherErr)
+	autopilot.Equals(t, "payments", team.Alias)
+	autopilot.Assert(t, other == nil, "expected the team of another account to not be cached but got %v", other)
+}
+
+func Test_GetServiceFilter_ListsEveryPage(t *testing.T) {
+	// Arrange
+	filters := StringMockResponse{
+		Status: http.StatusOK,
+		Data:   `{"data": {"account": {"filters": {"nodes": [{"id": "Z2lkOi8vb3BzbGV2ZWwvRmlsdGVyLzE", "name": "Tier 1 Payments"}], "pageInfo": {"hasNextPage": false}, "totalCount": 1}}}}`,
+	}
+	page1 := StringMockResponse{
+		Status: http.StatusOK,
+		Data:   `{"data": {"account": {"services": {"nodes": [{"aliases": ["checkout", "checkout-api"]}], "pageInfo": {"hasNextPage": true, "endCursor": "MQ"}}}}}`,
+	}
+	page2 := StringMockResponse{
+		Status: http.StatusOK,
+		Data:   `{"data": {"account": {"services": {"nodes": [{"aliases": ["payments"]}], "pageInfo": {"hasNextPage": false}}}}}`,
+	}
+	client, server := AMockedClient(filters, page1, page2)
+	defer server.Close()
+	// Act
+	filter, err := GetServiceFilter(client, "tier-1-payments")
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Equals(t, 3, filter.Size())
+	autopilot.Equals(t, true, filter.Matches(ServiceRegistration{Aliases: []string{"payments"}}))
+	autopilot.Equals(t, false, filter.Matches(ServiceRegistration{Aliases: []string{"inventory"}}))
+}
+
+func Test_CheckCoverage(t *testing.T) {
+	// Arrange
+	notFound := StringMockResponse{
+		Status: http.StatusOK,
+		Data:   "{}",
+	}
+	client, server := AMockedClient(notFound, notFound)
+	defer server.Close()
+	// Act
+	created := CheckCoverage(client, ServiceRegistration{Name: "web", Namespace: "shop", Aliases: []string{"web"}})
+	failed := CheckCoverage(client, ServiceRegistration{Name: "api", Namespace: "shop", Tier: "tier_9", Aliases: []string{"api"}})
+	// Assert
+	autopilot.Equals(t, CoverageStatus_New, created.Status)
+	autopilot.Equals(t, "shop", created.Namespace)
+	autopilot.Equals(t, CoverageStatus_Failed, failed.Status)
+	autopilot.Equals(t, []string{"unable to find 'Tier' with alias 'tier_9'"}, failed.Problems)
+}
+
+func Test_PrefetchServiceAliases_BatchesLookups(t *testing.T) {
+	// Arrange
+	var aliases []string
+	for i := 0; i < aliasBatchSize+1; i++ {
+		aliases = append(aliases, fmt.Sprintf("alias-%d", i))
+	}
+	firstBatch := StringMockResponse{
+		Status: http.StatusOK,
+		Data:   `{"data": {"account": {"s3": {"id": "XXX"}}}}`,
+	}
+	secondBatch := StringMockResponse{
+		Status: http.StatusOK,
+		Data:   `{"data": {"account": {"s0": null}}}`,
+	}
+	client, server := AMockedClient(firstBatch, secondBatch)
+	defer server.Close()
+	// Act
+	PrefetchServiceAliases(map[string]*opslevel.Client{"": client}, []ServiceRegistration{{Aliases: aliases}})
+	found, missing := takePrefetchedAliases("", []string{"alias-3", "alias-50", "other"})
+	_, again := takePrefetchedAliases("", []string{"alias-3"})
+	// Assert
+	autopilot.Equals(t, "XXX", found["alias-3"])
+	autopilot.Equals(t, nil, found["alias-50"])
+	autopilot.Equals(t, []string{"other"}, missing)
+	autopilot.Equals(t, []string{"alias-3"}, again)
+	prefetchedAliases = map[string]graphql.ID{}
+}
+
+func Test_ListServices_ListsEveryPage(t *testing.T) {
+	// Arrange
+	page1 := StringMockResponse{
+		Status: http.StatusOK,
+		Data:   `{"data": {"account": {"services": {"nodes": [{"id": "XXX", "name": "checkout", "aliases": ["checkout"]}], "pageInfo": {"hasNextPage": true, "endCursor": "MQ"}}}}}`,
+	}
+	page2 := StringMockResponse{
+		Status: http.StatusOK,
+		Data:   `{"data": {"account": {"services": {"nodes": [{"id": "YYY", "name": "payments", "aliases": ["payments", "payments-api"]}], "pageInfo": {"hasNextPage": false}}}}}`,
+	}
+	client, server := AMockedClient(page1, page2)
+	defer server.Close()
+	tag := opslevel.NewTagArgs("managed-by:kubectl-opslevel")
+	// Act
+	services, err := ListServices(client, &tag)
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Equals(t, 2, len(services))
+	autopilot.Equals(t, "payments", services[1].Name)
+	autopilot.Equals(t, []string{"payments", "payments-api"}, services[1].Aliases)
+}
+
+func Test_HandleRepositories_LooksUpASharedRepositoryOnce(t *testing.T) {
+	// Arrange
+	mockedClient, mockedServer := AMockedClient(
+		StringMockResponse{Status: 200, Data: `{"data": {"account": {"repository": {"id": "repo-1", "defaultAlias": "github.com:org/monorepo", "services": {"edges": [], "pageInfo": {"hasNextPage": false}}, "tags": {"nodes": [], "pageInfo": {"hasNextPage": false}}}}}}`},
+		StringMockResponse{Status: 200, Data: `{"data": {"serviceRepositoryCreate": {"serviceRepository": {"id": "sr-1", "baseDirectory": "/api", "service": {"id": "service-1"}}, "errors": []}}}`},
+		StringMockResponse{Status: 200, Data: `{"data": {"serviceRepositoryCreate": {"serviceRepository": {"id": "sr-2", "baseDirectory": "/web", "service": {"id": "service-2"}}, "errors": []}}}`},
+	)
+	defer mockedServer.Close()
+	defer ResetRepositoryLookups()
+	registration := func(directory string) ServiceRegistration {
+		return ServiceRegistration{
+			Name:    "Test",
+			Aliases: []string{"k8s:test"},
+			Repositories: []opslevel.ServiceRepositoryCreateInput{
+				{Repository: opslevel.IdentifierInput{Alias: "github.com:org/monorepo"}, BaseDirectory: directory},
+			},
+		}
+	}
+	api, web, again := newServiceResult(registration("/api")), newServiceResult(registration("/web")), newServiceResult(registration("/api"))
+	// Act
+	handleRepositories(mockedClient, registration("/api"), &opslevel.Service{ServiceId: opslevel.ServiceId{Id: "service-1"}}, api)
+	handleRepositories(mockedClient, registration("/web"), &opslevel.Service{ServiceId: opslevel.ServiceId{Id: "service-2"}}, web)
+	handleRepositories(mockedClient, registration("/api"), &opslevel.Service{ServiceId: opslevel.ServiceId{Id: "service-1"}}, again)
+	// Assert
+	autopilot.Equals(t, []string{"Attached repository '{Alias: github.com:org/monorepo, Directory: /api, Name: }'"}, api.Changes)
+	autopilot.Equals(t, []string{"Attached repository '{Alias: github.com:org/monorepo, Directory: /web, Name: }'"}, web.Changes)
+	autopilot.Equals(t, []string(nil), again.Changes)
+	autopilot.Equals(t, []string(nil), again.Errors)
+}
+
+func Test_HandleTools_UpdatesChangedUrls(t *testing.T) {
+	// Arrange
+	mockedClient, mockedServer := AMockedClient(
+		StringMockResponse{Status: 200, Data: `{"data": {"toolUpdate": {"tool": {"id": "tool-1", "url": "https://grafana.example.com/d/new"}, "errors": []}}}`},
+	)
+	defer mockedServer.Close()
+	registration := ServiceRegistration{
+		Name:    "Test",
+		Aliases: []string{"k8s:test"},
+		Tools: []opslevel.ToolCreateInput{
+			{Category: opslevel.ToolCategoryMetrics, DisplayName: "Grafana", Url: "https://grafana.example.com/d/new"},
+			{Category: opslevel.ToolCategoryLogs, DisplayName: "Kibana", Url: "https://kibana.example.com"},
+		},
+	}
+	service := &opslevel.Service{ServiceId: opslevel.ServiceId{Id: "test"}}
+	service.Tools.Nodes = []opslevel.Tool{
+		{Id: "tool-1", Category: opslevel.ToolCategoryMetrics, DisplayName: "Grafana", Url: "https://grafana.example.com/d/old"},
+		{Id: "tool-2", Category: opslevel.ToolCategoryLogs, DisplayName: "Kibana", Url: "https://kibana.example.com"},
+	}
+	result := newServiceResult(registration)
+	// Act
+	handleTools(mockedClient, registration, service, result)
+	// Assert
+	autopilot.Equals(t, []string(nil), result.Errors)
+	autopilot.Equals(t, []string{"Updated tool '{Category: metrics, Environment: , Name: Grafana}' url to 'https://grafana.example.com/d/new'"}, result.Changes)
+}
+
+func Test_HandleTagRemovals_DeletesMatchingTags(t *testing.T) {
+	// Arrange
+	autopilot.Ok(t, SetTagRemovals([]string{"team-legacy", "environment=prd"}))
+	defer SetTagRemovals(nil)
+	mockedClient, mockedServer := AMockedClient(
+		StringMockResponse{Status: 200, Data: `{"data": {"tagDelete": {"deletedTagId": "tag-1", "errors": []}}}`},
+		StringMockResponse{Status: 200, Data: `{"data": {"tagDelete": {"deletedTagId": "tag-2", "errors": []}}}`},
+	)
+	defer mockedServer.Close()
+	registration := ServiceRegistration{
+		Name:       "Test",
+		Aliases:    []string{"k8s:test"},
+		TagAssigns: []opslevel.TagInput{{Key: "team-legacy", Value: "checkout"}},
+	}
+	service := &opslevel.Service{ServiceId: opslevel.ServiceId{Id: "test"}}
+	service.Tags.Nodes = []opslevel.Tag{
+		{Id: "tag-1", Key: "team-legacy", Value: "payments"},
+		{Id: "tag-2", Key: "environment", Value: "prd"},
+		{Id: "tag-3", Key: "environment", Value: "production"},
+		{Id: "tag-4", Key: "team-legacy", Value: "checkout"},
+	}
+	result := newServiceResult(registration)
+	// Act
+	handleTagRemovals(mockedClient, registration, service, result)
+	// Assert
+	autopilot.Equals(t, []string(nil), result.Errors)
+	autopilot.Equals(t, []string{"Removed tag 'team-legacy = payments'", "Removed tag 'environment = prd'"}, result.Changes)
+	autopilot.Equals(t, 1, len(result.Warnings))
+	autopilot.Assert(t, SetTagRemovals([]string{"=value"}) != nil, "expected a removal without a key to fail")
+}
+
+func Test_HandleTagRemovals_PlansTheRemovalsUntilTheyAreConfirmed(t *testing.T) {
+	// Arrange
+	autopilot.Ok(t, SetTagRemovals([]string{"team-legacy"}))
+	defer SetTagRemovals(nil)
+	DeferRemovals = true
+	defer func() { DeferRemovals = false }()
+	mockedClient, mockedServer := AMockedClient(
+		StringMockResponse{Status: 200, Data: `{"data": {"tagDelete": {"deletedTagId": "tag-1", "errors": []}}}`},
+	)
+	defer mockedServer.Close()
+	registration := ServiceRegistration{Name: "Test", Aliases: []string{"k8s:test"}}
+	service := &opslevel.Service{ServiceId: opslevel.ServiceId{Id: "test"}}
+	service.Tags.Nodes = []opslevel.Tag{{Id: "tag-1", Key: "team-legacy", Value: "payments"}}
+	result := newServiceResult(registration)
+	// Act
+	handleTagRemovals(mockedClient, registration, service, result)
+	planned := PendingRemovals()
+	err := planned[0].Apply()
+	// Assert
+	autopilot.Equals(t, []string(nil), result.Changes)
+	autopilot.Equals(t, 1, len(planned))
+	autopilot.Equals(t, "[Test] tag 'team-legacy = payments'", planned[0].String())
+	autopilot.Ok(t, err)
+	autopilot.Equals(t, 0, len(PendingRemovals()))
+}
+
+func Test_HandleTagRemovals_KeepsStalePrefixedTagsWithoutPruneTags(t *testing.T) {
+	// Arrange
+	SetTagPrefix("k8s.")
+	defer SetTagPrefix("")
+	registration := ServiceRegistration{Name: "Test", Aliases: []string{"k8s:test"}}
+	service := &opslevel.Service{ServiceId: opslevel.ServiceId{Id: "test"}}
+	service.Tags.Nodes = []opslevel.Tag{{Id: "tag-1", Key: "k8s.team", Value: "payments"}}
+	result := newServiceResult(registration)
+	// Act
+	handleTagRemovals(nil, registration, service, result)
+	// Assert
+	autopilot.Equals(t, []string(nil), result.Errors)
+	autopilot.Equals(t, []string(nil), result.Changes)
+}
+
+func Test_HandleTagRemovals_PrunesStalePrefixedTags(t *testing.T) {
+	// Arrange
+	SetTagPrefix("k8s.")
+	defer SetTagPrefix("")
+	SetTagPruning(true)
+	defer SetTagPruning(false)
+	mockedClient, mockedServer := AMockedClient(
+		StringMockResponse{Status: 200, Data: `{"data": {"tagDelete": {"deletedTagId": "tag-2", "errors": []}}}`},
+	)
+	defer mockedServer.Close()
+	registration := ServiceRegistration{
+		Name:       "Test",
+		Aliases:    []string{"k8s:test"},
+		TagAssigns: []opslevel.TagInput{{Key: "k8s.env", Value: "prd"}},
+		TagCreates: []opslevel.TagInput{{Key: "k8s.team", Value: "checkout"}},
+	}
+	service := &opslevel.Service{ServiceId: opslevel.ServiceId{Id: "test"}}
+	service.Tags.Nodes = []opslevel.Tag{
+		{Id: "tag-1", Key: "k8s.env", Value: "stg"},
+		{Id: "tag-2", Key: "k8s.team", Value: "payments"},
+		{Id: "tag-3", Key: "k8s.team", Value: "checkout"},
+		{Id: "tag-4", Key: "k8s.managed-by", Value: "kubectl-opslevel"},
+		{Id: "tag-5", Key: "owner", Value: "manual"},
+	}
+	result := newServiceResult(registration)
+	// Act
+	handleTagRemovals(mockedClient, registration, service, result)
+	// Assert
+	autopilot.Equals(t, []string(nil), result.Errors)
+	autopilot.Equals(t, []string{"Removed tag 'k8s.team = payments'"}, result.Changes)
+}
+
+func Test_LookupTier_RefetchesDiskCachedTablesOnMiss(t *testing.T) {
+	// Arrange
+	mockedClient, mockedServer := AMockedClient(
+		StringMockResponse{Status: 200, Data: `{"data": {"account": {"tiers": [{"alias": "tier_1", "id": "tier-1", "index": 1, "name": "Tier 1"}]}}}`},
+		StringMockResponse{Status: 200, Data: `{"data": {"account": {"lifecycles": [{"alias": "beta", "id": "lifecycle-1", "index": 1, "name": "Beta"}]}}}`},
+		StringMockResponse{Status: 200, Data: `{"data": {"account": {"teams": {"nodes": [], "pageInfo": {"hasNextPage": false, "endCursor": ""}}}}}`},
+	)
+	defer mockedServer.Close()
+	diskCachedAccountsMutex.Lock()
+	diskCachedAccounts["refetch"] = true
+	diskCachedAccountsMutex.Unlock()
+	// Act
+	_, cachedOk := lookupTier(nil, "refetch", "tier_1")
+	tier, refetchedOk := lookupTier(mockedClient, "refetch", "tier_1")
+	lifecycle, lifecycleOk := lookupLifecycle(mockedClient, "refetch", "beta")
+	_, missingOk := lookupLifecycle(mockedClient, "refetch", "sunset")
+	// Assert
+	autopilot.Equals(t, false, cachedOk)
+	autopilot.Equals(t, true, refetchedOk)
+	autopilot.Equals(t, "tier_1", string(tier.Alias))
+	autopilot.Equals(t, true, lifecycleOk)
+	autopilot.Equals(t, "beta", string(lifecycle.Alias))
+	autopilot.Equals(t, false, missingOk)
+	autopilot.Equals(t, false, isDiskCached("refetch"))
+}
+
+func Test_ReconcileInfra_SkipsTheUpdateOfAnUnchangedResource(t *testing.T) {
+	// Arrange
+	mockedClient, mockedServer := AMockedClient(
+		StringMockResponse{Status: 200, Data: `{"data": {"account": {"infrastructureResource": {
+			"id": "infra-1", "name": "orders-db", "aliases": ["orders-db"], "providerResourceType": "Database",
+			"data": "{\"name\": \"orders-db\", \"engine\": \"postgres\", \"replicas\": 2}", "owner": {}
+		}}}}`},
+	)
+	defer mockedServer.Close()
+	registration := InfraRegistration{
+		Name:     "orders-db",
+		Aliases:  []string{"orders-db"},
+		Provider: InfraProvider{Type: "Database"},
+		Data:     map[string]interface{}{"engine": "postgres", "replicas": 2},
+	}
+	// Act
+	result := ReconcileInfra(mockedClient, registration)
+	// Assert
+	autopilot.Equals(t, []string(nil), result.Errors)
+	autopilot.Equals(t, ServiceAction_Unchanged, result.Action)
+	autopilot.Equals(t, []string(nil), result.Changes)
+}
+
+func Test_WithDefaultRepositoryAliases_MatchesAnAttachedRepositoryByAnyAlias(t *testing.T) {
+	// Arrange
+	mockedClient, mockedServer := AMockedClient(
+		StringMockResponse{Status: 200, Data: `{"data": {"account": {"repository": {"id": "repo-1", "defaultAlias": "github.com:org/monorepo", "services": {"edges": [], "pageInfo": {"hasNextPage": false}}, "tags": {"nodes": [], "pageInfo": {"hasNextPage": false}}}}}}`},
+	)
+	defer mockedServer.Close()
+	defer ResetRepositoryLookups()
+	service := &opslevel.Service{}
+	service.Repositories.Edges = []opslevel.ServiceRepositoryEdge{{
+		Node:                opslevel.RepositoryId{Id: "repo-1", DefaultAlias: "github.com:org/monorepo"},
+		ServiceRepositories: []opslevel.ServiceRepository{{BaseDirectory: "/api"}},
+	}}
+	registration := ServiceRegistration{
+		Name:    "Test",
+		Aliases: []string{"k8s:test"},
+		Repositories: []opslevel.ServiceRepositoryCreateInput{
+			{Repository: opslevel.IdentifierInput{Alias: "org/monorepo"}, BaseDirectory: "/api"},
+		},
+	}
+	current := newServiceState(service)
+	current.sort()
+	desired := newServiceState(service)
+	// Act
+	desired.apply(withDefaultRepositoryAliases(mockedClient, registration), false)
+	// Assert
+	autopilot.Equals(t, current.Repositories, desired.Repositories)
+}
+
+func Test_DeleteService_SendsNoRequest_WhenDryRun(t *testing.T) {
+	// Arrange
+	DryRun = true
+	defer func() { DryRun = false }()
+	mockedClient, mockedServer := AMockedClient()
+	defer mockedServer.Close()
+	service := opslevel.Service{Name: "Test"}
+	service.Id = "1"
+	// Act
+	err := DeleteService(mockedClient, &service)
+	// Assert
+	autopilot.Ok(t, err)
+}
+
+func Test_DeleteService_WhenSuccessful(t *testing.T) {
+	// Arrange
+	mockedClient, mockedServer := AMockedClient(StringMockResponse{
+		Status: http.StatusOK,
+		Data:   `{"data":{"serviceDelete":{"deletedServiceId":"1","errors":[]}}}`,
+	})
+	defer mockedServer.Close()
+	service := opslevel.Service{Name: "Test"}
+	service.Id = "1"
+	// Act
+	err := DeleteService(mockedClient, &service)
+	// Assert
+	autopilot.Ok(t, err)
+}
+
+func Test_DeleteService_ReturnsTheAPIErrors(t *testing.T) {
+	// Arrange
+	mockedClient, mockedServer := AMockedClient(StringMockResponse{
+		Status: http.StatusOK,
+		Data:   `{"data":{"serviceDelete":{"deletedServiceId":null,"errors":[{"message":"service not found","path":["id"]}]}}}`,
+	})
+	defer mockedServer.Close()
+	service := opslevel.Service{Name: "Test"}
+	service.Id = "1"
+	// Act
+	err := DeleteService(mockedClient, &service)
+	// Assert
+	autopilot.Assert(t, err != nil, "expected the API error to be returned")
+}
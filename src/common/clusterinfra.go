@@ -0,0 +1,77 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/opslevel/kubectl-opslevel/config"
+	"github.com/opslevel/kubectl-opslevel/k8sutils"
+	"github.com/rs/zerolog/log"
+)
+
+const defaultClusterInfraSchema = "Compute"
+
+var (
+	clusterInfosMutex sync.Mutex
+	// clusterInfos are the clusters gathered by this run keyed by cluster name
+	clusterInfos = map[string]k8sutils.ClusterInfo{}
+)
+
+// clusterInfraAlias is the alias of the infrastructure resource of a cluster
+func clusterInfraAlias(cluster string) string {
+	return strings.ToLower(fmt.Sprintf("k8s-cluster-%s", cluster))
+}
+
+// loadClusterInfo looks up the version, provider, region and node count of a live cluster - recordings and files are skipped
+func loadClusterInfo(source resourceSource, cluster string) {
+	live, ok := source.(*liveSource)
+	if !ok || cluster == "" {
+		return
+	}
+	info, err := live.client.GetClusterInfo()
+	if err != nil {
+		log.Warn().Msgf("Unable to look up the cluster '%s' - it is not registered as an infrastructure resource\n\tREASON: %v", cluster, err)
+		return
+	}
+	clusterInfosMutex.Lock()
+	defer clusterInfosMutex.Unlock()
+	clusterInfos[cluster] = info
+}
+
+// ClusterInfra returns an infrastructure resource for every cluster gathered by this run related to the services imported from it
+func ClusterInfra(c config.ClusterInfraConfig, services []ServiceRegistration) []InfraRegistration {
+	clusterInfosMutex.Lock()
+	defer clusterInfosMutex.Unlock()
+	var clusters []string
+	for cluster := range clusterInfos {
+		clusters = append(clusters, cluster)
+	}
+	sort.Strings(clusters)
+	var output []InfraRegistration
+	for _, cluster := range clusters {
+		info := clusterInfos[cluster]
+		registration := InfraRegistration{
+			Account:  c.Account,
+			Name:     cluster,
+			Schema:   orDefault(c.Schema, defaultClusterInfraSchema),
+			Owner:    c.Owner,
+			Aliases:  []string{clusterInfraAlias(cluster)},
+			Provider: InfraProvider{Name: info.Provider, Type: "Kubernetes Cluster"},
+			Data: map[string]interface{}{
+				"kubernetesVersion": info.Version,
+				"provider":          info.Provider,
+				"region":            info.Region,
+				"nodeCount":         info.NodeCount,
+			},
+		}
+		for _, service := range services {
+			if service.Cluster == cluster && service.Account == c.Account && len(service.Aliases) > 0 {
+				registration.Services = append(registration.Services, service.Aliases[0])
+			}
+		}
+		output = append(output, registration)
+	}
+	return output
+}
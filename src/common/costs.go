@@ -0,0 +1,254 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/opslevel/kubectl-opslevel/config"
+	"github.com/opslevel/kubectl-opslevel/k8sutils"
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	defaultOpenCostService = "opencost/opencost:9003"
+	defaultOpenCostWindow  = "7d"
+	minutesPerMonth        = 30 * 24 * 60
+	podMetricsPath         = "/apis/metrics.k8s.io/v1beta1/pods"
+)
+
+var podSelector = k8sutils.KubernetesSelector{ApiVersion: "v1", Kind: "Pod"}
+
+// workloadCost is the monthly cost and actual usage of a workload - the cost is only known from OpenCost
+type workloadCost struct {
+	MonthlyCost *float64
+	CPUCores    float64
+	MemoryBytes float64
+}
+
+var (
+	workloadCostsMutex sync.Mutex
+	// workloadCosts are keyed by '<namespace>/<kind>/<name>' with a lower case kind
+	workloadCosts map[string]*workloadCost
+)
+
+func workloadKey(namespace string, kind string, name string) string {
+	return fmt.Sprintf("%s/%s/%s", namespace, strings.ToLower(kind), name)
+}
+
+type openCostAllocation struct {
+	Properties struct {
+		Namespace      string `json:"namespace"`
+		ControllerKind string `json:"controllerKind"`
+		Controller     string `json:"controller"`
+	} `json:"properties"`
+	Minutes             float64 `json:"minutes"`
+	CPUCoreUsageAverage float64 `json:"cpuCoreUsageAverage"`
+	RAMByteUsageAverage float64 `json:"ramByteUsageAverage"`
+	TotalCost           float64 `json:"totalCost"`
+}
+
+// parseOpenCostAllocations extrapolates the cost of each controller over the window to a month
+func parseOpenCostAllocations(data []byte) (map[string]*workloadCost, error) {
+	var response struct {
+		Code    int                             `json:"code"`
+		Message string                          `json:"message"`
+		Data    []map[string]openCostAllocation `json:"data"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("unable to parse the OpenCost allocations: %v", err)
+	}
+	if response.Code != 200 {
+		return nil, fmt.Errorf("OpenCost responded with %d: %s", response.Code, response.Message)
+	}
+	output := map[string]*workloadCost{}
+	for _, set := range response.Data {
+		for _, allocation := range set {
+			properties := allocation.Properties
+			if properties.Controller == "" || allocation.Minutes <= 0 {
+				continue
+			}
+			monthly := allocation.TotalCost * minutesPerMonth / allocation.Minutes
+			output[workloadKey(properties.Namespace, properties.ControllerKind, properties.Controller)] = &workloadCost{
+				MonthlyCost: &monthly,
+				CPUCores:    allocation.CPUCoreUsageAverage,
+				MemoryBytes: allocation.RAMByteUsageAverage,
+			}
+		}
+	}
+	return output, nil
+}
+
+type costPod struct {
+	Metadata struct {
+		Name            string            `json:"name"`
+		Namespace       string            `json:"namespace"`
+		Labels          map[string]string `json:"labels"`
+		OwnerReferences []struct {
+			Kind       string `json:"kind"`
+			Name       string `json:"name"`
+			Controller bool   `json:"controller"`
+		} `json:"ownerReferences"`
+	} `json:"metadata"`
+}
+
+// podWorkload returns the key of the workload controlling the pod - a ReplicaSet is resolved to its Deployment by the pod-template-hash
+func podWorkload(pod costPod) string {
+	for _, owner := range pod.Metadata.OwnerReferences {
+		if !owner.Controller {
+			continue
+		}
+		if hash := pod.Metadata.Labels["pod-template-hash"]; owner.Kind == "ReplicaSet" && strings.HasSuffix(owner.Name, "-"+hash) {
+			return workloadKey(pod.Metadata.Namespace, "Deployment", strings.TrimSuffix(owner.Name, "-"+hash))
+		}
+		return workloadKey(pod.Metadata.Namespace, owner.Kind, owner.Name)
+	}
+	return ""
+}
+
+// parsePodMetrics adds up the current usage metrics-server reports for the pods of every workload
+func parsePodMetrics(pods [][]byte, data []byte) (map[string]*workloadCost, error) {
+	var metrics struct {
+		Items []struct {
+			Metadata struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"metadata"`
+			Containers []struct {
+				Usage map[string]resource.Quantity `json:"usage"`
+			} `json:"containers"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(data, &metrics); err != nil {
+		return nil, fmt.Errorf("unable to parse the pod metrics: %v", err)
+	}
+	workloads := map[string]string{}
+	for _, data := range pods {
+		var pod costPod
+		if err := json.Unmarshal(data, &pod); err == nil {
+			workloads[pod.Metadata.Namespace+"/"+pod.Metadata.Name] = podWorkload(pod)
+		}
+	}
+	output := map[string]*workloadCost{}
+	for _, item := range metrics.Items {
+		key := workloads[item.Metadata.Namespace+"/"+item.Metadata.Name]
+		if key == "" {
+			continue
+		}
+		if _, ok := output[key]; !ok {
+			output[key] = &workloadCost{}
+		}
+		for _, container := range item.Containers {
+			if cpu, ok := container.Usage["cpu"]; ok {
+				output[key].CPUCores += cpu.AsApproximateFloat64()
+			}
+			if memory, ok := container.Usage["memory"]; ok {
+				output[key].MemoryBytes += memory.AsApproximateFloat64()
+			}
+		}
+	}
+	return output, nil
+}
+
+// loadWorkloadCosts asks OpenCost for the cost of every controller and falls back to the usage reported by metrics-server
+func loadWorkloadCosts(source resourceSource, c config.CostsConfig) error {
+	live, ok := source.(*liveSource)
+	if !ok {
+		log.Debug().Msg("Skipping the cost tags since the resources are not read from a live cluster")
+		return nil
+	}
+	params := map[string]string{
+		"window":     orDefault(c.Window, defaultOpenCostWindow),
+		"aggregate":  "namespace,controllerKind,controller",
+		"accumulate": "true",
+	}
+	service := orDefault(c.OpenCost, defaultOpenCostService)
+	data, err := live.client.ProxyGetService(service, "/allocation/compute", params)
+	var costs map[string]*workloadCost
+	if err == nil {
+		costs, err = parseOpenCostAllocations(data)
+	}
+	if err != nil {
+		log.Warn().Msgf("Unable to query OpenCost '%s' - falling back to the usage reported by metrics-server\n\tREASON: %v", service, err)
+		// Only the metadata of the pods is needed to find their workload
+		pods, podsErr := live.client.QueryMetadata(podSelector)
+		if podsErr != nil {
+			return podsErr
+		}
+		metrics, metricsErr := live.client.GetRaw(podMetricsPath)
+		if metricsErr != nil {
+			return metricsErr
+		}
+		if costs, err = parsePodMetrics(pods, metrics); err != nil {
+			return err
+		}
+	}
+	workloadCostsMutex.Lock()
+	defer workloadCostsMutex.Unlock()
+	workloadCosts = costs
+	return nil
+}
+
+// costBucket returns the range of the 1-2-5 series (IE: 1, 2, 5, 10, 20, 50, ...) the value falls in
+func costBucket(value float64) (float64, float64) {
+	if value <= 0 {
+		return 0, 0
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(value)))
+	switch {
+	case value >= 5*magnitude:
+		return 5 * magnitude, 10 * magnitude
+	case value >= 2*magnitude:
+		return 2 * magnitude, 5 * magnitude
+	default:
+		return magnitude, 2 * magnitude
+	}
+}
+
+// formatCostBucket formats the range of the value IE: '200m-500m' - the tags only change when the value moves to
+// another range instead of on every run
+func formatCostBucket(value float64, unit string) string {
+	lower, upper := costBucket(value)
+	format := func(v float64) string {
+		return strconv.FormatFloat(math.Round(v*1e6)/1e6, 'f', -1, 64) + unit
+	}
+	if upper == 0 {
+		return format(0)
+	}
+	return fmt.Sprintf("%s-%s", format(lower), format(upper))
+}
+
+// costTags are the ranges of the monthly cost and actual usage of the resource IE: 'monthly-cost:100-200',
+// 'cpu-usage:200m-500m' and 'memory-usage:500Mi-1000Mi'
+func costTags(resource []byte) []opslevel.TagInput {
+	var object struct {
+		Kind     string `json:"kind"`
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(resource, &object); err != nil {
+		return nil
+	}
+	workloadCostsMutex.Lock()
+	defer workloadCostsMutex.Unlock()
+	cost, ok := workloadCosts[workloadKey(object.Metadata.Namespace, object.Kind, object.Metadata.Name)]
+	if !ok {
+		return nil
+	}
+	var tags []opslevel.TagInput
+	if cost.MonthlyCost != nil {
+		tags = append(tags, opslevel.TagInput{Key: "monthly-cost", Value: formatCostBucket(*cost.MonthlyCost, "")})
+	}
+	tags = append(tags,
+		opslevel.TagInput{Key: "cpu-usage", Value: formatCostBucket(cost.CPUCores*1000, "m")},
+		opslevel.TagInput{Key: "memory-usage", Value: formatCostBucket(cost.MemoryBytes/(1<<20), "Mi")},
+	)
+	return tags
+}
@@ -0,0 +1,61 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/opslevel/opslevel-go/v2022"
+)
+
+type CoverageStatus string
+
+const (
+	CoverageStatus_Matched CoverageStatus = "Matched" // An existing OpsLevel service has one of the registration's aliases
+	CoverageStatus_New     CoverageStatus = "New"     // An import would create a new OpsLevel service
+	CoverageStatus_Failed  CoverageStatus = "Failed"  // The service lookup or the owner, tier or lifecycle resolution failed
+)
+
+// ServiceCoverage is how a single registration is represented in the OpsLevel catalog
+type ServiceCoverage struct {
+	Name      string         `json:"name"`
+	Namespace string         `json:"namespace,omitempty"`
+	Team      string         `json:"team,omitempty"`
+	Status    CoverageStatus `json:"status"`
+	Problems  []string       `json:"problems,omitempty"`
+}
+
+// CheckCoverage looks up the registration's service and resolves its owner, tier and lifecycle without changing anything
+func CheckCoverage(client *opslevel.Client, registration ServiceRegistration) ServiceCoverage {
+	coverage := ServiceCoverage{Name: registration.Name, Namespace: registration.Namespace, Team: registration.Owner}
+	if registration.Owner != "" {
+		team, err := findTeam(client, registration.Account, registration.Owner)
+		switch {
+		case err != nil:
+			coverage.Problems = append(coverage.Problems, fmt.Sprintf("unable to look up 'Team' '%s': %v", registration.Owner, err))
+		case team != nil:
+			coverage.Team = team.Alias
+		case !getTeamsConfig().AutoCreate:
+			coverage.Problems = append(coverage.Problems, fmt.Sprintf("unable to find 'Team' with alias '%s'", registration.Owner))
+		}
+	}
+	if _, ok := lookupTier(client, registration.Account, registration.Tier); !ok && registration.Tier != "" {
+		coverage.Problems = append(coverage.Problems, fmt.Sprintf("unable to find 'Tier' with alias '%s'", registration.Tier))
+	}
+	if _, ok := lookupLifecycle(client, registration.Account, registration.Lifecycle); !ok && registration.Lifecycle != "" {
+		coverage.Problems = append(coverage.Problems, fmt.Sprintf("unable to find 'Lifecycle' with alias '%s'", registration.Lifecycle))
+	}
+	_, status := validateServiceAliases(client, registration)
+	switch status {
+	case serviceAliasesResult_AliasMatched:
+		coverage.Status = CoverageStatus_Matched
+	case serviceAliasesResult_NoAliasesMatched:
+		coverage.Status = CoverageStatus_New
+	case serviceAliasesResult_MultipleServicesFound:
+		coverage.Problems = append(coverage.Problems, "found multiple services with the aliases")
+	case serviceAliasesResult_APIErrorHappened:
+		coverage.Problems = append(coverage.Problems, "api error during service lookup by alias")
+	}
+	if len(coverage.Problems) > 0 {
+		coverage.Status = CoverageStatus_Failed
+	}
+	return coverage
+}
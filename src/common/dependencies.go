@@ -0,0 +1,242 @@
+package common
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/shurcooL/graphql"
+)
+
+// ManagedDependencyNote marks the dependency edges created by this tool so only those are ever pruned
+const ManagedDependencyNote = "Managed by kubectl-opslevel"
+
+// ServiceDependencyKey is the source (dependent) and destination (dependency) of a dependency edge
+type ServiceDependencyKey struct {
+	SourceIdentifier      opslevel.IdentifierInput `json:"sourceIdentifier"`
+	DestinationIdentifier opslevel.IdentifierInput `json:"destinationIdentifier"`
+}
+
+// ServiceDependencyCreateInput is named after the GraphQL input type of the 'serviceDependencyCreate' mutation
+type ServiceDependencyCreateInput struct {
+	DependencyKey ServiceDependencyKey `json:"dependencyKey"`
+	Notes         string               `json:"notes,omitempty"`
+}
+
+type serviceDependencyEdge struct {
+	Id     graphql.ID
+	Locked bool
+	Notes  string
+	Node   struct {
+		Id      graphql.ID
+		Aliases []string
+	}
+}
+
+var (
+	declaredDependenciesMutex sync.Mutex
+	// declaredDependencies counts the registrations declaring each edge and declaredByService is the edges of each
+	// registration so a registration declared again (IE: by 'service reconcile' on every change) replaces its edges
+	declaredDependencies = map[string]int{}
+	declaredByService    = map[string][]string{}
+	// pruneDependencies is off until the run has seen every registration IE: 'service reconcile' handles one
+	// resource at a time so an edge only declared by a service it has not seen yet would be removed
+	pruneDependencies = true
+)
+
+// SetDependencyPruning enables removing the managed dependency edges no registration of the run declares
+func SetDependencyPruning(enabled bool) {
+	declaredDependenciesMutex.Lock()
+	defer declaredDependenciesMutex.Unlock()
+	pruneDependencies = enabled
+}
+
+func dependencyEdgeKey(source string, destination string) string {
+	return source + "\x00" + destination
+}
+
+// DeclareDependencies registers the dependency edges of every registration of the run so an edge declared
+// from either side (one service's 'dependencies' or the other's 'dependents') is never pruned - it has to be
+// given every registration before '--services', '--resume' or '--filter' select the ones that are reconciled
+func DeclareDependencies(services []ServiceRegistration) {
+	declaredDependenciesMutex.Lock()
+	defer declaredDependenciesMutex.Unlock()
+	for _, service := range services {
+		declareDependencyEdges(service)
+	}
+}
+
+func declareDependencyEdges(service ServiceRegistration) {
+	key := service.Key()
+	for _, edge := range declaredByService[key] {
+		if declaredDependencies[edge]--; declaredDependencies[edge] <= 0 {
+			delete(declaredDependencies, edge)
+		}
+	}
+	var edges []string
+	for _, alias := range service.Aliases {
+		for _, dependency := range service.Dependencies {
+			edges = append(edges, dependencyEdgeKey(alias, dependency))
+		}
+		for _, dependent := range service.Dependents {
+			edges = append(edges, dependencyEdgeKey(dependent, alias))
+		}
+	}
+	for _, edge := range edges {
+		declaredDependencies[edge]++
+	}
+	if len(edges) > 0 {
+		declaredByService[key] = edges
+	} else {
+		delete(declaredByService, key)
+	}
+}
+
+func isDependencyDeclared(sources []string, destinations []string) bool {
+	declaredDependenciesMutex.Lock()
+	defer declaredDependenciesMutex.Unlock()
+	for _, source := range sources {
+		for _, destination := range destinations {
+			if declaredDependencies[dependencyEdgeKey(source, destination)] > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func getServiceDependencyEdges(client *opslevel.Client, id graphql.ID) ([]serviceDependencyEdge, []serviceDependencyEdge, error) {
+	var q struct {
+		Account struct {
+			Service struct {
+				Dependencies struct {
+					Edges []serviceDependencyEdge
+				}
+				Dependents struct {
+					Edges []serviceDependencyEdge
+				}
+			} `graphql:"service(id: $service)"`
+		}
+	}
+	v := opslevel.PayloadVariables{
+		"service": id,
+	}
+	if err := client.Query(&q, v); err != nil {
+		return nil, nil, err
+	}
+	return q.Account.Service.Dependencies.Edges, q.Account.Service.Dependents.Edges, nil
+}
+
+func createServiceDependency(client *opslevel.Client, input ServiceDependencyCreateInput) error {
+	var m struct {
+		Payload struct {
+			Errors []opslevel.OpsLevelErrors
+		} `graphql:"serviceDependencyCreate(inputV2: $input)"`
+	}
+	v := opslevel.PayloadVariables{
+		"input": input,
+	}
+	if err := client.Mutate(&m, v); err != nil {
+		return err
+	}
+	return opslevel.FormatErrors(m.Payload.Errors)
+}
+
+func deleteServiceDependency(client *opslevel.Client, id graphql.ID) error {
+	var m struct {
+		Payload struct {
+			Errors []opslevel.OpsLevelErrors
+		} `graphql:"serviceDependencyDelete(input: $input)"`
+	}
+	v := opslevel.PayloadVariables{
+		"input": opslevel.DeleteInput{Id: id},
+	}
+	if err := client.Mutate(&m, v); err != nil {
+		return err
+	}
+	return opslevel.FormatErrors(m.Payload.Errors)
+}
+
+func edgeHasAlias(edge serviceDependencyEdge, alias string) bool {
+	for _, item := range edge.Node.Aliases {
+		if item == alias {
+			return true
+		}
+	}
+	return false
+}
+
+func handleDependencies(client *opslevel.Client, registration ServiceRegistration, service *opslevel.Service, result *ServiceResult) {
+	if len(registration.Dependencies) == 0 && len(registration.Dependents) == 0 && !isDependencyPruningEnabled() {
+		return
+	}
+	declaredDependenciesMutex.Lock()
+	declareDependencyEdges(registration)
+	declaredDependenciesMutex.Unlock()
+
+	var dependencies, dependents []serviceDependencyEdge
+	if service.Id != nil {
+		var err error
+		dependencies, dependents, err = getServiceDependencyEdges(client, service.Id)
+		if err != nil {
+			result.failed(err, "Failed listing dependencies")
+			return
+		}
+	}
+	self := opslevel.IdentifierInput{Id: service.Id}
+	ensure := func(existing []serviceDependencyEdge, alias string, input ServiceDependencyCreateInput, description string) {
+		for _, edge := range existing {
+			if edgeHasAlias(edge, alias) {
+				return
+			}
+		}
+		if result.dryRun("create %s", description) {
+			return
+		}
+		err := createServiceDependency(client, input)
+		audit(registration.Name, registration.Aliases, "serviceDependencyCreate", input, err)
+		if err != nil {
+			result.failed(err, "Failed creating %s", description)
+		} else {
+			result.changed("Created %s", description)
+		}
+	}
+	for _, alias := range registration.Dependencies {
+		ensure(dependencies, alias, ServiceDependencyCreateInput{
+			DependencyKey: ServiceDependencyKey{SourceIdentifier: self, DestinationIdentifier: opslevel.IdentifierInput{Alias: graphql.String(alias)}},
+			Notes:         ManagedDependencyNote,
+		}, fmt.Sprintf("dependency on '%s'", alias))
+	}
+	for _, alias := range registration.Dependents {
+		ensure(dependents, alias, ServiceDependencyCreateInput{
+			DependencyKey: ServiceDependencyKey{SourceIdentifier: opslevel.IdentifierInput{Alias: graphql.String(alias)}, DestinationIdentifier: self},
+			Notes:         ManagedDependencyNote,
+		}, fmt.Sprintf("dependent '%s'", alias))
+	}
+
+	if !isDependencyPruningEnabled() {
+		return
+	}
+	prune := func(edge serviceDependencyEdge, declared bool, description string) {
+		if edge.Locked || edge.Notes != ManagedDependencyNote || declared {
+			return
+		}
+		planRemoval(registration.Name, description, result, func() error {
+			err := deleteServiceDependency(client, edge.Id)
+			audit(registration.Name, registration.Aliases, "serviceDependencyDelete", opslevel.DeleteInput{Id: edge.Id}, err)
+			return err
+		})
+	}
+	for _, edge := range dependencies {
+		prune(edge, isDependencyDeclared(registration.Aliases, edge.Node.Aliases), fmt.Sprintf("undeclared dependency on '%v'", edge.Node.Aliases))
+	}
+	for _, edge := range dependents {
+		prune(edge, isDependencyDeclared(edge.Node.Aliases, registration.Aliases), fmt.Sprintf("undeclared dependent '%v'", edge.Node.Aliases))
+	}
+}
+
+func isDependencyPruningEnabled() bool {
+	declaredDependenciesMutex.Lock()
+	defer declaredDependenciesMutex.Unlock()
+	return pruneDependencies
+}
@@ -0,0 +1,80 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// DeployDeployer is who or what made the deploy
+type DeployDeployer struct {
+	Email string `json:"email,omitempty"`
+	Name  string `json:"name,omitempty"`
+}
+
+// DeployCommit is the commit that was deployed
+type DeployCommit struct {
+	Sha string `json:"sha"`
+}
+
+// DeployEvent is the payload of the OpsLevel deploy integration
+type DeployEvent struct {
+	Service      string         `json:"service"`
+	Deployer     DeployDeployer `json:"deployer"`
+	DeployedAt   time.Time      `json:"deployed_at"`
+	Description  string         `json:"description,omitempty"`
+	Environment  string         `json:"environment,omitempty"`
+	DeployUrl    string         `json:"deploy_url,omitempty"`
+	DeployNumber string         `json:"deploy_number,omitempty"`
+	Commit       DeployCommit   `json:"commit"`
+	DedupId      string         `json:"dedup_id,omitempty"`
+}
+
+// SendDeployEvent posts the deploy event to the url of an OpsLevel deploy integration
+func SendDeployEvent(client *resty.Client, url string, event DeployEvent) error {
+	if event.DedupId == "" {
+		event.DedupId = fmt.Sprintf("%s-%s", event.Service, event.Commit.Sha)
+	}
+	data, _ := json.Marshal(event)
+	if isDryRun(event.Service, "send deploy event %s", string(data)) {
+		return nil
+	}
+	resp, err := client.R().SetHeader("Content-Type", "application/json").SetBody(data).Post(url)
+	if err == nil && resp.IsError() {
+		err = fmt.Errorf("%s: %s", resp.Status(), string(resp.Body()))
+	}
+	audit(event.Service, []string{event.Service}, "deploy", event, err)
+	if err != nil {
+		return err
+	}
+	log.Info().Msgf("[%s] Sent deploy event for version '%s'", event.Service, event.Commit.Sha)
+	return nil
+}
+
+// DeployTracker remembers the last seen version of every service so a deploy event is only sent when it changes
+type DeployTracker struct {
+	mutex    sync.Mutex
+	versions map[string]string
+}
+
+func NewDeployTracker() *DeployTracker {
+	return &DeployTracker{versions: map[string]string{}}
+}
+
+// Changed records the version of the service and reports whether it differs from a previously seen version.
+// The first version seen for a service is not a change since it was deployed before watching started.
+func (t *DeployTracker) Changed(service ServiceRegistration) bool {
+	if service.DeployVersion == "" {
+		return false
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	key := service.Key()
+	previous, seen := t.versions[key]
+	t.versions[key] = service.DeployVersion
+	return seen && previous != service.DeployVersion
+}
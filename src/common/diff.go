@@ -0,0 +1,203 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/shurcooL/graphql"
+)
+
+// serviceState is a flattened view of an OpsLevel service used to compare what exists against what an import would produce
+type serviceState struct {
+	Name         string
+	Description  string
+	Owner        string
+	Lifecycle    string
+	Tier         string
+	Product      string
+	Language     string
+	Framework    string
+	Aliases      []string
+	Tags         []string
+	Tools        []string
+	Repositories []string
+}
+
+func formatTag(key string, value string) string {
+	return fmt.Sprintf("%s:%s", key, value)
+}
+
+func formatTool(category string, environment string, name string, url string) string {
+	return fmt.Sprintf("{Category: %s, Environment: %s, Name: %s, Url: %s}", category, environment, name, url)
+}
+
+func formatRepository(alias string, directory string) string {
+	return fmt.Sprintf("%s:%s", alias, directory)
+}
+
+func newServiceState(service *opslevel.Service) serviceState {
+	state := serviceState{
+		Name:        service.Name,
+		Description: service.Description,
+		Owner:       service.Owner.Alias,
+		Lifecycle:   service.Lifecycle.Alias,
+		Tier:        service.Tier.Alias,
+		Product:     service.Product,
+		Language:    service.Language,
+		Framework:   service.Framework,
+		Aliases:     append([]string{}, service.Aliases...),
+	}
+	for _, tag := range service.Tags.Nodes {
+		state.Tags = append(state.Tags, formatTag(tag.Key, tag.Value))
+	}
+	for _, tool := range service.Tools.Nodes {
+		state.Tools = append(state.Tools, formatTool(string(tool.Category), tool.Environment, tool.DisplayName, tool.Url))
+	}
+	for _, edge := range service.Repositories.Edges {
+		for _, serviceRepository := range edge.ServiceRepositories {
+			state.Repositories = append(state.Repositories, formatRepository(edge.Node.DefaultAlias, serviceRepository.BaseDirectory))
+		}
+	}
+	return state
+}
+
+// apply overlays the registration onto the state the same way ReconcileService would mutate the service
+func (s *serviceState) apply(registration ServiceRegistration, created bool) {
+	cache := getCache(registration.Account)
+	if created && registration.Name != "" {
+		s.Name = registration.Name
+	}
+	if registration.Description != "" {
+		s.Description = registration.Description
+	}
+	if registration.Product != "" {
+		s.Product = registration.Product
+	}
+	if registration.Language != "" {
+		s.Language = registration.Language
+	}
+	if registration.Framework != "" {
+		s.Framework = registration.Framework
+	}
+	if team, _ := findTeam(nil, registration.Account, registration.Owner); team != nil {
+		s.Owner = team.Alias
+	}
+	if _, ok := cache.TryGetTier(registration.Tier); ok {
+		s.Tier = registration.Tier
+	}
+	if _, ok := cache.TryGetLifecycle(registration.Lifecycle); ok {
+		s.Lifecycle = registration.Lifecycle
+	}
+	s.Aliases = removeDuplicates(append(s.Aliases, registration.Aliases...))
+	var remaining []string
+	for _, existing := range s.Tags {
+		key, value, _ := strings.Cut(existing, ":")
+		tag := opslevel.Tag{Key: key, Value: value}
+		if isTagRemoved(tag) && !wantsTag(registration, tag) {
+			continue
+		}
+		remaining = append(remaining, existing)
+	}
+	s.Tags = remaining
+	for _, tag := range registration.TagAssigns {
+		var kept []string
+		for _, existing := range s.Tags {
+			if strings.HasPrefix(existing, tag.Key+":") {
+				continue
+			}
+			kept = append(kept, existing)
+		}
+		s.Tags = append(kept, formatTag(tag.Key, tag.Value))
+	}
+	for _, tag := range registration.TagCreates {
+		s.Tags = append(s.Tags, formatTag(tag.Key, tag.Value))
+	}
+	s.Tags = removeDuplicates(s.Tags)
+	for _, tool := range registration.Tools {
+		if i := s.toolIndex(tool); i < 0 {
+			s.Tools = append(s.Tools, formatTool(string(tool.Category), tool.Environment, tool.DisplayName, tool.Url))
+		} else if tool.Url != "" {
+			s.Tools[i] = formatTool(string(tool.Category), tool.Environment, tool.DisplayName, tool.Url)
+		}
+	}
+	for _, repository := range registration.Repositories {
+		s.Repositories = append(s.Repositories, formatRepository(string(repository.Repository.Alias), repository.BaseDirectory))
+	}
+	s.Repositories = removeDuplicates(s.Repositories)
+	s.sort()
+}
+
+// withDefaultRepositoryAliases returns the registration with the alias of every repository replaced by the default
+// alias of the repository it resolves to since the repositories attached to the service are listed by default alias
+func withDefaultRepositoryAliases(client *opslevel.Client, registration ServiceRegistration) ServiceRegistration {
+	repositories := make([]opslevel.ServiceRepositoryCreateInput, len(registration.Repositories))
+	for i, repository := range registration.Repositories {
+		repositories[i] = repository
+		lookup, err := getRepositoryWithAlias(client, registration.Account, string(repository.Repository.Alias))
+		if err == nil && lookup.repository != nil && lookup.repository.DefaultAlias != "" {
+			repositories[i].Repository.Alias = graphql.String(lookup.repository.DefaultAlias)
+		}
+	}
+	registration.Repositories = repositories
+	return registration
+}
+
+// toolIndex returns the index of the tool with the same category, environment and name or -1
+func (s *serviceState) toolIndex(tool opslevel.ToolCreateInput) int {
+	prefix := fmt.Sprintf("{Category: %s, Environment: %s, Name: %s,", tool.Category, tool.Environment, tool.DisplayName)
+	for i, existing := range s.Tools {
+		if strings.HasPrefix(existing, prefix) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *serviceState) sort() {
+	sort.Strings(s.Aliases)
+	sort.Strings(s.Tags)
+	sort.Strings(s.Tools)
+	sort.Strings(s.Repositories)
+}
+
+type ServiceDiffResult string
+
+const (
+	ServiceDiffResult_Create    ServiceDiffResult = "Create"
+	ServiceDiffResult_Update    ServiceDiffResult = "Update"
+	ServiceDiffResult_NoChanges ServiceDiffResult = "NoChanges"
+	ServiceDiffResult_Skipped   ServiceDiffResult = "Skipped"
+)
+
+// DiffService looks up the registration's service in OpsLevel and returns a diff of what ReconcileService would change without mutating anything
+func DiffService(client *opslevel.Client, registration ServiceRegistration) (ServiceDiffResult, string, error) {
+	if len(registration.Aliases) <= 0 {
+		return ServiceDiffResult_Skipped, "", fmt.Errorf("found 0 aliases from kubernetes data")
+	}
+	// Resolves an owner given as an ID so apply can use the cached alias
+	findTeam(client, registration.Account, registration.Owner)
+	foundService, foundServiceStatus := validateServiceAliases(client, registration)
+	switch foundServiceStatus {
+	case serviceAliasesResult_NoAliasesMatched:
+		current := serviceState{}
+		desired := serviceState{}
+		desired.apply(registration, true)
+		return ServiceDiffResult_Create, cmp.Diff(current, desired), nil
+	case serviceAliasesResult_AliasMatched:
+		current := newServiceState(foundService)
+		current.sort()
+		desired := newServiceState(foundService)
+		desired.apply(withDefaultRepositoryAliases(client, registration), false)
+		if diff := cmp.Diff(current, desired); diff != "" {
+			return ServiceDiffResult_Update, diff, nil
+		}
+		return ServiceDiffResult_NoChanges, "", nil
+	case serviceAliasesResult_MultipleServicesFound:
+		return ServiceDiffResult_Skipped, "", fmt.Errorf("found multiple services with the aliases %v", registration.Aliases)
+	default:
+		return ServiceDiffResult_Skipped, "", fmt.Errorf("api error during service lookup by alias")
+	}
+}
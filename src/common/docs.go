@@ -0,0 +1,136 @@
+package common
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/opslevel/kubectl-opslevel/config"
+	"github.com/opslevel/opslevel-go/v2022"
+)
+
+var (
+	docsConfigMutex sync.Mutex
+	docsConfig      config.DocsConfig
+)
+
+// SetDocs configures the API document integration that API specs referenced by url are pushed to
+func SetDocs(docs config.DocsConfig) {
+	docsConfigMutex.Lock()
+	defer docsConfigMutex.Unlock()
+	docsConfig = docs
+}
+
+func getDocsConfig() config.DocsConfig {
+	docsConfigMutex.Lock()
+	defer docsConfigMutex.Unlock()
+	return docsConfig
+}
+
+func isURL(value string) bool {
+	return strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://")
+}
+
+// isAPIDocument is true for OpenAPI, Swagger and AsyncAPI specs which are always yaml or json files
+func isAPIDocument(value string) bool {
+	switch strings.ToLower(path.Ext(strings.SplitN(value, "?", 2)[0])) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// splitDocs separates the API specs shown in the 'API Docs' tab from the tech docs which are attached as 'wiki' tools.
+// Tech docs given as repository paths are skipped because OpsLevel reads those from the service's repository.
+func splitDocs(docs []string) (apiDocs []string, tools []opslevel.ToolCreateInput) {
+	for _, doc := range docs {
+		if isAPIDocument(doc) {
+			apiDocs = append(apiDocs, doc)
+			continue
+		}
+		if !isURL(doc) {
+			continue
+		}
+		name := "Docs"
+		if len(tools) > 0 {
+			name = fmt.Sprintf("Docs %d", len(tools)+1)
+		}
+		tools = append(tools, opslevel.ToolCreateInput{
+			Category:    opslevel.ToolCategoryWiki,
+			DisplayName: name,
+			Url:         doc,
+		})
+	}
+	return
+}
+
+func setAPIDocSettings(client *opslevel.Client, registration ServiceRegistration, service *opslevel.Service, docPath string, source opslevel.ApiDocumentSourceEnum, result *ServiceResult) {
+	if service.ApiDocumentPath == docPath && service.PreferredApiDocumentSource != nil && *service.PreferredApiDocumentSource == source {
+		return
+	}
+	if result.dryRun("set the API document to '%s' from %s", docPath, source) {
+		return
+	}
+	_, err := client.ServiceApiDocSettingsUpdate(fmt.Sprint(service.Id), docPath, &source)
+	audit(registration.Name, registration.Aliases, "serviceApiDocSettingsUpdate", map[string]string{"docPath": docPath, "docSource": string(source)}, err)
+	if err != nil {
+		result.failed(err, "Failed setting the API document to '%s'", docPath)
+	} else {
+		result.changed("Set the API document to '%s' from %s", docPath, source)
+	}
+}
+
+// pushAPIDoc downloads the spec and pushes it to the API document integration of the service's first alias
+func pushAPIDoc(registration ServiceRegistration, url string, integrationUrl string, result *ServiceResult) bool {
+	if result.dryRun("push the API document '%s'", url) {
+		return true
+	}
+	client := NewHTTPClient()
+	download, err := client.R().Get(url)
+	if err == nil && download.IsError() {
+		err = fmt.Errorf("%s", download.Status())
+	}
+	if err != nil {
+		result.failed(err, "Failed downloading the API document '%s'", url)
+		return false
+	}
+	resp, err := client.R().
+		SetHeader("Content-Type", download.Header().Get("Content-Type")).
+		SetBody(download.Body()).
+		Post(fmt.Sprintf("%s/%s", strings.TrimSuffix(integrationUrl, "/"), registration.Aliases[0]))
+	if err == nil && resp.IsError() {
+		err = fmt.Errorf("%s: %s", resp.Status(), string(resp.Body()))
+	}
+	audit(registration.Name, registration.Aliases, "apiDocumentPush", url, err)
+	if err != nil {
+		result.failed(err, "Failed pushing the API document '%s'", url)
+		return false
+	}
+	result.changed("Pushed the API document '%s'", url)
+	return true
+}
+
+// handleDocs makes the first API spec the service's API document - repository paths are pulled by OpsLevel
+// and urls are pushed through the API document integration from 'docs.url'
+func handleDocs(client *opslevel.Client, registration ServiceRegistration, service *opslevel.Service, result *ServiceResult) {
+	if len(registration.APIDocs) == 0 {
+		return
+	}
+	if len(registration.APIDocs) > 1 {
+		result.warned("Only the first of the API documents %v is used", registration.APIDocs)
+	}
+	doc := registration.APIDocs[0]
+	if !isURL(doc) {
+		setAPIDocSettings(client, registration, service, strings.TrimPrefix(doc, "/"), opslevel.ApiDocumentSourceEnumPull, result)
+		return
+	}
+	integrationUrl := getDocsConfig().URL
+	if integrationUrl == "" {
+		result.warned("Skipping the API document '%s' because 'docs.url' is not set", doc)
+		return
+	}
+	if pushAPIDoc(registration, doc, integrationUrl, result) {
+		setAPIDocSettings(client, registration, service, service.ApiDocumentPath, opslevel.ApiDocumentSourceEnumPush, result)
+	}
+}
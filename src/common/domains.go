@@ -0,0 +1,159 @@
+package common
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/opslevel/kubectl-opslevel/config"
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/shurcooL/graphql"
+)
+
+var (
+	domainsConfigMutex sync.Mutex
+	domainsConfig      config.DomainsConfig
+)
+
+// SetDomains configures whether the missing domains of a registration are created
+func SetDomains(domains config.DomainsConfig) {
+	domainsConfigMutex.Lock()
+	defer domainsConfigMutex.Unlock()
+	domainsConfig = domains
+}
+
+func getDomainsConfig() config.DomainsConfig {
+	domainsConfigMutex.Lock()
+	defer domainsConfigMutex.Unlock()
+	return domainsConfig
+}
+
+// DomainInput is named after the GraphQL input type of the 'domainCreate' mutation
+type DomainInput struct {
+	Name        string     `json:"name,omitempty"`
+	Description string     `json:"description,omitempty"`
+	OwnerId     graphql.ID `json:"ownerId,omitempty"`
+}
+
+type domainNode struct {
+	Id      graphql.ID
+	Name    string
+	Aliases []string
+}
+
+func getDomainWithAlias(client *opslevel.Client, alias string) (*domainNode, error) {
+	var q struct {
+		Account struct {
+			Domain domainNode `graphql:"domain(input: $input)"`
+		}
+	}
+	v := opslevel.PayloadVariables{
+		"input": opslevel.IdentifierInput{Alias: graphql.String(alias)},
+	}
+	if err := client.Query(&q, v); err != nil {
+		return nil, err
+	}
+	return &q.Account.Domain, nil
+}
+
+func createDomain(client *opslevel.Client, input DomainInput) (*domainNode, error) {
+	var m struct {
+		Payload struct {
+			Domain domainNode
+			Errors []opslevel.OpsLevelErrors
+		} `graphql:"domainCreate(input: $input)"`
+	}
+	v := opslevel.PayloadVariables{
+		"input": input,
+	}
+	if err := client.Mutate(&m, v); err != nil {
+		return nil, err
+	}
+	return &m.Payload.Domain, opslevel.FormatErrors(m.Payload.Errors)
+}
+
+func getSystemParent(client *opslevel.Client, id graphql.ID) (*domainNode, error) {
+	var q struct {
+		Account struct {
+			System struct {
+				Parent *domainNode
+			} `graphql:"system(input: $input)"`
+		}
+	}
+	v := opslevel.PayloadVariables{
+		"input": opslevel.IdentifierInput{Id: id},
+	}
+	if err := client.Query(&q, v); err != nil {
+		return nil, err
+	}
+	return q.Account.System.Parent, nil
+}
+
+func setSystemParent(client *opslevel.Client, system graphql.ID, input SystemInput) error {
+	var m struct {
+		Payload struct {
+			Errors []opslevel.OpsLevelErrors
+		} `graphql:"systemUpdate(system: $system, input: $input)"`
+	}
+	v := opslevel.PayloadVariables{
+		"system": opslevel.IdentifierInput{Id: system},
+		"input":  input,
+	}
+	if err := client.Mutate(&m, v); err != nil {
+		return err
+	}
+	return opslevel.FormatErrors(m.Payload.Errors)
+}
+
+// ensureDomain returns the id of the domain with the alias creating it when 'domains.autoCreate' is set.
+// The id is nil when the domain does not exist (or would be created in a dry run).
+func ensureDomain(client *opslevel.Client, registration ServiceRegistration, alias string, result *ServiceResult) (graphql.ID, error) {
+	domains := getDomainsConfig()
+	definition := domains.Get(alias)
+	lookup := func() (graphql.ID, error) {
+		domain, err := getDomainWithAlias(client, alias)
+		if err != nil {
+			return nil, err
+		}
+		return domain.Id, nil
+	}
+	prepare := func(ownerId graphql.ID) (interface{}, func() (graphql.ID, []string, error)) {
+		input := DomainInput{
+			Name:        orDefault(definition.Name, alias),
+			Description: definition.Description,
+			OwnerId:     ownerId,
+		}
+		return input, func() (graphql.ID, []string, error) {
+			created, err := createDomain(client, input)
+			if err != nil {
+				return nil, nil, err
+			}
+			return created.Id, created.Aliases, nil
+		}
+	}
+	return ensureAliased(client, registration, "domain", alias, domains.AutoCreate, definition.Owner, lookup, prepare, result)
+}
+
+// ensureSystemDomain moves the system into the domain - checked once per system and run
+func ensureSystemDomain(client *opslevel.Client, registration ServiceRegistration, systemId graphql.ID, domainId graphql.ID, result *ServiceResult) error {
+	_, err := GetOrCreateAliasCache(registration.Account).Resolve("system-domain", fmt.Sprint(systemId), func() (graphql.ID, error) {
+		parent, err := getSystemParent(client, systemId)
+		if err != nil {
+			return nil, err
+		}
+		if parent != nil && fmt.Sprint(parent.Id) == fmt.Sprint(domainId) {
+			return domainId, nil
+		}
+		if result.dryRun("assign system '%s' to domain '%s'", registration.System, registration.Domain) {
+			return nil, nil
+		}
+		input := SystemInput{Parent: &opslevel.IdentifierInput{Id: domainId}}
+		err = setSystemParent(client, systemId, input)
+		audit(registration.Name, registration.Aliases, "systemUpdate", input, err)
+		if err != nil {
+			return nil, err
+		}
+		result.changed("Assigned system '%s' to domain '%s'", registration.System, registration.Domain)
+		return domainId, nil
+	})
+	return err
+}
@@ -0,0 +1,184 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/shurcooL/graphql"
+)
+
+// ServiceFilter is the set of services in an OpsLevel filter - only the registrations of these services are reconciled
+type ServiceFilter struct {
+	Name    string
+	aliases map[string]bool
+}
+
+// Matches is true when one of the registration's aliases belongs to a service in the filter
+func (f *ServiceFilter) Matches(registration ServiceRegistration) bool {
+	for _, alias := range registration.Aliases {
+		if f.aliases[alias] {
+			return true
+		}
+	}
+	return false
+}
+
+// Size is the number of services in the filter
+func (f *ServiceFilter) Size() int {
+	return len(f.aliases)
+}
+
+func findFilter(client *opslevel.Client, identifier string) (*opslevel.Filter, error) {
+	if opslevel.IsID(identifier) {
+		filter, err := client.GetFilter(graphql.ID(identifier))
+		if err != nil {
+			return nil, err
+		}
+		if filter.Id != nil {
+			return filter, nil
+		}
+	}
+	filters, err := client.ListFilters()
+	if err != nil {
+		return nil, err
+	}
+	for _, filter := range filters {
+		if filter.Name == identifier || filter.Alias() == identifier {
+			return &filter, nil
+		}
+	}
+	return nil, fmt.Errorf("no OpsLevel filter found with id, name or alias '%s'", identifier)
+}
+
+// GetServiceFilter looks up the OpsLevel filter by id, name or alias and lists the aliases of the services it selects
+func GetServiceFilter(client *opslevel.Client, identifier string) (*ServiceFilter, error) {
+	filter, err := findFilter(client, identifier)
+	if err != nil {
+		return nil, err
+	}
+	output := &ServiceFilter{Name: filter.Name, aliases: map[string]bool{}}
+	var q struct {
+		Account struct {
+			Services struct {
+				Nodes []struct {
+					Aliases []string
+				}
+				PageInfo opslevel.PageInfo
+			} `graphql:"services(filterIdentifier: $filter, after: $after, first: $first)"`
+		}
+	}
+	v := opslevel.PayloadVariables{
+		"filter": opslevel.IdentifierInput{Id: filter.Id},
+		"after":  graphql.String(""),
+		"first":  graphql.Int(100),
+	}
+	for {
+		if err := client.Query(&q, v); err != nil {
+			return nil, err
+		}
+		for _, node := range q.Account.Services.Nodes {
+			for _, alias := range node.Aliases {
+				output.aliases[alias] = true
+			}
+		}
+		if !q.Account.Services.PageInfo.HasNextPage {
+			return output, nil
+		}
+		v["after"] = graphql.String(q.Account.Services.PageInfo.End)
+	}
+}
+
+// ScopeFilter is the definition of an OpsLevel filter selecting the services this tool synced from a cluster or namespace
+type ScopeFilter struct {
+	Name       string                     `json:"name"`
+	Connective opslevel.ConnectiveEnum    `json:"connective,omitempty"`
+	Predicates []opslevel.FilterPredicate `json:"predicates"`
+}
+
+func tagEquals(key string, value string) opslevel.FilterPredicate {
+	return opslevel.FilterPredicate{Key: opslevel.PredicateKeyEnumTags, KeyData: key, Type: opslevel.PredicateTypeEnumEquals, Value: value}
+}
+
+// ScopeFilters returns a filter for the cluster and one per namespace keyed on the managed-by-cluster and managed-by-namespace tags
+func ScopeFilters(cluster string, namespaces []string) []ScopeFilter {
+	prefix := getTagPrefix()
+	clusterTag := tagEquals(prefix+"managed-by-cluster", cluster)
+	output := []ScopeFilter{{Name: fmt.Sprintf("Cluster %s", cluster), Connective: opslevel.ConnectiveEnumAnd, Predicates: []opslevel.FilterPredicate{clusterTag}}}
+	seen := map[string]bool{}
+	sorted := append([]string{}, namespaces...)
+	sort.Strings(sorted)
+	for _, namespace := range sorted {
+		if namespace == "" || seen[namespace] {
+			continue
+		}
+		seen[namespace] = true
+		output = append(output, ScopeFilter{
+			Name:       fmt.Sprintf("Cluster %s Namespace %s", cluster, namespace),
+			Connective: opslevel.ConnectiveEnumAnd,
+			Predicates: []opslevel.FilterPredicate{clusterTag, tagEquals(prefix+"managed-by-namespace", namespace)},
+		})
+	}
+	return output
+}
+
+func samePredicates(a []opslevel.FilterPredicate, b []opslevel.FilterPredicate) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// EnsureScopeFilters creates the filters missing from the account and updates the ones whose predicates changed
+func EnsureScopeFilters(client *opslevel.Client, filters []ScopeFilter) ([]ServiceResult, error) {
+	existing, err := client.ListFilters()
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]opslevel.Filter{}
+	for _, filter := range existing {
+		byName[filter.Name] = filter
+	}
+	var results []ServiceResult
+	for _, filter := range filters {
+		result := &ServiceResult{Name: filter.Name, Action: ServiceAction_Unchanged}
+		current, ok := byName[filter.Name]
+		switch {
+		case !ok:
+			result.Action = ServiceAction_Created
+			if result.dryRun("create filter with predicates %+v", filter.Predicates) {
+				break
+			}
+			input := opslevel.FilterCreateInput{Name: filter.Name, Predicates: filter.Predicates, Connective: filter.Connective}
+			_, err := client.CreateFilter(input)
+			audit(filter.Name, nil, "filterCreate", input, err)
+			if err != nil {
+				result.Action = ServiceAction_Failed
+				result.failed(err, "Failed creating filter")
+			} else {
+				result.changed("Created filter")
+			}
+		case !samePredicates(current.Predicates, filter.Predicates) || current.Connective != filter.Connective:
+			result.Action = ServiceAction_Updated
+			if result.dryRun("update filter predicates to %+v", filter.Predicates) {
+				break
+			}
+			input := opslevel.FilterUpdateInput{Id: current.Id, Name: filter.Name, Predicates: filter.Predicates, Connective: filter.Connective}
+			_, err := client.UpdateFilter(input)
+			audit(filter.Name, nil, "filterUpdate", input, err)
+			if err != nil {
+				result.Action = ServiceAction_Failed
+				result.failed(err, "Failed updating filter")
+			} else {
+				result.changed("Updated filter")
+			}
+		}
+		results = append(results, *result)
+	}
+	return results, nil
+}
@@ -0,0 +1,270 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/rs/zerolog/log"
+
+	"github.com/opslevel/kubectl-opslevel/k8sutils"
+)
+
+const argoTrackingAnnotation = "argocd.argoproj.io/tracking-id"
+
+var (
+	argoApplicationSelector   = k8sutils.KubernetesSelector{ApiVersion: "argoproj.io/v1alpha1", Kind: "Application"}
+	fluxKustomizationSelector = k8sutils.KubernetesSelector{ApiVersion: "kustomize.toolkit.fluxcd.io/v1", Kind: "Kustomization"}
+	fluxHelmReleaseSelector   = k8sutils.KubernetesSelector{ApiVersion: "helm.toolkit.fluxcd.io/v2", Kind: "HelmRelease"}
+	fluxGitRepositorySelector = k8sutils.KubernetesSelector{ApiVersion: "source.toolkit.fluxcd.io/v1", Kind: "GitRepository"}
+
+	// fluxOwnerLabels are the label groups Flux marks the objects it applies with
+	fluxOwnerLabels = []struct{ kind, group string }{
+		{"Kustomization", "kustomize.toolkit.fluxcd.io"},
+		{"HelmRelease", "helm.toolkit.fluxcd.io"},
+	}
+
+	gitOpsMutex sync.Mutex
+	// gitOpsSources is nil unless the GitOps resources were listed by this run
+	gitOpsSources *gitOpsIndex
+)
+
+// gitOpsSource is a path in a git repository a GitOps tool deploys from
+type gitOpsSource struct {
+	URL  string
+	Path string
+}
+
+// gitOpsIndex are the git sources of the Argo CD applications keyed by '<namespace>/<name>' and of the Flux
+// Kustomizations and HelmReleases keyed by '<kind>/<namespace>/<name>'
+type gitOpsIndex struct {
+	applications map[string][]gitOpsSource
+	flux         map[string][]gitOpsSource
+}
+
+type gitOpsObject struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name        string            `json:"name"`
+		Namespace   string            `json:"namespace"`
+		Labels      map[string]string `json:"labels"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+}
+
+type argoApplicationSource struct {
+	RepoURL string `json:"repoURL"`
+	Path    string `json:"path"`
+	Chart   string `json:"chart"`
+}
+
+type argoApplication struct {
+	gitOpsObject
+	Spec struct {
+		Source  *argoApplicationSource  `json:"source"`
+		Sources []argoApplicationSource `json:"sources"`
+	} `json:"spec"`
+}
+
+type fluxSourceRef struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+type fluxKustomization struct {
+	gitOpsObject
+	Spec struct {
+		Path      string        `json:"path"`
+		SourceRef fluxSourceRef `json:"sourceRef"`
+	} `json:"spec"`
+}
+
+type fluxHelmRelease struct {
+	gitOpsObject
+	Spec struct {
+		Chart struct {
+			Spec struct {
+				Chart     string        `json:"chart"`
+				SourceRef fluxSourceRef `json:"sourceRef"`
+			} `json:"spec"`
+		} `json:"chart"`
+	} `json:"spec"`
+}
+
+type fluxGitRepository struct {
+	gitOpsObject
+	Spec struct {
+		URL string `json:"url"`
+	} `json:"spec"`
+}
+
+// gitRepositoryAlias turns a clone url into an OpsLevel repository alias IE: 'git@github.com:acme/web.git' becomes 'github.com:acme/web'
+func gitRepositoryAlias(cloneURL string) string {
+	cloneURL = strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(cloneURL), "/"), ".git")
+	if strings.Contains(cloneURL, "://") {
+		parsed, err := url.Parse(cloneURL)
+		if err != nil || parsed.Hostname() == "" {
+			return ""
+		}
+		return fmt.Sprintf("%s:%s", parsed.Hostname(), strings.Trim(parsed.Path, "/"))
+	}
+	// scp-like syntax IE: 'git@github.com:acme/web'
+	if _, hostPath, ok := strings.Cut(cloneURL, "@"); ok {
+		if host, path, ok := strings.Cut(hostPath, ":"); ok && host != "" && path != "" {
+			return fmt.Sprintf("%s:%s", host, strings.Trim(path, "/"))
+		}
+	}
+	return ""
+}
+
+// gitOpsDirectory normalizes a path in a repository to a base directory IE: './apps/web/' becomes 'apps/web'
+func gitOpsDirectory(path string) string {
+	path = strings.Trim(strings.TrimPrefix(path, "./"), "/")
+	if path == "." {
+		return ""
+	}
+	return path
+}
+
+// indexGitOpsSources resolves the git repository and path every Argo CD application, Flux Kustomization and Flux
+// HelmRelease deploys from - helm repositories and OCI sources are not git repositories and are skipped
+func indexGitOpsSources(applications [][]byte, kustomizations [][]byte, helmReleases [][]byte, gitRepositories [][]byte) *gitOpsIndex {
+	output := &gitOpsIndex{applications: map[string][]gitOpsSource{}, flux: map[string][]gitOpsSource{}}
+	for _, data := range applications {
+		var application argoApplication
+		if err := json.Unmarshal(data, &application); err != nil {
+			continue
+		}
+		sources := application.Spec.Sources
+		if application.Spec.Source != nil {
+			sources = append(sources, *application.Spec.Source)
+		}
+		key := application.Metadata.Namespace + "/" + application.Metadata.Name
+		for _, source := range sources {
+			if source.Chart != "" || source.RepoURL == "" {
+				continue
+			}
+			output.applications[key] = append(output.applications[key], gitOpsSource{URL: source.RepoURL, Path: source.Path})
+		}
+	}
+	urls := map[string]string{}
+	for _, data := range gitRepositories {
+		var repository fluxGitRepository
+		if err := json.Unmarshal(data, &repository); err == nil {
+			urls[repository.Metadata.Namespace+"/"+repository.Metadata.Name] = repository.Spec.URL
+		}
+	}
+	add := func(object gitOpsObject, ref fluxSourceRef, path string) {
+		if ref.Kind != "GitRepository" {
+			return
+		}
+		namespace := orDefault(ref.Namespace, object.Metadata.Namespace)
+		if repositoryURL, ok := urls[namespace+"/"+ref.Name]; ok {
+			key := fmt.Sprintf("%s/%s/%s", object.Kind, object.Metadata.Namespace, object.Metadata.Name)
+			output.flux[key] = append(output.flux[key], gitOpsSource{URL: repositoryURL, Path: path})
+		}
+	}
+	for _, data := range kustomizations {
+		var kustomization fluxKustomization
+		if err := json.Unmarshal(data, &kustomization); err == nil {
+			add(kustomization.gitOpsObject, kustomization.Spec.SourceRef, kustomization.Spec.Path)
+		}
+	}
+	for _, data := range helmReleases {
+		var release fluxHelmRelease
+		if err := json.Unmarshal(data, &release); err == nil {
+			add(release.gitOpsObject, release.Spec.Chart.Spec.SourceRef, release.Spec.Chart.Spec.Chart)
+		}
+	}
+	return output
+}
+
+// sourcesOf returns the git sources of the Argo CD application or Flux object that manages the resource
+func (g *gitOpsIndex) sourcesOf(object gitOpsObject) []gitOpsSource {
+	var output []gitOpsSource
+	// the tracking id is '<app>:<group>/<kind>:<namespace>/<name>' where '<app>' is '<namespace>_<name>' outside the control plane namespace
+	if trackingID := object.Metadata.Annotations[argoTrackingAnnotation]; trackingID != "" {
+		application, _, _ := strings.Cut(trackingID, ":")
+		if namespace, name, ok := strings.Cut(application, "_"); ok {
+			output = append(output, g.applications[namespace+"/"+name]...)
+		} else {
+			var keys []string
+			for key := range g.applications {
+				if strings.HasSuffix(key, "/"+application) {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				output = append(output, g.applications[key]...)
+			}
+		}
+	}
+	for _, owner := range fluxOwnerLabels {
+		name := object.Metadata.Labels[owner.group+"/name"]
+		if name == "" {
+			continue
+		}
+		namespace := orDefault(object.Metadata.Labels[owner.group+"/namespace"], object.Metadata.Namespace)
+		output = append(output, g.flux[fmt.Sprintf("%s/%s/%s", owner.kind, namespace, name)]...)
+	}
+	return output
+}
+
+// loadGitOpsSources lists the Argo CD and Flux resources once - kinds whose CRDs are not installed are skipped
+func loadGitOpsSources(source resourceSource) error {
+	selectors := []k8sutils.KubernetesSelector{argoApplicationSelector, fluxKustomizationSelector, fluxHelmReleaseSelector, fluxGitRepositorySelector}
+	listed := make([][][]byte, len(selectors))
+	found := false
+	for i, selector := range selectors {
+		resources, err := source.Query(-1, selector)
+		if err != nil {
+			log.Debug().Msgf("Skipping the GitOps kind '%s/%s': %v", selector.ApiVersion, selector.Kind, err)
+			continue
+		}
+		if RecordDirectory != "" {
+			if err := writeRecording(RecordDirectory, -1, selector, resources); err != nil {
+				return err
+			}
+		}
+		listed[i] = resources
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("neither Argo CD applications nor Flux resources could be listed")
+	}
+	gitOpsMutex.Lock()
+	defer gitOpsMutex.Unlock()
+	gitOpsSources = indexGitOpsSources(listed[0], listed[1], listed[2], listed[3])
+	return nil
+}
+
+// gitOpsRepositories returns the repositories and base directories the resource is deployed from by Argo CD or Flux
+func gitOpsRepositories(resource []byte) []opslevel.ServiceRepositoryCreateInput {
+	var object gitOpsObject
+	if err := json.Unmarshal(resource, &object); err != nil {
+		return nil
+	}
+	gitOpsMutex.Lock()
+	defer gitOpsMutex.Unlock()
+	if gitOpsSources == nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	var output []opslevel.ServiceRepositoryCreateInput
+	for _, source := range gitOpsSources.sourcesOf(object) {
+		alias := gitRepositoryAlias(source.URL)
+		directory := gitOpsDirectory(source.Path)
+		if alias == "" || seen[alias+"\n"+directory] {
+			continue
+		}
+		seen[alias+"\n"+directory] = true
+		output = append(output, *convertToServiceRepositoryCreateInput(map[string]string{"repo": alias, "directory": directory}))
+	}
+	return output
+}
@@ -0,0 +1,215 @@
+package common
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/opslevel/kubectl-opslevel/jq"
+	"github.com/opslevel/kubectl-opslevel/k8sutils"
+)
+
+const (
+	rolloutComplete    = "complete"
+	rolloutProgressing = "progressing"
+	rolloutFailed      = "failed"
+)
+
+type healthWorkload struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name       string `json:"name"`
+		Namespace  string `json:"namespace"`
+		Generation int64  `json:"generation"`
+	} `json:"metadata"`
+	Spec struct {
+		Replicas *int64 `json:"replicas"`
+	} `json:"spec"`
+	Status struct {
+		ObservedGeneration     int64  `json:"observedGeneration"`
+		Replicas               int64  `json:"replicas"`
+		ReadyReplicas          int64  `json:"readyReplicas"`
+		UpdatedReplicas        int64  `json:"updatedReplicas"`
+		AvailableReplicas      int64  `json:"availableReplicas"`
+		DesiredNumberScheduled int64  `json:"desiredNumberScheduled"`
+		NumberReady            int64  `json:"numberReady"`
+		UpdatedNumberScheduled int64  `json:"updatedNumberScheduled"`
+		NumberAvailable        int64  `json:"numberAvailable"`
+		CurrentRevision        string `json:"currentRevision"`
+		UpdateRevision         string `json:"updateRevision"`
+		Conditions             []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+			Reason string `json:"reason"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+type healthPod struct {
+	costPod
+	Status struct {
+		ContainerStatuses []struct {
+			RestartCount int64 `json:"restartCount"`
+		} `json:"containerStatuses"`
+	} `json:"status"`
+}
+
+// resourceWorkloadKey is the '<namespace>/<kind>/<name>' key of a resource used to look up its runtime health
+func resourceWorkloadKey(resource []byte) string {
+	var workload healthWorkload
+	if err := json.Unmarshal(resource, &workload); err != nil || workload.Kind == "" {
+		return ""
+	}
+	return workloadKey(workload.Metadata.Namespace, workload.Kind, workload.Metadata.Name)
+}
+
+// rolloutStatus mirrors 'kubectl rollout status' - a rollout is complete once every replica runs the latest revision
+func (w healthWorkload) rolloutStatus(desired int64) string {
+	for _, condition := range w.Status.Conditions {
+		if condition.Type == "Progressing" && condition.Reason == "ProgressDeadlineExceeded" {
+			return rolloutFailed
+		}
+	}
+	if w.Status.ObservedGeneration < w.Metadata.Generation {
+		return rolloutProgressing
+	}
+	status := w.Status
+	switch w.Kind {
+	case "DaemonSet":
+		if status.UpdatedNumberScheduled < desired || status.NumberAvailable < desired {
+			return rolloutProgressing
+		}
+	case "StatefulSet":
+		if status.ReadyReplicas < desired || (status.UpdateRevision != "" && status.CurrentRevision != status.UpdateRevision) {
+			return rolloutProgressing
+		}
+	default:
+		if status.UpdatedReplicas < desired || status.Replicas > status.UpdatedReplicas || status.AvailableReplicas < status.UpdatedReplicas {
+			return rolloutProgressing
+		}
+	}
+	return rolloutComplete
+}
+
+// summarizeHealth computes the replica readiness, container restarts and rollout status of every workload keyed by '<namespace>/<kind>/<name>'
+func summarizeHealth(workloads [][]byte, pods [][]byte) map[string]map[string]interface{} {
+	restarts := map[string]int64{}
+	for _, data := range pods {
+		var pod healthPod
+		if err := json.Unmarshal(data, &pod); err != nil {
+			continue
+		}
+		key := podWorkload(pod.costPod)
+		for _, container := range pod.Status.ContainerStatuses {
+			restarts[key] += container.RestartCount
+		}
+	}
+	output := map[string]map[string]interface{}{}
+	for _, data := range workloads {
+		var workload healthWorkload
+		if err := json.Unmarshal(data, &workload); err != nil {
+			continue
+		}
+		desired, ready := int64(1), workload.Status.ReadyReplicas
+		if workload.Kind == "DaemonSet" {
+			desired, ready = workload.Status.DesiredNumberScheduled, workload.Status.NumberReady
+		} else if workload.Spec.Replicas != nil {
+			desired = *workload.Spec.Replicas
+		}
+		key := workloadKey(workload.Metadata.Namespace, workload.Kind, workload.Metadata.Name)
+		output[key] = map[string]interface{}{
+			"desired_replicas":   desired,
+			"ready_replicas":     ready,
+			"all_replicas_ready": ready >= desired,
+			"restart_count":      restarts[key],
+			"rollout_status":     workload.rolloutStatus(desired),
+		}
+	}
+	return output
+}
+
+// HealthReporter remembers the reconciled services and periodically posts the runtime health of their workloads
+// together with their other facts to the custom event check integration
+type HealthReporter struct {
+	mutex    sync.Mutex
+	services map[string]ServiceRegistration
+}
+
+func NewHealthReporter() *HealthReporter {
+	return &HealthReporter{services: map[string]ServiceRegistration{}}
+}
+
+// Remember keeps the latest registration of a service backed by a workload
+func (h *HealthReporter) Remember(service ServiceRegistration) {
+	if service.Workload == "" || len(service.Aliases) == 0 {
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.services[service.Aliases[0]] = service
+}
+
+// Report lists the workloads and pods once and posts a check payload for every remembered service
+func (h *HealthReporter) Report(k8sClient *k8sutils.ClientWrapper) error {
+	url := getChecksConfig().URL
+	if url == "" {
+		return nil
+	}
+	k8sutils.ResetSnapshot()
+	defer k8sutils.ResetSnapshot()
+	source := &liveSource{client: k8sClient}
+	var workloads [][]byte
+	for _, selector := range namespaceWorkloadSelectors {
+		resources, err := source.Query(-1, selector)
+		if err != nil {
+			return err
+		}
+		workloads = append(workloads, resources...)
+	}
+	pods, err := source.Query(-1, podSelector)
+	if err != nil {
+		return err
+	}
+	health := summarizeHealth(workloads, pods)
+
+	h.mutex.Lock()
+	var aliases []string
+	for alias := range h.services {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	services := make([]ServiceRegistration, len(aliases))
+	for i, alias := range aliases {
+		services[i] = h.services[alias]
+	}
+	h.mutex.Unlock()
+
+	sent := 0
+	for _, service := range services {
+		facts, ok := health[service.Workload]
+		if !ok {
+			continue
+		}
+		for key, value := range service.CheckPayload {
+			if _, isHealth := facts[key]; !isHealth {
+				facts[key] = value
+			}
+		}
+		payload := CheckPayload{Service: service.Aliases[0], Cluster: jq.GetArg("cluster"), Facts: facts}
+		data, _ := json.Marshal(payload)
+		if isDryRun(service.Name, "send health check payload %s", string(data)) {
+			continue
+		}
+		err := postCheckPayload(url, data)
+		audit(service.Name, service.Aliases, "checkPayload", payload, err)
+		if err != nil {
+			log.Error().Msgf("[%s] Failed sending health check payload\n\tREASON: %v", service.Name, err)
+			continue
+		}
+		sent++
+	}
+	log.Info().Msgf("Sent the runtime health of %d service(s)", sent)
+	return nil
+}
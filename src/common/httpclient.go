@@ -0,0 +1,32 @@
+package common
+
+import (
+	"crypto/tls"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+)
+
+var (
+	httpClientMutex sync.Mutex
+	httpTLSConfig   *tls.Config
+)
+
+// SetHTTPTLSConfig configures the tls config of the http clients posting payloads and fetching documents IE: the CA
+// bundle and client certificate of '--api-ca-file' - nil keeps the system roots
+func SetHTTPTLSConfig(tlsConfig *tls.Config) {
+	httpClientMutex.Lock()
+	defer httpClientMutex.Unlock()
+	httpTLSConfig = tlsConfig
+}
+
+// NewHTTPClient builds a rest client honoring the tls config of the OpsLevel API
+func NewHTTPClient() *resty.Client {
+	httpClientMutex.Lock()
+	defer httpClientMutex.Unlock()
+	client := resty.New()
+	if httpTLSConfig != nil {
+		client.SetTLSClientConfig(httpTLSConfig)
+	}
+	return client
+}
@@ -0,0 +1,235 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/opslevel/kubectl-opslevel/config"
+	"github.com/opslevel/kubectl-opslevel/k8sutils"
+)
+
+const (
+	defaultIdleDays = 14
+	idleSinceFormat = "2006-01-02"
+)
+
+// PersistIdleState makes GetAllServices save when the workloads were first seen idle - only set by 'service import' so a
+// preview, diff or report does not advance the days without ready endpoints
+var PersistIdleState bool
+
+var (
+	serviceSelector       = k8sutils.KubernetesSelector{ApiVersion: "v1", Kind: "Service"}
+	endpointSliceSelector = k8sutils.KubernetesSelector{ApiVersion: "discovery.k8s.io/v1", Kind: "EndpointSlice"}
+
+	idleMutex sync.Mutex
+	// idleEndpoints is nil unless the endpoints were listed by this run
+	idleEndpoints *endpointSummary
+	idleSettings  config.IdleConfig
+	// idleState is when every workload was first seen without ready endpoints keyed by '<namespace>/<kind>/<name>'
+	idleState     map[string]time.Time
+	idleStatePath string
+)
+
+// endpointSummary is which workloads are exposed by a Service and which of them have ready endpoints
+type endpointSummary struct {
+	selectors map[string][]labels.Selector
+	ready     map[string]bool
+}
+
+type idleService struct {
+	Metadata struct {
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		Selector map[string]string `json:"selector"`
+	} `json:"spec"`
+}
+
+type idleEndpointSlice struct {
+	Endpoints []struct {
+		Conditions struct {
+			Ready *bool `json:"ready"`
+		} `json:"conditions"`
+		TargetRef struct {
+			Kind      string `json:"kind"`
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"targetRef"`
+	} `json:"endpoints"`
+}
+
+type idleWorkload struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		Template struct {
+			Metadata struct {
+				Labels map[string]string `json:"labels"`
+			} `json:"metadata"`
+		} `json:"template"`
+	} `json:"spec"`
+}
+
+// summarizeEndpoints resolves the ready pods behind every EndpointSlice to their workloads - an endpoint without
+// a ready condition counts as ready like it does for kube-proxy
+func summarizeEndpoints(services [][]byte, slices [][]byte, pods [][]byte) *endpointSummary {
+	output := &endpointSummary{selectors: map[string][]labels.Selector{}, ready: map[string]bool{}}
+	for _, data := range services {
+		var service idleService
+		if err := json.Unmarshal(data, &service); err != nil || len(service.Spec.Selector) == 0 {
+			continue
+		}
+		namespace := service.Metadata.Namespace
+		output.selectors[namespace] = append(output.selectors[namespace], labels.SelectorFromSet(service.Spec.Selector))
+	}
+	workloads := map[string]string{}
+	for _, data := range pods {
+		var pod costPod
+		if err := json.Unmarshal(data, &pod); err == nil {
+			workloads[pod.Metadata.Namespace+"/"+pod.Metadata.Name] = podWorkload(pod)
+		}
+	}
+	for _, data := range slices {
+		var slice idleEndpointSlice
+		if err := json.Unmarshal(data, &slice); err != nil {
+			continue
+		}
+		for _, endpoint := range slice.Endpoints {
+			target := endpoint.TargetRef
+			if target.Kind != "Pod" || (endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready) {
+				continue
+			}
+			if key := workloads[target.Namespace+"/"+target.Name]; key != "" {
+				output.ready[key] = true
+			}
+		}
+	}
+	return output
+}
+
+// isIdle reports whether a Service selects the pods of the workload while none of them are ready endpoints - workloads
+// no Service selects such as queue workers never receive traffic and are not idle
+func (s *endpointSummary) isIdle(workload idleWorkload) bool {
+	key := workloadKey(workload.Metadata.Namespace, workload.Kind, workload.Metadata.Name)
+	if s.ready[key] || len(workload.Spec.Template.Metadata.Labels) == 0 {
+		return false
+	}
+	podLabels := labels.Set(workload.Spec.Template.Metadata.Labels)
+	for _, selector := range s.selectors[workload.Metadata.Namespace] {
+		if selector.Matches(podLabels) {
+			return true
+		}
+	}
+	return false
+}
+
+func idleStateFile(cluster string) string {
+	sum := sha256.Sum256([]byte(CacheNamespace + "\n" + cluster))
+	return filepath.Join(CacheDirectory, "idle-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// loadIdleEndpoints lists the Services, EndpointSlices and Pods once and reads when the workloads were first seen
+// without ready endpoints by earlier runs
+func loadIdleEndpoints(source resourceSource, cluster string, c config.IdleConfig) error {
+	var listed [3][][]byte
+	for i, selector := range []k8sutils.KubernetesSelector{serviceSelector, endpointSliceSelector, podSelector} {
+		resources, err := source.Query(-1, selector)
+		if err != nil {
+			return err
+		}
+		if RecordDirectory != "" {
+			if err := writeRecording(RecordDirectory, -1, selector, resources); err != nil {
+				return err
+			}
+		}
+		listed[i] = resources
+	}
+	state := map[string]time.Time{}
+	path := ""
+	if CacheDirectory != "" {
+		path = idleStateFile(cluster)
+		if data, err := os.ReadFile(path); err == nil {
+			if err := json.Unmarshal(data, &state); err != nil {
+				log.Debug().Msgf("Ignoring unreadable idle workloads state: %v", err)
+			}
+		}
+	}
+	idleMutex.Lock()
+	defer idleMutex.Unlock()
+	idleEndpoints = summarizeEndpoints(listed[0], listed[1], listed[2])
+	idleSettings = c
+	idleState = state
+	idleStatePath = path
+	return nil
+}
+
+// idleSince returns when the resource was first seen without ready endpoints once that is at least the configured
+// number of days ago - the first sighting is remembered until the workload has ready endpoints again
+func idleSince(resource []byte, now time.Time) (time.Time, bool) {
+	var workload idleWorkload
+	if err := json.Unmarshal(resource, &workload); err != nil {
+		return time.Time{}, false
+	}
+	idleMutex.Lock()
+	defer idleMutex.Unlock()
+	if idleEndpoints == nil {
+		return time.Time{}, false
+	}
+	key := workloadKey(workload.Metadata.Namespace, workload.Kind, workload.Metadata.Name)
+	if !idleEndpoints.isIdle(workload) {
+		delete(idleState, key)
+		return time.Time{}, false
+	}
+	since, ok := idleState[key]
+	if !ok {
+		since = now
+		idleState[key] = since
+	}
+	days := idleSettings.Days
+	if days <= 0 {
+		days = defaultIdleDays
+	}
+	return since, now.Sub(since) >= time.Duration(days)*24*time.Hour
+}
+
+// applyIdle flags the registration in the run report and moves it to the configured lifecycle once its workload is idle
+func applyIdle(service *ServiceRegistration, resource []byte) {
+	since, idle := idleSince(resource, time.Now())
+	if !idle {
+		return
+	}
+	service.IdleSince = since.Format(idleSinceFormat)
+	idleMutex.Lock()
+	defer idleMutex.Unlock()
+	if idleSettings.Lifecycle != "" {
+		service.Lifecycle = idleSettings.Lifecycle
+	}
+}
+
+// saveIdleState persists when the workloads were first seen without ready endpoints for the next run
+func saveIdleState() error {
+	idleMutex.Lock()
+	defer idleMutex.Unlock()
+	if idleEndpoints == nil || idleStatePath == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(idleStatePath), 0o700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(idleState)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(idleStatePath, data, 0o600)
+}
@@ -0,0 +1,106 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/opslevel/opslevel-go/v2022"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/opslevel/kubectl-opslevel/config"
+)
+
+type imageRepositoryRule struct {
+	image      *regexp.Regexp
+	repository string
+	directory  string
+}
+
+var (
+	imageRepositoryRulesMutex sync.Mutex
+	imageRepositoryRules      []imageRepositoryRule
+)
+
+// SetImageRepositoryRules configures the rules that infer the repository of a service from its container images
+func SetImageRepositoryRules(rules []config.ImageRepositoryRule) error {
+	var parsed []imageRepositoryRule
+	for i, rule := range rules {
+		if rule.Repository == "" {
+			return fmt.Errorf("imageRepositories[%d]: 'repository' is required", i+1)
+		}
+		image, err := regexp.Compile(rule.Image)
+		if err != nil {
+			return fmt.Errorf("imageRepositories[%d]: invalid image pattern '%s': %v", i+1, rule.Image, err)
+		}
+		parsed = append(parsed, imageRepositoryRule{image: image, repository: rule.Repository, directory: rule.Directory})
+	}
+	imageRepositoryRulesMutex.Lock()
+	defer imageRepositoryRulesMutex.Unlock()
+	imageRepositoryRules = parsed
+	return nil
+}
+
+// imageName strips the tag and digest from an image IE: 'ghcr.io/acme/web:1.2.3' becomes 'ghcr.io/acme/web'
+func imageName(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+// containerImages returns the images of the containers and init containers in the pod template of a resource
+func containerImages(resource []byte) []string {
+	var object map[string]interface{}
+	if err := json.Unmarshal(resource, &object); err != nil {
+		return nil
+	}
+	spec, _, ok := podTemplate(object)
+	if !ok {
+		return nil
+	}
+	var output []string
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, _, _ := unstructured.NestedSlice(spec, field)
+		for _, container := range containers {
+			if container, ok := container.(map[string]interface{}); ok {
+				if image, _, _ := unstructured.NestedString(container, "image"); image != "" {
+					output = append(output, image)
+				}
+			}
+		}
+	}
+	return output
+}
+
+// imageRepositories infers the repositories of a resource from its container images using the first rule matching each image
+func imageRepositories(resource []byte) []opslevel.ServiceRepositoryCreateInput {
+	imageRepositoryRulesMutex.Lock()
+	rules := imageRepositoryRules
+	imageRepositoryRulesMutex.Unlock()
+	if len(rules) == 0 {
+		return nil
+	}
+	seen := map[string]bool{}
+	var output []opslevel.ServiceRepositoryCreateInput
+	for _, image := range containerImages(resource) {
+		name := imageName(image)
+		for _, rule := range rules {
+			match := rule.image.FindStringSubmatchIndex(name)
+			if match == nil {
+				continue
+			}
+			repository := string(rule.image.ExpandString(nil, rule.repository, name, match))
+			directory := string(rule.image.ExpandString(nil, rule.directory, name, match))
+			if key := repository + "\n" + directory; !seen[key] {
+				seen[key] = true
+				output = append(output, *convertToServiceRepositoryCreateInput(map[string]string{"repo": repository, "directory": directory}))
+			}
+			break
+		}
+	}
+	return output
+}
@@ -0,0 +1,428 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/opslevel/kubectl-opslevel/config"
+	"github.com/opslevel/kubectl-opslevel/jq"
+	"github.com/opslevel/kubectl-opslevel/k8sutils"
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/rs/zerolog/log"
+	"github.com/shurcooL/graphql"
+)
+
+// InfraRelationshipType is the relationship created from every service that uses an infrastructure resource
+const InfraRelationshipType = "depends_on"
+
+// InfraProvider describes where an infrastructure resource lives
+type InfraProvider struct {
+	Account string `json:",omitempty"`
+	Name    string `json:",omitempty"`
+	Type    string `json:",omitempty"`
+	URL     string `json:",omitempty"`
+}
+
+// InfraRegistration is an OpsLevel infrastructure resource parsed from a non-service kubernetes resource
+// such as a database managed by an operator, a cache, a queue or a PVC-backed storage volume
+type InfraRegistration struct {
+	Account  string                 `json:",omitempty"`
+	Name     string                 `json:",omitempty"`
+	Schema   string                 `json:",omitempty"`
+	Owner    string                 `json:",omitempty"`
+	Aliases  []string               `json:",omitempty"`
+	Provider InfraProvider          `json:",omitempty"`
+	Data     map[string]interface{} `json:",omitempty"`
+	Services []string               `json:",omitempty"` // The aliases of the services that use the resource
+}
+
+// InfrastructureResourceSchemaInput is named after the GraphQL input type
+type InfrastructureResourceSchemaInput struct {
+	Type string `json:"type"`
+}
+
+// InfrastructureResourceProviderDataInput is named after the GraphQL input type
+type InfrastructureResourceProviderDataInput struct {
+	AccountName  string `json:"accountName"`
+	ExternalUrl  string `json:"externalUrl,omitempty"`
+	ProviderName string `json:"providerName,omitempty"`
+}
+
+// InfrastructureResourceInput is named after the GraphQL input type of the 'infrastructureResourceCreate' and 'infrastructureResourceUpdate' mutations
+type InfrastructureResourceInput struct {
+	Schema               *InfrastructureResourceSchemaInput       `json:"schema,omitempty"`
+	ProviderResourceType string                                   `json:"providerResourceType,omitempty"`
+	ProviderData         *InfrastructureResourceProviderDataInput `json:"providerData,omitempty"`
+	OwnerId              graphql.ID                               `json:"ownerId,omitempty"`
+	Data                 string                                   `json:"data,omitempty"` // A json encoded object
+}
+
+// RelationshipDefinitionInput is named after the GraphQL input type of the 'relationshipCreate' mutation
+type RelationshipDefinitionInput struct {
+	Source opslevel.IdentifierInput `json:"source"`
+	Target opslevel.IdentifierInput `json:"target"`
+	Type   string                   `json:"type"`
+}
+
+type infraNode struct {
+	Id                   graphql.ID
+	Name                 string
+	Aliases              []string
+	Data                 string // A json encoded object
+	ProviderResourceType string
+	ProviderData         *InfrastructureResourceProviderDataInput
+	Schema               *InfrastructureResourceSchemaInput
+	Owner                struct {
+		Team struct {
+			Id graphql.ID
+		} `graphql:"... on Team"`
+	}
+}
+
+// matches reports whether the resource already has everything the input would update it with
+func (n *infraNode) matches(input InfrastructureResourceInput) bool {
+	if n.ProviderResourceType != input.ProviderResourceType || fmt.Sprint(n.Owner.Team.Id) != fmt.Sprint(input.OwnerId) {
+		return false
+	}
+	if input.Schema != nil && (n.Schema == nil || *n.Schema != *input.Schema) {
+		return false
+	}
+	if input.ProviderData != nil && (n.ProviderData == nil || *n.ProviderData != *input.ProviderData) {
+		return false
+	}
+	var current, desired interface{}
+	if json.Unmarshal([]byte(n.Data), &current) != nil || json.Unmarshal([]byte(input.Data), &desired) != nil {
+		return false
+	}
+	return reflect.DeepEqual(current, desired)
+}
+
+func (n *infraNode) hasAlias(alias string) bool {
+	for _, existing := range n.Aliases {
+		if existing == alias {
+			return true
+		}
+	}
+	return false
+}
+
+func parseInfraData(field string, filters []string, resources []byte, count int) []map[string]interface{} {
+	output := make([]map[string]interface{}, count)
+	for index, filter := range filters {
+		parser := NewJQParserMulti(filter)
+		var values []json.RawMessage
+		if err := json.Unmarshal(parser.doParse(fmt.Sprintf("%s.data[%d]", field, index+1), resources), &values); err != nil {
+			continue
+		}
+		for i, value := range values {
+			var data map[string]interface{}
+			if i >= count || json.Unmarshal(value, &data) != nil {
+				continue
+			}
+			if output[i] == nil {
+				output[i] = map[string]interface{}{}
+			}
+			for key, item := range data {
+				output[i][key] = item
+			}
+		}
+	}
+	return output
+}
+
+// ProcessInfraResources evaluates the JQ expressions of an infra import against the kubernetes resources
+func ProcessInfraResources(field string, c config.InfraImport, resources [][]byte) []InfraRegistration {
+	filtered := FilterResources(c.SelectorConfig, resources)
+	count := len(filtered)
+	if count < 1 {
+		return []InfraRegistration{}
+	}
+	joined := joinResourceBytes(filtered)
+	opslevelConfig := c.OpslevelConfig
+	Names := parseField(fmt.Sprintf("%s.name", field), opslevelConfig.Name, joined)
+	Schemas := parseField(fmt.Sprintf("%s.schema", field), opslevelConfig.Schema, joined)
+	Owners := parseField(fmt.Sprintf("%s.owner", field), opslevelConfig.Owner, joined)
+	Aliases := parseFieldArray(fmt.Sprintf("%s.aliases", field), opslevelConfig.Aliases, joined)
+	ProviderAccounts := parseField(fmt.Sprintf("%s.provider.account", field), opslevelConfig.Provider.Account, joined)
+	ProviderNames := parseField(fmt.Sprintf("%s.provider.name", field), opslevelConfig.Provider.Name, joined)
+	ProviderTypes := parseField(fmt.Sprintf("%s.provider.type", field), opslevelConfig.Provider.Type, joined)
+	ProviderURLs := parseField(fmt.Sprintf("%s.provider.url", field), opslevelConfig.Provider.URL, joined)
+	Services := parseFieldArray(fmt.Sprintf("%s.services", field), opslevelConfig.Services, joined)
+	Data := parseInfraData(field, opslevelConfig.Data, joined, count)
+
+	var output []InfraRegistration
+	for i := 0; i < count; i++ {
+		registration := InfraRegistration{
+			Account: c.Account,
+			Name:    getString(i, Names),
+			Schema:  getString(i, Schemas),
+			Owner:   getString(i, Owners),
+			Aliases: getAliases(i, Aliases),
+			Provider: InfraProvider{
+				Account: getString(i, ProviderAccounts),
+				Name:    getString(i, ProviderNames),
+				Type:    getString(i, ProviderTypes),
+				URL:     getString(i, ProviderURLs),
+			},
+			Data:     Data[i],
+			Services: getAliases(i, Services),
+		}
+		if registration.Name == "" {
+			continue
+		}
+		output = append(output, registration)
+	}
+	return output
+}
+
+// GetAllInfra lists the resources of every infra import selector and parses them into infrastructure registrations
+func GetAllInfra(c *config.Config) ([]InfraRegistration, error) {
+	var output []InfraRegistration
+	source, sourceErr := newResourceSource()
+	if sourceErr != nil {
+		return output, sourceErr
+	}
+	clusterName := source.ClusterName(c.ClusterName)
+	jq.SetArg("cluster", clusterName)
+	if err := k8sutils.SetIgnoredResources(c.IgnoreResources); err != nil {
+		return output, err
+	}
+	if c.Infra.Cluster.Enabled {
+		loadClusterInfo(source, clusterName)
+		output = append(output, ClusterInfra(c.Infra.Cluster, nil)...)
+	}
+	for i, importConfig := range c.Infra.Import {
+		selector := importConfig.SelectorConfig
+		if selectorErr := selector.Validate(); selectorErr != nil {
+			return output, selectorErr
+		}
+		// Offset by the service imports so recordings of both never share a file
+		index := len(c.Service.Import) + i
+		resources, queryErr := source.Query(index, selector)
+		if queryErr != nil {
+			return output, queryErr
+		}
+		if RecordDirectory != "" {
+			if err := writeRecording(RecordDirectory, index, selector, resources); err != nil {
+				return output, err
+			}
+		}
+		output = append(output, ProcessInfraResources(fmt.Sprintf("infra.import[%d]", i+1), importConfig, resources)...)
+	}
+	return output, nil
+}
+
+func getInfraWithAlias(client *opslevel.Client, alias string) (*infraNode, error) {
+	var q struct {
+		Account struct {
+			InfrastructureResource infraNode `graphql:"infrastructureResource(input: $input)"`
+		}
+	}
+	v := opslevel.PayloadVariables{
+		"input": opslevel.IdentifierInput{Alias: graphql.String(alias)},
+	}
+	if err := client.Query(&q, v); err != nil {
+		return nil, err
+	}
+	return &q.Account.InfrastructureResource, nil
+}
+
+func createInfra(client *opslevel.Client, input InfrastructureResourceInput) (*infraNode, error) {
+	var m struct {
+		Payload struct {
+			InfrastructureResource infraNode
+			Errors                 []opslevel.OpsLevelErrors
+		} `graphql:"infrastructureResourceCreate(input: $input)"`
+	}
+	v := opslevel.PayloadVariables{
+		"input": input,
+	}
+	if err := client.Mutate(&m, v); err != nil {
+		return nil, err
+	}
+	return &m.Payload.InfrastructureResource, opslevel.FormatErrors(m.Payload.Errors)
+}
+
+func updateInfra(client *opslevel.Client, id graphql.ID, input InfrastructureResourceInput) error {
+	var m struct {
+		Payload struct {
+			Errors []opslevel.OpsLevelErrors
+		} `graphql:"infrastructureResourceUpdate(infrastructureResource: $resource, input: $input)"`
+	}
+	v := opslevel.PayloadVariables{
+		"resource": opslevel.IdentifierInput{Id: id},
+		"input":    input,
+	}
+	if err := client.Mutate(&m, v); err != nil {
+		return err
+	}
+	return opslevel.FormatErrors(m.Payload.Errors)
+}
+
+func createRelationship(client *opslevel.Client, input RelationshipDefinitionInput) error {
+	var m struct {
+		Payload struct {
+			Errors []opslevel.OpsLevelErrors
+		} `graphql:"relationshipCreate(relationshipDefinition: $input)"`
+	}
+	v := opslevel.PayloadVariables{
+		"input": input,
+	}
+	if err := client.Mutate(&m, v); err != nil {
+		return err
+	}
+	return opslevel.FormatErrors(m.Payload.Errors)
+}
+
+func findInfra(client *opslevel.Client, registration InfraRegistration) (*infraNode, error) {
+	for _, alias := range registration.Aliases {
+		resource, err := getInfraWithAlias(client, alias)
+		if err != nil {
+			return nil, err
+		}
+		if resource.Id != nil {
+			return resource, nil
+		}
+	}
+	return nil, nil
+}
+
+func buildInfraInput(client *opslevel.Client, registration InfraRegistration, result *ServiceResult) (InfrastructureResourceInput, error) {
+	input := InfrastructureResourceInput{
+		ProviderResourceType: registration.Provider.Type,
+	}
+	if registration.Schema != "" {
+		input.Schema = &InfrastructureResourceSchemaInput{Type: registration.Schema}
+	}
+	if registration.Provider.Account != "" {
+		input.ProviderData = &InfrastructureResourceProviderDataInput{
+			AccountName:  registration.Provider.Account,
+			ExternalUrl:  registration.Provider.URL,
+			ProviderName: registration.Provider.Name,
+		}
+	}
+	if team, _ := findTeam(client, registration.Account, registration.Owner); team != nil {
+		input.OwnerId = team.Id
+	} else if registration.Owner != "" {
+		result.warned("Unable to find 'Team' with alias '%s'", registration.Owner)
+	}
+	data := map[string]interface{}{"name": registration.Name}
+	for key, value := range registration.Data {
+		data[key] = value
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return input, err
+	}
+	input.Data = string(encoded)
+	return input, nil
+}
+
+// ReconcileInfra creates or updates the infrastructure resource, assigns its aliases and relates it to the services that use it
+func ReconcileInfra(client *opslevel.Client, registration InfraRegistration) ServiceResult {
+	result := &ServiceResult{
+		Name:    registration.Name,
+		Aliases: registration.Aliases,
+		Account: registration.Account,
+	}
+	if len(registration.Aliases) < 1 {
+		result.Action = ServiceAction_Skipped
+		result.warned("Skipping infrastructure resource without aliases")
+		return *result
+	}
+	input, err := buildInfraInput(client, registration, result)
+	if err != nil {
+		result.Action = ServiceAction_Failed
+		result.failed(err, "Failed encoding the data")
+		return *result
+	}
+	resource, err := findInfra(client, registration)
+	if err != nil {
+		result.Action = ServiceAction_Failed
+		result.failed(err, "Failed looking up the infrastructure resource")
+		return *result
+	}
+	if resource == nil {
+		if result.dryRun("create infrastructure resource") {
+			result.Action = ServiceAction_Created
+			return *result
+		}
+		resource, err = createInfra(client, input)
+		audit(registration.Name, registration.Aliases, "infrastructureResourceCreate", input, err)
+		if err != nil || resource.Id == nil {
+			result.Action = ServiceAction_Failed
+			result.failed(err, "Failed creating the infrastructure resource")
+			return *result
+		}
+		result.Action = ServiceAction_Created
+		result.changed("Created infrastructure resource")
+	} else if resource.matches(input) {
+		result.Action = ServiceAction_Unchanged
+	} else if !result.dryRun("update infrastructure resource") {
+		err = updateInfra(client, resource.Id, input)
+		audit(registration.Name, registration.Aliases, "infrastructureResourceUpdate", input, err)
+		if err != nil {
+			result.Action = ServiceAction_Failed
+			result.failed(err, "Failed updating the infrastructure resource")
+			return *result
+		}
+		result.Action = ServiceAction_Updated
+		result.changed("Updated infrastructure resource")
+	} else {
+		result.Action = ServiceAction_Updated
+	}
+	handleInfraAliases(client, registration, resource, result)
+	handleInfraRelationships(client, registration, resource, result)
+	return *result
+}
+
+func handleInfraAliases(client *opslevel.Client, registration InfraRegistration, resource *infraNode, result *ServiceResult) {
+	for _, alias := range registration.Aliases {
+		if resource.hasAlias(alias) {
+			continue
+		}
+		if result.dryRun("assign alias '%s'", alias) {
+			continue
+		}
+		input := opslevel.AliasCreateInput{
+			Alias:   alias,
+			OwnerId: resource.Id,
+		}
+		_, err := client.CreateAlias(input)
+		audit(registration.Name, registration.Aliases, "aliasCreate", input, err)
+		if err != nil {
+			result.failed(err, "Failed assigning alias '%s'", alias)
+		} else {
+			result.changed("Assigned alias '%s'", alias)
+		}
+	}
+}
+
+// handleInfraRelationships relates every service that uses the resource - each relationship is created once per run
+// since OpsLevel ignores relationships that already exist
+func handleInfraRelationships(client *opslevel.Client, registration InfraRegistration, resource *infraNode, result *ServiceResult) {
+	for _, service := range registration.Services {
+		key := fmt.Sprintf("%v/%s", resource.Id, service)
+		_, err := GetOrCreateAliasCache(registration.Account).Resolve("infra-relationship", key, func() (graphql.ID, error) {
+			if result.dryRun("relate service '%s' to the infrastructure resource", service) {
+				return nil, nil
+			}
+			input := RelationshipDefinitionInput{
+				Source: opslevel.IdentifierInput{Alias: graphql.String(service)},
+				Target: opslevel.IdentifierInput{Id: resource.Id},
+				Type:   InfraRelationshipType,
+			}
+			err := createRelationship(client, input)
+			audit(registration.Name, registration.Aliases, "relationshipCreate", input, err)
+			if err != nil {
+				return nil, err
+			}
+			log.Debug().Msgf("[%s] Related service '%s'", registration.Name, service)
+			return resource.Id, nil
+		})
+		if err != nil {
+			result.failed(err, "Failed relating service '%s'", service)
+		}
+	}
+}
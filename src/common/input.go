@@ -0,0 +1,142 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/opslevel/kubectl-opslevel/k8sutils"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// InputFiles makes GetAllServices read the resources from these files instead of a live cluster - '-' reads stdin
+var InputFiles []string
+
+// fileSource serves the resources of 'kubectl get -o json|yaml' dumps to the import selectors
+type fileSource struct {
+	resources []unstructured.Unstructured
+}
+
+func newFileSource(paths []string) (*fileSource, error) {
+	source := &fileSource{}
+	for _, path := range paths {
+		var reader io.Reader
+		name := path
+		if path == "-" {
+			reader = os.Stdin
+			name = "stdin"
+		} else {
+			file, err := os.Open(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read input file %s: %v", path, err)
+			}
+			defer file.Close()
+			reader = file
+		}
+		resources, err := ParseResources(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse input %s: %v", name, err)
+		}
+		log.Info().Msgf("Read %d kubernetes resources from %s", len(resources), name)
+		source.resources = append(source.resources, resources...)
+	}
+	return source, nil
+}
+
+// ParseResources decodes json or multi document yaml and flattens any List objects into their items
+func ParseResources(reader io.Reader) ([]unstructured.Unstructured, error) {
+	var output []unstructured.Unstructured
+	decoder := yaml.NewYAMLOrJSONDecoder(reader, 4096)
+	for {
+		var object map[string]interface{}
+		if err := decoder.Decode(&object); err != nil {
+			if err == io.EOF {
+				return output, nil
+			}
+			return nil, err
+		}
+		if len(object) == 0 {
+			continue
+		}
+		resource := unstructured.Unstructured{Object: object}
+		if !resource.IsList() {
+			output = append(output, resource)
+			continue
+		}
+		err := resource.EachListItem(func(item runtime.Object) error {
+			output = append(output, *item.(*unstructured.Unstructured))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// resourceFields looks up the fields a field selector references the way the API server exposes them (IE: 'status.phase')
+func resourceFields(resource unstructured.Unstructured, selector fields.Selector) fields.Set {
+	output := fields.Set{}
+	for _, requirement := range selector.Requirements() {
+		value, found, err := unstructured.NestedFieldNoCopy(resource.Object, strings.Split(requirement.Field, ".")...)
+		if found && err == nil && value != nil {
+			output[requirement.Field] = fmt.Sprint(value)
+		}
+	}
+	return output
+}
+
+func (s *fileSource) ClusterName(override string) string {
+	return override
+}
+
+func (s *fileSource) Query(index int, selector k8sutils.KubernetesSelector) ([][]byte, error) {
+	labelSelector, err := labels.Parse(selector.GetLabelSelector())
+	if err != nil {
+		return nil, fmt.Errorf("invalid label selector '%s': %v", selector.GetLabelSelector(), err)
+	}
+	fieldSelector, err := fields.ParseSelector(selector.FieldSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid field selector '%s': %v", selector.FieldSelector, err)
+	}
+	namespaces := map[string]bool{}
+	for _, namespace := range selector.Namespaces {
+		namespaces[namespace] = true
+	}
+	var output [][]byte
+	for _, resource := range s.resources {
+		if selector.Discover && selector.Kind == "" {
+			if !k8sutils.HasDiscoveryAnnotation(resource.GetAnnotations()) {
+				continue
+			}
+		} else if resource.GetAPIVersion() != selector.ApiVersion || resource.GetKind() != selector.Kind {
+			continue
+		}
+		if len(namespaces) > 0 && resource.GetNamespace() != "" && !namespaces[resource.GetNamespace()] {
+			continue
+		}
+		if !k8sutils.IsNamespaceAllowed(resource.GetNamespace()) {
+			continue
+		}
+		if !labelSelector.Matches(labels.Set(resource.GetLabels())) {
+			continue
+		}
+		if !fieldSelector.Matches(resourceFields(resource, fieldSelector)) {
+			continue
+		}
+		if k8sutils.IsIgnored(resource.GetNamespace(), resource.GetName()) {
+			continue
+		}
+		data, err := resource.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		output = append(output, data)
+	}
+	return output, nil
+}
@@ -0,0 +1,86 @@
+package common
+
+import (
+	"time"
+
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/rs/zerolog/log"
+	"github.com/shurcooL/graphql"
+)
+
+const (
+	// servicePageSize is how many services are requested per page when listing the catalog
+	servicePageSize = 100
+	// servicePageAttempts is how often a page is requested before the listing fails - a timed out page is retried from its cursor
+	servicePageAttempts = 3
+)
+
+type serviceListNode struct {
+	Id      graphql.ID
+	Name    string
+	Aliases []string
+}
+
+func queryServicePage(client *opslevel.Client, v opslevel.PayloadVariables) ([]serviceListNode, opslevel.PageInfo, error) {
+	if _, ok := v["tag"]; ok {
+		var q struct {
+			Account struct {
+				Services struct {
+					Nodes    []serviceListNode
+					PageInfo opslevel.PageInfo
+				} `graphql:"services(tag: $tag, after: $after, first: $first)"`
+			}
+		}
+		err := client.Query(&q, v)
+		return q.Account.Services.Nodes, q.Account.Services.PageInfo, err
+	}
+	var q struct {
+		Account struct {
+			Services struct {
+				Nodes    []serviceListNode
+				PageInfo opslevel.PageInfo
+			} `graphql:"services(after: $after, first: $first)"`
+		}
+	}
+	err := client.Query(&q, v)
+	return q.Account.Services.Nodes, q.Account.Services.PageInfo, err
+}
+
+// ListServices pages through the services of the account - only the ones with the tag when it is set - with cursor
+// pagination and returns their id, name and aliases. opslevel-go's listing drops the tag after the first page and
+// hydrates the tags, tools and repositories of every service one at a time which times out on large accounts.
+func ListServices(client *opslevel.Client, tag *opslevel.TagArgs) ([]opslevel.Service, error) {
+	v := opslevel.PayloadVariables{
+		"after": graphql.String(""),
+		"first": graphql.Int(servicePageSize),
+	}
+	if tag != nil {
+		v["tag"] = *tag
+	}
+	var output []opslevel.Service
+	for page := 1; ; page++ {
+		var nodes []serviceListNode
+		var pageInfo opslevel.PageInfo
+		var err error
+		for attempt := 1; attempt <= servicePageAttempts; attempt++ {
+			if nodes, pageInfo, err = queryServicePage(client, v); err == nil {
+				break
+			}
+			log.Warn().Msgf("Failed listing page %d of the services (attempt %d of %d)\n\tREASON: %v", page, attempt, servicePageAttempts, err)
+			if attempt < servicePageAttempts {
+				time.Sleep(time.Duration(attempt) * time.Second)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			output = append(output, opslevel.Service{ServiceId: opslevel.ServiceId{Id: node.Id, Aliases: node.Aliases}, Name: node.Name})
+		}
+		log.Debug().Msgf("Listed %d services", len(output))
+		if !pageInfo.HasNextPage {
+			return output, nil
+		}
+		v["after"] = pageInfo.End
+	}
+}
@@ -0,0 +1,122 @@
+package common
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/rs/zerolog/log"
+	"github.com/shurcooL/graphql"
+)
+
+// aliasBatchSize is how many aliases are looked up per GraphQL request
+const aliasBatchSize = 50
+
+var (
+	prefetchedAliasesMutex sync.Mutex
+	// prefetchedAliases are the ids of the services found by PrefetchServiceAliases keyed by account and alias -
+	// a nil id means no service has the alias. Every entry is only used once so a later reconcile looks it up again.
+	prefetchedAliases = map[string]graphql.ID{}
+)
+
+type serviceIdNode struct {
+	Id graphql.ID
+}
+
+// aliasLookupQuery builds '{ account { s0: service(alias: $a0) { id } s1: ... } }' since the struct tags of
+// shurcooL/graphql have to be known when the query is built
+func aliasLookupQuery(count int) reflect.Value {
+	fields := make([]reflect.StructField, count)
+	for i := range fields {
+		fields[i] = reflect.StructField{
+			Name: fmt.Sprintf("S%d", i),
+			Type: reflect.TypeOf((*serviceIdNode)(nil)),
+			Tag:  reflect.StructTag(fmt.Sprintf(`graphql:"s%d: service(alias: $a%d)"`, i, i)),
+		}
+	}
+	account := reflect.StructOf(fields)
+	query := reflect.StructOf([]reflect.StructField{{Name: "Account", Type: account}})
+	return reflect.New(query)
+}
+
+// lookupServiceIds returns the id of the service with each alias - nil when no service has the alias - using one
+// GraphQL request per batch of aliases instead of one per alias
+func lookupServiceIds(client *opslevel.Client, aliases []string) (map[string]graphql.ID, error) {
+	output := map[string]graphql.ID{}
+	for start := 0; start < len(aliases); start += aliasBatchSize {
+		end := start + aliasBatchSize
+		if end > len(aliases) {
+			end = len(aliases)
+		}
+		batch := aliases[start:end]
+		q := aliasLookupQuery(len(batch))
+		v := opslevel.PayloadVariables{}
+		for i, alias := range batch {
+			v[fmt.Sprintf("a%d", i)] = graphql.String(alias)
+		}
+		if err := client.Query(q.Interface(), v); err != nil {
+			return nil, err
+		}
+		account := q.Elem().Field(0)
+		for i, alias := range batch {
+			output[alias] = nil
+			if node := account.Field(i).Interface().(*serviceIdNode); node != nil && node.Id != nil {
+				output[alias] = node.Id
+			}
+		}
+	}
+	return output, nil
+}
+
+func prefetchKey(account string, alias string) string {
+	return account + "\x00" + alias
+}
+
+// PrefetchServiceAliases looks up the aliases of every registration in batches up front so reconciling a
+// registration does not need a request per alias. The registrations of an account whose lookup failed look up their
+// own aliases when they are reconciled.
+func PrefetchServiceAliases(clients map[string]*opslevel.Client, registrations []ServiceRegistration) {
+	aliases := map[string][]string{}
+	for _, registration := range registrations {
+		aliases[registration.Account] = append(aliases[registration.Account], registration.Aliases...)
+	}
+	for account, items := range aliases {
+		client, ok := clients[account]
+		if !ok {
+			continue
+		}
+		ids, err := lookupServiceIds(client, removeDuplicates(items))
+		if err != nil {
+			if account == "" {
+				log.Warn().Msgf("Unable to look up the service aliases up front - each service looks up its aliases when it is reconciled\n\tREASON: %v", err)
+			} else {
+				log.Warn().Msgf("Unable to look up the service aliases of account '%s' up front - each service looks up its aliases when it is reconciled\n\tREASON: %v", account, err)
+			}
+			continue
+		}
+		prefetchedAliasesMutex.Lock()
+		for alias, id := range ids {
+			prefetchedAliases[prefetchKey(account, alias)] = id
+		}
+		prefetchedAliasesMutex.Unlock()
+	}
+}
+
+// takePrefetchedAliases returns the prefetched ids of the aliases and the aliases that still need a lookup
+func takePrefetchedAliases(account string, aliases []string) (map[string]graphql.ID, []string) {
+	prefetchedAliasesMutex.Lock()
+	defer prefetchedAliasesMutex.Unlock()
+	found := map[string]graphql.ID{}
+	var missing []string
+	for _, alias := range aliases {
+		key := prefetchKey(account, alias)
+		if id, ok := prefetchedAliases[key]; ok {
+			found[alias] = id
+			delete(prefetchedAliases, key)
+		} else {
+			missing = append(missing, alias)
+		}
+	}
+	return found, missing
+}
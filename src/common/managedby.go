@@ -0,0 +1,121 @@
+package common
+
+import (
+	"sync"
+	"time"
+
+	"github.com/opslevel/kubectl-opslevel/jq"
+	"github.com/opslevel/opslevel-go/v2022"
+)
+
+// ManagedByTag is the '<key>:<value>' tag without the 'tagPrefix' which marks every service synced by this tool
+const ManagedByTag = "managed-by:kubectl-opslevel"
+
+// ToolVersion is the version of kubectl-opslevel stamped on every service it creates or updates
+var ToolVersion = "development"
+
+var (
+	managedByMutex    sync.Mutex
+	managedByDisabled bool
+)
+
+// SetManagedBy turns the managed-by tags stamped on created or updated services on or off
+func SetManagedBy(enabled bool) {
+	managedByMutex.Lock()
+	defer managedByMutex.Unlock()
+	managedByDisabled = !enabled
+}
+
+func isManagedByEnabled() bool {
+	managedByMutex.Lock()
+	defer managedByMutex.Unlock()
+	return !managedByDisabled
+}
+
+// lastSyncedInterval is how often the last-synced-at tag of an unchanged service is refreshed so a sync does not
+// assign a tag to every service on every run
+const lastSyncedInterval = 24 * time.Hour
+
+var managedByTagKeys = []string{"managed-by", "managed-by-version", "managed-by-cluster", "managed-by-namespace", "last-synced-at"}
+
+// isManagedByTag is true for the keys of the managed-by tags which are stamped outside of the registration
+func isManagedByTag(key string) bool {
+	prefix := getTagPrefix()
+	for _, managed := range managedByTagKeys {
+		if key == prefix+managed {
+			return true
+		}
+	}
+	return false
+}
+
+// managedByTags records which cluster, namespace and version of this tool syncs the service
+func managedByTags(cluster string, namespace string) map[string]string {
+	prefix := getTagPrefix()
+	tags := map[string]string{
+		prefix + "managed-by":         "kubectl-opslevel",
+		prefix + "managed-by-version": ToolVersion,
+	}
+	if cluster == "" {
+		cluster = jq.GetArg("cluster")
+	}
+	if cluster != "" {
+		tags[prefix+"managed-by-cluster"] = cluster
+	}
+	if namespace != "" {
+		tags[prefix+"managed-by-namespace"] = namespace
+	}
+	return tags
+}
+
+// missingManagedByTags returns the managed-by tags the service does not carry with the same value yet
+func missingManagedByTags(service *opslevel.Service, tags map[string]string) map[string]string {
+	missing := map[string]string{}
+	for key, value := range tags {
+		missing[key] = value
+	}
+	for _, tag := range service.Tags.Nodes {
+		if value, ok := missing[tag.Key]; ok && value == tag.Value {
+			delete(missing, tag.Key)
+		}
+	}
+	return missing
+}
+
+// lastSyncedTag returns the last-synced-at tag when the service changed or its tag is older than lastSyncedInterval
+func lastSyncedTag(service *opslevel.Service, changed bool, now time.Time) (string, string, bool) {
+	key := getTagPrefix() + "last-synced-at"
+	if !changed {
+		for _, tag := range service.Tags.Nodes {
+			if tag.Key != key {
+				continue
+			}
+			if synced, err := time.Parse(time.RFC3339, tag.Value); err == nil && now.Sub(synced) < lastSyncedInterval {
+				return "", "", false
+			}
+		}
+	}
+	return key, now.UTC().Format(time.RFC3339), true
+}
+
+// handleManagedBy stamps the managed-by tags the service does not carry with the same value yet IE: the version after
+// an upgrade and refreshes last-synced-at when the service changed or at most once per lastSyncedInterval - they are
+// bookkeeping so they are not reported as a change
+func handleManagedBy(client *opslevel.Client, registration ServiceRegistration, service *opslevel.Service, result *ServiceResult) {
+	if !isManagedByEnabled() || DryRun || service.Id == nil {
+		return
+	}
+	missing := missingManagedByTags(service, managedByTags(registration.Cluster, registration.Namespace))
+	changed := result.Action == ServiceAction_Created || result.Action == ServiceAction_Updated || len(result.Changes) > 0
+	if key, value, ok := lastSyncedTag(service, changed || len(missing) > 0, time.Now()); ok {
+		missing[key] = value
+	}
+	if len(missing) == 0 {
+		return
+	}
+	_, err := client.AssignTagsForId(service.Id, missing)
+	audit(registration.Name, registration.Aliases, "tagAssign", missing, err)
+	if err != nil {
+		result.warned("Unable to stamp the managed-by tags: %v", err)
+	}
+}
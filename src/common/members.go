@@ -0,0 +1,208 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/opslevel/kubectl-opslevel/config"
+	"github.com/opslevel/kubectl-opslevel/k8sutils"
+	"github.com/opslevel/opslevel-go/v2022"
+)
+
+var (
+	roleBindingSelector        = k8sutils.KubernetesSelector{ApiVersion: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding"}
+	clusterRoleBindingSelector = k8sutils.KubernetesSelector{ApiVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRoleBinding"}
+)
+
+// TeamMembership is the emails of the users bound to a role in the namespaces a team owns
+type TeamMembership struct {
+	Team   string   `json:"team"`
+	Emails []string `json:"emails"`
+}
+
+type roleBinding struct {
+	Metadata struct {
+		Name        string            `json:"name"`
+		Namespace   string            `json:"namespace"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	RoleRef struct {
+		Name string `json:"name"`
+	} `json:"roleRef"`
+	Subjects []struct {
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+	} `json:"subjects"`
+}
+
+// emails returns the names of the User subjects that are email addresses - groups and service accounts are skipped
+func (b roleBinding) emails() []string {
+	var output []string
+	for _, subject := range b.Subjects {
+		if subject.Kind == "User" && strings.Contains(subject.Name, "@") {
+			output = append(output, strings.ToLower(subject.Name))
+		}
+	}
+	return output
+}
+
+func (b roleBinding) matchesRoles(roles []string) bool {
+	if len(roles) == 0 {
+		return true
+	}
+	for _, role := range roles {
+		if role == b.RoleRef.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func queryRoleBindings(source resourceSource, selector k8sutils.KubernetesSelector) ([]roleBinding, error) {
+	resources, err := source.Query(-1, selector)
+	if err != nil {
+		return nil, err
+	}
+	if RecordDirectory != "" {
+		if err := writeRecording(RecordDirectory, -1, selector, resources); err != nil {
+			return nil, err
+		}
+	}
+	var output []roleBinding
+	for _, resource := range resources {
+		var binding roleBinding
+		if err := json.Unmarshal(resource, &binding); err != nil {
+			continue
+		}
+		output = append(output, binding)
+	}
+	return output, nil
+}
+
+// GetTeamMemberships maps the RoleBindings in every namespace annotated with an owner - and the ClusterRoleBindings
+// annotated with an owner - to the team whose members are the bound users. A team owning a namespace without any
+// matching RoleBinding has no members.
+func GetTeamMemberships(c *config.Config) ([]TeamMembership, error) {
+	source, err := newResourceSource()
+	if err != nil {
+		return nil, err
+	}
+	aliasKey := ownerAnnotation(c.Teams)
+	namespaces, err := source.Query(-1, namespaceSelector)
+	if err != nil {
+		return nil, err
+	}
+	owners := map[string]string{}
+	for _, resource := range namespaces {
+		var namespace roleBinding
+		if err := json.Unmarshal(resource, &namespace); err != nil {
+			continue
+		}
+		if owner := namespace.Metadata.Annotations[aliasKey]; owner != "" {
+			owners[namespace.Metadata.Name] = owner
+		}
+	}
+	roleBindings, err := queryRoleBindings(source, roleBindingSelector)
+	if err != nil {
+		return nil, err
+	}
+	clusterRoleBindings, err := queryRoleBindings(source, clusterRoleBindingSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	// every team owning a namespace is synced even without RoleBindings so 'remove' empties it once they are all gone
+	members := map[string]map[string]bool{}
+	for _, team := range owners {
+		members[team] = map[string]bool{}
+	}
+	add := func(team string, binding roleBinding) {
+		if team == "" {
+			return
+		}
+		if members[team] == nil {
+			members[team] = map[string]bool{}
+		}
+		if !binding.matchesRoles(c.Teams.Members.Roles) {
+			return
+		}
+		for _, email := range binding.emails() {
+			members[team][email] = true
+		}
+	}
+	for _, binding := range roleBindings {
+		add(owners[binding.Metadata.Namespace], binding)
+	}
+	for _, binding := range clusterRoleBindings {
+		add(binding.Metadata.Annotations[aliasKey], binding)
+	}
+
+	var output []TeamMembership
+	for team, emails := range members {
+		membership := TeamMembership{Team: team, Emails: []string{}}
+		for email := range emails {
+			membership.Emails = append(membership.Emails, email)
+		}
+		sort.Strings(membership.Emails)
+		output = append(output, membership)
+	}
+	sort.Slice(output, func(i, j int) bool { return output[i].Team < output[j].Team })
+	return output, nil
+}
+
+// ReconcileTeamMembers adds the bound users missing from the team and removes the unbound members when 'remove' is set
+func ReconcileTeamMembers(client *opslevel.Client, membership TeamMembership, remove bool) ServiceResult {
+	result := &ServiceResult{Name: membership.Team, Aliases: []string{membership.Team}}
+	team, err := client.GetTeamWithAlias(membership.Team)
+	if err != nil || team.Id == nil {
+		result.Action = ServiceAction_Failed
+		result.failed(err, "Unable to find 'Team' with alias '%s'", membership.Team)
+		return *result
+	}
+	existing := map[string]bool{}
+	for _, member := range team.Members.Nodes {
+		existing[strings.ToLower(member.Email)] = true
+	}
+	bound := map[string]bool{}
+	var added []string
+	for _, email := range membership.Emails {
+		bound[email] = true
+		if !existing[email] {
+			added = append(added, email)
+		}
+	}
+	var removed []string
+	if remove {
+		for email := range existing {
+			if !bound[email] {
+				removed = append(removed, email)
+			}
+		}
+		sort.Strings(removed)
+	}
+	result.Action = ServiceAction_Unchanged
+	if len(added) > 0 && !result.dryRun("add members %v", added) {
+		_, err := client.AddMembers(&team.TeamId, added)
+		audit(membership.Team, result.Aliases, "teamMembershipCreate", added, err)
+		if err != nil {
+			result.failed(err, "Failed adding members %v", added)
+		} else {
+			result.changed("Added members %v", added)
+		}
+	}
+	if len(removed) > 0 {
+		planRemoval(membership.Team, fmt.Sprintf("members %v", removed), result, func() error {
+			_, err := client.RemoveMembers(&team.TeamId, removed)
+			audit(membership.Team, result.Aliases, "teamMembershipDelete", removed, err)
+			return err
+		})
+	}
+	if len(result.Errors) > 0 {
+		result.Action = ServiceAction_Failed
+	} else if len(added) > 0 || len(removed) > 0 {
+		result.Action = ServiceAction_Updated
+	}
+	return *result
+}
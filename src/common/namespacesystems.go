@@ -0,0 +1,275 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/opslevel/kubectl-opslevel/k8sutils"
+)
+
+var (
+	namespaceWorkloadSelectors = []k8sutils.KubernetesSelector{
+		{ApiVersion: "apps/v1", Kind: "Deployment"},
+		{ApiVersion: "apps/v1", Kind: "StatefulSet"},
+		{ApiVersion: "apps/v1", Kind: "DaemonSet"},
+	}
+	resourceQuotaSelector = k8sutils.KubernetesSelector{ApiVersion: "v1", Kind: "ResourceQuota"}
+
+	namespaceSystemsMutex sync.Mutex
+	// namespaceSystems are the namespace systems gathered by this run keyed by their alias
+	namespaceSystems = map[string]*namespaceSummary{}
+)
+
+// namespaceSummary is the aggregate usage of the workloads of a namespace
+type namespaceSummary struct {
+	Cluster   string
+	Namespace string
+	Workloads int
+	CPU       resource.Quantity
+	Memory    resource.Quantity
+	QuotaUsed map[string]resource.Quantity
+	QuotaHard map[string]resource.Quantity
+}
+
+type namespaceWorkload struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		Replicas *int64 `json:"replicas"`
+		Template struct {
+			Spec struct {
+				Containers []struct {
+					Resources struct {
+						Requests map[string]resource.Quantity `json:"requests"`
+					} `json:"resources"`
+				} `json:"containers"`
+			} `json:"spec"`
+		} `json:"template"`
+	} `json:"spec"`
+	Status struct {
+		DesiredNumberScheduled int64 `json:"desiredNumberScheduled"`
+	} `json:"status"`
+}
+
+type namespaceResourceQuota struct {
+	Metadata struct {
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Status struct {
+		Hard map[string]resource.Quantity `json:"hard"`
+		Used map[string]resource.Quantity `json:"used"`
+	} `json:"status"`
+}
+
+// namespaceSystemAlias is the alias of the system of a namespace - the cluster keeps namespaces of several clusters apart
+func namespaceSystemAlias(cluster string, namespace string) string {
+	if cluster == "" {
+		return strings.ToLower(namespace)
+	}
+	return strings.ToLower(fmt.Sprintf("%s-%s", cluster, namespace))
+}
+
+// summarizeNamespaces adds up the workloads, their requested cpu and memory times their replicas and the quota usage per namespace
+func summarizeNamespaces(cluster string, workloads [][]byte, quotas [][]byte) map[string]*namespaceSummary {
+	output := map[string]*namespaceSummary{}
+	get := func(namespace string) *namespaceSummary {
+		if _, ok := output[namespace]; !ok {
+			output[namespace] = &namespaceSummary{
+				Cluster:   cluster,
+				Namespace: namespace,
+				QuotaUsed: map[string]resource.Quantity{},
+				QuotaHard: map[string]resource.Quantity{},
+			}
+		}
+		return output[namespace]
+	}
+	for _, data := range workloads {
+		var workload namespaceWorkload
+		if err := json.Unmarshal(data, &workload); err != nil || workload.Metadata.Namespace == "" {
+			continue
+		}
+		replicas := int64(1)
+		if workload.Kind == "DaemonSet" {
+			replicas = workload.Status.DesiredNumberScheduled
+		} else if workload.Spec.Replicas != nil {
+			replicas = *workload.Spec.Replicas
+		}
+		summary := get(workload.Metadata.Namespace)
+		summary.Workloads++
+		for _, container := range workload.Spec.Template.Spec.Containers {
+			if cpu, ok := container.Resources.Requests["cpu"]; ok {
+				summary.CPU.Add(*resource.NewMilliQuantity(cpu.MilliValue()*replicas, resource.DecimalSI))
+			}
+			if memory, ok := container.Resources.Requests["memory"]; ok {
+				summary.Memory.Add(*resource.NewQuantity(memory.Value()*replicas, resource.BinarySI))
+			}
+		}
+	}
+	for _, data := range quotas {
+		var quota namespaceResourceQuota
+		if err := json.Unmarshal(data, &quota); err != nil || quota.Metadata.Namespace == "" {
+			continue
+		}
+		summary := get(quota.Metadata.Namespace)
+		for name, hard := range quota.Status.Hard {
+			total := summary.QuotaHard[name]
+			total.Add(hard)
+			summary.QuotaHard[name] = total
+			used := summary.QuotaUsed[name]
+			used.Add(quota.Status.Used[name])
+			summary.QuotaUsed[name] = used
+		}
+	}
+	return output
+}
+
+// tags are the aggregate usage of the namespace given as tags IE: 'cpu-requests:3500m' or 'quota-requests.memory:45%'
+func (s *namespaceSummary) tags() []opslevel.TagInput {
+	tags := []opslevel.TagInput{
+		{Key: "workloads", Value: fmt.Sprint(s.Workloads)},
+		{Key: "cpu-requests", Value: s.CPU.String()},
+		{Key: "memory-requests", Value: s.Memory.String()},
+	}
+	var names []string
+	for name := range s.QuotaHard {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		hard := s.QuotaHard[name]
+		if hard.IsZero() {
+			continue
+		}
+		used := s.QuotaUsed[name]
+		percent := used.AsApproximateFloat64() / hard.AsApproximateFloat64() * 100
+		tags = append(tags, opslevel.TagInput{Key: fmt.Sprintf("quota-%s", name), Value: fmt.Sprintf("%.0f%%", percent)})
+	}
+	return prefixTags(tags)
+}
+
+// loadNamespaceSystems lists the workloads and resource quotas once to summarize the namespaces of the cluster
+func loadNamespaceSystems(source resourceSource, cluster string) error {
+	var workloads [][]byte
+	for _, selector := range namespaceWorkloadSelectors {
+		resources, err := source.Query(-1, selector)
+		if err != nil {
+			return err
+		}
+		if RecordDirectory != "" {
+			if err := writeRecording(RecordDirectory, -1, selector, resources); err != nil {
+				return err
+			}
+		}
+		workloads = append(workloads, resources...)
+	}
+	quotas, err := source.Query(-1, resourceQuotaSelector)
+	if err != nil {
+		return err
+	}
+	if RecordDirectory != "" {
+		if err := writeRecording(RecordDirectory, -1, resourceQuotaSelector, quotas); err != nil {
+			return err
+		}
+	}
+	namespaceSystemsMutex.Lock()
+	defer namespaceSystemsMutex.Unlock()
+	for namespace, summary := range summarizeNamespaces(cluster, workloads, quotas) {
+		if !k8sutils.IsNamespaceAllowed(namespace) {
+			continue
+		}
+		namespaceSystems[namespaceSystemAlias(cluster, namespace)] = summary
+	}
+	return nil
+}
+
+// PlaceInNamespaceSystems puts the registrations without a system into the system of their namespace
+func PlaceInNamespaceSystems(services []ServiceRegistration) {
+	namespaceSystemsMutex.Lock()
+	defer namespaceSystemsMutex.Unlock()
+	for i, service := range services {
+		if service.System != "" || service.Namespace == "" {
+			continue
+		}
+		alias := namespaceSystemAlias(service.Cluster, service.Namespace)
+		if _, ok := namespaceSystems[alias]; ok {
+			services[i].System = alias
+		}
+	}
+}
+
+// SyncNamespaceSystems creates the namespace systems gathered by this run in the accounts of their services and
+// assigns the aggregate usage tags - it has to run before the services are reconciled so they find their system
+func SyncNamespaceSystems(clients map[string]*opslevel.Client, services []ServiceRegistration) {
+	namespaceSystemsMutex.Lock()
+	defer namespaceSystemsMutex.Unlock()
+	var aliases []string
+	for alias := range namespaceSystems {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		summary := namespaceSystems[alias]
+		accounts := map[string]bool{}
+		for _, service := range services {
+			if service.System == alias {
+				accounts[service.Account] = true
+			}
+		}
+		for account := range accounts {
+			client, ok := clients[account]
+			if !ok {
+				continue
+			}
+			if err := syncNamespaceSystem(client, alias, summary); err != nil {
+				log.Error().Msgf("[%s] Failed syncing namespace system\n\tREASON: %v", alias, err)
+			}
+		}
+	}
+}
+
+func syncNamespaceSystem(client *opslevel.Client, alias string, summary *namespaceSummary) error {
+	tags := summary.tags()
+	jsonBytes, _ := json.Marshal(tags)
+	system, err := getSystemWithAlias(client, alias)
+	if err != nil {
+		return err
+	}
+	if system.Id == nil {
+		input := SystemInput{
+			Name:        alias,
+			Description: fmt.Sprintf("The workloads of the namespace '%s' in the cluster '%s'", summary.Namespace, summary.Cluster),
+		}
+		if isDryRun(alias, "create namespace system with input %+v and assign tags: %s", input, string(jsonBytes)) {
+			return nil
+		}
+		created, aliasErr, err := createSystemWithAlias(client, alias, []string{alias}, alias, input)
+		if err != nil {
+			return err
+		}
+		system = created
+		log.Info().Msgf("[%s] Created namespace system", alias)
+		if aliasErr != nil {
+			return aliasErr
+		}
+	}
+	if isDryRun(alias, "assign tags: %s", string(jsonBytes)) {
+		return nil
+	}
+	input := opslevel.TagAssignInput{Id: system.Id, Tags: tags}
+	_, err = client.AssignTags(input)
+	audit(alias, []string{alias}, "tagAssign", input, err)
+	if err != nil {
+		return err
+	}
+	log.Info().Msgf("[%s] Assigned namespace usage tags: %s", alias, string(jsonBytes))
+	return nil
+}
@@ -0,0 +1,180 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/opslevel/kubectl-opslevel/k8sutils"
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/shurcooL/graphql"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// noteConfigMapPrefix marks a parsed note as a reference to a ConfigMap key - IE: 'configmap:<namespace>/<name>/<key>'
+const noteConfigMapPrefix = "configmap:"
+
+var (
+	configMapSelector = k8sutils.KubernetesSelector{ApiVersion: "v1", Kind: "ConfigMap"}
+
+	configMapsMutex    sync.Mutex
+	configMapSource    resourceSource
+	configMaps         map[string]map[string]string
+	recordedConfigMaps [][]byte
+)
+
+// ServiceNoteUpdateInput is named after the GraphQL input type of the 'serviceNoteUpdate' mutation
+type ServiceNoteUpdateInput struct {
+	Service opslevel.IdentifierInput `json:"service"`
+	Note    string                   `json:"note"`
+}
+
+// setConfigMapSource sets where the ConfigMaps referenced by notes are read from - each one is only read once a note references it
+func setConfigMapSource(source resourceSource) {
+	configMapsMutex.Lock()
+	defer configMapsMutex.Unlock()
+	configMapSource = source
+	configMaps = nil
+	recordedConfigMaps = nil
+}
+
+// ResetConfigMaps drops the cached ConfigMaps so the notes pick up their edits IE: at every resync of 'service reconcile'
+func ResetConfigMaps() {
+	configMapsMutex.Lock()
+	defer configMapsMutex.Unlock()
+	configMaps = nil
+}
+
+// loadConfigMap reads the data of a single ConfigMap with a field selector on its name - nil when it does not exist
+func loadConfigMap(namespace string, name string) (map[string]string, error) {
+	if configMapSource == nil {
+		return nil, fmt.Errorf("no kubernetes source to read ConfigMaps from")
+	}
+	selector := configMapSelector
+	selector.Namespaces = []string{namespace}
+	selector.FieldSelector = fmt.Sprintf("metadata.name=%s", name)
+	resources, err := configMapSource.Query(-1, selector)
+	if err != nil {
+		return nil, err
+	}
+	if RecordDirectory != "" {
+		// a recording keeps every referenced ConfigMap in one file which is filtered again on replay
+		recordedConfigMaps = append(recordedConfigMaps, resources...)
+		if err := writeRecording(RecordDirectory, -1, configMapSelector, recordedConfigMaps); err != nil {
+			return nil, err
+		}
+	}
+	for _, resource := range resources {
+		var configMap struct {
+			Metadata metav1.ObjectMeta `json:"metadata"`
+			Data     map[string]string `json:"data"`
+		}
+		if err := json.Unmarshal(resource, &configMap); err != nil {
+			continue
+		}
+		if configMap.Metadata.Namespace == namespace && configMap.Metadata.Name == name {
+			if configMap.Data == nil {
+				return map[string]string{}, nil
+			}
+			return configMap.Data, nil
+		}
+	}
+	return nil, nil
+}
+
+// resolveNote returns the parsed note replacing a 'configmap:<namespace>/<name>/<key>' reference with the key's value
+func resolveNote(note string) (string, error) {
+	if !strings.HasPrefix(note, noteConfigMapPrefix) {
+		return note, nil
+	}
+	parts := strings.SplitN(strings.TrimPrefix(note, noteConfigMapPrefix), "/", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", fmt.Errorf("invalid note reference '%s' - expected format 'configmap:<namespace>/<name>/<key>'", note)
+	}
+	configMapsMutex.Lock()
+	defer configMapsMutex.Unlock()
+	if configMaps == nil {
+		configMaps = map[string]map[string]string{}
+	}
+	key := parts[0] + "/" + parts[1]
+	data, cached := configMaps[key]
+	if !cached {
+		var err error
+		if data, err = loadConfigMap(parts[0], parts[1]); err != nil {
+			return "", fmt.Errorf("unable to read the ConfigMap for note '%s': %v", note, err)
+		}
+		configMaps[key] = data
+	}
+	if data == nil {
+		return "", fmt.Errorf("no ConfigMap '%s' found", key)
+	}
+	value, ok := data[parts[2]]
+	if !ok {
+		return "", fmt.Errorf("no key '%s' found in ConfigMap '%s/%s'", parts[2], parts[0], parts[1])
+	}
+	return value, nil
+}
+
+func getServiceNote(client *opslevel.Client, id graphql.ID) (string, error) {
+	var q struct {
+		Account struct {
+			Service struct {
+				Note string
+			} `graphql:"service(id: $service)"`
+		}
+	}
+	v := opslevel.PayloadVariables{
+		"service": id,
+	}
+	if err := client.Query(&q, v); err != nil {
+		return "", err
+	}
+	return q.Account.Service.Note, nil
+}
+
+func updateServiceNote(client *opslevel.Client, input ServiceNoteUpdateInput) error {
+	var m struct {
+		Payload struct {
+			Errors []opslevel.OpsLevelErrors
+		} `graphql:"serviceNoteUpdate(input: $input)"`
+	}
+	v := opslevel.PayloadVariables{
+		"input": input,
+	}
+	if err := client.Mutate(&m, v); err != nil {
+		return err
+	}
+	return opslevel.FormatErrors(m.Payload.Errors)
+}
+
+func handleNote(client *opslevel.Client, registration ServiceRegistration, service *opslevel.Service, result *ServiceResult) {
+	if registration.Note == "" {
+		return
+	}
+	if service.Id != nil {
+		current, err := getServiceNote(client, service.Id)
+		if err != nil {
+			result.failed(err, "Failed reading the note")
+			return
+		}
+		if strings.TrimSpace(current) == strings.TrimSpace(registration.Note) {
+			return
+		}
+	}
+	if result.dryRun("update the note") {
+		return
+	}
+	input := ServiceNoteUpdateInput{
+		Service: opslevel.IdentifierInput{Id: service.Id},
+		Note:    registration.Note,
+	}
+	err := updateServiceNote(client, input)
+	audit(registration.Name, registration.Aliases, "serviceNoteUpdate", input, err)
+	if err != nil {
+		result.failed(err, "Failed updating the note")
+	} else {
+		result.changed("Updated the note")
+	}
+}
@@ -0,0 +1,75 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/opslevel/kubectl-opslevel/config"
+	"github.com/opslevel/opslevel-go/v2022"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	pagerDutyServiceURL = regexp.MustCompile(`https://([a-z0-9-]+)\.pagerduty\.com/(?:service-directory|services)/(P[A-Z0-9]{6})\b`)
+	pagerDutyServiceID  = regexp.MustCompile(`^P[A-Z0-9]{6}$`)
+)
+
+// findPagerDutyServices returns the urls of the PagerDuty services referenced in the annotations of a resource.
+// Service urls are recognized in any annotation while bare service ids are only recognized in annotations whose
+// key mentions pagerduty and need the subdomain to build the url.
+func findPagerDutyServices(c config.PagerDutyConfig, resource []byte) []string {
+	var object struct {
+		Metadata metav1.ObjectMeta `json:"metadata"`
+	}
+	if err := json.Unmarshal(resource, &object); err != nil {
+		return nil
+	}
+	var keys []string
+	for key := range object.Metadata.Annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	seen := map[string]bool{}
+	var output []string
+	add := func(subdomain string, id string) {
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+		output = append(output, fmt.Sprintf("https://%s.pagerduty.com/service-directory/%s", subdomain, id))
+	}
+	for _, key := range keys {
+		value := strings.TrimSpace(object.Metadata.Annotations[key])
+		for _, match := range pagerDutyServiceURL.FindAllStringSubmatch(value, -1) {
+			add(match[1], match[2])
+		}
+		if c.Subdomain != "" && strings.Contains(strings.ToLower(key), "pagerduty") && pagerDutyServiceID.MatchString(value) {
+			add(c.Subdomain, value)
+		}
+	}
+	return output
+}
+
+// pagerDutyTools attaches the PagerDuty services found in the annotations as incident tools so the service answers 'who do I page'
+func pagerDutyTools(c config.PagerDutyConfig, resource []byte) []opslevel.ToolCreateInput {
+	if !c.Enabled {
+		return nil
+	}
+	var tools []opslevel.ToolCreateInput
+	for _, url := range findPagerDutyServices(c, resource) {
+		name := "PagerDuty"
+		if len(tools) > 0 {
+			name = fmt.Sprintf("PagerDuty %d", len(tools)+1)
+		}
+		tools = append(tools, opslevel.ToolCreateInput{
+			Category:    opslevel.ToolCategoryIncidents,
+			DisplayName: name,
+			Url:         url,
+		})
+	}
+	return tools
+}
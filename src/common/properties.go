@@ -0,0 +1,152 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/rs/zerolog/log"
+	"github.com/shurcooL/graphql"
+)
+
+// PropertyInput is named after the GraphQL input type of the 'propertyAssign' mutation
+type PropertyInput struct {
+	Owner      opslevel.IdentifierInput `json:"owner"`
+	Definition opslevel.IdentifierInput `json:"definition"`
+	Value      string                   `json:"value"` // A json encoded value validated against the property definition's schema
+}
+
+type propertyNode struct {
+	Definition struct {
+		Id      graphql.ID
+		Aliases []string
+	}
+	Value string
+}
+
+// parseProperties evaluates the JQ expression of every property keeping the raw json result so any type can be assigned
+func parseProperties(field string, filters map[string]string, resources []byte, count int) []map[string]string {
+	output := make([]map[string]string, count)
+	var keys []string
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		parser := NewJQParserMulti(filters[key])
+		parsed := parser.doParse(fmt.Sprintf("%s.properties.%s", field, key), resources)
+		if parsed == nil {
+			continue // doParse already logged the JQ error
+		}
+		var values []json.RawMessage
+		if err := json.Unmarshal(parsed, &values); err != nil {
+			log.Warn().Str("Field", fmt.Sprintf("%s.properties.%s", field, key)).Msgf("Unable to read the JQ result of property '%s': %v", key, err)
+			continue
+		}
+		for i, value := range values {
+			if i >= count || string(value) == "null" {
+				continue
+			}
+			if output[i] == nil {
+				output[i] = map[string]string{}
+			}
+			output[i][key] = compactJSON(value)
+		}
+	}
+	return output
+}
+
+func compactJSON(value []byte) string {
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, value); err != nil {
+		return string(value)
+	}
+	return compacted.String()
+}
+
+func getServiceProperties(client *opslevel.Client, id graphql.ID) ([]propertyNode, error) {
+	var q struct {
+		Account struct {
+			Service struct {
+				Properties struct {
+					Nodes []propertyNode
+				}
+			} `graphql:"service(id: $service)"`
+		}
+	}
+	v := opslevel.PayloadVariables{
+		"service": id,
+	}
+	if err := client.Query(&q, v); err != nil {
+		return nil, err
+	}
+	return q.Account.Service.Properties.Nodes, nil
+}
+
+func assignProperty(client *opslevel.Client, input PropertyInput) error {
+	var m struct {
+		Payload struct {
+			Errors []opslevel.OpsLevelErrors
+		} `graphql:"propertyAssign(input: $input)"`
+	}
+	v := opslevel.PayloadVariables{
+		"input": input,
+	}
+	if err := client.Mutate(&m, v); err != nil {
+		return err
+	}
+	return opslevel.FormatErrors(m.Payload.Errors)
+}
+
+func handleProperties(client *opslevel.Client, registration ServiceRegistration, service *opslevel.Service, result *ServiceResult) {
+	if len(registration.Properties) == 0 {
+		return
+	}
+	// The keys of 'properties' are lowercased when the config is loaded so the definitions are matched case-insensitively
+	current := map[string]propertyNode{}
+	if service.Id != nil {
+		properties, err := getServiceProperties(client, service.Id)
+		if err != nil {
+			result.failed(err, "Failed listing properties")
+			return
+		}
+		for _, property := range properties {
+			for _, alias := range property.Definition.Aliases {
+				current[strings.ToLower(alias)] = property
+			}
+		}
+	}
+	var keys []string
+	for key := range registration.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := registration.Properties[key]
+		definition := opslevel.IdentifierInput{Alias: graphql.String(key)}
+		if existing, ok := current[strings.ToLower(key)]; ok {
+			if compactJSON([]byte(existing.Value)) == value {
+				continue
+			}
+			definition = opslevel.IdentifierInput{Id: existing.Definition.Id}
+		}
+		if result.dryRun("assign property '%s = %s'", key, value) {
+			continue
+		}
+		input := PropertyInput{
+			Owner:      opslevel.IdentifierInput{Id: service.Id},
+			Definition: definition,
+			Value:      value,
+		}
+		err := assignProperty(client, input)
+		audit(registration.Name, registration.Aliases, "propertyAssign", input, err)
+		if err != nil {
+			result.failed(err, "Failed assigning property '%s = %s'", key, value)
+		} else {
+			result.changed("Assigned property '%s = %s'", key, value)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package common
+
+import (
+	"github.com/opslevel/kubectl-opslevel/config"
+)
+
+// The defaults read the recommended labels (https://kubernetes.io/docs/concepts/overview/working-with-objects/common-labels/)
+// so well labeled clusters import sensible services without any JQ
+const (
+	recommendedNameExpression      = `.metadata.labels."app.kubernetes.io/name" // .metadata.name`
+	recommendedSystemExpression    = `.metadata.labels."app.kubernetes.io/part-of"`
+	recommendedFrameworkExpression = `.metadata.labels."app.kubernetes.io/managed-by"`
+	recommendedTagsExpression      = `.metadata.labels // {} | {"version": ."app.kubernetes.io/version", "component": ."app.kubernetes.io/component"} | with_entries(select(.value != null))`
+)
+
+// withRecommendedLabelDefaults fills the name, system, framework and assigned tags left empty in the config from the
+// app.kubernetes.io/* labels - fields with a JQ expression are never overridden
+func withRecommendedLabelDefaults(c config.ServiceRegistrationConfig) config.ServiceRegistrationConfig {
+	if c.DisableRecommendedLabels {
+		return c
+	}
+	if c.Name == "" {
+		c.Name = recommendedNameExpression
+	}
+	if c.System == "" {
+		c.System = recommendedSystemExpression
+	}
+	if c.Framework == "" {
+		c.Framework = recommendedFrameworkExpression
+	}
+	if len(c.Tags.Assign) == 0 {
+		c.Tags.Assign = []string{recommendedTagsExpression}
+	}
+	return c
+}
@@ -0,0 +1,147 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/opslevel/kubectl-opslevel/k8sutils"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// RecordDirectory makes GetAllServices dump the raw listed resources of every selector into this directory
+	RecordDirectory string
+	// ReplayDirectory makes GetAllServices read the resources from a recording instead of a live cluster
+	ReplayDirectory string
+
+	recordingFileNameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+)
+
+const recordingMetadataFile = "recording.json"
+
+type recordingMetadata struct {
+	ClusterName string `json:"clusterName"`
+}
+
+// resourceSource is where getServices reads the kubernetes resources from
+type resourceSource interface {
+	ClusterName(override string) string
+	Query(index int, selector k8sutils.KubernetesSelector) ([][]byte, error)
+}
+
+type liveSource struct {
+	client *k8sutils.ClientWrapper
+}
+
+func (s *liveSource) ClusterName(override string) string {
+	return s.client.GetClusterName(override)
+}
+
+func (s *liveSource) Query(index int, selector k8sutils.KubernetesSelector) ([][]byte, error) {
+	resources, err := s.client.Query(selector)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKubernetesAccess, err)
+	}
+	return resources, nil
+}
+
+type recordingSource struct {
+	directory string
+	metadata  recordingMetadata
+}
+
+func newRecordingSource(directory string) (*recordingSource, error) {
+	source := &recordingSource{directory: directory}
+	data, err := os.ReadFile(filepath.Join(directory, recordingMetadataFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording %s: %v", directory, err)
+	}
+	if err := json.Unmarshal(data, &source.metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse recording %s: %v", directory, err)
+	}
+	log.Info().Msgf("Replaying kubernetes resources from recording %s", directory)
+	return source, nil
+}
+
+func (s *recordingSource) ClusterName(override string) string {
+	if override != "" {
+		return override
+	}
+	return s.metadata.ClusterName
+}
+
+func (s *recordingSource) Query(index int, selector k8sutils.KubernetesSelector) ([][]byte, error) {
+	path := recordingPath(s.directory, index, selector)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recorded resources for selector '%s/%s' - was the recording made with the same config? %v", selector.ApiVersion, selector.Kind, err)
+	}
+	var resources []json.RawMessage
+	if err := json.Unmarshal(data, &resources); err != nil {
+		return nil, fmt.Errorf("failed to parse recorded resources %s: %v", path, err)
+	}
+	// Compact so the replayed resources match the single line json the live cluster query produces
+	output := make([][]byte, len(resources))
+	for i, resource := range resources {
+		var compacted bytes.Buffer
+		if err := json.Compact(&compacted, resource); err != nil {
+			return nil, fmt.Errorf("failed to parse recorded resources %s: %v", path, err)
+		}
+		output[i] = compacted.Bytes()
+	}
+	return output, nil
+}
+
+func newResourceSource() (resourceSource, error) {
+	if ReplayDirectory != "" {
+		return newRecordingSource(ReplayDirectory)
+	}
+	if len(InputFiles) > 0 {
+		return newFileSource(InputFiles)
+	}
+	client, err := k8sutils.NewKubernetesClient()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKubernetesAccess, err)
+	}
+	return &liveSource{client: client}, nil
+}
+
+// recordingPath names the file after the selector's position and type so a recording only replays against the same config
+func recordingPath(directory string, index int, selector k8sutils.KubernetesSelector) string {
+	name := fmt.Sprintf("import-%d-%s-%s.json", index+1, selector.ApiVersion, selector.Kind)
+	if selector.Discover && selector.Kind == "" {
+		name = fmt.Sprintf("import-%d-discover.json", index+1)
+	}
+	return filepath.Join(directory, strings.ToLower(recordingFileNameInvalidChars.ReplaceAllString(name, "_")))
+}
+
+func writeRecordingMetadata(directory string, clusterName string) error {
+	if err := os.MkdirAll(directory, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(recordingMetadata{ClusterName: clusterName}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(directory, recordingMetadataFile), data, 0o644)
+}
+
+func writeRecording(directory string, index int, selector k8sutils.KubernetesSelector, resources [][]byte) error {
+	raw := make([]json.RawMessage, len(resources))
+	for i, resource := range resources {
+		raw[i] = resource
+	}
+	data, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := recordingPath(directory, index, selector)
+	log.Info().Msgf("Recorded %d resources for selector '%s/%s' to %s", len(resources), selector.ApiVersion, selector.Kind, path)
+	return os.WriteFile(path, data, 0o644)
+}
@@ -0,0 +1,58 @@
+package common
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Removal is a tag, dependency or team membership deletion planned while reconciling with DeferRemovals set
+type Removal struct {
+	Service     string
+	Description string
+	apply       func() error
+}
+
+// Apply sends the planned deletion to OpsLevel
+func (r Removal) Apply() error {
+	return r.apply()
+}
+
+func (r Removal) String() string {
+	return fmt.Sprintf("[%s] %s", r.Service, r.Description)
+}
+
+var (
+	// DeferRemovals makes the reconciliation plan its deletions instead of sending them so the command can list them
+	// and ask for confirmation once before any of them is applied
+	DeferRemovals bool
+
+	pendingRemovalsMutex sync.Mutex
+	pendingRemovals      []Removal
+)
+
+// planRemoval sends the deletion right away or plans it when DeferRemovals is set - in a dry run it is only reported
+func planRemoval(service string, description string, result *ServiceResult, apply func() error) {
+	if result.dryRun("remove %s", description) {
+		return
+	}
+	if DeferRemovals {
+		pendingRemovalsMutex.Lock()
+		defer pendingRemovalsMutex.Unlock()
+		pendingRemovals = append(pendingRemovals, Removal{Service: service, Description: description, apply: apply})
+		return
+	}
+	if err := apply(); err != nil {
+		result.failed(err, "Failed removing %s", description)
+	} else {
+		result.changed("Removed %s", description)
+	}
+}
+
+// PendingRemovals returns the deletions planned since the last call and forgets them
+func PendingRemovals() []Removal {
+	pendingRemovalsMutex.Lock()
+	defer pendingRemovalsMutex.Unlock()
+	output := pendingRemovals
+	pendingRemovals = nil
+	return output
+}
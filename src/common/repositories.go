@@ -0,0 +1,82 @@
+package common
+
+import (
+	"sync"
+
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/shurcooL/graphql"
+)
+
+// repositoryLookup is a single lookup of a repository shared by every worker asking for the same alias
+type repositoryLookup struct {
+	once       sync.Once
+	mutex      sync.Mutex
+	repository *opslevel.Repository
+	err        error
+}
+
+var (
+	repositoryLookupsMutex sync.Mutex
+	// repositoryLookups memoizes the repositories looked up during a run keyed by account and alias - services
+	// sharing a monorepo would otherwise each fetch the repository and page through every service attached to it
+	repositoryLookups = map[string]*repositoryLookup{}
+)
+
+func getRepositoryWithAlias(client *opslevel.Client, account string, alias string) (*repositoryLookup, error) {
+	key := account + "/" + alias
+	repositoryLookupsMutex.Lock()
+	lookup, ok := repositoryLookups[key]
+	if !ok {
+		lookup = &repositoryLookup{}
+		repositoryLookups[key] = lookup
+	}
+	repositoryLookupsMutex.Unlock()
+	lookup.once.Do(func() {
+		lookup.repository, lookup.err = client.GetRepositoryWithAlias(alias)
+	})
+	if lookup.err != nil {
+		// errors are not remembered so the next service retries the lookup
+		repositoryLookupsMutex.Lock()
+		if repositoryLookups[key] == lookup {
+			delete(repositoryLookups, key)
+		}
+		repositoryLookupsMutex.Unlock()
+		return nil, lookup.err
+	}
+	return lookup, nil
+}
+
+func (l *repositoryLookup) serviceRepository(service graphql.ID, directory string) *opslevel.ServiceRepository {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.repository.GetService(service, directory)
+}
+
+// remember records a service repository created or updated during the run so the memoized repository stays current
+func (l *repositoryLookup) remember(serviceRepository *opslevel.ServiceRepository) {
+	if serviceRepository == nil {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	edges := l.repository.Services.Edges
+	for i := range edges {
+		for j := range edges[i].ServiceRepositories {
+			if edges[i].ServiceRepositories[j].Id == serviceRepository.Id {
+				edges[i].ServiceRepositories[j] = *serviceRepository
+				return
+			}
+		}
+	}
+	l.repository.Services.Edges = append(edges, opslevel.RepositoryServiceEdge{
+		Node:                serviceRepository.Service,
+		ServiceRepositories: []opslevel.ServiceRepository{*serviceRepository},
+	})
+}
+
+// ResetRepositoryLookups drops every memoized repository so a resync sees the current state of OpsLevel
+func ResetRepositoryLookups() {
+	repositoryLookupsMutex.Lock()
+	defer repositoryLookupsMutex.Unlock()
+	repositoryLookups = map[string]*repositoryLookup{}
+}
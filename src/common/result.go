@@ -0,0 +1,102 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+type ServiceAction string
+
+const (
+	ServiceAction_Created   ServiceAction = "created"
+	ServiceAction_Updated   ServiceAction = "updated"
+	ServiceAction_Unchanged ServiceAction = "unchanged"
+	ServiceAction_Skipped   ServiceAction = "skipped"
+	ServiceAction_Failed    ServiceAction = "failed"
+)
+
+// ServiceResult is the machine readable outcome of ReconcileService for a single service registration
+type ServiceResult struct {
+	Name     string        `json:"name"`
+	Aliases  []string      `json:"aliases"`
+	Account  string        `json:"account,omitempty"`
+	Action   ServiceAction `json:"action"`
+	Diff     string        `json:"diff,omitempty"`
+	Changes  []string      `json:"changes,omitempty"`
+	Warnings []string      `json:"warnings,omitempty"`
+	Errors   []string      `json:"errors,omitempty"`
+}
+
+func newServiceResult(registration ServiceRegistration) *ServiceResult {
+	return &ServiceResult{
+		Name:    registration.Name,
+		Aliases: registration.Aliases,
+		Account: registration.Account,
+	}
+}
+
+// HasErrors is true when the service failed entirely or any of its mutations failed
+func (r *ServiceResult) HasErrors() bool {
+	return r.Action == ServiceAction_Failed || len(r.Errors) > 0
+}
+
+func (r *ServiceResult) changed(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	log.Info().Msgf("[%s] %s", r.Name, message)
+	r.Changes = append(r.Changes, message)
+}
+
+func (r *ServiceResult) warned(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	log.Warn().Msgf("[%s] %s", r.Name, message)
+	r.Warnings = append(r.Warnings, message)
+}
+
+func (r *ServiceResult) failed(err error, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	log.Error().Msgf("[%s] %s\n\tREASON: %v", r.Name, message, err)
+	r.Errors = append(r.Errors, fmt.Sprintf("%s: %v", message, err))
+}
+
+// dryRun records the mutation that would have happened when DryRun is set
+func (r *ServiceResult) dryRun(format string, args ...interface{}) bool {
+	if isDryRun(r.Name, format, args...) {
+		r.Changes = append(r.Changes, "would "+fmt.Sprintf(format, args...))
+		return true
+	}
+	return false
+}
+
+// ServiceResultsSummary counts the results by action
+type ServiceResultsSummary struct {
+	Total     int `json:"total"`
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Skipped   int `json:"skipped"`
+	Failed    int `json:"failed"`
+	Errored   int `json:"errored"` // Services whose action succeeded but at least one of the follow up mutations failed
+}
+
+func SummarizeResults(results []ServiceResult) ServiceResultsSummary {
+	summary := ServiceResultsSummary{Total: len(results)}
+	for _, result := range results {
+		switch result.Action {
+		case ServiceAction_Created:
+			summary.Created++
+		case ServiceAction_Updated:
+			summary.Updated++
+		case ServiceAction_Unchanged:
+			summary.Unchanged++
+		case ServiceAction_Skipped:
+			summary.Skipped++
+		case ServiceAction_Failed:
+			summary.Failed++
+		}
+		if result.Action != ServiceAction_Failed && len(result.Errors) > 0 {
+			summary.Errored++
+		}
+	}
+	return summary
+}
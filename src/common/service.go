@@ -2,33 +2,55 @@ package common
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"path"
+	"strings"
 
 	"github.com/opslevel/kubectl-opslevel/config"
+	"github.com/opslevel/kubectl-opslevel/jq"
 	"github.com/opslevel/kubectl-opslevel/k8sutils"
 	"github.com/opslevel/opslevel-go/v2022"
 
-	_ "github.com/rs/zerolog/log"
+	"github.com/rs/zerolog/log"
 )
 
+// ErrKubernetesAccess wraps the errors caused by loading the kubeconfig or querying the Kubernetes API
+var ErrKubernetesAccess = errors.New("kubernetes access failure")
+
 type SelectorParser struct {
 	Excludes []JQParser
 }
 
 type ServiceRegistration struct {
-	Name         string                                  `json:",omitempty"`
-	Description  string                                  `json:",omitempty"`
-	Owner        string                                  `json:",omitempty"`
-	Lifecycle    string                                  `json:",omitempty"`
-	Tier         string                                  `json:",omitempty"`
-	Product      string                                  `json:",omitempty"`
-	Language     string                                  `json:",omitempty"`
-	Framework    string                                  `json:",omitempty"`
-	Aliases      []string                                `json:",omitempty"`
-	TagAssigns   []opslevel.TagInput                     `json:",omitempty"`
-	TagCreates   []opslevel.TagInput                     `json:",omitempty"`
-	Tools        []opslevel.ToolCreateInput              `json:",omitempty"` // This is a concrete class so fields are validated during `service preview`
-	Repositories []opslevel.ServiceRepositoryCreateInput `json:",omitempty"` // This is a concrete class so fields are validated during `service preview`
+	Name          string                                  `json:",omitempty"`
+	Description   string                                  `json:",omitempty"`
+	Owner         string                                  `json:",omitempty"`
+	Lifecycle     string                                  `json:",omitempty"`
+	Tier          string                                  `json:",omitempty"`
+	Product       string                                  `json:",omitempty"`
+	Language      string                                  `json:",omitempty"`
+	Framework     string                                  `json:",omitempty"`
+	System        string                                  `json:",omitempty"` // The alias of the system the service belongs to
+	Domain        string                                  `json:",omitempty"` // The alias of the domain the system belongs to
+	DeployVersion string                                  `json:",omitempty"` // The deployed version used to detect deploys while watching
+	Type          string                                  `json:",omitempty"` // The alias of the component type IE: backend, frontend, worker or library
+	Note          string                                  `json:",omitempty"` // The long-form Markdown note of the service
+	Account       string                                  `json:",omitempty"` // The named account from config 'accounts' - empty is the default account
+	Cluster       string                                  `json:",omitempty"` // The cluster the kubernetes resource was found in
+	Namespace     string                                  `json:",omitempty"` // The namespace of the kubernetes resource the service was found in
+	Aliases       []string                                `json:",omitempty"`
+	TagAssigns    []opslevel.TagInput                     `json:",omitempty"`
+	TagCreates    []opslevel.TagInput                     `json:",omitempty"`
+	Tools         []opslevel.ToolCreateInput              `json:",omitempty"` // This is a concrete class so fields are validated during `service preview`
+	Repositories  []opslevel.ServiceRepositoryCreateInput `json:",omitempty"` // This is a concrete class so fields are validated during `service preview`
+	APIDocs       []string                                `json:",omitempty"` // The url or repository relative path of the API specs
+	Properties    map[string]string                       `json:",omitempty"` // Custom property definition alias to the json encoded value
+	CheckPayload  map[string]interface{}                  `json:",omitempty"` // The facts posted to the custom event check integration
+	Dependencies  []string                                `json:",omitempty"` // The aliases of the services this service depends on
+	Dependents    []string                                `json:",omitempty"` // The aliases of the services that depend on this service
+	IdleSince     string                                  `json:",omitempty"` // The day the workload was first seen without ready endpoints once it is idle
+	Workload      string                                  `json:"-"`          // The '<namespace>/<kind>/<name>' of the kubernetes resource used to look up its runtime health
 }
 
 func (s *ServiceRegistration) toPrettyJson() string {
@@ -61,6 +83,33 @@ func (s *ServiceRegistration) mergeData(o ServiceRegistration) {
 	if s.Framework == "" {
 		s.Framework = o.Framework
 	}
+	if s.System == "" {
+		s.System = o.System
+	}
+	if s.Domain == "" {
+		s.Domain = o.Domain
+	}
+	if s.DeployVersion == "" {
+		s.DeployVersion = o.DeployVersion
+	}
+	if s.Type == "" {
+		s.Type = o.Type
+	}
+	if s.Cluster == "" {
+		s.Cluster = o.Cluster
+	}
+	if s.Namespace == "" {
+		s.Namespace = o.Namespace
+	}
+	if s.Note == "" {
+		s.Note = o.Note
+	}
+	if s.IdleSince == "" {
+		s.IdleSince = o.IdleSince
+	}
+	if s.Workload == "" {
+		s.Workload = o.Workload
+	}
 	for _, alias := range o.Aliases {
 		s.Aliases = append(s.Aliases, alias)
 	}
@@ -79,6 +128,25 @@ func (s *ServiceRegistration) mergeData(o ServiceRegistration) {
 	for _, repo := range o.Repositories {
 		s.Repositories = append(s.Repositories, repo)
 	}
+	s.APIDocs = removeDuplicates(append(s.APIDocs, o.APIDocs...))
+	for key, value := range o.CheckPayload {
+		if s.CheckPayload == nil {
+			s.CheckPayload = map[string]interface{}{}
+		}
+		if _, ok := s.CheckPayload[key]; !ok {
+			s.CheckPayload[key] = value
+		}
+	}
+	for key, value := range o.Properties {
+		if s.Properties == nil {
+			s.Properties = map[string]string{}
+		}
+		if _, ok := s.Properties[key]; !ok {
+			s.Properties[key] = value
+		}
+	}
+	s.Dependencies = removeDuplicates(append(s.Dependencies, o.Dependencies...))
+	s.Dependents = removeDuplicates(append(s.Dependents, o.Dependents...))
 }
 
 func parseField(field string, filter string, resources []byte) *JQResponseMulti {
@@ -196,6 +264,23 @@ func convertToServiceRepositoryCreateInput(data map[string]string) *opslevel.Ser
 	}
 }
 
+// appendRepositories adds the inferred repositories that are not already listed with the same base directory
+func appendRepositories(repositories []opslevel.ServiceRepositoryCreateInput, inferred []opslevel.ServiceRepositoryCreateInput) []opslevel.ServiceRepositoryCreateInput {
+	for _, candidate := range inferred {
+		found := false
+		for _, repository := range repositories {
+			if repository.Repository.Alias == candidate.Repository.Alias && repository.BaseDirectory == candidate.BaseDirectory {
+				found = true
+				break
+			}
+		}
+		if !found {
+			repositories = append(repositories, candidate)
+		}
+	}
+	return repositories
+}
+
 func getString(index int, data *JQResponseMulti) string {
 	if index < len(data.Objects) {
 		return data.Objects[index].StringObj
@@ -296,6 +381,34 @@ func getTools(index int, data []*JQResponseMulti) []opslevel.ToolCreateInput {
 	return output
 }
 
+// parseRepositoryReferences splits a comma separated list of repository references with the format
+// '<alias>[:<directory>][=<displayname>]' so a monorepo can be attached once per path. The directory is only split
+// off when the rest still looks like a repository (contains a '/') since aliases like 'github.com:org/repo' contain a ':'
+func parseRepositoryReferences(value string) []map[string]string {
+	var output []map[string]string
+	for _, reference := range strings.Split(value, ",") {
+		reference = strings.TrimSpace(reference)
+		if reference == "" {
+			continue
+		}
+		data := map[string]string{}
+		if index := strings.Index(reference, "="); index > 0 {
+			data["name"] = strings.TrimSpace(reference[index+1:])
+			reference = strings.TrimSpace(reference[:index])
+		}
+		data["repo"] = reference
+		if index := strings.LastIndex(reference, ":"); index > 0 && strings.Contains(reference[:index], "/") {
+			data["repo"] = reference[:index]
+			data["directory"] = strings.Trim(reference[index+1:], "/")
+			if data["name"] == "" && data["directory"] != "" {
+				data["name"] = path.Base(data["directory"])
+			}
+		}
+		output = append(output, data)
+	}
+	return output
+}
+
 func getRepositories(index int, data []*JQResponseMulti) []opslevel.ServiceRepositoryCreateInput {
 	output := []opslevel.ServiceRepositoryCreateInput{}
 	count := len(data)
@@ -306,19 +419,17 @@ func getRepositories(index int, data []*JQResponseMulti) []opslevel.ServiceRepos
 		parsedData := data[i].Objects[index]
 		switch parsedData.Type {
 		case String:
-			if parsedData.StringObj == "" {
-				continue
-			}
-			if input := convertToServiceRepositoryCreateInput(map[string]string{"repo": parsedData.StringObj}); input != nil {
-				output = append(output, *input)
+			for _, reference := range parseRepositoryReferences(parsedData.StringObj) {
+				if input := convertToServiceRepositoryCreateInput(reference); input != nil {
+					output = append(output, *input)
+				}
 			}
 		case StringArray:
 			for _, item := range parsedData.StringArray {
-				if item == "" {
-					continue
-				}
-				if input := convertToServiceRepositoryCreateInput(map[string]string{"repo": item}); input != nil {
-					output = append(output, *input)
+				for _, reference := range parseRepositoryReferences(item) {
+					if input := convertToServiceRepositoryCreateInput(reference); input != nil {
+						output = append(output, *input)
+					}
 				}
 			}
 		case StringStringMap:
@@ -396,6 +507,12 @@ func FilterResources(selector k8sutils.KubernetesSelector, resources [][]byte) [
 		if anyIsTrue(resourceIndex, filterResults) {
 			continue
 		}
+		if selector.Discover && !isDiscoverable(resources[resourceIndex]) {
+			continue
+		}
+		if !k8sutils.IsNamespaceAllowed(resourceNamespace(resources[resourceIndex])) {
+			continue
+		}
 		output = append(output, resources[resourceIndex])
 	}
 	return output
@@ -415,6 +532,19 @@ func aliasOverlaps(a []string, b []string) bool {
 // TODO: bubble up errors better
 func parseResources(field string, c config.ServiceRegistrationConfig, count int, resources []byte) ([]ServiceRegistration, error) {
 	services := make([]ServiceRegistration, count)
+	c = withRecommendedLabelDefaults(c)
+	tagTransformers, tagTransformersErr := newTagTransformers(fmt.Sprintf("%s.tags.transforms", field), c.Tags.Transforms)
+	if tagTransformersErr != nil {
+		return nil, tagTransformersErr
+	}
+	tagKeyModes, tagKeyModesErr := newTagKeyModes(fmt.Sprintf("%s.tags.keys", field), c.Tags.Keys)
+	if tagKeyModesErr != nil {
+		return nil, tagKeyModesErr
+	}
+	aliasNormalizer, aliasNormalizerErr := newAliasNormalizer(fmt.Sprintf("%s.aliasNormalization", field), c.AliasNormalization)
+	if aliasNormalizerErr != nil {
+		return nil, aliasNormalizerErr
+	}
 
 	// Parse
 	Names := parseField(fmt.Sprintf("%s.name", field), c.Name, resources)
@@ -425,6 +555,11 @@ func parseResources(field string, c config.ServiceRegistrationConfig, count int,
 	Products := parseField(fmt.Sprintf("%s.product", field), c.Product, resources)
 	Languages := parseField(fmt.Sprintf("%s.language", field), c.Language, resources)
 	Frameworks := parseField(fmt.Sprintf("%s.framework", field), c.Framework, resources)
+	Systems := parseField(fmt.Sprintf("%s.system", field), c.System, resources)
+	Domains := parseField(fmt.Sprintf("%s.domain", field), c.Domain, resources)
+	DeployVersions := parseField(fmt.Sprintf("%s.deployVersion", field), c.DeployVersion, resources)
+	Types := parseField(fmt.Sprintf("%s.type", field), c.Type, resources)
+	Notes := parseField(fmt.Sprintf("%s.note", field), c.Note, resources)
 	Aliases := parseFieldArray(fmt.Sprintf("%s.aliases", field), c.Aliases, resources)
 	if len(Aliases) < 1 {
 		Aliases = append(Aliases, parseField("Auto Added Alias", "\"k8s:\\(.metadata.name)-\\(.metadata.namespace)\"", resources))
@@ -433,6 +568,10 @@ func parseResources(field string, c config.ServiceRegistrationConfig, count int,
 	TagCreates := parseFieldArray(fmt.Sprintf("%s.tags.create", field), c.Tags.Create, resources)
 	Tools := parseFieldArray(fmt.Sprintf("%s.tools", field), c.Tools, resources)
 	Repositories := parseFieldArray(fmt.Sprintf("%s.repository", field), c.Repositories, resources)
+	Docs := parseFieldArray(fmt.Sprintf("%s.docs", field), c.Docs, resources)
+	Properties := parseProperties(field, c.Properties, resources, count)
+	Dependencies := parseFieldArray(fmt.Sprintf("%s.dependencies", field), c.Dependencies, resources)
+	Dependents := parseFieldArray(fmt.Sprintf("%s.dependents", field), c.Dependents, resources)
 
 	// Aggregate
 	for i := 0; i < count; i++ {
@@ -446,24 +585,77 @@ func parseResources(field string, c config.ServiceRegistrationConfig, count int,
 		service.Product = getString(i, Products)
 		service.Language = getString(i, Languages)
 		service.Framework = getString(i, Frameworks)
-		service.Aliases = getAliases(i, Aliases)
-		service.TagAssigns = getTags(i, TagAssigns)
-		service.TagCreates = getTags(i, TagCreates)
+		service.System = getString(i, Systems)
+		service.Domain = getString(i, Domains)
+		service.DeployVersion = getString(i, DeployVersions)
+		service.Type = getString(i, Types)
+		service.Note = getString(i, Notes)
+		service.Aliases = normalizeAliases(getAliases(i, Aliases), aliasNormalizer)
+		service.TagAssigns = transformTags(getTags(i, TagAssigns), tagTransformers)
+		service.TagCreates = transformTags(getTags(i, TagCreates), tagTransformers)
+		service.TagAssigns, service.TagCreates = applyTagKeyModes(service.TagAssigns, service.TagCreates, tagKeyModes)
 		service.TagCreates = removeDuplicatesTags(service.TagCreates)
 		service.TagAssigns = removeOverlappedKeys(service.TagAssigns, service.TagCreates)
 		service.Tools = getTools(i, Tools)
 		service.Repositories = getRepositories(i, Repositories)
+		apiDocs, docTools := splitDocs(getAliases(i, Docs))
+		service.APIDocs = apiDocs
+		service.Tools = append(service.Tools, docTools...)
+		service.Properties = Properties[i]
+		service.Dependencies = getAliases(i, Dependencies)
+		service.Dependents = getAliases(i, Dependents)
 	}
 
 	return services, nil
 }
 
+func isDiscoverable(resource []byte) bool {
+	var object struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(resource, &object); err != nil {
+		return false
+	}
+	return k8sutils.HasDiscoveryAnnotation(object.Metadata.Annotations)
+}
+
+func resourceNamespace(resource []byte) string {
+	var object struct {
+		Metadata struct {
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(resource, &object); err != nil {
+		return ""
+	}
+	return object.Metadata.Namespace
+}
+
+func resourceName(resource []byte) string {
+	var object struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(resource, &object); err != nil {
+		return ""
+	}
+	return object.Metadata.Name
+}
+
+// MergeServices merges the registrations sharing an alias - IE: the same service gathered from several clusters
+func MergeServices(input []ServiceRegistration) ([]ServiceRegistration, error) {
+	return dedupServices(input)
+}
+
 func dedupServices(input []ServiceRegistration) ([]ServiceRegistration, error) {
 	var output []ServiceRegistration
 	for _, source := range input {
 		wasMerged := false
 		for i, dest := range output {
-			if aliasOverlaps(source.Aliases, dest.Aliases) {
+			if source.Account == dest.Account && aliasOverlaps(source.Aliases, dest.Aliases) {
 				dest.mergeData(source)
 				output[i] = dest
 				wasMerged = true
@@ -479,28 +671,159 @@ func dedupServices(input []ServiceRegistration) ([]ServiceRegistration, error) {
 
 func getServices(c *config.Config) ([]ServiceRegistration, error) {
 	var services []ServiceRegistration
-	k8sClient := k8sutils.CreateKubernetesClient()
+	k8sutils.ResetSnapshot()
+	source, sourceErr := newResourceSource()
+	if sourceErr != nil {
+		return services, sourceErr
+	}
+	clusterName := source.ClusterName(c.ClusterName)
+	if RecordDirectory != "" {
+		if err := writeRecordingMetadata(RecordDirectory, clusterName); err != nil {
+			return services, err
+		}
+	}
+	if err := applyGlobals(c, source, clusterName); err != nil {
+		return services, err
+	}
+	// Every selector is queried before parsing so the progress is reported against the total number of resources
+	selectorResources := make([][][]byte, len(c.Service.Import))
+	total := 0
 	for i, importConfig := range c.Service.Import {
 		selector := importConfig.SelectorConfig
 		if selectorErr := selector.Validate(); selectorErr != nil {
 			return services, selectorErr
 		}
 
-		resources, queryErr := k8sClient.Query(selector)
+		resources, queryErr := source.Query(i, selector)
 		if queryErr != nil {
 			return services, queryErr
 		}
-
-		parsedServices, parsedServicesErr := ProcessResources(fmt.Sprintf("service.import[%d]", i+1), importConfig, resources)
+		if RecordDirectory != "" {
+			if err := writeRecording(RecordDirectory, i, selector, resources); err != nil {
+				return services, err
+			}
+		}
+		selectorResources[i] = resources
+		total += len(resources)
+	}
+	parsed := 0
+	for i, importConfig := range c.Service.Import {
+		parsedServices, parsedServicesErr := ProcessResources(fmt.Sprintf("service.import[%d]", i+1), importConfig, selectorResources[i])
 		if parsedServicesErr != nil {
 			return services, parsedServicesErr
 		}
 
 		services = append(services, parsedServices...)
+		parsed += len(selectorResources[i])
+		reportResourcesParsed(parsed, total)
+	}
+	for i, importConfig := range c.Systems.Import {
+		selector := importConfig.SelectorConfig
+		if selector.Kind != "Namespace" {
+			return services, fmt.Errorf("systems.import[%d].selector: only 'kind: Namespace' can be imported as systems", i+1)
+		}
+		if selectorErr := selector.Validate(); selectorErr != nil {
+			return services, selectorErr
+		}
+		// Offset by the service and infra imports so recordings of all of them never share a file
+		index := len(c.Service.Import) + len(c.Infra.Import) + i
+		resources, queryErr := source.Query(index, selector)
+		if queryErr != nil {
+			return services, queryErr
+		}
+		if RecordDirectory != "" {
+			if err := writeRecording(RecordDirectory, index, selector, resources); err != nil {
+				return services, err
+			}
+		}
+		rememberImportedSystems(ProcessSystemResources(fmt.Sprintf("systems.import[%d]", i+1), importConfig, resources))
+	}
+	placeInImportedSystems(services)
+	if c.Systems.Namespaces {
+		PlaceInNamespaceSystems(services)
+	}
+	if c.Idle.Enabled && PersistIdleState {
+		if err := saveIdleState(); err != nil {
+			log.Warn().Msgf("Unable to persist the idle workloads - the days without ready endpoints restart next run\n\tREASON: %v", err)
+		}
 	}
 	return services, nil
 }
 
+// ApplyGlobals configures the settings shared by every selector such as built-in JQ variables and ignored resources
+func ApplyGlobals(c *config.Config, k8sClient *k8sutils.ClientWrapper) error {
+	// the informers watch the latest state once the resources the globals are built from were listed as one snapshot
+	k8sutils.ResetSnapshot()
+	defer k8sutils.ResetSnapshot()
+	return applyGlobals(c, &liveSource{client: k8sClient}, k8sClient.GetClusterName(c.ClusterName))
+}
+
+// applyGlobals configures the settings shared by every selector and lists the resources the parsed registrations are
+// enriched from (IE: namespace teams, costs, GitOps sources and idle endpoints) once for 'import' and 'reconcile'
+func applyGlobals(c *config.Config, source resourceSource, clusterName string) error {
+	jq.SetArg("cluster", clusterName)
+	jq.SetArg("context", k8sutils.CurrentKubeContext())
+	SetTagPrefix(c.TagPrefix)
+	SetManagedBy(!c.DisableManagedBy)
+	if err := SetTagRemovals(c.TagRemovals); err != nil {
+		return err
+	}
+	SetTagPruning(c.PruneTags)
+	if err := SetImageRepositoryRules(c.ImageRepositories); err != nil {
+		return err
+	}
+	if err := k8sutils.SetIgnoredResources(c.IgnoreResources); err != nil {
+		return err
+	}
+	if err := k8sutils.SetNamespaceFilter(c.Namespaces.Include, c.Namespaces.Exclude, c.Namespaces.OptIn); err != nil {
+		return err
+	}
+	if live, ok := source.(*liveSource); ok && c.Namespaces.OptIn != "" {
+		if err := live.client.RefreshNamespaces(); err != nil {
+			return err
+		}
+	}
+	setConfigMapSource(source)
+	if c.Teams.AutoCreate {
+		if err := loadNamespaceTeams(source, c.Teams); err != nil {
+			log.Warn().Msgf("Unable to list Namespaces - created teams are named after their alias\n\tREASON: %v", err)
+		}
+	}
+	if c.Infra.Cluster.Enabled {
+		loadClusterInfo(source, clusterName)
+	}
+	if c.Costs.Enabled {
+		if err := loadWorkloadCosts(source, c.Costs); err != nil {
+			log.Warn().Msgf("Unable to look up the cost of the workloads - the cost tags are skipped\n\tREASON: %v", err)
+		}
+	}
+	if c.GitOps.Enabled {
+		if err := loadGitOpsSources(source); err != nil {
+			log.Warn().Msgf("Unable to list the GitOps resources - repositories are not inferred from Argo CD or Flux\n\tREASON: %v", err)
+		}
+	}
+	if c.Idle.Enabled {
+		if err := loadIdleEndpoints(source, clusterName, c.Idle); err != nil {
+			log.Warn().Msgf("Unable to list the endpoints - idle services are not detected\n\tREASON: %v", err)
+		}
+	}
+	if c.Systems.Namespaces {
+		if err := loadNamespaceSystems(source, clusterName); err != nil {
+			log.Warn().Msgf("Unable to summarize the namespaces - no namespace systems are created\n\tREASON: %v", err)
+		}
+	}
+	for _, importConfig := range c.Service.Import {
+		if importConfig.OpslevelConfig.CheckFacts {
+			if err := loadPodDisruptionBudgets(source); err != nil {
+				log.Warn().Msgf("Unable to list PodDisruptionBudgets - the 'has_pod_disruption_budget' fact is skipped\n\tREASON: %v", err)
+				podDisruptionBudgets = nil
+			}
+			break
+		}
+	}
+	return nil
+}
+
 func GetAllServices(c *config.Config) ([]ServiceRegistration, error) {
 	services, err := getServices(c)
 	if err != nil {
@@ -514,10 +837,33 @@ func ProcessResources(field string, config config.Import, resources [][]byte) ([
 	if len(filtered) < 1 {
 		return []ServiceRegistration{}, nil
 	}
-	parsed, parseError := parseResources(field, config.OpslevelConfig, len(filtered), joinResourceBytes(filtered))
+	joined := joinResourceBytes(filtered)
+	parsed, parseError := parseResources(field, config.OpslevelConfig, len(filtered), joined)
 	if parseError != nil {
 		return nil, parseError
 	}
+	checkPayloads := parseCheckPayloads(field, config.OpslevelConfig, filtered, joined)
+	for i := range parsed {
+		parsed[i].Account = config.Account
+		parsed[i].Cluster = jq.GetArg("cluster")
+		parsed[i].Namespace = resourceNamespace(filtered[i])
+		parsed[i].Workload = resourceWorkloadKey(filtered[i])
+		parsed[i].TagAssigns = prefixTags(append(parsed[i].TagAssigns, costTags(filtered[i])...))
+		parsed[i].TagCreates = prefixTags(parsed[i].TagCreates)
+		parsed[i].CheckPayload = checkPayloads[i]
+		applyIdle(&parsed[i], filtered[i])
+		parsed[i].Repositories = appendRepositories(parsed[i].Repositories, gitOpsRepositories(filtered[i]))
+		if len(parsed[i].Repositories) == 0 {
+			parsed[i].Repositories = imageRepositories(filtered[i])
+		}
+		parsed[i].Tools = append(parsed[i].Tools, pagerDutyTools(config.OpslevelConfig.PagerDuty, filtered[i])...)
+		validateToolCategories(&parsed[i])
+		note, err := resolveNote(parsed[i].Note)
+		if err != nil {
+			log.Warn().Msgf("[%s] Skipping the note\n\tREASON: %v", parsed[i].Name, err)
+		}
+		parsed[i].Note = note
+	}
 	deduped, dedupErr := dedupServices(parsed)
 	if dedupErr != nil {
 		return nil, dedupErr
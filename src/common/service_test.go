@@ -1,10 +1,17 @@
 package common
 
 import (
+	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/opslevel/kubectl-opslevel/config"
+	"github.com/opslevel/kubectl-opslevel/jq"
+	"github.com/opslevel/kubectl-opslevel/k8sutils"
 	"github.com/opslevel/opslevel-go/v2022"
 	"github.com/rocktavious/autopilot"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 func Test_RemoveDuplicatesTagAssign_WhenNoDuplicatesExist(t *testing.T) {
@@ -53,3 +60,879 @@ func Test_RemoveDuplicatesTagAssign_WhenDuplicatesExist(t *testing.T) {
 	// Assert
 	autopilot.Equals(t, 2, len(result))
 }
+
+func Test_DedupServices_DoesNotMergeAcrossAccounts(t *testing.T) {
+	// Arrange
+	input := []ServiceRegistration{
+		{Name: "foo", Aliases: []string{"k8s:foo"}},
+		{Name: "foo", Aliases: []string{"k8s:foo"}, Account: "payments"},
+		{Name: "bar", Aliases: []string{"k8s:foo", "k8s:bar"}},
+	}
+	// Act
+	result, err := dedupServices(input)
+
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Equals(t, 2, len(result))
+	autopilot.Equals(t, []string{"k8s:foo", "k8s:bar"}, result[0].Aliases)
+	autopilot.Equals(t, "payments", result[1].Account)
+}
+
+func Test_TransformTags_AppliesTransformsInOrder(t *testing.T) {
+	// Arrange
+	transformers, err := newTagTransformers("tags.transforms", []config.TagTransformConfig{
+		{
+			Target:        "both",
+			StripPrefixes: []string{"app.kubernetes.io/"},
+			Lowercase:     true,
+			Replace:       []config.ReplaceConfig{{Pattern: "[^a-z0-9_./:-]", With: "_"}},
+		},
+		{
+			Keys:      []string{"app.kubernetes.io/version"},
+			MaxLength: 3,
+		},
+	})
+	input := []opslevel.TagInput{
+		{Key: "app.kubernetes.io/Name", Value: "My App"},
+		{Key: "app.kubernetes.io/version", Value: "1.2.3"},
+		{Key: "empty", Value: "@"},
+	}
+	// Act
+	result := transformTags(input, transformers)
+
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Equals(t, []opslevel.TagInput{
+		{Key: "name", Value: "my_app"},
+		{Key: "version", Value: "1.2"},
+		{Key: "empty", Value: "_"},
+	}, result)
+}
+
+func Test_StringTransformer_TruncatesByRune(t *testing.T) {
+	// Arrange
+	transformer := stringTransformer{maxLength: 4}
+	// Act
+	result := transformer.apply("café-au-lait")
+	// Assert
+	autopilot.Equals(t, "café", result)
+}
+
+func Test_NewTagTransformers_FailsOnInvalidTarget(t *testing.T) {
+	// Act
+	_, err := newTagTransformers("tags.transforms", []config.TagTransformConfig{{Target: "label"}})
+
+	// Assert
+	autopilot.Assert(t, err != nil, "expected an error for an invalid target")
+}
+
+func Test_NormalizeAliases_AppliesRulesAndRemovesDuplicates(t *testing.T) {
+	// Arrange
+	normalizer, err := newAliasNormalizer("aliasNormalization", config.AliasNormalizationConfig{
+		Lowercase:     true,
+		StripPrefixes: []string{"k8s:"},
+		StripSuffixes: []string{"-default"},
+		Replace:       []config.ReplaceConfig{{Pattern: "[_.]", With: "-"}},
+	})
+	input := []string{"k8s:My_App-default", "my-app", "k8s:other.app"}
+
+	// Act
+	result := normalizeAliases(input, normalizer)
+
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Equals(t, []string{"my-app", "other-app"}, result)
+}
+
+func Test_ToBackstageEntity_SanitizesNameAndTags(t *testing.T) {
+	// Arrange
+	service := ServiceRegistration{
+		Name:       "My App",
+		Owner:      "platform",
+		Lifecycle:  "Generally_Available",
+		Aliases:    []string{"k8s:my_app-default"},
+		TagAssigns: []opslevel.TagInput{{Key: "env", Value: "Prod"}, {Key: "env", Value: "prod"}},
+	}
+
+	// Act
+	result := service.ToBackstageEntity()
+
+	// Assert
+	autopilot.Equals(t, "k8s-my_app-default", result.Metadata.Name)
+	autopilot.Equals(t, "My App", result.Metadata.Title)
+	autopilot.Equals(t, []string{"env-prod"}, result.Metadata.Tags)
+	autopilot.Equals(t, "generally_available", result.Spec.Lifecycle)
+	autopilot.Equals(t, "platform", result.Spec.Owner)
+}
+
+func Test_ParseBackstageCatalog_ConvertsComponents(t *testing.T) {
+	// Arrange
+	data := []byte(`apiVersion: backstage.io/v1alpha1
+kind: Component
+metadata:
+  name: my-app
+  title: My App
+  tags: [java, spring]
+  annotations:
+    github.com/project-slug: org/my-app
+spec:
+  type: service
+  lifecycle: production
+  owner: group:default/platform
+---
+apiVersion: backstage.io/v1alpha1
+kind: Group
+metadata:
+  name: platform
+`)
+
+	// Act
+	result, err := ParseBackstageCatalog(data)
+
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Equals(t, 1, len(result))
+	autopilot.Equals(t, "My App", result[0].Name)
+	autopilot.Equals(t, "platform", result[0].Owner)
+	autopilot.Equals(t, []string{"my-app"}, result[0].Aliases)
+	autopilot.Equals(t, []opslevel.TagInput{{Key: "backstage", Value: "java"}, {Key: "backstage", Value: "spring"}}, result[0].TagCreates)
+	autopilot.Equals(t, 0, len(result[0].TagAssigns))
+	autopilot.Equals(t, "github.com:org/my-app", string(result[0].Repositories[0].Repository.Alias))
+}
+
+func Test_Recording_ReplaysRecordedResources(t *testing.T) {
+	// Arrange
+	directory := t.TempDir()
+	selector := k8sutils.KubernetesSelector{ApiVersion: "apps/v1", Kind: "Deployment"}
+	resources := [][]byte{[]byte(`{"metadata":{"name":"a"}}`), []byte(`{"metadata":{"name":"b"}}`)}
+	autopilot.Ok(t, writeRecordingMetadata(directory, "my-cluster"))
+	autopilot.Ok(t, writeRecording(directory, 0, selector, resources))
+
+	// Act
+	source, err := newRecordingSource(directory)
+	autopilot.Ok(t, err)
+	result, err := source.Query(0, selector)
+
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Equals(t, "my-cluster", source.ClusterName(""))
+	autopilot.Equals(t, "override", source.ClusterName("override"))
+	autopilot.Equals(t, 2, len(result))
+	autopilot.Equals(t, `{"metadata":{"name":"b"}}`, string(result[1]))
+}
+
+func Test_DiffSnapshots(t *testing.T) {
+	// Arrange
+	before := []ServiceRegistration{
+		{Name: "web", Aliases: []string{"k8s:web"}, Tier: "tier_1"},
+		{Name: "worker", Aliases: []string{"k8s:worker"}},
+		{Name: "cron", Aliases: []string{"k8s:cron"}},
+	}
+	after := []ServiceRegistration{
+		{Name: "web", Aliases: []string{"k8s:web"}, Tier: "tier_2"},
+		{Name: "worker", Aliases: []string{"k8s:worker"}},
+		{Name: "api", Aliases: []string{"k8s:api"}},
+	}
+	// Act
+	result := DiffSnapshots(before, after)
+	// Assert
+	autopilot.Equals(t, 1, len(result.Added))
+	autopilot.Equals(t, "api", result.Added[0].Name)
+	autopilot.Equals(t, 1, len(result.Removed))
+	autopilot.Equals(t, "cron", result.Removed[0].Name)
+	autopilot.Equals(t, 1, len(result.Changed))
+	autopilot.Equals(t, "k8s:web", result.Changed[0].Key)
+	autopilot.Equals(t, []SnapshotFieldChange{{Field: "Tier", Before: `"tier_1"`, After: `"tier_2"`}}, result.Changed[0].Fields)
+}
+
+func Test_FileSource_FiltersListAndMultiDocumentInput(t *testing.T) {
+	// Arrange
+	jsonInput := `{"apiVersion": "v1", "kind": "List", "items": [
+  {"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "web", "namespace": "default", "labels": {"team": "a"}}},
+  {"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "api", "namespace": "other", "labels": {"team": "a"}}}
+]}`
+	yamlInput := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+  namespace: default
+  labels:
+    team: b
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: default
+  annotations:
+    opslevel.com/owner: payments
+`
+	resources, err := ParseResources(strings.NewReader(jsonInput))
+	autopilot.Ok(t, err)
+	yamlResources, yamlErr := ParseResources(strings.NewReader(yamlInput))
+	autopilot.Ok(t, yamlErr)
+	resources = append(resources, yamlResources...)
+	source := &fileSource{resources: resources}
+	// Act
+	all, allErr := source.Query(0, k8sutils.KubernetesSelector{ApiVersion: "apps/v1", Kind: "Deployment"})
+	filtered, filteredErr := source.Query(0, k8sutils.KubernetesSelector{ApiVersion: "apps/v1", Kind: "Deployment", Namespaces: []string{"default"}, LabelSelector: "team=a"})
+	fielded, fieldedErr := source.Query(0, k8sutils.KubernetesSelector{ApiVersion: "apps/v1", Kind: "Deployment", FieldSelector: "metadata.namespace!=other,metadata.name!=worker"})
+	discovered, discoveredErr := source.Query(0, k8sutils.KubernetesSelector{Discover: true})
+	// Assert
+	autopilot.Equals(t, 4, len(resources))
+	autopilot.Ok(t, allErr)
+	autopilot.Equals(t, 3, len(all))
+	autopilot.Ok(t, filteredErr)
+	autopilot.Equals(t, 1, len(filtered))
+	autopilot.Assert(t, strings.Contains(string(filtered[0]), `"name":"web"`), "expected the 'web' deployment")
+	autopilot.Ok(t, fieldedErr)
+	autopilot.Equals(t, 1, len(fielded))
+	autopilot.Assert(t, strings.Contains(string(fielded[0]), `"name":"web"`), "expected the 'web' deployment")
+	autopilot.Ok(t, discoveredErr)
+	autopilot.Equals(t, 1, len(discovered))
+	autopilot.Assert(t, strings.Contains(string(discovered[0]), `"kind":"Service"`), "expected the annotated 'web' service")
+}
+
+func Test_BuiltinCheckFacts(t *testing.T) {
+	// Arrange
+	podDisruptionBudgets = map[string][]labels.Selector{"default": {labels.SelectorFromSet(labels.Set{"app": "web"})}}
+	defer func() { podDisruptionBudgets = nil }()
+	resource := []byte(`{"kind": "Deployment", "metadata": {"name": "web", "namespace": "default"}, "spec": {"template": {
+		"metadata": {"labels": {"app": "web"}},
+		"spec": {"securityContext": {"runAsNonRoot": true}, "containers": [
+			{"name": "app", "resources": {"limits": {"cpu": "1", "memory": "1Gi"}}, "readinessProbe": {}},
+			{"name": "sidecar", "resources": {"limits": {"cpu": "1"}}, "readinessProbe": {}}
+		]}
+	}}}`)
+	// Act
+	facts := builtinCheckFacts(resource)
+	// Assert
+	autopilot.Equals(t, false, facts["has_resource_limits"])
+	autopilot.Equals(t, true, facts["runs_as_non_root"])
+	autopilot.Equals(t, false, facts["has_liveness_probe"])
+	autopilot.Equals(t, true, facts["has_readiness_probe"])
+	autopilot.Equals(t, true, facts["has_pod_disruption_budget"])
+}
+
+func Test_ProcessInfraResources(t *testing.T) {
+	// Arrange
+	importConfig := config.InfraImport{
+		SelectorConfig: k8sutils.KubernetesSelector{ApiVersion: "postgresql.cnpg.io/v1", Kind: "Cluster"},
+		OpslevelConfig: config.InfraRegistrationConfig{
+			Name:     ".metadata.name",
+			Schema:   `"Database"`,
+			Owner:    `.metadata.annotations."opslevel.com/owner"`,
+			Aliases:  []string{`"k8s:\(.metadata.name)"`},
+			Provider: config.InfraProviderConfig{Account: `"prod"`, Type: ".kind"},
+			Data:     []string{`{"instances": .spec.instances}`},
+			Services: []string{`.metadata.annotations."opslevel.com/used-by" | split(",")`},
+		},
+	}
+	resources := [][]byte{
+		[]byte(`{"kind": "Cluster", "metadata": {"name": "orders-db", "annotations": {"opslevel.com/owner": "payments", "opslevel.com/used-by": "checkout,orders"}}, "spec": {"instances": 3}}`),
+	}
+	// Act
+	registrations := ProcessInfraResources("infra.import[1]", importConfig, resources)
+	// Assert
+	autopilot.Equals(t, 1, len(registrations))
+	autopilot.Equals(t, "orders-db", registrations[0].Name)
+	autopilot.Equals(t, "Database", registrations[0].Schema)
+	autopilot.Equals(t, "payments", registrations[0].Owner)
+	autopilot.Equals(t, []string{"k8s:orders-db"}, registrations[0].Aliases)
+	autopilot.Equals(t, InfraProvider{Account: "prod", Type: "Cluster"}, registrations[0].Provider)
+	autopilot.Equals(t, float64(3), registrations[0].Data["instances"])
+	autopilot.Equals(t, []string{"checkout", "orders"}, registrations[0].Services)
+}
+
+func Test_LoadNamespaceTeams(t *testing.T) {
+	// Arrange
+	resources, err := ParseResources(strings.NewReader(`{"apiVersion": "v1", "kind": "List", "items": [
+  {"apiVersion": "v1", "kind": "Namespace", "metadata": {"name": "payments", "annotations": {"opslevel.com/owner": "payments-team", "opslevel.com/team-name": "Payments", "opslevel.com/team-contact": "#payments", "opslevel.com/team-manager": "lead@example.com"}}},
+  {"apiVersion": "v1", "kind": "Namespace", "metadata": {"name": "default"}}
+]}`))
+	autopilot.Ok(t, err)
+	defer func() { namespaceTeams = map[string]teamDefinition{} }()
+	// Act
+	loadErr := loadNamespaceTeams(&fileSource{resources: resources}, config.TeamsConfig{AutoCreate: true})
+	// Assert
+	autopilot.Ok(t, loadErr)
+	autopilot.Equals(t, teamDefinition{Name: "Payments", Contact: "#payments", Manager: "lead@example.com"}, getNamespaceTeam("payments-team"))
+	autopilot.Equals(t, teamDefinition{Name: "unknown"}, getNamespaceTeam("unknown"))
+	autopilot.Equals(t, opslevel.ContactTypeSlack, toContactInput("#payments").Type)
+	autopilot.Equals(t, opslevel.ContactTypeEmail, toContactInput("team@example.com").Type)
+}
+
+func Test_ApplyGlobals_LoadsTheEnabledLookups(t *testing.T) {
+	// Arrange
+	resources, err := ParseResources(strings.NewReader(`{"apiVersion": "v1", "kind": "List", "items": [
+  {"apiVersion": "v1", "kind": "Namespace", "metadata": {"name": "payments", "annotations": {"opslevel.com/owner": "payments-team", "opslevel.com/team-name": "Payments"}}},
+  {"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "web", "namespace": "payments"}, "spec": {"replicas": 1}}
+]}`))
+	autopilot.Ok(t, err)
+	c := &config.Config{}
+	c.Teams.AutoCreate = true
+	c.Systems.Namespaces = true
+	defer func() {
+		namespaceTeams = map[string]teamDefinition{}
+		namespaceSystems = map[string]*namespaceSummary{}
+		jq.SetArg("cluster", "")
+	}()
+	services := []ServiceRegistration{{Name: "web", Cluster: "prod", Namespace: "payments"}}
+	// Act
+	applyErr := applyGlobals(c, &fileSource{resources: resources}, "prod")
+	PlaceInNamespaceSystems(services)
+	// Assert
+	autopilot.Ok(t, applyErr)
+	autopilot.Equals(t, "Payments", getNamespaceTeam("payments-team").Name)
+	autopilot.Equals(t, namespaceSystemAlias("prod", "payments"), services[0].System)
+}
+
+func Test_GetTeamMemberships(t *testing.T) {
+	// Arrange
+	path := t.TempDir() + "/rbac.json"
+	autopilot.Ok(t, os.WriteFile(path, []byte(`{"apiVersion": "v1", "kind": "List", "items": [
+  {"apiVersion": "v1", "kind": "Namespace", "metadata": {"name": "payments", "annotations": {"opslevel.com/owner": "payments-team"}}},
+  {"apiVersion": "v1", "kind": "Namespace", "metadata": {"name": "legacy", "annotations": {"opslevel.com/owner": "legacy-team"}}},
+  {"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "RoleBinding", "metadata": {"name": "devs", "namespace": "payments"}, "roleRef": {"name": "edit"},
+   "subjects": [{"kind": "User", "name": "Alice@example.com"}, {"kind": "Group", "name": "devs@example.com"}, {"kind": "ServiceAccount", "name": "ci"}]},
+  {"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "RoleBinding", "metadata": {"name": "viewers", "namespace": "payments"}, "roleRef": {"name": "view"},
+   "subjects": [{"kind": "User", "name": "bob@example.com"}]},
+  {"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "RoleBinding", "metadata": {"name": "other", "namespace": "default"}, "roleRef": {"name": "edit"},
+   "subjects": [{"kind": "User", "name": "carol@example.com"}]},
+  {"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "ClusterRoleBinding", "metadata": {"name": "platform", "annotations": {"opslevel.com/owner": "platform-team"}}, "roleRef": {"name": "admin"},
+   "subjects": [{"kind": "User", "name": "dave@example.com"}]}
+]}`), 0o600))
+	InputFiles = []string{path}
+	defer func() { InputFiles = nil }()
+	c := &config.Config{Teams: config.TeamsConfig{Members: config.TeamMembersConfig{Roles: []string{"edit", "admin"}}}}
+	// Act
+	memberships, err := GetTeamMemberships(c)
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Equals(t, []TeamMembership{
+		{Team: "legacy-team", Emails: []string{}},
+		{Team: "payments-team", Emails: []string{"alice@example.com"}},
+		{Team: "platform-team", Emails: []string{"dave@example.com"}},
+	}, memberships)
+}
+
+func Test_SplitDocs(t *testing.T) {
+	// Act
+	apiDocs, tools := splitDocs([]string{"docs/openapi.yaml", "https://example.com/spec.json?v=2", "https://wiki.example.com/checkout", "docs/README.md", "https://example.com/runbook"})
+	// Assert
+	autopilot.Equals(t, []string{"docs/openapi.yaml", "https://example.com/spec.json?v=2"}, apiDocs)
+	autopilot.Equals(t, 2, len(tools))
+	autopilot.Equals(t, opslevel.ToolCategoryWiki, tools[0].Category)
+	autopilot.Equals(t, "Docs", tools[0].DisplayName)
+	autopilot.Equals(t, "https://wiki.example.com/checkout", tools[0].Url)
+	autopilot.Equals(t, "Docs 2", tools[1].DisplayName)
+}
+
+func Test_ParseRepositoryReferences_SplitsMonorepoPaths(t *testing.T) {
+	// Act
+	references := parseRepositoryReferences("github.com:org/mono:services/checkout, github.com:org/mono:libs/billing=Billing Library,github.com:org/app, org/mono:/tools/")
+	// Assert
+	autopilot.Equals(t, []map[string]string{
+		{"repo": "github.com:org/mono", "directory": "services/checkout", "name": "checkout"},
+		{"repo": "github.com:org/mono", "directory": "libs/billing", "name": "Billing Library"},
+		{"repo": "github.com:org/app"},
+		{"repo": "org/mono", "directory": "tools", "name": "tools"},
+	}, references)
+}
+
+func Test_PrefixTags(t *testing.T) {
+	// Arrange
+	SetTagPrefix("k8s.")
+	defer SetTagPrefix("")
+	// Act
+	tags := prefixTags([]opslevel.TagInput{{Key: "env", Value: "prod"}, {Key: "k8s.team", Value: "payments"}})
+	// Assert
+	autopilot.Equals(t, []opslevel.TagInput{{Key: "k8s.env", Value: "prod"}, {Key: "k8s.team", Value: "payments"}}, tags)
+	autopilot.Equals(t, true, isManagedTag("k8s.env"))
+	autopilot.Equals(t, false, isManagedTag("env"))
+}
+
+func Test_AccountCache_IsReusedUntilItExpires(t *testing.T) {
+	// Arrange
+	CacheDirectory = t.TempDir()
+	CacheTTL = time.Hour
+	defer func() { CacheDirectory, CacheTTL = "", 0 }()
+	persisted := &opslevel.Cacher{Teams: map[string]opslevel.Team{"payments": {TeamId: opslevel.TeamId{Alias: "payments"}}}}
+	autopilot.Ok(t, saveAccountCache("test", persisted))
+	// Act
+	loaded := &opslevel.Cacher{}
+	fresh := loadAccountCache("test", loaded)
+	CacheTTL = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	expired := loadAccountCache("test", &opslevel.Cacher{})
+	removed, err := ClearAccountCaches()
+	// Assert
+	autopilot.Equals(t, true, fresh)
+	autopilot.Equals(t, "payments", string(loaded.Teams["payments"].Alias))
+	autopilot.Equals(t, true, isDiskCached("test"))
+	autopilot.Equals(t, false, expired)
+	autopilot.Ok(t, err)
+	autopilot.Equals(t, 1, removed)
+}
+
+func Test_ResolveNote_ReadsConfigMapKeys(t *testing.T) {
+	// Arrange
+	path := t.TempDir() + "/configmaps.json"
+	autopilot.Ok(t, os.WriteFile(path, []byte(`{"apiVersion": "v1", "kind": "List", "items": [
+  {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "runbook", "namespace": "payments"}, "data": {"README.md": "# Restart\nkubectl rollout restart"}},
+  {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "unrelated", "namespace": "payments"}, "data": {"key": "value"}}
+]}`), 0o600))
+	source, err := newFileSource([]string{path})
+	autopilot.Ok(t, err)
+	setConfigMapSource(source)
+	defer setConfigMapSource(nil)
+	// Act
+	inline, inlineErr := resolveNote("Call the on-call")
+	referenced, referencedErr := resolveNote("configmap:payments/runbook/README.md")
+	_, missingErr := resolveNote("configmap:payments/runbook/missing.md")
+	_, missingConfigMapErr := resolveNote("configmap:payments/playbook/README.md")
+	cached := len(configMaps)
+	ResetConfigMaps()
+	// Assert
+	autopilot.Ok(t, inlineErr)
+	autopilot.Ok(t, referencedErr)
+	autopilot.Equals(t, "Call the on-call", inline)
+	autopilot.Equals(t, "# Restart\nkubectl rollout restart", referenced)
+	autopilot.Assert(t, missingErr != nil, "expected an error for a missing key")
+	autopilot.Assert(t, missingConfigMapErr != nil, "expected an error for a missing ConfigMap")
+	autopilot.Equals(t, 2, cached)
+	autopilot.Equals(t, 0, len(configMaps))
+}
+
+func Test_PagerDutyTools(t *testing.T) {
+	// Arrange
+	resource := []byte(`{"metadata": {"annotations": {
+  "pagerduty.com/service-id": "PABC123",
+  "runbook": "page https://acme.pagerduty.com/services/PXYZ789 first",
+  "opslevel.com/pagerduty": "https://acme.pagerduty.com/service-directory/PABC123"
+}}}`)
+	// Act
+	disabled := pagerDutyTools(config.PagerDutyConfig{}, resource)
+	tools := pagerDutyTools(config.PagerDutyConfig{Enabled: true, Subdomain: "acme"}, resource)
+	// Assert
+	autopilot.Equals(t, 0, len(disabled))
+	autopilot.Equals(t, []opslevel.ToolCreateInput{
+		{Category: opslevel.ToolCategoryIncidents, DisplayName: "PagerDuty", Url: "https://acme.pagerduty.com/service-directory/PABC123"},
+		{Category: opslevel.ToolCategoryIncidents, DisplayName: "PagerDuty 2", Url: "https://acme.pagerduty.com/service-directory/PXYZ789"},
+	}, tools)
+}
+
+func Test_ManagedByTags(t *testing.T) {
+	// Arrange
+	SetTagPrefix("k8s.")
+	defer SetTagPrefix("")
+	jq.SetArg("cluster", "prod-eu")
+	defer jq.SetArg("cluster", "")
+	service := &opslevel.Service{}
+	service.Tags.Nodes = []opslevel.Tag{
+		{Key: "k8s.managed-by", Value: "kubectl-opslevel"},
+		{Key: "k8s.managed-by-cluster", Value: "prod-us"},
+	}
+	// Act
+	tags := managedByTags("", "shop")
+	missing := missingManagedByTags(service, tags)
+	// Assert
+	autopilot.Equals(t, map[string]string{
+		"k8s.managed-by":           "kubectl-opslevel",
+		"k8s.managed-by-cluster":   "prod-eu",
+		"k8s.managed-by-namespace": "shop",
+		"k8s.managed-by-version":   "development",
+	}, tags)
+	autopilot.Equals(t, map[string]string{
+		"k8s.managed-by-cluster":   "prod-eu",
+		"k8s.managed-by-namespace": "shop",
+		"k8s.managed-by-version":   "development",
+	}, missing)
+}
+
+func Test_LastSyncedTag_RefreshesOnChangesAndOncePerInterval(t *testing.T) {
+	// Arrange
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	recent := &opslevel.Service{}
+	recent.Tags.Nodes = []opslevel.Tag{{Key: "last-synced-at", Value: now.Add(-time.Hour).Format(time.RFC3339)}}
+	stale := &opslevel.Service{}
+	stale.Tags.Nodes = []opslevel.Tag{{Key: "last-synced-at", Value: now.Add(-25 * time.Hour).Format(time.RFC3339)}}
+	// Act
+	_, _, recentOk := lastSyncedTag(recent, false, now)
+	_, _, changedOk := lastSyncedTag(recent, true, now)
+	key, value, staleOk := lastSyncedTag(stale, false, now)
+	// Assert
+	autopilot.Equals(t, false, recentOk)
+	autopilot.Equals(t, true, changedOk)
+	autopilot.Equals(t, true, staleOk)
+	autopilot.Equals(t, "last-synced-at", key)
+	autopilot.Equals(t, "2026-10-15T12:00:00Z", value)
+}
+
+func Test_ScopeFilters(t *testing.T) {
+	// Act
+	filters := ScopeFilters("prod-eu1", []string{"shop", "", "billing", "shop"})
+	// Assert
+	autopilot.Equals(t, 3, len(filters))
+	autopilot.Equals(t, "Cluster prod-eu1", filters[0].Name)
+	autopilot.Equals(t, "Cluster prod-eu1 Namespace billing", filters[1].Name)
+	autopilot.Equals(t, "Cluster prod-eu1 Namespace shop", filters[2].Name)
+	autopilot.Equals(t, "managed-by-namespace", filters[2].Predicates[1].KeyData)
+	autopilot.Equals(t, "shop", filters[2].Predicates[1].Value)
+}
+
+func Test_ValidateToolCategories(t *testing.T) {
+	// Arrange
+	registration := ServiceRegistration{
+		Name: "web",
+		Tools: []opslevel.ToolCreateInput{
+			{Category: "logs", DisplayName: "Logs"},
+			{Category: "API Documentation", DisplayName: "Swagger"},
+			{Category: "metrcs", DisplayName: "Grafana"},
+		},
+	}
+	// Act
+	validateToolCategories(&registration)
+	// Assert
+	autopilot.Equals(t, 2, len(registration.Tools))
+	autopilot.Equals(t, opslevel.ToolCategoryAPIDocumentation, registration.Tools[1].Category)
+	autopilot.Equals(t, "metrics", suggestToolCategory("metrcs"))
+	autopilot.Equals(t, "incidents", suggestToolCategory("Incident"))
+}
+
+func Test_ApplyTagKeyModes(t *testing.T) {
+	// Arrange
+	modes, err := newTagKeyModes("tags.keys", map[string]string{"environment": "single", "team": "Multi"})
+	_, invalidErr := newTagKeyModes("tags.keys", map[string]string{"environment": "replace"})
+	assigns := []opslevel.TagInput{{Key: "imported", Value: "kubectl-opslevel"}, {Key: "Team", Value: "payments"}, {Key: "environment", Value: "prod"}}
+	creates := []opslevel.TagInput{{Key: "environment", Value: "staging"}, {Key: "region", Value: "us-east-1"}}
+	// Act
+	outputAssigns, outputCreates := applyTagKeyModes(assigns, creates, modes)
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Assert(t, invalidErr != nil, "expected an invalid mode to fail")
+	autopilot.Equals(t, []opslevel.TagInput{{Key: "imported", Value: "kubectl-opslevel"}, {Key: "environment", Value: "prod"}}, outputAssigns)
+	autopilot.Equals(t, []opslevel.TagInput{{Key: "Team", Value: "payments"}, {Key: "region", Value: "us-east-1"}}, outputCreates)
+}
+
+func Test_MergeServices_KeepsTheFirstCluster(t *testing.T) {
+	// Arrange
+	services := []ServiceRegistration{
+		{Name: "web", Cluster: "prod-eu1", Aliases: []string{"k8s:web-shop"}},
+		{Name: "web", Cluster: "prod-us1", Aliases: []string{"k8s:web-shop", "web"}},
+	}
+	// Act
+	merged, err := MergeServices(services)
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Equals(t, 1, len(merged))
+	autopilot.Equals(t, "prod-eu1", merged[0].Cluster)
+	autopilot.Equals(t, "prod-eu1", managedByTags(merged[0].Cluster, "")["managed-by-cluster"])
+}
+
+func Test_RegistrationTracker_SkipsUnchangedRegistrations(t *testing.T) {
+	// Arrange
+	now := time.Now()
+	tracker := NewRegistrationTracker(time.Hour)
+	service := ServiceRegistration{Name: "web", Aliases: []string{"k8s:web-shop"}, Tier: "tier_1"}
+	changed := service
+	changed.Tier = "tier_2"
+	failed := ServiceRegistration{Name: "api", Aliases: []string{"k8s:api-shop"}}
+	// Act
+	tracker.Remember(service, ServiceResult{Action: ServiceAction_Updated}, now)
+	tracker.Remember(failed, ServiceResult{Action: ServiceAction_Failed}, now)
+	// Assert
+	autopilot.Equals(t, true, tracker.Unchanged(service, now.Add(time.Minute)))
+	autopilot.Equals(t, false, tracker.Unchanged(changed, now.Add(time.Minute)))
+	autopilot.Equals(t, false, tracker.Unchanged(service, now.Add(time.Hour)))
+	autopilot.Equals(t, false, tracker.Unchanged(failed, now.Add(time.Minute)))
+}
+
+func Test_FilterResources_SkipsFilteredNamespaces(t *testing.T) {
+	// Arrange
+	err := k8sutils.SetNamespaceFilter([]string{"team-*"}, []string{"team-legacy"}, "")
+	defer k8sutils.SetNamespaceFilter(nil, nil, "")
+	resources := [][]byte{
+		[]byte(`{"metadata": {"name": "web", "namespace": "team-a"}}`),
+		[]byte(`{"metadata": {"name": "web", "namespace": "team-legacy"}}`),
+		[]byte(`{"metadata": {"name": "web", "namespace": "default"}}`),
+		[]byte(`{"metadata": {"name": "cluster-wide"}}`),
+	}
+	// Act
+	filtered := FilterResources(k8sutils.KubernetesSelector{}, resources)
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Equals(t, 2, len(filtered))
+	autopilot.Assert(t, strings.Contains(string(filtered[0]), "team-a"), "expected the 'team-a' resource")
+	autopilot.Assert(t, strings.Contains(string(filtered[1]), "cluster-wide"), "expected the cluster scoped resource")
+}
+
+func Test_FileSourceQuery_SkipsFilteredNamespaces(t *testing.T) {
+	// Arrange
+	err := k8sutils.SetNamespaceFilter([]string{"team-*"}, []string{"team-legacy"}, "")
+	defer k8sutils.SetNamespaceFilter(nil, nil, "")
+	resources, parseErr := ParseResources(strings.NewReader(`{"apiVersion": "v1", "kind": "List", "items": [
+  {"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "web", "namespace": "team-a"}},
+  {"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "web", "namespace": "team-legacy"}},
+  {"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "web", "namespace": "default"}}
+]}`))
+	source := &fileSource{resources: resources}
+	// Act
+	queried, queryErr := source.Query(0, k8sutils.KubernetesSelector{ApiVersion: "apps/v1", Kind: "Deployment"})
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Ok(t, parseErr)
+	autopilot.Ok(t, queryErr)
+	autopilot.Equals(t, 1, len(queried))
+	autopilot.Assert(t, strings.Contains(string(queried[0]), "team-a"), "expected the 'team-a' resource")
+}
+
+func Test_SummarizeNamespaces_AddsUpTheWorkloadRequests(t *testing.T) {
+	// Arrange
+	workloads := [][]byte{
+		[]byte(`{"kind": "Deployment", "metadata": {"namespace": "shop"}, "spec": {"replicas": 3, "template": {"spec": {"containers": [{"resources": {"requests": {"cpu": "500m", "memory": "256Mi"}}}]}}}}`),
+		[]byte(`{"kind": "DaemonSet", "metadata": {"namespace": "shop"}, "spec": {"template": {"spec": {"containers": [{"resources": {"requests": {"cpu": "1", "memory": "1Gi"}}}]}}}, "status": {"desiredNumberScheduled": 2}}`),
+	}
+	quotas := [][]byte{
+		[]byte(`{"metadata": {"namespace": "shop"}, "status": {"hard": {"requests.cpu": "10"}, "used": {"requests.cpu": "3500m"}}}`),
+	}
+	// Act
+	summaries := summarizeNamespaces("prod", workloads, quotas)
+	// Assert
+	autopilot.Equals(t, 1, len(summaries))
+	autopilot.Equals(t, "prod-shop", namespaceSystemAlias("prod", "shop"))
+	autopilot.Equals(t, []opslevel.TagInput{
+		{Key: "workloads", Value: "2"},
+		{Key: "cpu-requests", Value: "3500m"},
+		{Key: "memory-requests", Value: "2816Mi"},
+		{Key: "quota-requests.cpu", Value: "35%"},
+	}, summaries["shop"].tags())
+}
+
+func Test_ClusterInfra_RelatesTheServicesOfTheCluster(t *testing.T) {
+	// Arrange
+	clusterInfos["prod-eu1"] = k8sutils.ClusterInfo{Version: "v1.27.3", Provider: "aws", Region: "eu-west-1", NodeCount: 12}
+	defer delete(clusterInfos, "prod-eu1")
+	services := []ServiceRegistration{
+		{Name: "web", Cluster: "prod-eu1", Aliases: []string{"k8s:web"}},
+		{Name: "api", Cluster: "prod-us1", Aliases: []string{"k8s:api"}},
+	}
+	// Act
+	registrations := ClusterInfra(config.ClusterInfraConfig{Enabled: true}, services)
+	// Assert
+	autopilot.Equals(t, 1, len(registrations))
+	autopilot.Equals(t, []string{"k8s-cluster-prod-eu1"}, registrations[0].Aliases)
+	autopilot.Equals(t, "Compute", registrations[0].Schema)
+	autopilot.Equals(t, []string{"k8s:web"}, registrations[0].Services)
+	autopilot.Equals(t, 12, registrations[0].Data["nodeCount"])
+}
+
+func Test_CostTags_FromOpenCostAndMetricsServer(t *testing.T) {
+	// Arrange
+	allocations := []byte(`{"code": 200, "data": [{"shop/deployment/web": {"properties": {"namespace": "shop", "controllerKind": "deployment", "controller": "web"}, "minutes": 10080, "cpuCoreUsageAverage": 0.25, "ramByteUsageAverage": 536870912, "totalCost": 7}}]}`)
+	pods := [][]byte{[]byte(`{"metadata": {"name": "web-5d9c7f-x2x", "namespace": "shop", "labels": {"pod-template-hash": "5d9c7f"}, "ownerReferences": [{"kind": "ReplicaSet", "name": "web-5d9c7f", "controller": true}]}}`)}
+	metrics := []byte(`{"items": [{"metadata": {"name": "web-5d9c7f-x2x", "namespace": "shop"}, "containers": [{"usage": {"cpu": "120m", "memory": "256Mi"}}]}]}`)
+	resource := []byte(`{"kind": "Deployment", "metadata": {"name": "web", "namespace": "shop"}}`)
+	defer func() { workloadCosts = nil }()
+	// Act
+	fromOpenCost, openCostErr := parseOpenCostAllocations(allocations)
+	workloadCosts = fromOpenCost
+	openCostTags := costTags(resource)
+	fromMetrics, metricsErr := parsePodMetrics(pods, metrics)
+	workloadCosts = fromMetrics
+	metricsTags := costTags(resource)
+	// Assert
+	autopilot.Ok(t, openCostErr)
+	autopilot.Ok(t, metricsErr)
+	autopilot.Equals(t, []opslevel.TagInput{{Key: "monthly-cost", Value: "20-50"}, {Key: "cpu-usage", Value: "200m-500m"}, {Key: "memory-usage", Value: "500Mi-1000Mi"}}, openCostTags)
+	autopilot.Equals(t, []opslevel.TagInput{{Key: "cpu-usage", Value: "100m-200m"}, {Key: "memory-usage", Value: "200Mi-500Mi"}}, metricsTags)
+}
+
+func Test_FormatCostBucket(t *testing.T) {
+	// Act
+	small := formatCostBucket(0.3, "")
+	boundary := formatCostBucket(200, "m")
+	idle := formatCostBucket(0, "Mi")
+	// Assert
+	autopilot.Equals(t, "0.2-0.5", small)
+	autopilot.Equals(t, "200m-500m", boundary)
+	autopilot.Equals(t, "0Mi", idle)
+}
+
+func Test_IdleSince_AfterDaysWithoutReadyEndpoints(t *testing.T) {
+	// Arrange
+	services := [][]byte{[]byte(`{"metadata": {"namespace": "shop"}, "spec": {"selector": {"app": "web"}}}`)}
+	slices := [][]byte{[]byte(`{"endpoints": [{"conditions": {"ready": false}, "targetRef": {"kind": "Pod", "name": "web-5d9c7f-x2x", "namespace": "shop"}}]}`)}
+	pods := [][]byte{[]byte(`{"metadata": {"name": "web-5d9c7f-x2x", "namespace": "shop", "labels": {"pod-template-hash": "5d9c7f"}, "ownerReferences": [{"kind": "ReplicaSet", "name": "web-5d9c7f", "controller": true}]}}`)}
+	web := []byte(`{"kind": "Deployment", "metadata": {"name": "web", "namespace": "shop"}, "spec": {"template": {"metadata": {"labels": {"app": "web"}}}}}`)
+	worker := []byte(`{"kind": "Deployment", "metadata": {"name": "worker", "namespace": "shop"}, "spec": {"template": {"metadata": {"labels": {"app": "worker"}}}}}`)
+	start := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	idleEndpoints = summarizeEndpoints(services, slices, pods)
+	idleSettings = config.IdleConfig{Enabled: true, Days: 7}
+	idleState = map[string]time.Time{}
+	defer func() { idleEndpoints = nil }()
+	// Act
+	_, firstRun := idleSince(web, start)
+	since, weekLater := idleSince(web, start.Add(7*24*time.Hour))
+	_, workerIdle := idleSince(worker, start.Add(7*24*time.Hour))
+	// Assert
+	autopilot.Equals(t, false, firstRun)
+	autopilot.Equals(t, true, weekLater)
+	autopilot.Equals(t, start, since)
+	autopilot.Equals(t, false, workerIdle)
+}
+
+func Test_ImageRepositories_FromTheFirstMatchingRule(t *testing.T) {
+	// Arrange
+	rulesErr := SetImageRepositoryRules([]config.ImageRepositoryRule{
+		{Image: `^ghcr\.io/acme/([^/]+)/(.+)$`, Repository: "github.com:acme/$1", Directory: "services/$2"},
+		{Image: `^[0-9]+\.dkr\.ecr\.[a-z0-9-]+\.amazonaws\.com/(.+)$`, Repository: "github.com:acme/$1"},
+		{Image: `.*`, Repository: "github.com:acme/monorepo"},
+	})
+	defer SetImageRepositoryRules(nil)
+	resource := []byte(`{"kind": "Deployment", "spec": {"template": {"spec": {
+		"initContainers": [{"image": "123456789012.dkr.ecr.us-east-1.amazonaws.com/migrations@sha256:abc"}],
+		"containers": [{"image": "ghcr.io/acme/shop/web:1.2.3"}, {"image": "localhost:5000/sidecar"}]
+	}}}}`)
+	// Act
+	repositories := imageRepositories(resource)
+	// Assert
+	autopilot.Ok(t, rulesErr)
+	autopilot.Equals(t, 3, len(repositories))
+	autopilot.Equals(t, "github.com:acme/migrations", string(repositories[0].Repository.Alias))
+	autopilot.Equals(t, "github.com:acme/shop", string(repositories[1].Repository.Alias))
+	autopilot.Equals(t, "services/web", repositories[1].BaseDirectory)
+	autopilot.Equals(t, "github.com:acme/monorepo", string(repositories[2].Repository.Alias))
+}
+
+func Test_GitOpsRepositories_FromArgoCDAndFlux(t *testing.T) {
+	// Arrange
+	applications := [][]byte{[]byte(`{"metadata": {"name": "web", "namespace": "argocd"}, "spec": {"source": {"repoURL": "https://github.com/acme/deploy.git", "path": "./apps/web/"}}}`)}
+	kustomizations := [][]byte{[]byte(`{"kind": "Kustomization", "metadata": {"name": "api", "namespace": "flux-system"}, "spec": {"path": "./clusters/prod/api", "sourceRef": {"kind": "GitRepository", "name": "platform"}}}`)}
+	gitRepositories := [][]byte{[]byte(`{"metadata": {"name": "platform", "namespace": "flux-system"}, "spec": {"url": "ssh://git@gitlab.com/acme/platform"}}`)}
+	web := []byte(`{"metadata": {"name": "web", "namespace": "shop", "annotations": {"argocd.argoproj.io/tracking-id": "web:apps/Deployment:shop/web"}}}`)
+	api := []byte(`{"metadata": {"name": "api", "namespace": "shop", "labels": {"kustomize.toolkit.fluxcd.io/name": "api", "kustomize.toolkit.fluxcd.io/namespace": "flux-system"}}}`)
+	gitOpsSources = indexGitOpsSources(applications, kustomizations, nil, gitRepositories)
+	defer func() { gitOpsSources = nil }()
+	// Act
+	webRepositories := gitOpsRepositories(web)
+	apiRepositories := gitOpsRepositories(api)
+	// Assert
+	autopilot.Equals(t, "github.com:acme/deploy", gitRepositoryAlias("git@github.com:acme/deploy.git"))
+	autopilot.Equals(t, 1, len(webRepositories))
+	autopilot.Equals(t, "github.com:acme/deploy", string(webRepositories[0].Repository.Alias))
+	autopilot.Equals(t, "apps/web", webRepositories[0].BaseDirectory)
+	autopilot.Equals(t, 1, len(apiRepositories))
+	autopilot.Equals(t, "gitlab.com:acme/platform", string(apiRepositories[0].Repository.Alias))
+	autopilot.Equals(t, "clusters/prod/api", apiRepositories[0].BaseDirectory)
+}
+
+func Test_WithRecommendedLabelDefaults_OnlyFillsEmptyFields(t *testing.T) {
+	// Arrange
+	c := config.ServiceRegistrationConfig{Name: ".metadata.name"}
+	// Act
+	defaulted := withRecommendedLabelDefaults(c)
+	c.DisableRecommendedLabels = true
+	disabled := withRecommendedLabelDefaults(c)
+	// Assert
+	autopilot.Equals(t, ".metadata.name", defaulted.Name)
+	autopilot.Equals(t, `.metadata.labels."app.kubernetes.io/part-of"`, defaulted.System)
+	autopilot.Equals(t, `.metadata.labels."app.kubernetes.io/managed-by"`, defaulted.Framework)
+	autopilot.Equals(t, 1, len(defaulted.Tags.Assign))
+	autopilot.Equals(t, "", disabled.System)
+	autopilot.Equals(t, 0, len(disabled.Tags.Assign))
+}
+
+func Test_SummarizeHealth_ReadinessRestartsAndRollout(t *testing.T) {
+	// Arrange
+	workloads := [][]byte{
+		[]byte(`{"kind": "Deployment", "metadata": {"name": "web", "namespace": "shop", "generation": 4}, "spec": {"replicas": 3}, "status": {"observedGeneration": 4, "replicas": 3, "readyReplicas": 2, "updatedReplicas": 3, "availableReplicas": 2}}`),
+		[]byte(`{"kind": "DaemonSet", "metadata": {"name": "agent", "namespace": "shop", "generation": 1}, "status": {"observedGeneration": 1, "desiredNumberScheduled": 2, "numberReady": 2, "updatedNumberScheduled": 2, "numberAvailable": 2}}`),
+		[]byte(`{"kind": "Deployment", "metadata": {"name": "api", "namespace": "shop", "generation": 2}, "status": {"observedGeneration": 2, "conditions": [{"type": "Progressing", "status": "False", "reason": "ProgressDeadlineExceeded"}]}}`),
+	}
+	pods := [][]byte{
+		[]byte(`{"metadata": {"name": "web-5d9c7f-a", "namespace": "shop", "labels": {"pod-template-hash": "5d9c7f"}, "ownerReferences": [{"kind": "ReplicaSet", "name": "web-5d9c7f", "controller": true}]}, "status": {"containerStatuses": [{"restartCount": 3}, {"restartCount": 1}]}}`),
+		[]byte(`{"metadata": {"name": "web-5d9c7f-b", "namespace": "shop", "labels": {"pod-template-hash": "5d9c7f"}, "ownerReferences": [{"kind": "ReplicaSet", "name": "web-5d9c7f", "controller": true}]}, "status": {"containerStatuses": [{"restartCount": 2}]}}`),
+	}
+	// Act
+	health := summarizeHealth(workloads, pods)
+	// Assert
+	autopilot.Equals(t, map[string]interface{}{
+		"desired_replicas":   int64(3),
+		"ready_replicas":     int64(2),
+		"all_replicas_ready": false,
+		"restart_count":      int64(6),
+		"rollout_status":     "progressing",
+	}, health["shop/deployment/web"])
+	autopilot.Equals(t, true, health["shop/daemonset/agent"]["all_replicas_ready"])
+	autopilot.Equals(t, "complete", health["shop/daemonset/agent"]["rollout_status"])
+	autopilot.Equals(t, "failed", health["shop/deployment/api"]["rollout_status"])
+}
+
+func Test_PlaceInImportedSystems_NestsNamespaceServices(t *testing.T) {
+	// Arrange
+	rememberImportedSystems([]SystemRegistration{{Alias: "prod-shop", Name: "shop", Cluster: "prod", Namespace: "shop"}})
+	services := []ServiceRegistration{
+		{Name: "web", Cluster: "prod", Namespace: "shop"},
+		{Name: "api", Cluster: "prod", Namespace: "shop", System: "storefront"},
+		{Name: "db", Cluster: "prod", Namespace: "data"},
+	}
+	// Act
+	placeInImportedSystems(services)
+	// Assert
+	autopilot.Equals(t, "prod-shop", services[0].System)
+	autopilot.Equals(t, "storefront", services[1].System)
+	autopilot.Equals(t, "", services[2].System)
+	autopilot.Equals(t, "shop", resourceName([]byte(`{"kind": "Namespace", "metadata": {"name": "shop"}}`)))
+}
+
+func Test_SortServices_IsDeterministic(t *testing.T) {
+	// Arrange
+	services := []ServiceRegistration{
+		{Name: "web", Aliases: []string{"k8s:web", "b-web"}, TagAssigns: []opslevel.TagInput{{Key: "team", Value: "shop"}, {Key: "env", Value: "prod"}}},
+		{Name: "api", Aliases: []string{"a-api"}},
+	}
+	before := []ServiceRegistration{{Name: "api", Aliases: []string{"a-api"}}, {Name: "web", Aliases: []string{"b-web", "k8s:web"}, TagAssigns: []opslevel.TagInput{{Key: "env", Value: "prod"}, {Key: "team", Value: "shop"}}}}
+	// Act
+	sorted := SortServices(services)
+	diff := DiffSnapshots(before, services)
+	// Assert
+	autopilot.Equals(t, "api", sorted[0].Name)
+	autopilot.Equals(t, []string{"b-web", "k8s:web"}, sorted[1].Aliases)
+	autopilot.Equals(t, "env", sorted[1].TagAssigns[0].Key)
+	autopilot.Equals(t, "k8s:web", services[0].Aliases[0])
+	autopilot.Equals(t, true, diff.IsEmpty())
+}
+
+func Test_DeclareDependencies_KeepsEdgesOfUnselectedServices(t *testing.T) {
+	// Arrange
+	services := []ServiceRegistration{
+		{Name: "web", Aliases: []string{"web"}, Dependencies: []string{"api"}},
+		{Name: "api", Aliases: []string{"api"}, Dependents: []string{"worker"}},
+	}
+	// Act
+	DeclareDependencies(services)
+	// Assert
+	autopilot.Equals(t, true, isDependencyDeclared([]string{"web"}, []string{"api"}))
+	autopilot.Equals(t, true, isDependencyDeclared([]string{"worker"}, []string{"api"}))
+	autopilot.Equals(t, false, isDependencyDeclared([]string{"api"}, []string{"web"}))
+}
+
+func Test_DeployTracker_ReportsOnlyVersionChanges(t *testing.T) {
+	// Arrange
+	tracker := NewDeployTracker()
+	first := ServiceRegistration{Name: "web", Aliases: []string{"web"}, DeployVersion: "v1"}
+	same := ServiceRegistration{Name: "web", Aliases: []string{"web"}, DeployVersion: "v1"}
+	next := ServiceRegistration{Name: "web", Aliases: []string{"web"}, DeployVersion: "v2"}
+	empty := ServiceRegistration{Name: "web", Aliases: []string{"web"}}
+	// Act
+	result1 := tracker.Changed(first)
+	result2 := tracker.Changed(same)
+	result3 := tracker.Changed(next)
+	result4 := tracker.Changed(empty)
+	// Assert
+	autopilot.Equals(t, false, result1)
+	autopilot.Equals(t, false, result2)
+	autopilot.Equals(t, true, result3)
+	autopilot.Equals(t, false, result4)
+}
@@ -0,0 +1,59 @@
+package common
+
+import (
+	"strings"
+
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/shurcooL/graphql"
+)
+
+func getServiceType(client *opslevel.Client, id graphql.ID) (string, error) {
+	var q struct {
+		Account struct {
+			Service struct {
+				Type *struct {
+					Alias string
+				}
+			} `graphql:"service(id: $service)"`
+		}
+	}
+	v := opslevel.PayloadVariables{
+		"service": id,
+	}
+	if err := client.Query(&q, v); err != nil {
+		return "", err
+	}
+	if q.Account.Service.Type == nil {
+		return "", nil
+	}
+	return q.Account.Service.Type.Alias, nil
+}
+
+// handleType assigns the component type - IE: backend, frontend, worker or library - by alias
+func handleType(client *opslevel.Client, registration ServiceRegistration, service *opslevel.Service, result *ServiceResult) {
+	alias := strings.ToLower(strings.TrimSpace(registration.Type))
+	if alias == "" {
+		return
+	}
+	if service.Id != nil {
+		current, err := getServiceType(client, service.Id)
+		if err != nil {
+			result.failed(err, "Failed looking up the type of the service")
+			return
+		}
+		if current == alias {
+			return
+		}
+	}
+	if result.dryRun("set the type to '%s'", alias) {
+		return
+	}
+	input := ServiceUpdateInput{Id: service.Id, Type: &opslevel.IdentifierInput{Alias: graphql.String(alias)}}
+	err := sendServiceUpdate(client, input)
+	audit(registration.Name, registration.Aliases, "serviceUpdate", input, err)
+	if err != nil {
+		result.failed(err, "Failed setting the type to '%s'", alias)
+	} else {
+		result.changed("Set the type to '%s'", alias)
+	}
+}
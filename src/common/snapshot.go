@@ -0,0 +1,212 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/opslevel/opslevel-go/v2022"
+)
+
+// SnapshotFieldChange is a single field of a service registration that differs between snapshots
+type SnapshotFieldChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// SnapshotServiceChange is a service registration present in both snapshots with different data
+type SnapshotServiceChange struct {
+	Key    string                `json:"key"`
+	Fields []SnapshotFieldChange `json:"fields"`
+}
+
+// SnapshotDiff describes how the emitted service registrations changed between two snapshots
+type SnapshotDiff struct {
+	Added   []ServiceRegistration   `json:"added"`
+	Removed []ServiceRegistration   `json:"removed"`
+	Changed []SnapshotServiceChange `json:"changed"`
+}
+
+// IsEmpty returns true when both snapshots contain the same service registrations
+func (d SnapshotDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Sorted returns a copy of the registration with its lists sorted so the output of consecutive runs is diffable -
+// only the printed registrations are sorted because reconciliation relies on the order of the aliases
+func (s ServiceRegistration) Sorted() ServiceRegistration {
+	s.Aliases = sortedStrings(s.Aliases)
+	s.APIDocs = sortedStrings(s.APIDocs)
+	s.Dependencies = sortedStrings(s.Dependencies)
+	s.Dependents = sortedStrings(s.Dependents)
+	s.TagAssigns = sortedTags(s.TagAssigns)
+	s.TagCreates = sortedTags(s.TagCreates)
+	if s.Tools != nil {
+		s.Tools = append([]opslevel.ToolCreateInput{}, s.Tools...)
+		sort.SliceStable(s.Tools, func(i, j int) bool {
+			a, b := s.Tools[i], s.Tools[j]
+			return formatTool(string(a.Category), a.Environment, a.DisplayName, a.Url) < formatTool(string(b.Category), b.Environment, b.DisplayName, b.Url)
+		})
+	}
+	if s.Repositories != nil {
+		s.Repositories = append([]opslevel.ServiceRepositoryCreateInput{}, s.Repositories...)
+		sort.SliceStable(s.Repositories, func(i, j int) bool {
+			a, b := s.Repositories[i], s.Repositories[j]
+			return formatRepository(string(a.Repository.Alias), a.BaseDirectory) < formatRepository(string(b.Repository.Alias), b.BaseDirectory)
+		})
+	}
+	return s
+}
+
+func sortedStrings(data []string) []string {
+	if data == nil {
+		return nil
+	}
+	output := append([]string{}, data...)
+	sort.Strings(output)
+	return output
+}
+
+func sortedTags(data []opslevel.TagInput) []opslevel.TagInput {
+	if data == nil {
+		return nil
+	}
+	output := append([]opslevel.TagInput{}, data...)
+	sort.SliceStable(output, func(i, j int) bool {
+		return formatTag(output[i].Key, output[i].Value) < formatTag(output[j].Key, output[j].Value)
+	})
+	return output
+}
+
+// SortServices returns the sorted registrations ordered by their key then account, cluster and namespace
+func SortServices(services []ServiceRegistration) []ServiceRegistration {
+	output := make([]ServiceRegistration, len(services))
+	for i, service := range services {
+		output[i] = service.Sorted()
+	}
+	sort.SliceStable(output, func(i, j int) bool {
+		a, b := output[i], output[j]
+		if a.Key() != b.Key() {
+			return a.Key() < b.Key()
+		}
+		if a.Account != b.Account {
+			return a.Account < b.Account
+		}
+		if a.Cluster != b.Cluster {
+			return a.Cluster < b.Cluster
+		}
+		return a.Namespace < b.Namespace
+	})
+	return output
+}
+
+// WriteSnapshot stores the service registrations as json so a later run can be diffed against them
+func WriteSnapshot(path string, services []ServiceRegistration) error {
+	if services == nil {
+		services = []ServiceRegistration{}
+	}
+	data, err := json.MarshalIndent(SortServices(services), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("unable to write snapshot '%s': %v", path, err)
+	}
+	return nil
+}
+
+// ReadSnapshot loads the service registrations written by WriteSnapshot
+func ReadSnapshot(path string) ([]ServiceRegistration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read snapshot '%s': %v", path, err)
+	}
+	var services []ServiceRegistration
+	if err := json.Unmarshal(data, &services); err != nil {
+		return nil, fmt.Errorf("unable to parse snapshot '%s': %v", path, err)
+	}
+	return services, nil
+}
+
+// Key identifies a service registration across runs by its first alias, falling back to its name
+func (s *ServiceRegistration) Key() string {
+	if len(s.Aliases) > 0 {
+		aliases := append([]string{}, s.Aliases...)
+		sort.Strings(aliases)
+		return aliases[0]
+	}
+	return s.Name
+}
+
+// DiffSnapshots compares two sets of service registrations keyed by alias
+func DiffSnapshots(before []ServiceRegistration, after []ServiceRegistration) SnapshotDiff {
+	diff := SnapshotDiff{
+		Added:   []ServiceRegistration{},
+		Removed: []ServiceRegistration{},
+		Changed: []SnapshotServiceChange{},
+	}
+	previous := map[string]ServiceRegistration{}
+	for _, service := range before {
+		previous[service.Key()] = service
+	}
+	current := map[string]bool{}
+	for _, service := range after {
+		key := service.Key()
+		current[key] = true
+		old, ok := previous[key]
+		if !ok {
+			diff.Added = append(diff.Added, service)
+			continue
+		}
+		if fields := diffServiceFields(old, service); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, SnapshotServiceChange{Key: key, Fields: fields})
+		}
+	}
+	for _, service := range before {
+		if !current[service.Key()] {
+			diff.Removed = append(diff.Removed, service)
+		}
+	}
+	sort.SliceStable(diff.Added, func(i, j int) bool { return diff.Added[i].Key() < diff.Added[j].Key() })
+	sort.SliceStable(diff.Removed, func(i, j int) bool { return diff.Removed[i].Key() < diff.Removed[j].Key() })
+	sort.SliceStable(diff.Changed, func(i, j int) bool { return diff.Changed[i].Key < diff.Changed[j].Key })
+	return diff
+}
+
+func diffServiceFields(before ServiceRegistration, after ServiceRegistration) []SnapshotFieldChange {
+	oldFields := serviceFields(before)
+	newFields := serviceFields(after)
+	keys := map[string]bool{}
+	for key := range oldFields {
+		keys[key] = true
+	}
+	for key := range newFields {
+		keys[key] = true
+	}
+	var sortedKeys []string
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	var output []SnapshotFieldChange
+	for _, key := range sortedKeys {
+		if oldFields[key] != newFields[key] {
+			output = append(output, SnapshotFieldChange{Field: key, Before: oldFields[key], After: newFields[key]})
+		}
+	}
+	return output
+}
+
+func serviceFields(service ServiceRegistration) map[string]string {
+	output := map[string]string{}
+	data, _ := json.Marshal(service.Sorted())
+	var fields map[string]json.RawMessage
+	_ = json.Unmarshal(data, &fields)
+	for key, value := range fields {
+		output[key] = string(value)
+	}
+	return output
+}
@@ -0,0 +1,34 @@
+package common
+
+type ServiceStatus string
+
+const (
+	ServiceStatus_Queued       ServiceStatus = "queued"
+	ServiceStatus_LookingUp    ServiceStatus = "looking up"
+	ServiceStatus_Creating     ServiceStatus = "creating"
+	ServiceStatus_Updating     ServiceStatus = "updating"
+	ServiceStatus_UpdatingTags ServiceStatus = "updating tags"
+	ServiceStatus_Done         ServiceStatus = "done"
+	ServiceStatus_Failed       ServiceStatus = "failed"
+)
+
+// OnServiceStatus is called as ReconcileService moves a service through each step (IE: to drive a progress display)
+// with the Key of the registration - names are not unique across namespaces - and its name.
+// It is called concurrently from every worker so it must be safe for concurrent use
+var OnServiceStatus func(key string, name string, status ServiceStatus)
+
+func reportStatus(service ServiceRegistration, status ServiceStatus) {
+	if OnServiceStatus != nil {
+		OnServiceStatus(service.Key(), service.Name, status)
+	}
+}
+
+// OnResourcesParsed is called after the resources of each import selector have been parsed into registrations with
+// the running count of parsed resources out of the resources of every selector
+var OnResourcesParsed func(done int, total int)
+
+func reportResourcesParsed(done int, total int) {
+	if OnResourcesParsed != nil {
+		OnResourcesParsed(done, total)
+	}
+}
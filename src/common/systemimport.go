@@ -0,0 +1,208 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/rs/zerolog/log"
+	"github.com/shurcooL/graphql"
+
+	"github.com/opslevel/kubectl-opslevel/config"
+	"github.com/opslevel/kubectl-opslevel/jq"
+)
+
+const (
+	defaultSystemNameExpression        = `.metadata.name`
+	defaultSystemDescriptionExpression = `.metadata.annotations."opslevel.com/description"`
+	defaultSystemOwnerExpression       = `.metadata.annotations."opslevel.com/owner"`
+)
+
+// SystemRegistration is a system parsed from a Namespace by 'systems.import'
+type SystemRegistration struct {
+	Account     string `json:",omitempty"`
+	Alias       string
+	Name        string
+	Description string `json:",omitempty"`
+	Owner       string `json:",omitempty"`
+	Cluster     string `json:",omitempty"`
+	Namespace   string
+}
+
+var (
+	importedSystemsMutex sync.Mutex
+	// importedSystems are the systems parsed from the Namespaces of this run keyed by '<cluster>/<namespace>'
+	importedSystems = map[string]SystemRegistration{}
+)
+
+// ProcessSystemResources evaluates the JQ expressions of a system import against the Namespaces
+func ProcessSystemResources(field string, c config.SystemImport, resources [][]byte) []SystemRegistration {
+	filtered := FilterResources(c.SelectorConfig, resources)
+	count := len(filtered)
+	if count < 1 {
+		return []SystemRegistration{}
+	}
+	joined := joinResourceBytes(filtered)
+	opslevelConfig := c.OpslevelConfig
+	Aliases := parseField(fmt.Sprintf("%s.alias", field), opslevelConfig.Alias, joined)
+	Names := parseField(fmt.Sprintf("%s.name", field), orDefault(opslevelConfig.Name, defaultSystemNameExpression), joined)
+	Descriptions := parseField(fmt.Sprintf("%s.description", field), orDefault(opslevelConfig.Description, defaultSystemDescriptionExpression), joined)
+	Owners := parseField(fmt.Sprintf("%s.owner", field), orDefault(opslevelConfig.Owner, defaultSystemOwnerExpression), joined)
+
+	cluster := jq.GetArg("cluster")
+	var output []SystemRegistration
+	for i := 0; i < count; i++ {
+		namespace := resourceName(filtered[i])
+		registration := SystemRegistration{
+			Account:     c.Account,
+			Alias:       orDefault(getString(i, Aliases), namespaceSystemAlias(cluster, namespace)),
+			Name:        orDefault(getString(i, Names), namespace),
+			Description: getString(i, Descriptions),
+			Owner:       getString(i, Owners),
+			Cluster:     cluster,
+			Namespace:   namespace,
+		}
+		if registration.Namespace == "" {
+			continue
+		}
+		output = append(output, registration)
+	}
+	return output
+}
+
+func rememberImportedSystems(systems []SystemRegistration) {
+	importedSystemsMutex.Lock()
+	defer importedSystemsMutex.Unlock()
+	for _, system := range systems {
+		importedSystems[system.Cluster+"/"+system.Namespace] = system
+	}
+}
+
+// placeInImportedSystems puts the registrations without a system into the system imported from their namespace
+func placeInImportedSystems(services []ServiceRegistration) {
+	importedSystemsMutex.Lock()
+	defer importedSystemsMutex.Unlock()
+	for i, service := range services {
+		if service.System != "" || service.Namespace == "" {
+			continue
+		}
+		if system, ok := importedSystems[service.Cluster+"/"+service.Namespace]; ok {
+			services[i].System = system.Alias
+		}
+	}
+}
+
+// SyncImportedSystems creates or updates the systems imported from Namespaces in their account and the accounts of
+// the services placed in them - it has to run before the services are reconciled so they find their system
+func SyncImportedSystems(clients map[string]*opslevel.Client, services []ServiceRegistration) {
+	importedSystemsMutex.Lock()
+	defer importedSystemsMutex.Unlock()
+	var keys []string
+	for key := range importedSystems {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		system := importedSystems[key]
+		accounts := map[string]bool{system.Account: true}
+		for _, service := range services {
+			if service.System == system.Alias {
+				accounts[service.Account] = true
+			}
+		}
+		for account := range accounts {
+			client, ok := clients[account]
+			if !ok {
+				continue
+			}
+			if err := syncImportedSystem(client, account, system); err != nil {
+				log.Error().Msgf("[%s] Failed syncing system imported from namespace '%s'\n\tREASON: %v", system.Alias, system.Namespace, err)
+			}
+		}
+	}
+}
+
+type systemDetails struct {
+	Id          graphql.ID
+	Name        string
+	Description string
+	Aliases     []string
+	Owner       struct {
+		Team struct {
+			Id graphql.ID
+		} `graphql:"... on Team"`
+	}
+}
+
+func getSystemDetails(client *opslevel.Client, alias string) (*systemDetails, error) {
+	var q struct {
+		Account struct {
+			System systemDetails `graphql:"system(input: $input)"`
+		}
+	}
+	v := opslevel.PayloadVariables{
+		"input": opslevel.IdentifierInput{Alias: graphql.String(alias)},
+	}
+	if err := client.Query(&q, v); err != nil {
+		return nil, err
+	}
+	return &q.Account.System, nil
+}
+
+func updateSystem(client *opslevel.Client, id graphql.ID, input SystemInput) error {
+	var m struct {
+		Payload struct {
+			Errors []opslevel.OpsLevelErrors
+		} `graphql:"systemUpdate(system: $system, input: $input)"`
+	}
+	v := opslevel.PayloadVariables{
+		"system": opslevel.IdentifierInput{Id: id},
+		"input":  input,
+	}
+	if err := client.Mutate(&m, v); err != nil {
+		return err
+	}
+	return opslevel.FormatErrors(m.Payload.Errors)
+}
+
+func syncImportedSystem(client *opslevel.Client, account string, system SystemRegistration) error {
+	alias := system.Alias
+	input := SystemInput{Name: system.Name, Description: system.Description}
+	if system.Owner != "" {
+		if team, _ := findTeam(client, account, system.Owner); team != nil {
+			input.OwnerId = team.Id
+		} else {
+			log.Warn().Msgf("[%s] Unable to find 'Team' with alias '%s' to own the system", alias, system.Owner)
+		}
+	}
+	existing, err := getSystemDetails(client, alias)
+	if err != nil {
+		return err
+	}
+	if existing.Id == nil {
+		if isDryRun(alias, "create system with input %+v", input) {
+			return nil
+		}
+		_, aliasErr, err := createSystemWithAlias(client, alias, []string{alias}, alias, input)
+		if err != nil {
+			return err
+		}
+		log.Info().Msgf("[%s] Created system from namespace '%s'", alias, system.Namespace)
+		return aliasErr
+	}
+	if existing.Name == input.Name && existing.Description == input.Description && (input.OwnerId == nil || existing.Owner.Team.Id == input.OwnerId) {
+		log.Debug().Msgf("[%s] System imported from namespace '%s' is up to date", alias, system.Namespace)
+		return nil
+	}
+	if isDryRun(alias, "update system with input %+v", input) {
+		return nil
+	}
+	err = updateSystem(client, existing.Id, input)
+	audit(alias, []string{alias}, "systemUpdate", input, err)
+	if err != nil {
+		return err
+	}
+	log.Info().Msgf("[%s] Updated system from namespace '%s'", alias, system.Namespace)
+	return nil
+}
@@ -0,0 +1,259 @@
+package common
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/opslevel/kubectl-opslevel/config"
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/shurcooL/graphql"
+)
+
+var (
+	systemsConfigMutex sync.Mutex
+	systemsConfig      config.SystemsConfig
+)
+
+// SetSystems configures how the system of a registration is resolved and whether missing systems are created
+func SetSystems(systems config.SystemsConfig) {
+	systemsConfigMutex.Lock()
+	defer systemsConfigMutex.Unlock()
+	systemsConfig = systems
+}
+
+func getSystemsConfig() config.SystemsConfig {
+	systemsConfigMutex.Lock()
+	defer systemsConfigMutex.Unlock()
+	return systemsConfig
+}
+
+// SystemInput is named after the GraphQL input type of the 'systemCreate' mutation
+type SystemInput struct {
+	Name        string                    `json:"name,omitempty"`
+	Description string                    `json:"description,omitempty"`
+	OwnerId     graphql.ID                `json:"ownerId,omitempty"`
+	Parent      *opslevel.IdentifierInput `json:"parent,omitempty"`
+}
+
+// ServiceUpdateInput is named after the GraphQL input type of the 'serviceUpdate' mutation
+// opslevel-go's version of it does not support the service's parent system or component type
+type ServiceUpdateInput struct {
+	Id     graphql.ID                `json:"id"`
+	Parent *opslevel.IdentifierInput `json:"parent,omitempty"`
+	Type   *opslevel.IdentifierInput `json:"type,omitempty"` // The component type IE: backend, frontend, worker or library
+}
+
+type systemNode struct {
+	Id      graphql.ID
+	Name    string
+	Aliases []string
+}
+
+func getSystemWithAlias(client *opslevel.Client, alias string) (*systemNode, error) {
+	var q struct {
+		Account struct {
+			System systemNode `graphql:"system(input: $input)"`
+		}
+	}
+	v := opslevel.PayloadVariables{
+		"input": opslevel.IdentifierInput{Alias: graphql.String(alias)},
+	}
+	if err := client.Query(&q, v); err != nil {
+		return nil, err
+	}
+	return &q.Account.System, nil
+}
+
+func createSystem(client *opslevel.Client, input SystemInput) (*systemNode, error) {
+	var m struct {
+		Payload struct {
+			System systemNode
+			Errors []opslevel.OpsLevelErrors
+		} `graphql:"systemCreate(input: $input)"`
+	}
+	v := opslevel.PayloadVariables{
+		"input": input,
+	}
+	if err := client.Mutate(&m, v); err != nil {
+		return nil, err
+	}
+	return &m.Payload.System, opslevel.FormatErrors(m.Payload.Errors)
+}
+
+func getServiceParent(client *opslevel.Client, id graphql.ID) (*systemNode, error) {
+	var q struct {
+		Account struct {
+			Service struct {
+				Parent *systemNode
+			} `graphql:"service(id: $service)"`
+		}
+	}
+	v := opslevel.PayloadVariables{
+		"service": id,
+	}
+	if err := client.Query(&q, v); err != nil {
+		return nil, err
+	}
+	return q.Account.Service.Parent, nil
+}
+
+func sendServiceUpdate(client *opslevel.Client, input ServiceUpdateInput) error {
+	var m struct {
+		Payload struct {
+			Errors []opslevel.OpsLevelErrors
+		} `graphql:"serviceUpdate(input: $input)"`
+	}
+	v := opslevel.PayloadVariables{
+		"input": input,
+	}
+	if err := client.Mutate(&m, v); err != nil {
+		return err
+	}
+	return opslevel.FormatErrors(m.Payload.Errors)
+}
+
+// ensureSystem returns the id of the system with the alias creating it inside the domain when 'systems.autoCreate' is set.
+// The id is nil when the system does not exist (or would be created in a dry run).
+func ensureSystem(client *opslevel.Client, registration ServiceRegistration, alias string, domainId graphql.ID, result *ServiceResult) (graphql.ID, error) {
+	systems := getSystemsConfig()
+	definition := systems.Get(alias)
+	lookup := func() (graphql.ID, error) {
+		system, err := getSystemWithAlias(client, alias)
+		if err != nil {
+			return nil, err
+		}
+		return system.Id, nil
+	}
+	prepare := func(ownerId graphql.ID) (interface{}, func() (graphql.ID, []string, error)) {
+		input := SystemInput{
+			Name:        orDefault(definition.Name, alias),
+			Description: definition.Description,
+			OwnerId:     ownerId,
+		}
+		if domainId != nil {
+			input.Parent = &opslevel.IdentifierInput{Id: domainId}
+		}
+		return input, func() (graphql.ID, []string, error) {
+			created, err := createSystem(client, input)
+			if err != nil {
+				return nil, nil, err
+			}
+			return created.Id, created.Aliases, nil
+		}
+	}
+	return ensureAliased(client, registration, "system", alias, systems.AutoCreate, definition.Owner, lookup, prepare, result)
+}
+
+// ensureAliased returns the id of the domain or system with the alias through the alias cache creating it when
+// autoCreate is set. prepare returns the create input owned by the team with the 'owner' alias and the mutation
+// sending it. The id is nil when it does not exist (or would be created in a dry run).
+func ensureAliased(client *opslevel.Client, registration ServiceRegistration, kind string, alias string, autoCreate bool, owner string,
+	lookup func() (graphql.ID, error), prepare func(ownerId graphql.ID) (interface{}, func() (graphql.ID, []string, error)), result *ServiceResult) (graphql.ID, error) {
+	return GetOrCreateAliasCache(registration.Account).Resolve(kind, alias, func() (graphql.ID, error) {
+		id, err := lookup()
+		if err != nil || id != nil {
+			return id, err
+		}
+		if !autoCreate {
+			return nil, nil
+		}
+		var ownerId graphql.ID
+		if owner != "" {
+			if team, _ := findTeam(client, registration.Account, owner); team != nil {
+				ownerId = team.Id
+			} else {
+				result.warned("Unable to find 'Team' with alias '%s' to own %s '%s'", owner, kind, alias)
+			}
+		}
+		input, create := prepare(ownerId)
+		if result.dryRun("create %s '%s' with input %+v", kind, alias, input) {
+			return nil, nil
+		}
+		id, aliases, err := create()
+		audit(registration.Name, registration.Aliases, kind+"Create", input, err)
+		if err != nil {
+			return nil, err
+		}
+		result.changed("Created %s '%s'", kind, alias)
+		if err := addCreatedAlias(client, registration.Name, registration.Aliases, alias, id, aliases); err != nil {
+			result.failed(err, "Failed assigning alias '%s' to %s", alias, kind)
+		}
+		return id, nil
+	})
+}
+
+// createSystemWithAlias creates the system and adds the alias it is looked up by. The alias error is returned apart so
+// the caller can still use the created system.
+func createSystemWithAlias(client *opslevel.Client, name string, aliases []string, alias string, input SystemInput) (*systemNode, error, error) {
+	created, err := createSystem(client, input)
+	audit(name, aliases, "systemCreate", input, err)
+	if err != nil {
+		return nil, nil, err
+	}
+	return created, addCreatedAlias(client, name, aliases, alias, created.Id, created.Aliases), nil
+}
+
+// addCreatedAlias adds the alias to a created domain or system - they only get an alias generated from their name so
+// the configured alias has to be added for the next lookup
+func addCreatedAlias(client *opslevel.Client, name string, aliases []string, alias string, id graphql.ID, existing []string) error {
+	if aliasOverlaps([]string{alias}, existing) {
+		return nil
+	}
+	aliasInput := opslevel.AliasCreateInput{Alias: alias, OwnerId: id}
+	_, err := client.CreateAlias(aliasInput)
+	audit(name, aliases, "aliasCreate", aliasInput, err)
+	return err
+}
+
+func handleSystem(client *opslevel.Client, registration ServiceRegistration, service *opslevel.Service, result *ServiceResult) {
+	alias := registration.System
+	if alias == "" {
+		return
+	}
+	var domainId graphql.ID
+	if registration.Domain != "" {
+		var err error
+		if domainId, err = ensureDomain(client, registration, registration.Domain, result); err != nil {
+			result.failed(err, "Failed looking up domain '%s'", registration.Domain)
+		} else if domainId == nil && !DryRun {
+			result.warned("Unable to find 'Domain' with alias '%s' - set 'domains.autoCreate' to create it", registration.Domain)
+		}
+	}
+	systemId, err := ensureSystem(client, registration, alias, domainId, result)
+	if err != nil {
+		result.failed(err, "Failed looking up system '%s'", alias)
+		return
+	}
+	if systemId == nil {
+		if !DryRun {
+			result.warned("Unable to find 'System' with alias '%s' - set 'systems.autoCreate' to create it", alias)
+		}
+		return
+	}
+	if domainId != nil {
+		if err := ensureSystemDomain(client, registration, systemId, domainId, result); err != nil {
+			result.failed(err, "Failed assigning system '%s' to domain '%s'", alias, registration.Domain)
+		}
+	}
+	if service.Id != nil {
+		parent, err := getServiceParent(client, service.Id)
+		if err != nil {
+			result.failed(err, "Failed looking up the system of the service")
+			return
+		}
+		if parent != nil && fmt.Sprint(parent.Id) == fmt.Sprint(systemId) {
+			return
+		}
+	}
+	if result.dryRun("assign service to system '%s'", alias) {
+		return
+	}
+	input := ServiceUpdateInput{Id: service.Id, Parent: &opslevel.IdentifierInput{Id: systemId}}
+	err = sendServiceUpdate(client, input)
+	audit(registration.Name, registration.Aliases, "serviceUpdate", input, err)
+	if err != nil {
+		result.failed(err, "Failed assigning service to system '%s'", alias)
+	} else {
+		result.changed("Assigned service to system '%s'", alias)
+	}
+}
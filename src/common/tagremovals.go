@@ -0,0 +1,129 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/opslevel/opslevel-go/v2022"
+)
+
+// tagRemoval matches the tags with the key - and the value when it is set
+type tagRemoval struct {
+	Key   string
+	Value string
+}
+
+func (r tagRemoval) matches(tag opslevel.Tag) bool {
+	return tag.Key == r.Key && (r.Value == "" || tag.Value == r.Value)
+}
+
+var (
+	tagRemovalsMutex sync.Mutex
+	tagRemovals      []tagRemoval
+	pruneTags        bool
+)
+
+// SetTagPruning enables removing the tags carrying the 'tagPrefix' which are no longer parsed for a service
+func SetTagPruning(enabled bool) {
+	tagRemovalsMutex.Lock()
+	defer tagRemovalsMutex.Unlock()
+	pruneTags = enabled
+}
+
+func isTagPruningEnabled() bool {
+	tagRemovalsMutex.Lock()
+	defer tagRemovalsMutex.Unlock()
+	return pruneTags
+}
+
+// SetTagRemovals configures the tags deleted from every reconciled service given as 'key' or 'key=value'
+func SetTagRemovals(removals []string) error {
+	var parsed []tagRemoval
+	for i, removal := range removals {
+		key, value, _ := strings.Cut(removal, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if key == "" {
+			return fmt.Errorf("tagRemovals[%d]: invalid value '%s' - expected format 'key' or 'key=value'", i+1, removal)
+		}
+		parsed = append(parsed, tagRemoval{Key: key, Value: value})
+	}
+	tagRemovalsMutex.Lock()
+	defer tagRemovalsMutex.Unlock()
+	tagRemovals = parsed
+	return nil
+}
+
+func getTagRemovals() []tagRemoval {
+	tagRemovalsMutex.Lock()
+	defer tagRemovalsMutex.Unlock()
+	return tagRemovals
+}
+
+// isTagRemoved is true when a removal directive matches the tag - with a 'tagPrefix' the directive also matches the
+// prefixed key since the keys are configured the way the tags are parsed
+func isTagRemoved(tag opslevel.Tag) bool {
+	prefix := getTagPrefix()
+	for _, removal := range getTagRemovals() {
+		if removal.matches(tag) {
+			return true
+		}
+		if prefix != "" && !strings.HasPrefix(removal.Key, prefix) && (tagRemoval{Key: prefix + removal.Key, Value: removal.Value}).matches(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTagStale is true when the tag is managed by this tool - it carries the 'tagPrefix' - but the registration neither
+// assigns its key nor creates it any more. Assigned keys are skipped because the assign already replaced their value.
+func isTagStale(registration ServiceRegistration, tag opslevel.Tag) bool {
+	if !isManagedTag(tag.Key) || isManagedByTag(tag.Key) {
+		return false
+	}
+	for _, assigned := range registration.TagAssigns {
+		if assigned.Key == tag.Key {
+			return false
+		}
+	}
+	return !wantsTag(registration, tag)
+}
+
+func wantsTag(registration ServiceRegistration, tag opslevel.Tag) bool {
+	for _, wanted := range append(append([]opslevel.TagInput{}, registration.TagAssigns...), registration.TagCreates...) {
+		if wanted.Key == tag.Key && wanted.Value == tag.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// handleTagRemovals deletes the tags of the service matching a removal directive and with 'pruneTags' the stale tags
+// this tool manages - a tag the registration itself assigns or creates is kept so the two settings do not undo each other on every run
+func handleTagRemovals(client *opslevel.Client, registration ServiceRegistration, service *opslevel.Service, result *ServiceResult) {
+	prune := isTagPruningEnabled()
+	if service.Id == nil || (len(getTagRemovals()) == 0 && !prune) {
+		return
+	}
+	for _, tag := range service.Tags.Nodes {
+		if !isTagRemoved(tag) {
+			if prune && isTagStale(registration, tag) {
+				removeTag(client, registration, tag, result)
+			}
+			continue
+		}
+		if wantsTag(registration, tag) {
+			result.warned("Tag '%s = %s' matches 'tagRemovals' but is also parsed for the service ... keeping it", tag.Key, tag.Value)
+			continue
+		}
+		removeTag(client, registration, tag, result)
+	}
+}
+
+func removeTag(client *opslevel.Client, registration ServiceRegistration, tag opslevel.Tag, result *ServiceResult) {
+	planRemoval(registration.Name, fmt.Sprintf("tag '%s = %s'", tag.Key, tag.Value), result, func() error {
+		err := client.DeleteTag(tag.Id)
+		audit(registration.Name, registration.Aliases, "tagDelete", tag, err)
+		return err
+	})
+}
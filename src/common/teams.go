@@ -0,0 +1,235 @@
+package common
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/opslevel/kubectl-opslevel/config"
+	"github.com/opslevel/kubectl-opslevel/k8sutils"
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/shurcooL/graphql"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	teamsConfigMutex sync.Mutex
+	teamsConfig      config.TeamsConfig
+	// namespaceTeams are the definitions of the teams declared by namespace annotations keyed by team alias
+	namespaceTeams = map[string]teamDefinition{}
+
+	namespaceSelector = k8sutils.KubernetesSelector{ApiVersion: "v1", Kind: "Namespace"}
+)
+
+type teamDefinition struct {
+	Name    string
+	Contact string
+	Manager string
+}
+
+// SetTeams configures whether the missing owner teams of registrations are created
+func SetTeams(teams config.TeamsConfig) {
+	teamsConfigMutex.Lock()
+	defer teamsConfigMutex.Unlock()
+	teamsConfig = teams
+}
+
+func getTeamsConfig() config.TeamsConfig {
+	teamsConfigMutex.Lock()
+	defer teamsConfigMutex.Unlock()
+	return teamsConfig
+}
+
+func annotationOrDefault(annotation string, fallback string) string {
+	if annotation == "" {
+		return fallback
+	}
+	return annotation
+}
+
+// ownerAnnotation is the namespace annotation holding the alias of the team that owns the namespace
+func ownerAnnotation(teams config.TeamsConfig) string {
+	return annotationOrDefault(teams.Annotations.Alias, "opslevel.com/owner")
+}
+
+// loadNamespaceTeams reads the name, contact and manager of the owner teams from the namespace annotations
+func loadNamespaceTeams(source resourceSource, teams config.TeamsConfig) error {
+	resources, err := source.Query(-1, namespaceSelector)
+	if err != nil {
+		return err
+	}
+	if RecordDirectory != "" {
+		if err := writeRecording(RecordDirectory, -1, namespaceSelector, resources); err != nil {
+			return err
+		}
+	}
+	aliasKey := ownerAnnotation(teams)
+	nameKey := annotationOrDefault(teams.Annotations.Name, "opslevel.com/team-name")
+	contactKey := annotationOrDefault(teams.Annotations.Contact, "opslevel.com/team-contact")
+	managerKey := annotationOrDefault(teams.Annotations.Manager, "opslevel.com/team-manager")
+
+	definitions := map[string]teamDefinition{}
+	for _, resource := range resources {
+		var namespace struct {
+			Metadata metav1.ObjectMeta `json:"metadata"`
+		}
+		if err := json.Unmarshal(resource, &namespace); err != nil {
+			continue
+		}
+		annotations := namespace.Metadata.Annotations
+		alias := annotations[aliasKey]
+		if alias == "" {
+			continue
+		}
+		definition := definitions[alias]
+		if definition.Name == "" {
+			definition.Name = annotations[nameKey]
+		}
+		if definition.Contact == "" {
+			definition.Contact = annotations[contactKey]
+		}
+		if definition.Manager == "" {
+			definition.Manager = annotations[managerKey]
+		}
+		definitions[alias] = definition
+	}
+	teamsConfigMutex.Lock()
+	defer teamsConfigMutex.Unlock()
+	namespaceTeams = definitions
+	return nil
+}
+
+func getNamespaceTeam(alias string) teamDefinition {
+	teamsConfigMutex.Lock()
+	defer teamsConfigMutex.Unlock()
+	definition := namespaceTeams[alias]
+	if definition.Name == "" {
+		definition.Name = alias
+	}
+	return definition
+}
+
+// toContactInput guesses the contact type - '#channel' is slack, anything with an '@' is an email otherwise a website
+func toContactInput(contact string) opslevel.ContactInput {
+	switch {
+	case strings.HasPrefix(contact, "#"):
+		return opslevel.ContactInput{Type: opslevel.ContactTypeSlack, Address: contact}
+	case strings.Contains(contact, "@") && !strings.Contains(contact, "://"):
+		return opslevel.ContactInput{Type: opslevel.ContactTypeEmail, Address: contact}
+	default:
+		return opslevel.ContactInput{Type: opslevel.ContactTypeWeb, Address: contact}
+	}
+}
+
+// teamIdentity is the id and alias of a team found by either of them
+type teamIdentity struct {
+	Id    graphql.ID
+	Alias string
+}
+
+var (
+	teamsByIdMutex sync.Mutex
+	teamsById      = map[string]*teamIdentity{}
+)
+
+// findTeam resolves a team given as an OpsLevel ID or an alias. IDs templated into manifests are looked up
+// directly (once per run and account) while aliases go through the account's team cache. The team is nil when it does not exist.
+func findTeam(client *opslevel.Client, account string, identifier string) (*teamIdentity, error) {
+	if identifier == "" {
+		return nil, nil
+	}
+	if !opslevel.IsID(identifier) {
+		if v, ok := getCache(account).TryGetTeam(identifier); ok {
+			return &teamIdentity{Id: v.Id, Alias: string(v.Alias)}, nil
+		}
+		// teams created after the lookup tables were persisted are only found by asking the API
+		if !isDiskCached(account) {
+			return nil, nil
+		}
+	}
+	// keyed by account since the same ID or alias can exist in several accounts
+	key := account + "/" + identifier
+	teamsByIdMutex.Lock()
+	cached, ok := teamsById[key]
+	teamsByIdMutex.Unlock()
+	if ok {
+		return cached, nil
+	}
+	if client == nil {
+		return nil, nil
+	}
+	var team *opslevel.Team
+	var err error
+	if opslevel.IsID(identifier) {
+		team, err = client.GetTeam(graphql.ID(identifier))
+	} else {
+		team, err = client.GetTeamWithAlias(identifier)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var identity *teamIdentity
+	if team.Id != nil {
+		identity = &teamIdentity{Id: team.Id, Alias: string(team.Alias)}
+	}
+	teamsByIdMutex.Lock()
+	defer teamsByIdMutex.Unlock()
+	teamsById[key] = identity
+	return identity, nil
+}
+
+// resolveOwner returns the alias of the registration's owner creating the team when 'teams.autoCreate' is set.
+// The alias is empty when the team does not exist (or would be created in a dry run).
+func resolveOwner(client *opslevel.Client, registration ServiceRegistration, result *ServiceResult) string {
+	if registration.Owner == "" {
+		return ""
+	}
+	team, err := findTeam(client, registration.Account, registration.Owner)
+	if err != nil {
+		result.warned("Unable to look up 'Team' '%s': %v", registration.Owner, err)
+		return ""
+	}
+	if team != nil {
+		return team.Alias
+	}
+	if !getTeamsConfig().AutoCreate || opslevel.IsID(registration.Owner) {
+		result.warned("Unable to find 'Team' with alias '%s'", registration.Owner)
+		return ""
+	}
+	id, err := GetOrCreateAliasCache(registration.Account).Resolve("team", registration.Owner, func() (graphql.ID, error) {
+		definition := getNamespaceTeam(registration.Owner)
+		input := opslevel.TeamCreateInput{
+			Name:         definition.Name,
+			ManagerEmail: definition.Manager,
+		}
+		if definition.Contact != "" {
+			input.Contacts = []opslevel.ContactInput{toContactInput(definition.Contact)}
+		}
+		if result.dryRun("create team '%s' with input %+v", registration.Owner, input) {
+			return nil, nil
+		}
+		team, err := client.CreateTeam(input)
+		audit(registration.Name, registration.Aliases, "teamCreate", input, err)
+		if err != nil {
+			return nil, err
+		}
+		if !aliasOverlaps(team.Aliases, []string{registration.Owner}) {
+			aliasInput := opslevel.AliasCreateInput{Alias: registration.Owner, OwnerId: team.Id}
+			_, err = client.CreateAlias(aliasInput)
+			audit(registration.Name, registration.Aliases, "aliasCreate", aliasInput, err)
+			if err != nil {
+				return nil, err
+			}
+		}
+		result.changed("Created team '%s'", registration.Owner)
+		return team.Id, nil
+	})
+	if err != nil {
+		result.failed(err, "Failed creating team '%s'", registration.Owner)
+		return ""
+	}
+	if id == nil {
+		return ""
+	}
+	return registration.Owner
+}
@@ -0,0 +1,75 @@
+package common
+
+import (
+	"strings"
+
+	"github.com/opslevel/opslevel-go/v2022"
+	"github.com/rs/zerolog/log"
+)
+
+// normalizeToolCategory maps near misses such as 'API Documentation' onto the enum value 'api_documentation'
+func normalizeToolCategory(category string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(strings.ToLower(strings.TrimSpace(category)), " ", "_"), "-", "_")
+}
+
+// suggestToolCategory returns the valid category with the smallest edit distance to the category
+func suggestToolCategory(category string) string {
+	normalized := normalizeToolCategory(category)
+	best, bestDistance := "", -1
+	for _, candidate := range opslevel.AllToolCategory() {
+		if distance := editDistance(normalized, candidate); bestDistance < 0 || distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, minInt(current[j-1]+1, previous[j-1]+cost))
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// validateToolCategories fixes the case and separators of tool categories and drops the tools whose category is not
+// part of the OpsLevel enum with a warning suggesting the nearest valid category so preview surfaces them before import
+func validateToolCategories(registration *ServiceRegistration) {
+	valid := map[string]bool{}
+	for _, category := range opslevel.AllToolCategory() {
+		valid[category] = true
+	}
+	output := registration.Tools[:0]
+	for _, tool := range registration.Tools {
+		category := string(tool.Category)
+		if !valid[category] {
+			if normalized := normalizeToolCategory(category); valid[normalized] {
+				tool.Category = opslevel.ToolCategory(normalized)
+			} else {
+				log.Warn().Msgf("[%s] Skipping tool '{Category: %s, Environment: %s, Name: %s}' - invalid category '%s', did you mean '%s'?", registration.Name, category, tool.Environment, tool.DisplayName, category, suggestToolCategory(category))
+				continue
+			}
+		}
+		output = append(output, tool)
+	}
+	registration.Tools = output
+}
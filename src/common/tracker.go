@@ -0,0 +1,63 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RegistrationTracker remembers a hash of the last reconciled registration of every service so watch events which
+// do not change what is sent to OpsLevel (IE: status updates or rollout churn) skip the OpsLevel API calls
+type RegistrationTracker struct {
+	mutex  sync.Mutex
+	maxAge time.Duration
+	hashes map[string]trackedRegistration
+}
+
+type trackedRegistration struct {
+	hash string
+	at   time.Time
+}
+
+// NewRegistrationTracker forgets each hash after maxAge so a full resync still reconciles drift made in OpsLevel - it
+// must be shorter than the resync period since a resync event may arrive just under a period after the last reconcile.
+// 0 never forgets
+func NewRegistrationTracker(maxAge time.Duration) *RegistrationTracker {
+	return &RegistrationTracker{maxAge: maxAge, hashes: map[string]trackedRegistration{}}
+}
+
+func registrationTrackerKey(service ServiceRegistration) string {
+	return fmt.Sprintf("%s/%s", service.Account, service.Key())
+}
+
+func hashRegistration(service ServiceRegistration) string {
+	data, _ := json.Marshal(service)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Unchanged reports whether the registration hashes the same as the one last reconciled for the service
+func (t *RegistrationTracker) Unchanged(service ServiceRegistration, now time.Time) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	previous, ok := t.hashes[registrationTrackerKey(service)]
+	if !ok || (t.maxAge > 0 && now.Sub(previous.at) >= t.maxAge) {
+		return false
+	}
+	return previous.hash == hashRegistration(service)
+}
+
+// Remember records the registration as reconciled unless the reconcile had errors so it is retried on the next event
+func (t *RegistrationTracker) Remember(service ServiceRegistration, result ServiceResult, now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	key := registrationTrackerKey(service)
+	if result.HasErrors() {
+		delete(t.hashes, key)
+		return
+	}
+	t.hashes[key] = trackedRegistration{hash: hashRegistration(service), at: now}
+}
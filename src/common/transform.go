@@ -0,0 +1,247 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/opslevel/kubectl-opslevel/config"
+	"github.com/opslevel/opslevel-go/v2022"
+)
+
+type replacer struct {
+	pattern *regexp.Regexp
+	with    string
+}
+
+// stringTransformer applies the configured steps in order: strip prefixes/suffixes, lowercase, replace, truncate
+type stringTransformer struct {
+	stripPrefixes []string
+	stripSuffixes []string
+	lowercase     bool
+	replacers     []replacer
+	maxLength     int
+}
+
+func newReplacers(field string, configs []config.ReplaceConfig) ([]replacer, error) {
+	var output []replacer
+	for i, c := range configs {
+		pattern, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s[%d].pattern: %s", field, i+1, err)
+		}
+		output = append(output, replacer{pattern: pattern, with: c.With})
+	}
+	return output, nil
+}
+
+func (t *stringTransformer) apply(value string) string {
+	for _, prefix := range t.stripPrefixes {
+		value = strings.TrimPrefix(value, prefix)
+	}
+	for _, suffix := range t.stripSuffixes {
+		value = strings.TrimSuffix(value, suffix)
+	}
+	if t.lowercase {
+		value = strings.ToLower(value)
+	}
+	for _, r := range t.replacers {
+		value = r.pattern.ReplaceAllString(value, r.with)
+	}
+	// Truncated by rune so multi-byte characters are never split into invalid UTF-8
+	if runes := []rune(value); t.maxLength > 0 && len(runes) > t.maxLength {
+		value = string(runes[:t.maxLength])
+	}
+	return value
+}
+
+type tagTransformer struct {
+	stringTransformer
+	keys  map[string]bool
+	key   bool
+	value bool
+}
+
+func newTagTransformers(field string, configs []config.TagTransformConfig) ([]tagTransformer, error) {
+	var output []tagTransformer
+	for i, c := range configs {
+		replacers, err := newReplacers(fmt.Sprintf("%s[%d].replace", field, i+1), c.Replace)
+		if err != nil {
+			return nil, err
+		}
+		transformer := tagTransformer{
+			stringTransformer: stringTransformer{
+				stripPrefixes: c.StripPrefixes,
+				lowercase:     c.Lowercase,
+				replacers:     replacers,
+				maxLength:     c.MaxLength,
+			},
+			keys: map[string]bool{},
+		}
+		for _, key := range c.Keys {
+			transformer.keys[key] = true
+		}
+		switch strings.ToLower(c.Target) {
+		case "", "value":
+			transformer.value = true
+		case "key":
+			transformer.key = true
+		case "both":
+			transformer.key = true
+			transformer.value = true
+		default:
+			return nil, fmt.Errorf("%s[%d].target: invalid value '%s' - expected one of: value|key|both", field, i+1, c.Target)
+		}
+		output = append(output, transformer)
+	}
+	return output, nil
+}
+
+// transformTags runs every tag through the transformers in order dropping any tag whose key or value ends up empty
+func transformTags(tags []opslevel.TagInput, transformers []tagTransformer) []opslevel.TagInput {
+	if len(transformers) == 0 {
+		return tags
+	}
+	var output []opslevel.TagInput
+	for _, tag := range tags {
+		key, value := tag.Key, tag.Value
+		for _, transformer := range transformers {
+			if len(transformer.keys) > 0 && !transformer.keys[tag.Key] {
+				continue
+			}
+			if transformer.key {
+				key = transformer.apply(key)
+			}
+			if transformer.value {
+				value = transformer.apply(value)
+			}
+		}
+		if key == "" || value == "" {
+			continue
+		}
+		output = append(output, opslevel.TagInput{Key: key, Value: value})
+	}
+	return output
+}
+
+const (
+	tagKeyMode_Single = "single"
+	tagKeyMode_Multi  = "multi"
+)
+
+// newTagKeyModes validates the modes of 'tags.keys' keyed by the lowercased tag key - the keys are lowercased when the
+// config is loaded so the tags are matched case-insensitively
+func newTagKeyModes(field string, configs map[string]string) (map[string]string, error) {
+	output := map[string]string{}
+	for key, mode := range configs {
+		switch strings.ToLower(mode) {
+		case tagKeyMode_Single, tagKeyMode_Multi:
+			output[strings.ToLower(key)] = strings.ToLower(mode)
+		default:
+			return nil, fmt.Errorf("%s.%s: invalid value '%s' - expected one of: single|multi", field, key, mode)
+		}
+	}
+	return output, nil
+}
+
+// applyTagKeyModes moves the tags of single-valued keys to the assigns - keeping the last parsed value - and the tags
+// of multi-valued keys to the creates no matter which of the lists parsed them. Other keys keep their list.
+func applyTagKeyModes(assigns []opslevel.TagInput, creates []opslevel.TagInput, modes map[string]string) ([]opslevel.TagInput, []opslevel.TagInput) {
+	if len(modes) == 0 {
+		return assigns, creates
+	}
+	single := map[string]opslevel.TagInput{}
+	var singleKeys []string
+	var outputAssigns, outputCreates []opslevel.TagInput
+	// creates go first so a value parsed by an assign expression wins over one parsed by a create expression
+	for _, tag := range append(append([]opslevel.TagInput{}, creates...), assigns...) {
+		if modes[strings.ToLower(tag.Key)] != tagKeyMode_Single {
+			continue
+		}
+		if _, ok := single[tag.Key]; !ok {
+			singleKeys = append(singleKeys, tag.Key)
+		}
+		single[tag.Key] = tag
+	}
+	for _, tag := range assigns {
+		switch modes[strings.ToLower(tag.Key)] {
+		case tagKeyMode_Single:
+		case tagKeyMode_Multi:
+			outputCreates = append(outputCreates, tag)
+		default:
+			outputAssigns = append(outputAssigns, tag)
+		}
+	}
+	for _, tag := range creates {
+		if modes[strings.ToLower(tag.Key)] != tagKeyMode_Single {
+			outputCreates = append(outputCreates, tag)
+		}
+	}
+	for _, key := range singleKeys {
+		outputAssigns = append(outputAssigns, single[key])
+	}
+	return outputAssigns, outputCreates
+}
+
+func newAliasNormalizer(field string, c config.AliasNormalizationConfig) (*stringTransformer, error) {
+	replacers, err := newReplacers(fmt.Sprintf("%s.replace", field), c.Replace)
+	if err != nil {
+		return nil, err
+	}
+	return &stringTransformer{
+		stripPrefixes: c.StripPrefixes,
+		stripSuffixes: c.StripSuffixes,
+		lowercase:     c.Lowercase,
+		replacers:     replacers,
+	}, nil
+}
+
+// normalizeAliases applies the normalization rules to every alias removing any duplicates or empty results
+func normalizeAliases(aliases []string, normalizer *stringTransformer) []string {
+	output := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		output = append(output, normalizer.apply(alias))
+	}
+	return removeDuplicates(output)
+}
+
+var (
+	tagPrefixMutex sync.Mutex
+	tagPrefix      string
+)
+
+// SetTagPrefix configures the prefix prepended to the key of every tag this tool assigns or creates
+func SetTagPrefix(prefix string) {
+	tagPrefixMutex.Lock()
+	defer tagPrefixMutex.Unlock()
+	tagPrefix = prefix
+}
+
+func getTagPrefix() string {
+	tagPrefixMutex.Lock()
+	defer tagPrefixMutex.Unlock()
+	return tagPrefix
+}
+
+// prefixTags prepends the tag prefix to every key that does not already start with it
+func prefixTags(tags []opslevel.TagInput) []opslevel.TagInput {
+	prefix := getTagPrefix()
+	if prefix == "" {
+		return tags
+	}
+	output := make([]opslevel.TagInput, len(tags))
+	for i, tag := range tags {
+		if !strings.HasPrefix(tag.Key, prefix) {
+			tag.Key = prefix + tag.Key
+		}
+		output[i] = tag
+	}
+	return output
+}
+
+// isManagedTag is true when the tag key carries the tag prefix - without a prefix no tag is known to be owned by this tool
+func isManagedTag(key string) bool {
+	prefix := getTagPrefix()
+	return prefix != "" && strings.HasPrefix(key, prefix)
+}
@@ -14,27 +14,70 @@ var (
 	ConfigCurrentVersion = "1.2.0"
 )
 
+type ReplaceConfig struct {
+	Pattern string `json:"pattern"` // A regular expression
+	With    string `json:"with"`
+}
+
+type TagTransformConfig struct {
+	Keys          []string        `json:"keys,omitempty"`   // Tag keys this transform applies to - empty applies to every tag
+	Target        string          `json:"target,omitempty"` // One of: value|key|both - defaults to value
+	StripPrefixes []string        `json:"stripPrefixes,omitempty"`
+	Lowercase     bool            `json:"lowercase,omitempty"`
+	Replace       []ReplaceConfig `json:"replace,omitempty"`   // Applied in order after lowercasing
+	MaxLength     int             `json:"maxLength,omitempty"` // In characters
+}
+
+type AliasNormalizationConfig struct {
+	Lowercase     bool            `json:"lowercase,omitempty"`
+	Replace       []ReplaceConfig `json:"replace,omitempty"` // Applied in order after lowercasing - IE: replace '_' separators with '-'
+	StripPrefixes []string        `json:"stripPrefixes,omitempty"`
+	StripSuffixes []string        `json:"stripSuffixes,omitempty"`
+}
+
 type TagRegistrationConfig struct {
-	Assign []string `json:"assign"` // JQ expressions that return a single string or a map[string]string
-	Create []string `json:"create"` // JQ expressions that return a single string or a map[string]string
+	Assign     []string             `json:"assign"`               // JQ expressions that return a single string or a map[string]string
+	Create     []string             `json:"create"`               // JQ expressions that return a single string or a map[string]string
+	Transforms []TagTransformConfig `json:"transforms,omitempty"` // Applied in order to every parsed tag
+	Keys       map[string]string    `json:"keys,omitempty"`       // Tag key (after transforms) to one of: single|multi - single keys are assigned (replacing the value) and multi keys created (appending) whichever list parsed them - the keys are matched case-insensitively
+}
+
+type PagerDutyConfig struct {
+	Enabled   bool   `json:"enabled,omitempty"`
+	Subdomain string `json:"subdomain,omitempty"` // IE: 'acme' for acme.pagerduty.com - needed to link annotations holding a bare service id
 }
 
 type ServiceRegistrationConfig struct {
-	Name         string                `json:"name"`
-	Description  string                `json:"description"`
-	Owner        string                `json:"owner"`
-	Lifecycle    string                `json:"lifecycle"`
-	Tier         string                `json:"tier"`
-	Product      string                `json:"product"`
-	Language     string                `json:"language"`
-	Framework    string                `json:"framework"`
-	Aliases      []string              `json:"aliases"` // JQ expressions that return a single string or a []string
-	Tags         TagRegistrationConfig `json:"tags"`
-	Tools        []string              `json:"tools"`        // JQ expressions that return a single map[string]string or a []map[string]string
-	Repositories []string              `json:"repositories"` // JQ expressions that return a single string or []string or map[string]string or a []map[string]string
+	Name                     string                   `json:"name"`
+	Description              string                   `json:"description"`
+	Owner                    string                   `json:"owner"`
+	Lifecycle                string                   `json:"lifecycle"`
+	Tier                     string                   `json:"tier"`
+	Product                  string                   `json:"product"`
+	Language                 string                   `json:"language"`
+	Framework                string                   `json:"framework"`
+	System                   string                   `json:"system,omitempty"`             // JQ expression that returns the alias of the system the service belongs to
+	Domain                   string                   `json:"domain,omitempty"`             // JQ expression that returns the alias of the domain the service's system belongs to
+	DeployVersion            string                   `json:"deployVersion,omitempty"`      // JQ expression that returns the deployed version - a change sends a deploy event in 'service reconcile'
+	Type                     string                   `json:"type,omitempty"`               // JQ expression that returns the alias of the component type IE: backend, frontend, worker or library
+	Note                     string                   `json:"note,omitempty"`               // JQ expression that returns the Markdown note or a 'configmap:<namespace>/<name>/<key>' reference to it
+	Aliases                  []string                 `json:"aliases"`                      // JQ expressions that return a single string or a []string
+	AliasNormalization       AliasNormalizationConfig `json:"aliasNormalization,omitempty"` // Applied to every parsed alias
+	Tags                     TagRegistrationConfig    `json:"tags"`
+	Tools                    []string                 `json:"tools"`                              // JQ expressions that return a single map[string]string or a []map[string]string
+	Repositories             []string                 `json:"repositories"`                       // JQ expressions that return a single string or []string or map[string]string or a []map[string]string
+	Docs                     []string                 `json:"docs,omitempty"`                     // JQ expressions that return urls or repository relative paths of API specs (yaml/json) and tech docs
+	Properties               map[string]string        `json:"properties,omitempty"`               // Custom property definition alias to a JQ expression whose json result is assigned as the property value - the aliases are lowercased when the config is loaded and matched case-insensitively
+	CheckPayload             []string                 `json:"checkPayload,omitempty"`             // JQ expressions that return a map merged into the custom event check payload of the service
+	CheckFacts               bool                     `json:"checkFacts,omitempty"`               // Adds the built-in facts about the pod template (resource limits, non-root, probes, pod disruption budget) to the check payload
+	PagerDuty                PagerDutyConfig          `json:"pagerDuty,omitempty"`                // Attaches the PagerDuty services referenced in the annotations as incident tools
+	Dependencies             []string                 `json:"dependencies,omitempty"`             // JQ expressions that return the alias or []alias of the services this service depends on
+	Dependents               []string                 `json:"dependents,omitempty"`               // JQ expressions that return the alias or []alias of the services that depend on this service
+	DisableRecommendedLabels bool                     `json:"disableRecommendedLabels,omitempty"` // Stops defaulting an empty name, system, framework and tags.assign to the app.kubernetes.io/* labels
 }
 
 type Import struct {
+	Account        string                      `yaml:"account,omitempty" json:"account,omitempty" mapstructure:"account"` // The name of an entry in 'accounts' to send these services to - defaults to --api-token
 	SelectorConfig k8sutils.KubernetesSelector `yaml:"selector" json:"selector" mapstructure:"selector"`
 	OpslevelConfig ServiceRegistrationConfig   `yaml:"opslevel" json:"opslevel" mapstructure:"opslevel"`
 }
@@ -48,9 +91,189 @@ type Service struct {
 	Collect []Collect `json:"collect"`
 }
 
+type InfraProviderConfig struct {
+	Account string `json:"account,omitempty"` // JQ expression that returns the name of the cloud account the resource lives in
+	Name    string `json:"name,omitempty"`    // JQ expression that returns the provider name IE: AWS, GCP or the operator that manages the resource
+	Type    string `json:"type,omitempty"`    // JQ expression that returns the provider's resource type IE: RDS Instance
+	URL     string `json:"url,omitempty"`     // JQ expression that returns a link to the resource in the provider's console
+}
+
+type InfraRegistrationConfig struct {
+	Name     string              `json:"name"`
+	Schema   string              `json:"schema"` // JQ expression that returns the OpsLevel infrastructure schema IE: Database, Cache, Queue, Storage
+	Owner    string              `json:"owner"`
+	Aliases  []string            `json:"aliases"` // JQ expressions that return a single string or a []string
+	Provider InfraProviderConfig `json:"provider,omitempty"`
+	Data     []string            `json:"data,omitempty"`     // JQ expressions that return a map merged into the data of the resource
+	Services []string            `json:"services,omitempty"` // JQ expressions that return the alias or []alias of the services that use the resource
+}
+
+type InfraImport struct {
+	Account        string                      `yaml:"account,omitempty" json:"account,omitempty" mapstructure:"account"`
+	SelectorConfig k8sutils.KubernetesSelector `yaml:"selector" json:"selector" mapstructure:"selector"`
+	OpslevelConfig InfraRegistrationConfig     `yaml:"opslevel" json:"opslevel" mapstructure:"opslevel"`
+}
+
+// ClusterInfraConfig registers the cluster itself as an infrastructure resource
+type ClusterInfraConfig struct {
+	Enabled bool   `json:"enabled,omitempty"` // Register each cluster as an infrastructure resource related to the services imported from it
+	Account string `json:"account,omitempty"` // The name of an entry in 'accounts' to register the cluster in - defaults to --api-token
+	Schema  string `json:"schema,omitempty"`  // The OpsLevel infrastructure schema of the cluster - defaults to 'Compute'
+	Owner   string `json:"owner,omitempty"`   // The alias of the team owning the cluster
+}
+
+type Infra struct {
+	Import  []InfraImport      `json:"import"`
+	Cluster ClusterInfraConfig `json:"cluster,omitempty"`
+}
+
+type SystemConfig struct {
+	Alias       string `json:"alias"`
+	Name        string `json:"name,omitempty"` // Defaults to the alias
+	Description string `json:"description,omitempty"`
+	Owner       string `json:"owner,omitempty"` // The alias of the owning team
+}
+
+// SystemRegistrationConfig maps a Namespace to an OpsLevel system with JQ expressions
+type SystemRegistrationConfig struct {
+	Alias       string `json:"alias,omitempty"`       // JQ expression that returns the alias of the system - defaults to '<cluster>-<namespace>' like 'systems.namespaces'
+	Name        string `json:"name,omitempty"`        // JQ expression that returns the name of the system - defaults to the namespace name
+	Description string `json:"description,omitempty"` // JQ expression that returns the description of the system
+	Owner       string `json:"owner,omitempty"`       // JQ expression that returns the alias or the OpsLevel ID of the owning team
+}
+
+type SystemImport struct {
+	Account        string                      `yaml:"account,omitempty" json:"account,omitempty" mapstructure:"account"`
+	SelectorConfig k8sutils.KubernetesSelector `yaml:"selector" json:"selector" mapstructure:"selector"` // Only 'kind: Namespace' is supported
+	OpslevelConfig SystemRegistrationConfig    `yaml:"opslevel" json:"opslevel" mapstructure:"opslevel"`
+}
+
+type SystemsConfig struct {
+	AutoCreate  bool           `json:"autoCreate,omitempty"`  // Create the systems referenced by a registration that do not exist in OpsLevel
+	Definitions []SystemConfig `json:"definitions,omitempty"` // The name, description and owner used when creating a system
+	Namespaces  bool           `json:"namespaces,omitempty"`  // Create a system per namespace tagged with the workload count, requested cpu and memory and quota usage of the namespace - services without a system are placed in it - not together with 'import'
+	Import      []SystemImport `json:"import,omitempty"`      // Create or update a system per selected Namespace - the services imported from the namespace without a system are placed in it
+}
+
+// Get returns the definition of the system with the alias or an empty definition
+func (s SystemsConfig) Get(alias string) SystemConfig {
+	for _, definition := range s.Definitions {
+		if definition.Alias == alias {
+			return definition
+		}
+	}
+	return SystemConfig{Alias: alias}
+}
+
+type DomainConfig struct {
+	Alias       string `json:"alias"`
+	Name        string `json:"name,omitempty"` // Defaults to the alias
+	Description string `json:"description,omitempty"`
+	Owner       string `json:"owner,omitempty"` // The alias of the owning team
+}
+
+type DomainsConfig struct {
+	AutoCreate  bool           `json:"autoCreate,omitempty"`  // Create the domains referenced by a registration that do not exist in OpsLevel
+	Definitions []DomainConfig `json:"definitions,omitempty"` // The name, description and owner used when creating a domain
+}
+
+// Get returns the definition of the domain with the alias or an empty definition
+func (d DomainsConfig) Get(alias string) DomainConfig {
+	for _, definition := range d.Definitions {
+		if definition.Alias == alias {
+			return definition
+		}
+	}
+	return DomainConfig{Alias: alias}
+}
+
+type TeamAnnotationsConfig struct {
+	Alias   string `json:"alias,omitempty"`   // The namespace annotation holding the alias of the owning team - defaults to 'opslevel.com/owner'
+	Name    string `json:"name,omitempty"`    // Defaults to 'opslevel.com/team-name'
+	Contact string `json:"contact,omitempty"` // An email, slack channel ('#channel') or url - defaults to 'opslevel.com/team-contact'
+	Manager string `json:"manager,omitempty"` // The email of the team's manager - defaults to 'opslevel.com/team-manager'
+}
+
+type TeamMembersConfig struct {
+	Roles  []string `json:"roles,omitempty"`  // Only the subjects bound to these roles are members IE: admin, edit - empty uses every binding
+	Remove bool     `json:"remove,omitempty"` // Remove the team members that are no longer bound in any owned namespace
+}
+
+type TeamsConfig struct {
+	AutoCreate  bool                  `json:"autoCreate,omitempty"`  // Create the owner teams that do not exist in OpsLevel instead of leaving the services ownerless
+	Annotations TeamAnnotationsConfig `json:"annotations,omitempty"` // The namespace annotations the name, contact and manager of a created team are read from
+	Members     TeamMembersConfig     `json:"members,omitempty"`     // How 'team sync-members' maps RoleBindings to team membership
+}
+
+type DocsConfig struct {
+	URL string `json:"url,omitempty"` // The url of the API document integration that API specs referenced by url are pushed to
+}
+
+type ChecksConfig struct {
+	URL string `json:"url,omitempty"` // The url of the custom event check integration the payloads are posted to
+}
+
+type Account struct {
+	Name         string `json:"name"`
+	APIToken     string `json:"apiToken,omitempty"`
+	APITokenPath string `json:"apiTokenPath,omitempty"` // Absolute path to a file containing the API token
+	APIURL       string `json:"apiUrl,omitempty"`       // Defaults to --api-url
+}
+
 type Config struct {
-	Version string  `json:"version"`
-	Service Service `json:"service"`
+	Version           string                `json:"version"`
+	ClusterName       string                `json:"clusterName,omitempty"` // Overrides the automatically detected cluster name exposed to JQ expressions as $cluster
+	Accounts          []Account             `json:"accounts,omitempty"`
+	IgnoreResources   []string              `json:"ignoreResources,omitempty"` // Regular expressions matched against '<namespace>/<name>' (or '<name>' for cluster scoped resources) of every listed resource
+	Namespaces        Namespaces            `json:"namespaces,omitempty"`
+	Costs             CostsConfig           `json:"costs,omitempty"`
+	Idle              IdleConfig            `json:"idle,omitempty"`
+	TagPrefix         string                `json:"tagPrefix,omitempty"`        // Prepended to the key of every tag this tool assigns or creates IE: 'k8s.'
+	PruneTags         bool                  `json:"pruneTags,omitempty"`        // Remove the tags carrying the 'tagPrefix' which are no longer parsed for a service
+	DisableManagedBy  bool                  `json:"disableManagedBy,omitempty"` // Stops stamping the managed-by, managed-by-cluster, managed-by-namespace, managed-by-version and last-synced-at tags on the synced services
+	TagRemovals       []string              `json:"tagRemovals,omitempty"`      // Tags deleted from every reconciled service given as 'key' or 'key=value' IE: after renaming a label
+	GitOps            GitOpsConfig          `json:"gitOps,omitempty"`
+	ImageRepositories []ImageRepositoryRule `json:"imageRepositories,omitempty"` // Infer the repositories of the services without any from their container images - the first matching rule wins per image
+	Systems           SystemsConfig         `json:"systems,omitempty"`
+	Domains           DomainsConfig         `json:"domains,omitempty"`
+	Checks            ChecksConfig          `json:"checks,omitempty"`
+	Docs              DocsConfig            `json:"docs,omitempty"`
+	Teams             TeamsConfig           `json:"teams,omitempty"`
+	Service           Service               `json:"service"`
+	Infra             Infra                 `json:"infra,omitempty"`
+}
+
+// Namespaces restricts which namespaces are scanned so multi-tenant clusters can roll out the importer team by team
+type Namespaces struct {
+	Include []string `json:"include,omitempty"` // Globs of the namespaces to scan IE: 'team-*' - empty scans every namespace
+	Exclude []string `json:"exclude,omitempty"` // Globs of the namespaces never scanned even if included IE: 'kube-*'
+	OptIn   string   `json:"optIn,omitempty"`   // A label selector only the namespaces to scan carry IE: 'opslevel.com/import=true'
+}
+
+// CostsConfig enriches every service with the range of its monthly cost and actual usage from OpenCost or metrics-server
+type CostsConfig struct {
+	Enabled  bool   `json:"enabled,omitempty"`
+	OpenCost string `json:"openCost,omitempty"` // The OpenCost service as '<namespace>/<name>:<port>' called through the API server proxy - defaults to 'opencost/opencost:9003'
+	Window   string `json:"window,omitempty"`   // The OpenCost window the monthly cost is extrapolated from IE: '7d' - defaults to '7d'
+}
+
+// GitOpsConfig attaches the repository and path Argo CD or Flux deploy every resource from to its service
+type GitOpsConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+}
+
+// ImageRepositoryRule maps the container images matching a pattern to the alias of the repository they are built from
+type ImageRepositoryRule struct {
+	Image      string `json:"image"`               // Regular expression matched against the image without its tag or digest IE: '^ghcr\.io/acme/(.+)$'
+	Repository string `json:"repository"`          // The repository alias which may reference the groups of 'image' IE: 'github.com:acme/$1'
+	Directory  string `json:"directory,omitempty"` // The base directory of the service in the repository which may reference the groups of 'image'
+}
+
+// IdleConfig detects the services whose workloads are selected by a Service but had no ready endpoints for days
+type IdleConfig struct {
+	Enabled   bool   `json:"enabled,omitempty"`
+	Days      int    `json:"days,omitempty"`      // How many days without ready endpoints make a service idle - defaults to 14
+	Lifecycle string `json:"lifecycle,omitempty"` // The alias of the lifecycle idle services are moved to IE: 'end-of-life' - empty only flags them in the run report
 }
 
 type ConfigVersion struct {
@@ -69,5 +292,52 @@ func New() (*Config, error) {
 	if err := defaults.Set(c); err != nil {
 		return c, err
 	}
+	if err := c.validateAccounts(); err != nil {
+		return c, err
+	}
+	if err := c.validateSystems(); err != nil {
+		return c, err
+	}
+	if c.PruneTags && c.TagPrefix == "" {
+		return c, fmt.Errorf("pruneTags: only the tags carrying the 'tagPrefix' are pruned - set a 'tagPrefix' as well")
+	}
 	return c, nil
 }
+
+func (c *Config) GetAccount(name string) (*Account, error) {
+	for _, account := range c.Accounts {
+		if account.Name == name {
+			return &account, nil
+		}
+	}
+	return nil, fmt.Errorf("account '%s' not found in config 'accounts'", name)
+}
+
+// validateSystems rejects 'systems.namespaces' together with 'systems.import' since both create a system per
+// namespace under the same '<cluster>-<namespace>' alias
+func (c *Config) validateSystems() error {
+	if c.Systems.Namespaces && len(c.Systems.Import) > 0 {
+		return fmt.Errorf("systems: 'namespaces' and 'import' both create a system per namespace - enable only one of them")
+	}
+	return nil
+}
+
+func (c *Config) validateAccounts() error {
+	for i, importConfig := range c.Service.Import {
+		if importConfig.Account == "" {
+			continue
+		}
+		if _, err := c.GetAccount(importConfig.Account); err != nil {
+			return fmt.Errorf("service.import[%d]: %s", i+1, err)
+		}
+	}
+	for i, importConfig := range c.Infra.Import {
+		if importConfig.Account == "" {
+			continue
+		}
+		if _, err := c.GetAccount(importConfig.Account); err != nil {
+			return fmt.Errorf("infra.import[%d]: %s", i+1, err)
+		}
+	}
+	return nil
+}
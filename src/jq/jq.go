@@ -8,11 +8,25 @@ import (
 	"io/ioutil"
 	"log"
 	"os/exec"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
+// Definitions are helpers available to every filter to read the operator reported state of custom resources
+// IE: 'phase' of an Argo Rollout or 'ready' of a Knative Service - the full object including '.status' is always passed
+const Definitions = `def condition($type): [.status.conditions[]? | select(.type == $type)] | first; ` +
+	`def ready: condition("Ready") | if . == null then null else .status == "True" end; ` +
+	`def phase: .status.phase; `
+
+var (
+	argsMutex sync.RWMutex
+	args      = map[string]string{}
+)
+
 type JQ struct {
+	filter  string
 	options []string
 	timeout time.Duration
 	writer  io.Writer
@@ -58,7 +72,7 @@ func (e *JQError) Error() string {
 }
 
 func (jq *JQ) Filter() string {
-	return jq.options[len(jq.options)-1]
+	return jq.filter
 }
 
 func (jq *JQ) Options() []string {
@@ -118,6 +132,36 @@ func ValidateInstalled() {
 	}
 }
 
+// SetArg registers a named string value that is passed to every jq invocation
+// created afterwards, making it available to filters as `$name`
+func SetArg(name string, value string) {
+	argsMutex.Lock()
+	defer argsMutex.Unlock()
+	args[name] = value
+}
+
+// GetArg returns the value of the named '$' variable
+func GetArg(name string) string {
+	argsMutex.RLock()
+	defer argsMutex.RUnlock()
+	return args[name]
+}
+
+func getArgs() []string {
+	argsMutex.RLock()
+	defer argsMutex.RUnlock()
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	output := []string{}
+	for _, name := range names {
+		output = append(output, "--arg", name, args[name])
+	}
+	return output
+}
+
 func New(filter string) JQ {
 	return NewWithOptions(filter, 8*time.Second, nil)
 }
@@ -129,8 +173,10 @@ func NewWithOptions(filter string, timeout time.Duration, options []JQOpt) JQ {
 			opts = append(opts, fmt.Sprintf("--%s", opt.Name))
 		}
 	}
-	opts = append(opts, fmt.Sprintf("%s", filter))
+	opts = append(opts, getArgs()...)
+	opts = append(opts, Definitions+filter)
 	jq := &JQ{
+		filter:  filter,
 		options: opts,
 		timeout: timeout,
 		writer:  ioutil.Discard,
@@ -0,0 +1,205 @@
+package k8sutils
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var (
+	clusterNameWasCached bool
+	clusterNameCache     string
+
+	// arn:aws:eks:us-east-1:123456789012:cluster/my-cluster
+	eksContextRegex = regexp.MustCompile(`^arn:aws[a-zA-Z-]*:eks:[^:]+:[0-9]+:cluster/(.+)$`)
+	// admin@my-cluster.us-east-1.eksctl.io
+	eksctlContextRegex = regexp.MustCompile(`^[^@]+@([^.]+)\.[^.]+\.eksctl\.io$`)
+	// gke_my-project_us-central1-a_my-cluster
+	gkeContextRegex = regexp.MustCompile(`^gke_[^_]+_[^_]+_(.+)$`)
+)
+
+var (
+	// kubeconfigPath is the kubeconfig file given by '--kubeconfig' - empty uses KUBECONFIG and ~/.kube/config
+	kubeconfigPath string
+	// kubeOverrides are the connection settings given by the standard kubectl flags on top of the kubeconfig
+	kubeOverrides = &clientcmd.ConfigOverrides{}
+	// ProxyURL is the http, https or socks5 proxy the Kubernetes API is reached through unless '--proxy-url' is given
+	ProxyURL string
+)
+
+// BindKubectlFlags adds the standard kubectl connection flags such as '--kubeconfig', '--context', '--server',
+// '--token' and the '--as' impersonation flags so the plugin connects like every other kubectl command. '--namespace' is left to the commands
+// that restrict their selectors with it and '--request-timeout' is already a flag of the plugin.
+func BindKubectlFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&kubeconfigPath, clientcmd.RecommendedConfigPathFlag, "", "Path to the kubeconfig file to use for the Kubernetes API requests")
+	names := clientcmd.RecommendedConfigOverrideFlags("")
+	names.ContextOverrideFlags.Namespace.LongName = ""
+	names.Timeout.LongName = ""
+	names.ClusterOverrideFlags.ProxyURL.Description = "The http, https or socks5 proxy to reach the Kubernetes API through IE: 'socks5://localhost:1080' - overrides the kubeconfig 'proxy-url' and environment variable 'OPSLEVEL_K8S_PROXY_URL'"
+	clientcmd.BindOverrideFlags(kubeOverrides, flags, names)
+}
+
+func kubeconfigLoader() clientcmd.ClientConfig {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfigPath
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, kubeOverrides)
+}
+
+// kubeProxy returns the proxy given by '--proxy-url' or ProxyURL - nil leaves the kubeconfig 'proxy-url' and the
+// HTTPS_PROXY environment variable in charge
+func kubeProxy() (func(*http.Request) (*url.URL, error), error) {
+	proxy := kubeOverrides.ClusterInfo.ProxyURL
+	if proxy == "" {
+		proxy = ProxyURL
+	}
+	if proxy == "" {
+		return nil, nil
+	}
+	parsed, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url '%s': %v", proxy, err)
+	}
+	switch parsed.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy url '%s': the scheme must be one of http, https or socks5", proxy)
+	}
+	return http.ProxyURL(parsed), nil
+}
+
+// InCluster reports whether there is no kubeconfig to connect with so the clients use the in-cluster service account
+func InCluster() bool {
+	if kubeconfigPath != "" || kubeOverrides.ClusterInfo.Server != "" {
+		return false
+	}
+	raw, err := kubeconfigLoader().RawConfig()
+	return err == nil && len(raw.Clusters) == 0 && len(raw.Contexts) == 0
+}
+
+func getKubernetesContext() string {
+	if kubeOverrides.CurrentContext != "" {
+		return kubeOverrides.CurrentContext
+	}
+	raw, err := kubeconfigLoader().RawConfig()
+	if err != nil {
+		return ""
+	}
+	return raw.CurrentContext
+}
+
+// CurrentKubeContext returns the name of the kubeconfig context the clients connect to
+func CurrentKubeContext() string {
+	return getKubernetesContext()
+}
+
+// ListKubeContexts returns the names of every context in the kubeconfig sorted by name
+func ListKubeContexts() ([]string, error) {
+	raw, err := kubeconfigLoader().RawConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to load kubernetes config: %v", err)
+	}
+	var output []string
+	for name := range raw.Contexts {
+		output = append(output, name)
+	}
+	sort.Strings(output)
+	return output, nil
+}
+
+// UseKubeContext points the clients created from now on at the kubeconfig context and forgets what was
+// detected about the previous cluster
+func UseKubeContext(name string) {
+	kubeOverrides.CurrentContext = name
+	clusterNameWasCached = false
+	clusterNameCache = ""
+	namespacesWereCached = false
+	namespacesCache = nil
+	namespaceFilterMutex.Lock()
+	optedInNamespaces = nil
+	namespaceFilterMutex.Unlock()
+}
+
+// ParseClusterName extracts the cluster name from well known EKS, eksctl and GKE kubeconfig context formats.
+// AKS and other providers name the context after the cluster so the context is returned unchanged.
+func ParseClusterName(context string) string {
+	for _, regex := range []*regexp.Regexp{eksContextRegex, eksctlContextRegex, gkeContextRegex} {
+		if matches := regex.FindStringSubmatch(context); len(matches) == 2 {
+			return matches[1]
+		}
+	}
+	return context
+}
+
+// KubeconfigClusterName returns the cluster name parsed from the current kubeconfig context without calling the cluster
+func KubeconfigClusterName() string {
+	return ParseClusterName(getKubernetesContext())
+}
+
+// GetClusterName returns the override if set otherwise it detects the cluster identity from the
+// kubeconfig context and falls back to the 'kube-system' namespace UID (IE: when running in-cluster)
+func (c *ClientWrapper) GetClusterName(override string) string {
+	if override != "" {
+		return override
+	}
+	if clusterNameWasCached {
+		return clusterNameCache
+	}
+	name := ParseClusterName(getKubernetesContext())
+	if name == "" {
+		ctx, cancel := requestContext()
+		defer cancel()
+		namespace, err := c.client.CoreV1().Namespaces().Get(ctx, "kube-system", metav1.GetOptions{})
+		if err != nil {
+			log.Warn().Msgf("Unable to detect cluster name: %v", err)
+		} else {
+			name = string(namespace.UID)
+		}
+	}
+	name = strings.TrimSpace(name)
+	log.Debug().Msgf("Detected cluster name '%s'", name)
+	clusterNameWasCached = true
+	clusterNameCache = name
+	return clusterNameCache
+}
+
+// ClusterInfo describes the cluster the client is connected to
+type ClusterInfo struct {
+	Version   string `json:"kubernetesVersion,omitempty"`
+	Provider  string `json:"provider,omitempty"` // Parsed from the provider id of the nodes IE: aws, gce or azure
+	Region    string `json:"region,omitempty"`
+	NodeCount int    `json:"nodeCount"`
+}
+
+// GetClusterInfo looks up the Kubernetes version of the API server and the provider, region and count of the nodes
+func (c *ClientWrapper) GetClusterInfo() (ClusterInfo, error) {
+	var info ClusterInfo
+	version, err := c.client.Discovery().ServerVersion()
+	if err != nil {
+		return info, err
+	}
+	info.Version = version.GitVersion
+	ctx, cancel := requestContext()
+	defer cancel()
+	nodes, err := c.client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return info, err
+	}
+	info.NodeCount = len(nodes.Items)
+	for _, node := range nodes.Items {
+		if provider, _, found := strings.Cut(node.Spec.ProviderID, "://"); found && info.Provider == "" {
+			info.Provider = provider
+		}
+		if region := node.Labels["topology.kubernetes.io/region"]; region != "" && info.Region == "" {
+			info.Region = region
+		}
+	}
+	return info, nil
+}
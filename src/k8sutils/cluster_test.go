@@ -0,0 +1,112 @@
+package k8sutils
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rocktavious/autopilot"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: eu
+  cluster:
+    server: https://eu.example.com
+- name: us
+  cluster:
+    server: https://us.example.com
+contexts:
+- name: prod-us1
+  context:
+    cluster: us
+- name: arn:aws:eks:eu-west-1:123456789012:cluster/prod-eu1
+  context:
+    cluster: eu
+current-context: prod-us1
+`
+
+func useTestKubeconfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	autopilot.Ok(t, os.WriteFile(path, []byte(testKubeconfig), 0o600))
+	previous := kubeconfigPath
+	kubeconfigPath = path
+	t.Cleanup(func() {
+		kubeconfigPath = previous
+		UseKubeContext("")
+	})
+}
+
+func Test_ListKubeContexts_SortsTheContextsByName(t *testing.T) {
+	// Arrange
+	useTestKubeconfig(t)
+	// Act
+	contexts, err := ListKubeContexts()
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Equals(t, []string{"arn:aws:eks:eu-west-1:123456789012:cluster/prod-eu1", "prod-us1"}, contexts)
+}
+
+func Test_UseKubeContext_SwitchesTheClusterName(t *testing.T) {
+	// Arrange
+	useTestKubeconfig(t)
+	current := KubeconfigClusterName()
+	// Act
+	UseKubeContext("arn:aws:eks:eu-west-1:123456789012:cluster/prod-eu1")
+	// Assert
+	autopilot.Equals(t, "prod-us1", current)
+	autopilot.Equals(t, "prod-eu1", KubeconfigClusterName())
+}
+
+func Test_ParseClusterName(t *testing.T) {
+	// Arrange
+	contexts := map[string]string{
+		"arn:aws:eks:us-east-1:123456789012:cluster/my-cluster": "my-cluster",
+		"admin@my-cluster.us-east-1.eksctl.io":                  "my-cluster",
+		"gke_my-project_us-central1-a_my-cluster":               "my-cluster",
+		"my-aks-cluster": "my-aks-cluster",
+	}
+	for context, expected := range contexts {
+		// Act
+		name := ParseClusterName(context)
+		// Assert
+		autopilot.Equals(t, expected, name)
+	}
+}
+
+func Test_KubeProxy_PrefersTheFlagOverTheEnvironment(t *testing.T) {
+	// Arrange
+	ProxyURL = "http://proxy.example.com:3128"
+	kubeOverrides.ClusterInfo.ProxyURL = "socks5://localhost:1080"
+	defer func() {
+		ProxyURL = ""
+		kubeOverrides.ClusterInfo.ProxyURL = ""
+	}()
+	req, _ := http.NewRequest(http.MethodGet, "https://kubernetes.default.svc", nil)
+	// Act
+	proxy, err := kubeProxy()
+	// Assert
+	autopilot.Ok(t, err)
+	proxied, _ := proxy(req)
+	autopilot.Equals(t, "socks5://localhost:1080", proxied.String())
+}
+
+func Test_KubeProxy_IsNilWithoutAProxy(t *testing.T) {
+	// Act
+	proxy, err := kubeProxy()
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Assert(t, proxy == nil, "expected no proxy")
+}
+
+func Test_KubeProxy_RejectsAnUnsupportedScheme(t *testing.T) {
+	// Arrange
+	ProxyURL = "ftp://proxy.example.com"
+	defer func() { ProxyURL = "" }()
+	// Act
+	_, err := kubeProxy()
+	// Assert
+	autopilot.Assert(t, err != nil, "expected the ftp proxy to be rejected")
+}
@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -106,6 +108,9 @@ func (c *KubernetesController) processNextItem() bool {
 			return true
 		}
 		c.queue.Done(item)
+		if accessor, err := meta.Accessor(obj); err == nil && IsIgnored(accessor.GetNamespace(), accessor.GetName()) {
+			continue
+		}
 		items = append(items, obj)
 	}
 	switch matchType {
@@ -147,10 +152,23 @@ func (c *KubernetesController) Start(workers int) {
 	<-c.Channel
 }
 
-func NewController(gvr schema.GroupVersionResource, resyncInterval time.Duration, maxBatch int) *KubernetesController {
+// Requeue queues the cached resources of the namespace as if they were just created IE: once the namespace opted in
+func (c *KubernetesController) Requeue(namespace string) int {
+	keys, err := c.informer.GetIndexer().IndexKeys(cache.NamespaceIndex, namespace)
+	if err != nil {
+		log.Warn().Msgf("[%s] Unable to look up the cached resources of namespace '%s': %v", c.id, namespace, err)
+		return 0
+	}
+	for _, key := range keys {
+		c.queue.Add(KubernetesEvent{Key: key, Type: KubernetesEventTypeCreate})
+	}
+	return len(keys)
+}
+
+func NewController(gvr schema.GroupVersionResource, options metav1.ListOptions, resyncInterval time.Duration, maxBatch int) *KubernetesController {
 	k8sClient := CreateKubernetesClient()
 	queue := workqueue.New()
-	factory := k8sClient.GetInformerFactory(resyncInterval)
+	factory := k8sClient.GetInformerFactory(resyncInterval, options)
 	informer := factory.ForResource(gvr).Informer()
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
@@ -199,6 +217,10 @@ func NewController(gvr schema.GroupVersionResource, resyncInterval time.Duration
 
 func Start() {
 	log.Info().Msg("Controller is Starting...")
-	<-setupSignalHandler() // Block until signals
+	// Block until signals or the run is aborted
+	select {
+	case <-setupSignalHandler():
+	case <-Context.Done():
+	}
 	log.Info().Msg("Controller is Stopping...")
 }
@@ -0,0 +1,140 @@
+package k8sutils
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// DiscoveryAnnotationPrefix marks the resources a 'discover' selector imports regardless of their kind
+const DiscoveryAnnotationPrefix = "opslevel.com/"
+
+// discoverySkippedResources are never listed by a 'discover' selector - events are pure churn and secrets
+// would be pulled into memory and recordings just to look at their annotations
+var discoverySkippedResources = sets.NewString("events", "secrets")
+
+// discoveryWorkloadResources are the only kinds of the built-in API groups a 'discover' selector walks by default -
+// pods, configmaps, endpoints, leases and the like are churn which never carry a service
+var discoveryWorkloadResources = sets.NewString("deployments", "statefulsets", "daemonsets", "cronjobs", "jobs", "services")
+
+// isBuiltinGroup reports whether the API group is served by Kubernetes itself rather than a custom resource definition
+func isBuiltinGroup(group string) bool {
+	return !strings.Contains(group, ".") || strings.HasSuffix(group, ".k8s.io")
+}
+
+// isDiscoverable reports whether a 'discover' selector walks the resource of the API group
+func isDiscoverable(selector KubernetesSelector, group string, resource string) bool {
+	if discoverySkippedResources.Has(resource) {
+		return false
+	}
+	if len(selector.DiscoverGroups) > 0 {
+		if group == "" {
+			group = "core"
+		}
+		return sets.NewString(selector.DiscoverGroups...).Has(group)
+	}
+	return !isBuiltinGroup(group) || discoveryWorkloadResources.Has(resource)
+}
+
+// HasDiscoveryAnnotation reports whether any of the annotations starts with DiscoveryAnnotationPrefix
+func HasDiscoveryAnnotation(annotations map[string]string) bool {
+	for key := range annotations {
+		if strings.HasPrefix(key, DiscoveryAnnotationPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type discoveredResource struct {
+	Metadata struct {
+		UID         string            `json:"uid"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+}
+
+// DiscoverSelectors expands a 'discover' selector into one selector per listable kind of the discovered API groups
+func (c *ClientWrapper) DiscoverSelectors(selector KubernetesSelector) ([]KubernetesSelector, error) {
+	// Partial results are returned when some aggregated APIs are unavailable
+	resources, err := c.client.Discovery().ServerPreferredResources()
+	if len(resources) == 0 && err != nil {
+		return nil, err
+	}
+	var output []KubernetesSelector
+	for _, list := range resources {
+		group := strings.Split(list.GroupVersion, "/")[0]
+		if !strings.Contains(list.GroupVersion, "/") {
+			group = ""
+		}
+		for _, resource := range list.APIResources {
+			if strings.Contains(resource.Name, "/") || !isDiscoverable(selector, group, resource.Name) || !sets.NewString(resource.Verbs...).Has("list") {
+				continue
+			}
+			discovered := selector
+			discovered.ApiVersion = list.GroupVersion
+			discovered.Kind = resource.Kind
+			output = append(output, discovered)
+		}
+	}
+	return output, nil
+}
+
+// queryDiscovered lists every discovered kind and keeps the resources carrying an 'opslevel.com/' annotation
+func (c *ClientWrapper) queryDiscovered(selector KubernetesSelector) ([][]byte, error) {
+	output, _, err := c.discover(selector)
+	return output, err
+}
+
+// DiscoverAnnotatedSelectors expands a 'discover' selector into the kinds which currently have a resource carrying an
+// 'opslevel.com/' annotation so 'service reconcile' only watches those - kinds annotated later need a restart
+func (c *ClientWrapper) DiscoverAnnotatedSelectors(selector KubernetesSelector) ([]KubernetesSelector, error) {
+	_, annotated, err := c.discover(selector)
+	return annotated, err
+}
+
+// discover lists each discovered kind once - across all namespaces unless the selector names some since the
+// namespace filters are applied to the parsed resources - and returns the annotated resources and their kinds
+func (c *ClientWrapper) discover(selector KubernetesSelector) ([][]byte, []KubernetesSelector, error) {
+	selectors, err := c.DiscoverSelectors(selector)
+	if err != nil {
+		return nil, nil, err
+	}
+	namespaces := []string{""}
+	if len(selector.Namespaces) > 0 {
+		if namespaces, err = c.GetNamespaces(selector); err != nil {
+			return nil, nil, err
+		}
+	}
+	seen := map[string]bool{}
+	var output [][]byte
+	var annotated []KubernetesSelector
+	for _, discovered := range selectors {
+		resources, queryErr := c.queryNamespaces(discovered, namespaces)
+		if queryErr != nil {
+			// kinds the credentials may not list are expected when walking every API group
+			log.Debug().Msgf("Skipping discovered kind '%s/%s': %v", discovered.ApiVersion, discovered.Kind, queryErr)
+			continue
+		}
+		found := false
+		for _, resource := range resources {
+			var parsed discoveredResource
+			if err := json.Unmarshal(resource, &parsed); err != nil || !HasDiscoveryAnnotation(parsed.Metadata.Annotations) {
+				continue
+			}
+			found = true
+			// the same object can be served by several API groups (IE: 'Ingress' in 'extensions' and 'networking.k8s.io')
+			if parsed.Metadata.UID != "" && seen[parsed.Metadata.UID] {
+				continue
+			}
+			seen[parsed.Metadata.UID] = true
+			output = append(output, resource)
+		}
+		if found {
+			annotated = append(annotated, discovered)
+		}
+	}
+	log.Debug().Msgf("Discovered %d annotated resources across %d of %d kinds", len(output), len(annotated), len(selectors))
+	return output, annotated, nil
+}
@@ -0,0 +1,30 @@
+package k8sutils
+
+import (
+	"testing"
+
+	"github.com/rocktavious/autopilot"
+)
+
+func Test_IsDiscoverable_DefaultsToWorkloadsAndCustomResources(t *testing.T) {
+	// Arrange
+	selector := KubernetesSelector{Discover: true}
+	// Assert
+	autopilot.Equals(t, true, isDiscoverable(selector, "apps", "deployments"))
+	autopilot.Equals(t, true, isDiscoverable(selector, "", "services"))
+	autopilot.Equals(t, true, isDiscoverable(selector, "argoproj.io", "rollouts"))
+	autopilot.Equals(t, false, isDiscoverable(selector, "", "pods"))
+	autopilot.Equals(t, false, isDiscoverable(selector, "", "configmaps"))
+	autopilot.Equals(t, false, isDiscoverable(selector, "coordination.k8s.io", "leases"))
+	autopilot.Equals(t, false, isDiscoverable(selector, "argoproj.io", "secrets"))
+}
+
+func Test_IsDiscoverable_OnlyWalksTheConfiguredGroups(t *testing.T) {
+	// Arrange
+	selector := KubernetesSelector{Discover: true, DiscoverGroups: []string{"core", "argoproj.io"}}
+	// Assert
+	autopilot.Equals(t, true, isDiscoverable(selector, "", "pods"))
+	autopilot.Equals(t, true, isDiscoverable(selector, "argoproj.io", "rollouts"))
+	autopilot.Equals(t, false, isDiscoverable(selector, "apps", "deployments"))
+	autopilot.Equals(t, false, isDiscoverable(selector, "", "events"))
+}
@@ -0,0 +1,89 @@
+package k8sutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+// ExecCredentialCommand is the hidden argument the binary runs itself with to wrap a kubeconfig exec credential plugin
+const ExecCredentialCommand = "__exec-credential"
+
+// ExecTimeout is how long an exec credential plugin (IE: 'aws eks get-token') may take to return a token - 0 never times out
+var ExecTimeout = 30 * time.Second
+
+// execPluginHints explain how to install the credential plugins of the managed clusters when the kubeconfig has no 'installHint'
+var execPluginHints = map[string]string{
+	"aws":                    "install the AWS CLI v2 - https://docs.aws.amazon.com/cli/latest/userguide/getting-started-install.html",
+	"aws-iam-authenticator":  "install it from https://github.com/kubernetes-sigs/aws-iam-authenticator",
+	"gke-gcloud-auth-plugin": "install it with 'gcloud components install gke-gcloud-auth-plugin'",
+	"kubelogin":              "install it with 'az aks install-cli'",
+}
+
+// wrapExecProvider fails early when the exec credential plugin of the kubeconfig is not installed and runs it through
+// this binary so every token refresh - IE: in a long running 'service reconcile' - is bound by ExecTimeout
+func wrapExecProvider(config *rest.Config) error {
+	provider := config.ExecProvider
+	if provider == nil {
+		return nil
+	}
+	path, err := exec.LookPath(provider.Command)
+	if err != nil {
+		hint := provider.InstallHint
+		if hint == "" {
+			hint = execPluginHints[filepath.Base(provider.Command)]
+		}
+		if hint != "" {
+			return fmt.Errorf("the kubeconfig runs '%s' to get credentials but it was not found on the PATH - %s", provider.Command, hint)
+		}
+		return fmt.Errorf("the kubeconfig runs '%s' to get credentials but it was not found on the PATH", provider.Command)
+	}
+	if ExecTimeout <= 0 {
+		return nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil
+	}
+	provider.Args = append([]string{ExecCredentialCommand, ExecTimeout.String(), path}, provider.Args...)
+	provider.Command = self
+	return nil
+}
+
+// RunExecCredential runs the wrapped credential plugin given as '<timeout> <command> [args...]' passing its stdin,
+// stdout, stderr and environment through and returns the exit code
+func RunExecCredential(args []string) int {
+	if len(args) < 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s <timeout> <command> [args...]\n", ExecCredentialCommand)
+		return 1
+	}
+	timeout, err := time.ParseDuration(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid timeout '%s': %v\n", args[0], err)
+		return 1
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[1], args[2:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		fmt.Fprintf(os.Stderr, "the credential plugin '%s' did not return a token within %s - it may be waiting for an interactive login (IE: 'aws sso login') so log in first or raise --k8s-exec-timeout\n", filepath.Base(args[1]), timeout)
+		return 1
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to run the credential plugin '%s': %v\n", args[1], err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,65 @@
+package k8sutils
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rocktavious/autopilot"
+
+	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func Test_WrapExecProvider_ExplainsAMissingPlugin(t *testing.T) {
+	// Arrange
+	config := &rest.Config{ExecProvider: &clientcmdapi.ExecConfig{Command: "/does/not/exist/gke-gcloud-auth-plugin"}}
+	// Act
+	err := wrapExecProvider(config)
+	// Assert
+	autopilot.Assert(t, err != nil && strings.Contains(err.Error(), "gcloud components install"), "expected the install hint but got %v", err)
+}
+
+func Test_WrapExecProvider_RunsThePluginThroughThisBinary(t *testing.T) {
+	// Arrange
+	config := &rest.Config{ExecProvider: &clientcmdapi.ExecConfig{Command: "sh", Args: []string{"-c", "true"}}}
+	self, _ := os.Executable()
+	// Act
+	err := wrapExecProvider(config)
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Equals(t, self, config.ExecProvider.Command)
+	autopilot.Equals(t, ExecCredentialCommand, config.ExecProvider.Args[0])
+	autopilot.Equals(t, ExecTimeout.String(), config.ExecProvider.Args[1])
+	autopilot.Equals(t, []string{"-c", "true"}, config.ExecProvider.Args[3:])
+}
+
+func Test_WrapExecProvider_IgnoresConfigsWithoutAPlugin(t *testing.T) {
+	// Act
+	err := wrapExecProvider(&rest.Config{})
+	// Assert
+	autopilot.Ok(t, err)
+}
+
+func Test_RunExecCredential_PassesTheExitCodeThrough(t *testing.T) {
+	// Act
+	code := RunExecCredential([]string{"10s", "sh", "-c", "exit 3"})
+	// Assert
+	autopilot.Equals(t, 3, code)
+}
+
+func Test_RunExecCredential_FailsAfterTheTimeout(t *testing.T) {
+	// Act
+	code := RunExecCredential([]string{"100ms", "sleep", "5"})
+	// Assert
+	autopilot.Equals(t, 1, code)
+}
+
+func Test_RunExecCredential_RejectsInvalidArguments(t *testing.T) {
+	// Act
+	missing := RunExecCredential([]string{"10s"})
+	invalid := RunExecCredential([]string{"soon", "sh"})
+	// Assert
+	autopilot.Equals(t, 1, missing)
+	autopilot.Equals(t, 1, invalid)
+}
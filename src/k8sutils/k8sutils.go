@@ -3,26 +3,33 @@ package k8sutils
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/rs/zerolog/log"
 
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/restmapper"
 
 	// This is here because of https://github.com/OpsLevel/kubectl-opslevel/issues/24
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog/v2"
 )
 
@@ -32,86 +39,199 @@ type NamespaceSelector struct {
 }
 
 type KubernetesSelector struct {
-	ApiVersion string            `json:"apiVersion"`
-	Kind       string            `json:"kind"`
-	Namespaces []string          `json:"namespaces,omitempty"`
-	namespace  NamespaceSelector `json:"namespace"` //Deprecated 1.0.0 -> 1.1.0
-	labels     map[string]string `json:"labels"`    //Deprecated 1.0.0 -> 1.1.0
-	Excludes   []string          `json:"excludes,omitempty"`
+	ApiVersion     string            `json:"apiVersion"`
+	Kind           string            `json:"kind"`
+	Namespaces     []string          `json:"namespaces,omitempty"`
+	namespace      NamespaceSelector `json:"namespace"`               //Deprecated 1.0.0 -> 1.1.0
+	labels         map[string]string `json:"labels"`                  //Deprecated 1.0.0 -> 1.1.0
+	LabelSelector  string            `json:"labelSelector,omitempty"` // A kubernetes label selector applied server side IE: 'app.kubernetes.io/managed-by=helm,tier!=cache'
+	FieldSelector  string            `json:"fieldSelector,omitempty"` // A kubernetes field selector applied server side IE: 'metadata.namespace!=kube-system,status.phase=Running'
+	Excludes       []string          `json:"excludes,omitempty"`
+	Discover       bool              `json:"discover,omitempty"`       // Walk every listable kind instead of 'apiVersion' and 'kind' and keep the resources carrying an 'opslevel.com/' annotation
+	DiscoverGroups []string          `json:"discoverGroups,omitempty"` // The API groups 'discover' walks IE: 'apps' or 'argoproj.io' ('core' for the core group) - defaults to the workload kinds and every custom resource group
 }
 
 type ClientWrapper struct {
-	client  kubernetes.Interface
-	dynamic dynamic.Interface
-	mapper  restmapper.DeferredDiscoveryRESTMapper
+	client   kubernetes.Interface
+	dynamic  dynamic.Interface
+	metadata metadata.Interface
+	mapper   restmapper.DeferredDiscoveryRESTMapper
+	protobuf *protobufClients
 }
 
+// getKubernetesConfig loads the kubeconfig and falls back to the service account token and CA mounted into
+// the pod when there is none so the same binary runs unchanged as a CronJob or operator inside the cluster
 func getKubernetesConfig() (*rest.Config, error) {
-	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
-	configOverrides := &clientcmd.ConfigOverrides{}
-	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides).ClientConfig()
+	proxy, err := kubeProxy()
 	if err != nil {
 		return nil, err
 	}
+	if InCluster() {
+		config, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("no kubeconfig found and unable to use the in-cluster service account: %v", err)
+		}
+		log.Debug().Msg("No kubeconfig found ... using the in-cluster service account")
+		config.Impersonate = rest.ImpersonationConfig{
+			UserName: kubeOverrides.AuthInfo.Impersonate,
+			UID:      kubeOverrides.AuthInfo.ImpersonateUID,
+			Groups:   kubeOverrides.AuthInfo.ImpersonateGroups,
+		}
+		if proxy != nil {
+			config.Proxy = proxy
+		}
+		return config, nil
+	}
+	config, err := kubeconfigLoader().ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	if proxy != nil {
+		config.Proxy = proxy
+	}
+	if err := wrapExecProvider(config); err != nil {
+		return nil, err
+	}
 	return config, nil
 }
 
 func CreateKubernetesClient() *ClientWrapper {
+	client, err := NewKubernetesClient()
+	if err != nil {
+		log.Fatal().Msg(err.Error())
+	}
+	return client
+}
+
+// NewKubernetesClient is like CreateKubernetesClient but returns the error instead of exiting (IE: for shell completion)
+func NewKubernetesClient() (*ClientWrapper, error) {
 	config, err := getKubernetesConfig()
 	if err != nil {
-		log.Fatal().Msgf("Unable to load kubernetes config: %v", err)
+		return nil, fmt.Errorf("unable to load kubernetes config: %v", err)
 	}
+	config.QPS = ClientQPS
+	config.Burst = ClientBurst
 
-	client1, client1Err := kubernetes.NewForConfig(config)
+	client1, client1Err := kubernetes.NewForConfig(withProtobuf(config))
 	if client1Err != nil {
-		log.Fatal().Msgf("Unable to create a kubernetes client: %v", client1Err)
+		return nil, fmt.Errorf("unable to create a kubernetes client: %v", client1Err)
 	}
 
 	client2, client2Err2 := dynamic.NewForConfig(config)
 	if client2Err2 != nil {
-		log.Fatal().Msgf("Unable to create a dynamic kubernetes client: %v", client2Err2)
+		return nil, fmt.Errorf("unable to create a dynamic kubernetes client: %v", client2Err2)
+	}
+
+	metadataClient, metadataErr := metadata.NewForConfig(config)
+	if metadataErr != nil {
+		return nil, fmt.Errorf("unable to create a metadata kubernetes client: %v", metadataErr)
 	}
 
 	dc, dcErr := discovery.NewDiscoveryClientForConfig(config)
 	if dcErr != nil {
-		log.Fatal().Msgf("Unable to create a discovery kubernetes client: %v", dcErr)
+		return nil, fmt.Errorf("unable to create a discovery kubernetes client: %v", dcErr)
 	}
 	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(dc))
 
 	// Supress k8s client-go
 	klog.SetLogger(logr.Discard())
-	return &ClientWrapper{client: client1, dynamic: client2, mapper: *mapper}
+	return &ClientWrapper{client: client1, dynamic: client2, metadata: metadataClient, mapper: *mapper, protobuf: newProtobufClients(config)}, nil
+}
+
+// ListPageSize is the max amount of resources returned by a single list call - 0 disables paging
+var ListPageSize int64 = 500
+
+// ClientQPS and ClientBurst tune the client side rate limiter of the Kubernetes clients - 0 keeps the client-go defaults
+var (
+	ClientQPS   float32
+	ClientBurst int
+)
+
+// RequestTimeout is the deadline for each Kubernetes API call - 0 disables the deadline
+var RequestTimeout time.Duration
+
+// Context is cancelled when the run is aborted (IE: it exceeded --timeout) so the Kubernetes API calls and the
+// controller stop
+var Context = context.Background()
+
+func requestContext() (context.Context, context.CancelFunc) {
+	if RequestTimeout <= 0 {
+		return context.WithCancel(Context)
+	}
+	return context.WithTimeout(Context, RequestTimeout)
 }
 
 var (
 	namespacesWereCached bool
 	namespacesCache      []string
+	ignoredResources     []*regexp.Regexp
 )
 
-func (c *ClientWrapper) GetInformerFactory(resync time.Duration) dynamicinformer.DynamicSharedInformerFactory {
-	return dynamicinformer.NewDynamicSharedInformerFactory(c.dynamic, resync)
+// SetIgnoredResources compiles the regular expressions used to skip resources during listing
+func SetIgnoredResources(patterns []string) error {
+	var compiled []*regexp.Regexp
+	for i, pattern := range patterns {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("ignoreResources[%d]: %s", i+1, err)
+		}
+		compiled = append(compiled, regex)
+	}
+	ignoredResources = compiled
+	return nil
+}
+
+// IsIgnored reports if '<namespace>/<name>' (or '<name>' when namespace is empty) matches any of the ignored resources
+func IsIgnored(namespace string, name string) bool {
+	id := name
+	if namespace != "" {
+		id = fmt.Sprintf("%s/%s", namespace, name)
+	}
+	for _, regex := range ignoredResources {
+		if regex.MatchString(id) {
+			log.Debug().Msgf("Ignoring resource '%s' matched by '%s'", id, regex.String())
+			return true
+		}
+	}
+	return false
+}
+
+func (c *ClientWrapper) GetInformerFactory(resync time.Duration, options metav1.ListOptions) dynamicinformer.DynamicSharedInformerFactory {
+	return dynamicinformer.NewFilteredDynamicSharedInformerFactory(c.dynamic, resync, metav1.NamespaceAll, func(o *metav1.ListOptions) {
+		o.LabelSelector = options.LabelSelector
+		o.FieldSelector = options.FieldSelector
+	})
 }
 
 func (c *ClientWrapper) GetNamespaces(selector KubernetesSelector) ([]string, error) {
-	if len(selector.Namespaces) > 0 {
-		return selector.Namespaces, nil
-	} else {
-		if namespacesWereCached {
+	// the opt-in label is only known for the listed namespaces
+	if len(selector.Namespaces) == 0 || namespaceOptIn() != "" {
+		if !namespacesWereCached {
+			allNamespaces, err := c.listAllowedNamespaces()
+			if err != nil {
+				return nil, err
+			}
+			namespacesWereCached = true
+			namespacesCache = allNamespaces
+		}
+		if len(selector.Namespaces) == 0 {
 			return namespacesCache, nil
 		}
-		allNamespaces, err := c.GetAllNamespaces()
-		if err != nil {
-			return nil, err
+	}
+	var output []string
+	for _, namespace := range selector.Namespaces {
+		if IsNamespaceAllowed(namespace) {
+			output = append(output, namespace)
 		}
-		namespacesWereCached = true
-		namespacesCache = allNamespaces
-		return namespacesCache, nil
 	}
+	return output, nil
 }
 
 func (c *ClientWrapper) GetAllNamespaces() ([]string, error) {
 	var output []string
-	resources, queryErr := c.client.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+	ctx, cancel := requestContext()
+	defer cancel()
+	resources, queryErr := c.client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
 	if queryErr != nil {
 		return output, queryErr
 	}
@@ -121,30 +241,96 @@ func (c *ClientWrapper) GetAllNamespaces() ([]string, error) {
 	return output, nil
 }
 
+// GetKinds returns the sorted kinds of every listable resource the API server knows about
+func (c *ClientWrapper) GetKinds() ([]string, error) {
+	// Partial results are returned when some aggregated APIs are unavailable
+	resources, err := c.client.Discovery().ServerPreferredResources()
+	if len(resources) == 0 && err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var output []string
+	for _, list := range resources {
+		for _, resource := range list.APIResources {
+			if seen[resource.Kind] || !sets.NewString(resource.Verbs...).Has("list") {
+				continue
+			}
+			seen[resource.Kind] = true
+			output = append(output, resource.Kind)
+		}
+	}
+	sort.Strings(output)
+	return output, nil
+}
+
+func (c *ClientWrapper) GetSecretValue(namespace string, name string, key string) (string, error) {
+	ctx, cancel := requestContext()
+	defer cancel()
+	secret, err := c.client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	value, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("key '%s' not found in secret '%s/%s'", key, namespace, name)
+	}
+	return string(value), nil
+}
+
+// ProxyGetService calls an in-cluster service given as '<namespace>/<name>:<port>' through the API server proxy
+func (c *ClientWrapper) ProxyGetService(service string, path string, params map[string]string) ([]byte, error) {
+	namespace, target, found := strings.Cut(service, "/")
+	if !found {
+		return nil, fmt.Errorf("invalid service '%s' - expected '<namespace>/<name>:<port>'", service)
+	}
+	name, port, _ := strings.Cut(target, ":")
+	ctx, cancel := requestContext()
+	defer cancel()
+	return c.client.CoreV1().Services(namespace).ProxyGet("http", name, port, path, params).DoRaw(ctx)
+}
+
+// GetRaw calls an API server path that has no typed client IE: '/apis/metrics.k8s.io/v1beta1/pods'
+func (c *ClientWrapper) GetRaw(path string) ([]byte, error) {
+	ctx, cancel := requestContext()
+	defer cancel()
+	return c.client.Discovery().RESTClient().Get().AbsPath(path).DoRaw(ctx)
+}
+
 func (c *ClientWrapper) Query(selector KubernetesSelector) ([][]byte, error) {
-	var output [][]byte
-	aggregator := func(resource []byte) {
-		output = append(output, resource)
+	if selector.Discover && selector.Kind == "" {
+		return c.queryDiscovered(selector)
 	}
 	namespaces, namespacesErr := c.GetNamespaces(selector)
 	if namespacesErr != nil {
-		return output, namespacesErr
+		return nil, namespacesErr
+	}
+	return c.queryNamespaces(selector, namespaces)
+}
+
+// queryNamespaces lists the selector's kind in each of the namespaces - an empty namespace lists across all of them
+func (c *ClientWrapper) queryNamespaces(selector KubernetesSelector, namespaces []string) ([][]byte, error) {
+	var output [][]byte
+	aggregator := func(resource []byte) {
+		output = append(output, resource)
 	}
 	mapping, mappingErr := c.GetMapping(selector)
 	if mappingErr != nil {
 		return output, fmt.Errorf("%s \n\t Please ensure you are using a valid `ApiVersion` and `Kind` found in `kubectl api-resources --verbs=\"get,list\"`", mappingErr)
 	}
 	options := selector.GetListOptions()
-	dr := c.dynamic.Resource(mapping.Resource)
-	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
-		for _, namespace := range namespaces {
-			listErr := List(dr.Namespace(namespace), options, aggregator)
-			if listErr != nil {
-				return output, listErr
-			}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		namespaces = []string{""}
+	}
+	kind := fmt.Sprintf("%s/%s", mapping.GroupVersionKind.GroupVersion(), mapping.GroupVersionKind.Kind)
+	for _, namespace := range namespaces {
+		var listErr error
+		if protobuf := c.protobuf.forMapping(mapping); protobuf != nil {
+			listErr = listPages(kind, options, protobuf.lister(mapping, namespace), aggregator)
+		} else if namespace != "" {
+			listErr = listPages(kind, options, dynamicLister(c.dynamic.Resource(mapping.Resource).Namespace(namespace)), aggregator)
+		} else {
+			listErr = listPages(kind, options, dynamicLister(c.dynamic.Resource(mapping.Resource)), aggregator)
 		}
-	} else {
-		listErr := List(dr, options, aggregator)
 		if listErr != nil {
 			return output, listErr
 		}
@@ -152,19 +338,62 @@ func (c *ClientWrapper) Query(selector KubernetesSelector) ([][]byte, error) {
 	return output, nil
 }
 
+// List pages through the resources using limit/continue so very large clusters never return a single enormous response
 func List(client dynamic.ResourceInterface, options metav1.ListOptions, aggregator func(resource []byte)) error {
-	resources, queryErr := client.List(context.TODO(), options)
-	if queryErr != nil {
-		return fmt.Errorf("%s `%s`", queryErr, "")
+	return listPages("", options, dynamicLister(client), aggregator)
+}
+
+type pageLister func(ctx context.Context, options metav1.ListOptions) (*unstructured.UnstructuredList, error)
+
+func dynamicLister(client dynamic.ResourceInterface) pageLister {
+	return func(ctx context.Context, options metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+		return client.List(ctx, options)
 	}
-	for _, resource := range resources.Items {
-		bytes, bytesErr := resource.MarshalJSON()
-		if bytesErr != nil {
-			return bytesErr
+}
+
+func listPages(kind string, options metav1.ListOptions, lister pageLister, aggregator func(resource []byte)) error {
+	options.Limit = ListPageSize
+	first := true
+	for {
+		// only the first page is pinned - the continue token of the later pages carries the resourceVersion
+		pageOptions, pinned := options, false
+		if first {
+			pageOptions, pinned = pinSnapshot(options)
 		}
-		aggregator(bytes)
+		ctx, cancel := requestContext()
+		resources, queryErr := lister(ctx, pageOptions)
+		cancel()
+		if queryErr != nil && pinned && unpinSnapshot(kind, queryErr) {
+			ctx, cancel = requestContext()
+			resources, queryErr = lister(ctx, options)
+			cancel()
+		}
+		if queryErr != nil {
+			if errors.IsResourceExpired(queryErr) {
+				return fmt.Errorf("%s \n\t The list expired while paging through results - please retry or increase --k8s-page-size", queryErr)
+			}
+			return fmt.Errorf("%s `%s`", queryErr, "")
+		}
+		if first {
+			recordSnapshot(resources.GetResourceVersion())
+			first = false
+		}
+		for _, resource := range resources.Items {
+			if IsIgnored(resource.GetNamespace(), resource.GetName()) {
+				continue
+			}
+			bytes, bytesErr := resource.MarshalJSON()
+			if bytesErr != nil {
+				return bytesErr
+			}
+			aggregator(bytes)
+		}
+		options.Continue = resources.GetContinue()
+		if options.Continue == "" {
+			return nil
+		}
+		log.Debug().Msgf("Fetching next page of %d resources", options.Limit)
 	}
-	return nil
 }
 
 func (c *ClientWrapper) GetMapping(selector KubernetesSelector) (*meta.RESTMapping, error) {
@@ -221,7 +450,7 @@ To read more about this change please see - https://github.com/OpsLevel/kubectl-
 )
 
 func (selector *KubernetesSelector) Validate() error {
-	if selector.ApiVersion == "" {
+	if selector.ApiVersion == "" && !selector.Discover {
 		return fmt.Errorf(MISSING_API_VERSION_ERROR)
 	}
 	if len(selector.namespace.Include) > 0 && len(selector.namespace.Exclude) > 0 {
@@ -247,19 +476,63 @@ func (selector *KubernetesSelector) Validate() error {
 		}
 		return fmt.Errorf(UPGRADE_LABEL_FILTER_ERROR, selector.ApiVersion, selector.Kind, strings.Join(upgrades, ","))
 	}
+	if _, err := labels.Parse(selector.GetLabelSelector()); err != nil {
+		return fmt.Errorf("invalid label selector '%s' for '%s/%s': %s", selector.GetLabelSelector(), selector.ApiVersion, selector.Kind, err)
+	}
+	if _, err := fields.ParseSelector(selector.FieldSelector); err != nil {
+		return fmt.Errorf("invalid field selector '%s' for '%s/%s': %s \n\t Field selectors only support the '=', '==' and '!=' operators", selector.FieldSelector, selector.ApiVersion, selector.Kind, err)
+	}
 	return nil
 }
 
+// AddLabelSelector narrows the selector with an additional label selector which is AND'ed with any existing one
+func (selector *KubernetesSelector) AddLabelSelector(value string) {
+	if value == "" {
+		return
+	}
+	if selector.LabelSelector == "" {
+		selector.LabelSelector = value
+		return
+	}
+	selector.LabelSelector = fmt.Sprintf("%s,%s", selector.LabelSelector, value)
+}
+
+// RestrictNamespaces narrows the selector to the given namespaces and returns false if none of them overlap the selector's own namespaces
+func (selector *KubernetesSelector) RestrictNamespaces(namespaces []string) bool {
+	if len(namespaces) == 0 {
+		return true
+	}
+	if len(selector.Namespaces) == 0 {
+		selector.Namespaces = namespaces
+		return true
+	}
+	var output []string
+	for _, namespace := range selector.Namespaces {
+		for _, allowed := range namespaces {
+			if namespace == allowed {
+				output = append(output, namespace)
+				break
+			}
+		}
+	}
+	selector.Namespaces = output
+	return len(output) > 0
+}
+
 func (selector *KubernetesSelector) GetListOptions() metav1.ListOptions {
 	return metav1.ListOptions{
-		LabelSelector: selector.LabelSelector(),
+		LabelSelector: selector.GetLabelSelector(),
+		FieldSelector: selector.FieldSelector,
 	}
 }
 
-func (selector *KubernetesSelector) LabelSelector() string {
-	var labels []string
+func (selector *KubernetesSelector) GetLabelSelector() string {
+	var output []string
 	for key, value := range selector.labels {
-		labels = append(labels, fmt.Sprintf("%s=%s", key, value))
+		output = append(output, fmt.Sprintf("%s=%s", key, value))
+	}
+	if selector.LabelSelector != "" {
+		output = append(output, selector.LabelSelector)
 	}
-	return strings.Join(labels, ",")
+	return strings.Join(output, ",")
 }
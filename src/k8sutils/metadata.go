@@ -0,0 +1,68 @@
+package k8sutils
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/metadata"
+)
+
+// QueryMetadata is like Query but only lists the metadata of the resources so kinds with large specs and statuses
+// such as Pods are cheap to list across the whole cluster
+func (c *ClientWrapper) QueryMetadata(selector KubernetesSelector) ([][]byte, error) {
+	namespaces, namespacesErr := c.GetNamespaces(selector)
+	if namespacesErr != nil {
+		return nil, namespacesErr
+	}
+	mapping, mappingErr := c.GetMapping(selector)
+	if mappingErr != nil {
+		return nil, mappingErr
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		namespaces = []string{""}
+	}
+	var output [][]byte
+	aggregator := func(resource []byte) {
+		output = append(output, resource)
+	}
+	kind := fmt.Sprintf("%s/%s", mapping.GroupVersionKind.GroupVersion(), mapping.GroupVersionKind.Kind)
+	for _, namespace := range namespaces {
+		var client metadata.ResourceInterface = c.metadata.Resource(mapping.Resource)
+		if namespace != "" {
+			client = c.metadata.Resource(mapping.Resource).Namespace(namespace)
+		}
+		if err := listPages(kind, selector.GetListOptions(), metadataLister(client), aggregator); err != nil {
+			return output, err
+		}
+	}
+	return output, nil
+}
+
+func metadataLister(client metadata.ResourceInterface) pageLister {
+	return func(ctx context.Context, options metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+		list, err := client.List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		return toUnstructuredList(list)
+	}
+}
+
+// toUnstructuredList converts a list of metadata so it is paged through like the lists of the dynamic client
+func toUnstructuredList(list *metav1.PartialObjectMetadataList) (*unstructured.UnstructuredList, error) {
+	output := &unstructured.UnstructuredList{Object: map[string]interface{}{}}
+	output.SetResourceVersion(list.GetResourceVersion())
+	output.SetContinue(list.GetContinue())
+	for i := range list.Items {
+		item, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		output.Items = append(output.Items, unstructured.Unstructured{Object: item})
+	}
+	return output, nil
+}
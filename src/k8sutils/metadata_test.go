@@ -0,0 +1,33 @@
+package k8sutils
+
+import (
+	"testing"
+
+	"github.com/rocktavious/autopilot"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_ToUnstructuredList_KeepsTheMetadataAndPaging(t *testing.T) {
+	// Arrange
+	list := &metav1.PartialObjectMetadataList{
+		ListMeta: metav1.ListMeta{ResourceVersion: "42", Continue: "next"},
+		Items: []metav1.PartialObjectMetadata{{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "web-5d9c7f-x2x",
+				Namespace:       "shop",
+				OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web-5d9c7f"}},
+			},
+		}},
+	}
+	// Act
+	output, err := toUnstructuredList(list)
+	// Assert
+	autopilot.Ok(t, err)
+	autopilot.Equals(t, "42", output.GetResourceVersion())
+	autopilot.Equals(t, "next", output.GetContinue())
+	autopilot.Equals(t, 1, len(output.Items))
+	autopilot.Equals(t, "shop", output.Items[0].GetNamespace())
+	autopilot.Equals(t, "web-5d9c7f", output.Items[0].GetOwnerReferences()[0].Name)
+}
@@ -0,0 +1,132 @@
+package k8sutils
+
+import (
+	"fmt"
+	"path"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// namespaceFilter restricts which namespaces are scanned so multi-tenant clusters can roll out the importer team by team
+type namespaceFilter struct {
+	include []string
+	exclude []string
+	optIn   string
+}
+
+var (
+	namespaceFilterMutex sync.RWMutex
+	namespaceRules       namespaceFilter
+	// optedInNamespaces are the namespaces carrying the opt-in label as of the last listing - nil until listed
+	optedInNamespaces map[string]bool
+)
+
+// SetNamespaceFilter sets the include and exclude globs (IE: 'team-*') and the label selector a namespace must
+// carry to be scanned (IE: 'opslevel.com/import=true') - empty values do not restrict anything
+func SetNamespaceFilter(include []string, exclude []string, optIn string) error {
+	for i, pattern := range include {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("namespaces.include[%d]: %s", i+1, err)
+		}
+	}
+	for i, pattern := range exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("namespaces.exclude[%d]: %s", i+1, err)
+		}
+	}
+	if _, err := labels.Parse(optIn); err != nil {
+		return fmt.Errorf("namespaces.optIn: %s", err)
+	}
+	namespaceFilterMutex.Lock()
+	defer namespaceFilterMutex.Unlock()
+	namespaceRules = namespaceFilter{include: include, exclude: exclude, optIn: optIn}
+	optedInNamespaces = nil
+	namespacesWereCached = false
+	namespacesCache = nil
+	return nil
+}
+
+func namespaceOptIn() string {
+	namespaceFilterMutex.RLock()
+	defer namespaceFilterMutex.RUnlock()
+	return namespaceRules.optIn
+}
+
+func matchesAnyGlob(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// IsNamespaceAllowed reports whether resources in the namespace may be imported - cluster scoped resources always are.
+// The opt-in label is only enforced once the namespaces of a live cluster were listed.
+func IsNamespaceAllowed(namespace string) bool {
+	if namespace == "" {
+		return true
+	}
+	namespaceFilterMutex.RLock()
+	defer namespaceFilterMutex.RUnlock()
+	if len(namespaceRules.include) > 0 && !matchesAnyGlob(namespaceRules.include, namespace) {
+		return false
+	}
+	if matchesAnyGlob(namespaceRules.exclude, namespace) {
+		return false
+	}
+	if namespaceRules.optIn != "" && optedInNamespaces != nil {
+		return optedInNamespaces[namespace]
+	}
+	return true
+}
+
+// ObserveNamespace records whether a watched namespace carries the opt-in label and reports whether its resources
+// may be imported now - it keeps the namespaces current between the listings in watch mode
+func ObserveNamespace(name string, namespaceLabels map[string]string) bool {
+	namespaceFilterMutex.Lock()
+	if namespaceRules.optIn != "" && optedInNamespaces != nil {
+		if selector, err := labels.Parse(namespaceRules.optIn); err == nil {
+			optedInNamespaces[name] = selector.Matches(labels.Set(namespaceLabels))
+		}
+	}
+	namespaceFilterMutex.Unlock()
+	return IsNamespaceAllowed(name)
+}
+
+// listAllowedNamespaces lists the namespaces carrying the opt-in label and keeps the ones the globs allow
+func (c *ClientWrapper) listAllowedNamespaces() ([]string, error) {
+	optIn := namespaceOptIn()
+	ctx, cancel := requestContext()
+	defer cancel()
+	resources, err := c.client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: optIn})
+	if err != nil {
+		return nil, err
+	}
+	if optIn != "" {
+		optedIn := map[string]bool{}
+		for _, resource := range resources.Items {
+			optedIn[resource.Name] = true
+		}
+		namespaceFilterMutex.Lock()
+		optedInNamespaces = optedIn
+		namespaceFilterMutex.Unlock()
+	}
+	var output []string
+	for _, resource := range resources.Items {
+		if IsNamespaceAllowed(resource.Name) {
+			output = append(output, resource.Name)
+		}
+	}
+	return output, nil
+}
+
+// RefreshNamespaces forgets the listed namespaces and lists them again so newly opted in namespaces are picked up
+func (c *ClientWrapper) RefreshNamespaces() error {
+	namespacesWereCached = false
+	namespacesCache = nil
+	_, err := c.GetNamespaces(KubernetesSelector{})
+	return err
+}
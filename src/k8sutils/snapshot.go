@@ -0,0 +1,93 @@
+package k8sutils
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConsistentSnapshot lists every kind at the resourceVersion of the first list of a run so joins across kinds see the
+// cluster at one point in time instead of objects observed minutes apart on a busy cluster. Exact resourceVersion
+// lists bypass the watch cache of the API server and are served from etcd.
+var ConsistentSnapshot = true
+
+var (
+	snapshotMutex    sync.Mutex
+	snapshotVersion  string
+	snapshotUnpinned = map[string]bool{}
+)
+
+// SnapshotResourceVersion is the resourceVersion the lists of this run are pinned to - empty until the first list
+func SnapshotResourceVersion() string {
+	snapshotMutex.Lock()
+	defer snapshotMutex.Unlock()
+	return snapshotVersion
+}
+
+// ResetSnapshot lets the next list pin a new resourceVersion IE: at the start of every pass of 'service reconcile'
+func ResetSnapshot() {
+	snapshotMutex.Lock()
+	defer snapshotMutex.Unlock()
+	snapshotVersion = ""
+	snapshotUnpinned = map[string]bool{}
+}
+
+// UnpinnedKinds are the kinds of this run which were listed at their latest state instead of the snapshot
+func UnpinnedKinds() []string {
+	snapshotMutex.Lock()
+	defer snapshotMutex.Unlock()
+	output := make([]string, 0, len(snapshotUnpinned))
+	for kind := range snapshotUnpinned {
+		output = append(output, kind)
+	}
+	sort.Strings(output)
+	return output
+}
+
+// pinSnapshot returns the options of the first page pinned to the snapshot with an exact resourceVersion match
+func pinSnapshot(options metav1.ListOptions) (metav1.ListOptions, bool) {
+	if !ConsistentSnapshot || options.ResourceVersion != "" {
+		return options, false
+	}
+	version := SnapshotResourceVersion()
+	if version == "" {
+		return options, false
+	}
+	options.ResourceVersion = version
+	options.ResourceVersionMatch = metav1.ResourceVersionMatchExact
+	return options, true
+}
+
+// recordSnapshot keeps the resourceVersion of the first list of the run as the snapshot
+func recordSnapshot(version string) {
+	if !ConsistentSnapshot || version == "" {
+		return
+	}
+	snapshotMutex.Lock()
+	defer snapshotMutex.Unlock()
+	if snapshotVersion == "" {
+		snapshotVersion = version
+		log.Debug().Msgf("Listing the Kubernetes resources at resourceVersion %s", version)
+	}
+}
+
+// unpinSnapshot reports whether a pinned list of the kind should be retried at the latest resourceVersion and records
+// the kind as unpinned - the snapshot is compacted away after a few minutes and kinds served by an aggregated API
+// server have their own resourceVersions
+func unpinSnapshot(kind string, err error) bool {
+	if errors.IsResourceExpired(err) || errors.IsGone(err) {
+		log.Info().Msgf("The snapshot at resourceVersion %s was compacted - listing the latest state of '%s' instead", SnapshotResourceVersion(), kind)
+	} else if errors.IsBadRequest(err) || errors.IsInvalid(err) || errors.IsNotFound(err) {
+		log.Debug().Msgf("Unable to list '%s' at resourceVersion %s - listing the latest state instead: %v", kind, SnapshotResourceVersion(), err)
+	} else {
+		return false
+	}
+	snapshotMutex.Lock()
+	defer snapshotMutex.Unlock()
+	snapshotUnpinned[kind] = true
+	return true
+}
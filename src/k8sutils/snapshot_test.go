@@ -0,0 +1,45 @@
+package k8sutils
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rocktavious/autopilot"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_PinSnapshot_IsOptOut(t *testing.T) {
+	// Arrange
+	defer ResetSnapshot()
+	recordSnapshot("100")
+	recordSnapshot("200")
+	// Act
+	options, pinned := pinSnapshot(metav1.ListOptions{})
+	ConsistentSnapshot = false
+	defer func() { ConsistentSnapshot = true }()
+	_, disabledPinned := pinSnapshot(metav1.ListOptions{})
+	// Assert
+	autopilot.Equals(t, false, disabledPinned)
+	autopilot.Equals(t, true, pinned)
+	autopilot.Equals(t, "100", options.ResourceVersion)
+	autopilot.Equals(t, metav1.ResourceVersionMatchExact, options.ResourceVersionMatch)
+}
+
+func Test_UnpinSnapshot_RecordsTheUnpinnedKinds(t *testing.T) {
+	// Arrange
+	defer ResetSnapshot()
+	// Act
+	expired := unpinSnapshot("apps/v1/Deployment", errors.NewResourceExpired("too old resource version"))
+	invalid := unpinSnapshot("metrics.k8s.io/v1beta1/PodMetrics", errors.NewBadRequest("resourceVersionMatch is not supported"))
+	other := unpinSnapshot("v1/Service", fmt.Errorf("connection refused"))
+	unpinned := UnpinnedKinds()
+	ResetSnapshot()
+	// Assert
+	autopilot.Equals(t, true, expired)
+	autopilot.Equals(t, true, invalid)
+	autopilot.Equals(t, false, other)
+	autopilot.Equals(t, []string{"apps/v1/Deployment", "metrics.k8s.io/v1beta1/PodMetrics"}, unpinned)
+	autopilot.Equals(t, 0, len(UnpinnedKinds()))
+}